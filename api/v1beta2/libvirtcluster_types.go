@@ -1,7 +1,88 @@
 package v1beta2
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+)
+
+// LibvirtCluster's Ready condition and corresponding reasons.
+const (
+	// LibvirtClusterReadyCondition is true if the libvirt hosts of the LibvirtCluster are reachable and have its
+	// networks and storage pools. It summarizes the other conditions of the LibvirtCluster.
+	LibvirtClusterReadyCondition = clusterv1.ReadyCondition
+
+	// LibvirtClusterReadyReason surfaces when the LibvirtCluster is ready.
+	LibvirtClusterReadyReason = clusterv1.ReadyReason
+
+	// LibvirtClusterNotReadyReason surfaces when the LibvirtCluster is not ready.
+	LibvirtClusterNotReadyReason = clusterv1.NotReadyReason
+
+	// LibvirtClusterReadyUnknownReason surfaces when the readiness of the LibvirtCluster is unknown.
+	LibvirtClusterReadyUnknownReason = clusterv1.ReadyUnknownReason
+)
+
+// LibvirtCluster's LibvirtReachable condition and corresponding reasons.
+const (
+	// LibvirtClusterLibvirtReachableCondition documents whether the controller could connect and authenticate to all
+	// libvirt hosts of the LibvirtCluster.
+	LibvirtClusterLibvirtReachableCondition = "LibvirtReachable"
+
+	// LibvirtClusterLibvirtReachableReason surfaces when all libvirt hosts are reachable.
+	LibvirtClusterLibvirtReachableReason = "Reachable"
+
+	// LibvirtClusterLibvirtCredentialsUnavailableReason surfaces when the Secret with the credentials of a libvirt host
+	// could not be read.
+	LibvirtClusterLibvirtCredentialsUnavailableReason = "CredentialsUnavailable"
+
+	// LibvirtClusterLibvirtAuthenticationFailedReason surfaces when a libvirt host rejected the credentials, or no
+	// supported authentication method could be negotiated.
+	LibvirtClusterLibvirtAuthenticationFailedReason = "AuthenticationFailed"
+
+	// LibvirtClusterLibvirtUnreachableReason surfaces when the connection to a libvirt host failed for any other
+	// reason.
+	LibvirtClusterLibvirtUnreachableReason = "Unreachable"
+)
+
+// LibvirtCluster's NetworkReady condition and corresponding reasons.
+const (
+	// LibvirtClusterNetworkReadyCondition documents whether the networks of the LibvirtCluster exist and are active on
+	// all of its libvirt hosts.
+	LibvirtClusterNetworkReadyCondition = "NetworkReady"
+
+	// LibvirtClusterNetworkReadyReason surfaces when the networks exist and are active on all libvirt hosts.
+	LibvirtClusterNetworkReadyReason = "Ready"
+
+	// LibvirtClusterNetworkNotFoundReason surfaces when a network does not exist on a libvirt host.
+	LibvirtClusterNetworkNotFoundReason = "NotFound"
+
+	// LibvirtClusterNetworkNotActiveReason surfaces when a network exists but is not active on a libvirt host.
+	LibvirtClusterNetworkNotActiveReason = "NotActive"
+
+	// LibvirtClusterNetworkLibvirtUnreachableReason surfaces when the networks could not be checked because a libvirt
+	// host is not reachable (see the LibvirtReachable condition) or the lookup failed.
+	LibvirtClusterNetworkLibvirtUnreachableReason = "LibvirtUnreachable"
+)
+
+// LibvirtCluster's StoragePoolReady condition and corresponding reasons.
+const (
+	// LibvirtClusterStoragePoolReadyCondition documents whether the storage pools of the LibvirtCluster exist and are
+	// active on all of its libvirt hosts.
+	LibvirtClusterStoragePoolReadyCondition = "StoragePoolReady"
+
+	// LibvirtClusterStoragePoolReadyReason surfaces when the storage pools exist and are active on all libvirt hosts.
+	LibvirtClusterStoragePoolReadyReason = "Ready"
+
+	// LibvirtClusterStoragePoolNotFoundReason surfaces when a storage pool does not exist on a libvirt host.
+	LibvirtClusterStoragePoolNotFoundReason = "NotFound"
+
+	// LibvirtClusterStoragePoolNotActiveReason surfaces when a storage pool exists but is not active on a libvirt host.
+	LibvirtClusterStoragePoolNotActiveReason = "NotActive"
+
+	// LibvirtClusterStoragePoolLibvirtUnreachableReason surfaces when the storage pools could not be checked because a
+	// libvirt host is not reachable (see the LibvirtReachable condition) or the lookup failed.
+	LibvirtClusterStoragePoolLibvirtUnreachableReason = "LibvirtUnreachable"
 )
 
 // LibvirtClusterSpec defines the desired state of LibvirtCluster.
@@ -9,6 +90,78 @@ type LibvirtClusterSpec struct {
 	// foo is unused but something is required to exist when creating LibvirtClusterTemplates in v1beta1.
 	// +optional
 	Foo bool `json:"foo,omitempty"`
+
+	// uri is the libvirt connection URI of the host on which the LibvirtMachines of the cluster are created
+	// (e.g. "qemu+tls://libvirt-host.example.com/system"). Uses the LIBVIRT_URI of the controller manager if not specified.
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=512
+	URI string `json:"uri,omitempty"`
+
+	// credentialsSecretRef references a Secret in the namespace of the LibvirtCluster with the credentials used to
+	// connect to uri. The LIBVIRT_CREDENTIALS_SECRET of the controller manager is only used together with its LIBVIRT_URI,
+	// i.e. if uri is not specified.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+
+	// hosts is a pool of libvirt hosts across which the LibvirtMachines of the cluster are placed. If specified, uri and
+	// credentialsSecretRef are ignored.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	// +kubebuilder:validation:MaxItems=64
+	Hosts []LibvirtHost `json:"hosts,omitempty"`
+
+	// networks are the names of the libvirt networks which must exist and be active on each libvirt host before the
+	// LibvirtCluster is provisioned. Defaults to the 'default' network, which LibvirtMachines use unless they specify
+	// another network.
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=16
+	// +kubebuilder:validation:items:MinLength=1
+	Networks []string `json:"networks,omitempty"`
+
+	// storagePools are the names of the libvirt storage pools which must exist and be active on each libvirt host
+	// before the LibvirtCluster is provisioned. Defaults to the 'default' storage pool, which LibvirtMachines use unless
+	// they specify another storage pool.
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=16
+	// +kubebuilder:validation:items:MinLength=1
+	StoragePools []string `json:"storagePools,omitempty"`
+}
+
+// LibvirtHost is a libvirt host on which LibvirtMachines can be placed.
+type LibvirtHost struct {
+	// name identifies the host within the LibvirtCluster. It is recorded in the status of the LibvirtMachines placed
+	// on the host, so it should not be changed while the host has any LibvirtMachines.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+
+	// uri is the libvirt connection URI of the host (e.g. "qemu+tls://libvirt-host.example.com/system").
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=512
+	URI string `json:"uri"`
+
+	// credentialsSecretRef references a Secret in the namespace of the LibvirtCluster with the credentials used to
+	// connect to uri.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+
+	// weight scales the share of LibvirtMachines placed on the host relative to the other hosts, e.g. a host with
+	// weight 2 is preferred over a host with weight 1 and the same free capacity. A weight of 0 excludes the host from
+	// the placement of new LibvirtMachines (e.g. while draining it). Defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight *int32 `json:"weight,omitempty"`
+
+	// labels of the host, which are matched against the hostSelector of LibvirtMachines.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // LibvirtClusterStatus defines the observed state of LibvirtCluster.
@@ -16,10 +169,11 @@ type LibvirtClusterStatus struct {
 	// conditions represent the current state of the LibvirtCluster resource.
 	// Each condition has a unique type and reflects the status of a specific aspect of the resource.
 	//
-	// Standard condition types include:
-	// - "Available": the resource is fully functional
-	// - "Progressing": the resource is being created or updated
-	// - "Degraded": the resource failed to reach or maintain its desired state
+	// Condition types include:
+	// - "Ready": summarizes the other conditions of the LibvirtCluster
+	// - "LibvirtReachable": the controller can connect to all libvirt hosts of the LibvirtCluster
+	// - "NetworkReady": the networks exist and are active on all libvirt hosts
+	// - "StoragePoolReady": the storage pools exist and are active on all libvirt hosts
 	//
 	// The status of each condition is one of True, False, or Unknown.
 	// +listType=map
@@ -66,11 +220,21 @@ type LibvirtCluster struct {
 	// +optional
 	Status LibvirtClusterStatus `json:"status,omitzero"`
 
-	// spec is unused but it required to exist when creating LibvirtClusterTemplates.
+	// spec defines the desired state of LibvirtCluster
 	// +optional
 	Spec LibvirtClusterSpec `json:"spec,omitzero"`
 }
 
+// GetConditions returns the set of conditions for this object.
+func (c *LibvirtCluster) GetConditions() []metav1.Condition {
+	return c.Status.Conditions
+}
+
+// SetConditions sets conditions for an API object.
+func (c *LibvirtCluster) SetConditions(conditions []metav1.Condition) {
+	c.Status.Conditions = conditions
+}
+
 // +kubebuilder:object:root=true
 
 // LibvirtClusterList contains a list of LibvirtCluster
@@ -0,0 +1,203 @@
+package v1beta2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ImageFinalizer allows ReconcileLibvirtImage to block the deletion of a LibvirtImage while it is in use, and to
+	// delete the storage volume of a downloaded image before removing the LibvirtImage from the apiserver.
+	ImageFinalizer = "libvirtimage.infrastructure.cluster.x-k8s.io"
+)
+
+// LibvirtImage's Ready condition and corresponding reasons.
+const (
+	// LibvirtImageReadyCondition documents whether the image is available in its storage pool and can be used as the
+	// backing image of LibvirtMachines.
+	LibvirtImageReadyCondition = "Ready"
+
+	// LibvirtImageReadyReason surfaces when the image is available in its storage pool.
+	LibvirtImageReadyReason = "Ready"
+
+	// LibvirtImageConnectionFailedReason surfaces when the controller could not connect to the libvirt host.
+	LibvirtImageConnectionFailedReason = "ConnectionFailed"
+
+	// LibvirtImageSourceNotFoundReason surfaces when the source volume or path does not exist on the libvirt host.
+	LibvirtImageSourceNotFoundReason = "SourceNotFound"
+
+	// LibvirtImageDownloadFailedReason surfaces when the image could not be downloaded from its source URL, e.g. because
+	// its checksum does not match.
+	LibvirtImageDownloadFailedReason = "DownloadFailed"
+
+	// LibvirtImageDownloadingReason surfaces while the image is being downloaded from its source URL.
+	LibvirtImageDownloadingReason = "Downloading"
+
+	// LibvirtImageFormatMismatchReason surfaces when the detected format of a downloaded image does not match the
+	// format of the LibvirtImage.
+	LibvirtImageFormatMismatchReason = "FormatMismatch"
+
+	// LibvirtImageDeletionBlockedReason surfaces when the LibvirtImage is being deleted but is still used by
+	// LibvirtMachines or linked clones.
+	LibvirtImageDeletionBlockedReason = "DeletionBlocked"
+)
+
+// LibvirtImageSpec defines the desired state of LibvirtImage.
+type LibvirtImageSpec struct {
+	// uri is the libvirt connection URI of the host on which the image is provided (e.g.
+	// "qemu+tls://libvirt-host.example.com/system"). Uses the LIBVIRT_URI of the controller manager if not specified.
+	// Only LibvirtMachines placed on this host can use the image.
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=512
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="uri is immutable"
+	URI string `json:"uri,omitempty"`
+
+	// credentialsSecretRef references a Secret in the namespace of the LibvirtImage with the credentials used to
+	// connect to uri. The LIBVIRT_CREDENTIALS_SECRET of the controller manager is only used together with its LIBVIRT_URI,
+	// i.e. if uri is not specified.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+
+	// source is where the image comes from.
+	// +required
+	Source LibvirtImageSource `json:"source"`
+
+	// storagePool is the name of the storage pool into which an image with a source url is downloaded. Uses the
+	// 'default' storage pool if not specified. Not used for the other sources.
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="storagePool is immutable"
+	StoragePool *string `json:"storagePool,omitempty"`
+
+	// format is the format of the image. It is detected automatically for an image with a source url, and must match
+	// the detected format if specified. Uses the 'qcow2' format for the other sources if not specified.
+	// +optional
+	// +kubebuilder:validation:Enum=qcow2;raw
+	Format *string `json:"format,omitempty"`
+}
+
+// LibvirtImageSource is the source of a LibvirtImage. Exactly one of url, volume and path must be specified.
+// +kubebuilder:validation:XValidation:rule="[has(self.url), has(self.volume), has(self.path)].filter(s, s).size() == 1",message="exactly one of url, volume and path must be specified"
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="source is immutable"
+type LibvirtImageSource struct {
+	// url is the http or https URL from which the image is downloaded into the storage pool. Only qcow2 and raw images
+	// are supported, and images compressed with gzip or bzip2 are decompressed; converting images in other formats is
+	// out of scope. The downloaded image is shared with LibvirtMachines and LibvirtImages using the
+	// same image (by checksum) in the storage pool, and it is deleted together with the last LibvirtImage using it.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +kubebuilder:validation:MaxLength=2048
+	URL string `json:"url,omitempty"`
+
+	// checksum is the SHA-256 checksum of the image at url (as downloaded), optionally prefixed with 'sha256:'. The
+	// downloaded image is verified against the checksum, and it is not downloaded again if it is already cached in the
+	// storage pool.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^(sha256:)?[0-9a-fA-F]{64}$`
+	Checksum *string `json:"checksum,omitempty"`
+
+	// volume is an existing storage volume on the libvirt host. It is not deleted together with the LibvirtImage.
+	// +optional
+	Volume *LibvirtImageVolume `json:"volume,omitempty"`
+
+	// path is the path of an existing image on the libvirt host, which must be a volume of a (possibly inactive)
+	// storage pool. It is not deleted together with the LibvirtImage.
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=4096
+	Path string `json:"path,omitempty"`
+}
+
+// LibvirtImageVolume references a storage volume on the libvirt host.
+type LibvirtImageVolume struct {
+	// pool is the name of the storage pool of the volume.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	Pool string `json:"pool"`
+
+	// name is the name of the volume within the storage pool.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// LibvirtImageStatus defines the observed state of LibvirtImage.
+type LibvirtImageStatus struct {
+	// conditions represent the current state of the LibvirtImage resource.
+	// The Ready condition documents whether the image is available in its storage pool.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ready is true when the image is available and can be used by LibvirtMachines.
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+
+	// path is the path of the storage volume of the image on the libvirt host, which LibvirtMachines use as the
+	// backing image of their primary disk.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// format is the format of the image (qcow2 or raw).
+	// +optional
+	Format string `json:"format,omitempty"`
+
+	// size is the capacity (in bytes) of the storage volume of the image.
+	// +optional
+	Size int64 `json:"size,omitempty"`
+
+	// checksum is the SHA-256 checksum of the image as downloaded. It is only set for images with a source url.
+	// +optional
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=libvirtimages,scope=Namespaced,categories=cluster-api
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="Image is available"
+// +kubebuilder:printcolumn:name="Format",type="string",JSONPath=".status.format",description="Image format"
+// +kubebuilder:printcolumn:name="Size",type="integer",JSONPath=".status.size",description="Image size in bytes"
+// +kubebuilder:printcolumn:name="Path",type="string",JSONPath=".status.path",description="Path of the image on the libvirt host",priority=1
+
+// LibvirtImage is the Schema for the libvirtimages API
+type LibvirtImage struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitzero"`
+
+	// spec defines the desired state of LibvirtImage
+	// +required
+	Spec LibvirtImageSpec `json:"spec"`
+
+	// status defines the observed state of LibvirtImage
+	// +optional
+	Status LibvirtImageStatus `json:"status,omitzero"`
+}
+
+// GetConditions returns the set of conditions for this object.
+func (i *LibvirtImage) GetConditions() []metav1.Condition {
+	return i.Status.Conditions
+}
+
+// SetConditions sets conditions for an API object.
+func (i *LibvirtImage) SetConditions(conditions []metav1.Condition) {
+	i.Status.Conditions = conditions
+}
+
+// +kubebuilder:object:root=true
+
+// LibvirtImageList contains a list of LibvirtImage
+type LibvirtImageList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitzero"`
+	Items           []LibvirtImage `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &LibvirtImage{}, &LibvirtImageList{})
+}
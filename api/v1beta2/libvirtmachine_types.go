@@ -1,6 +1,7 @@
 package v1beta2
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
@@ -12,34 +13,300 @@ const (
 	MachineFinalizer = "libvirtmachine.infrastructure.cluster.x-k8s.io"
 )
 
+// LibvirtMachine's Ready condition and corresponding reasons.
+const (
+	// LibvirtMachineReadyCondition is true if the LibvirtMachine is connected to its libvirt host, its virtual machine
+	// is provisioned and has addresses, and no other condition reports an issue. It summarizes the other conditions of
+	// the LibvirtMachine and is mirrored by the InfrastructureReady condition of its Machine.
+	LibvirtMachineReadyCondition = clusterv1.ReadyCondition
+
+	// LibvirtMachineReadyReason surfaces when the LibvirtMachine is ready.
+	LibvirtMachineReadyReason = clusterv1.ReadyReason
+
+	// LibvirtMachineNotReadyReason surfaces when the LibvirtMachine is not ready.
+	LibvirtMachineNotReadyReason = clusterv1.NotReadyReason
+
+	// LibvirtMachineReadyUnknownReason surfaces when the readiness of the LibvirtMachine is unknown.
+	LibvirtMachineReadyUnknownReason = clusterv1.ReadyUnknownReason
+)
+
+// LibvirtMachine's VirtualMachineProvisioned condition and corresponding reasons.
+const (
+	// LibvirtMachineVirtualMachineProvisionedCondition documents whether the virtual machine of the LibvirtMachine is
+	// created and running.
+	LibvirtMachineVirtualMachineProvisionedCondition = "VirtualMachineProvisioned"
+
+	// LibvirtMachineVirtualMachineProvisionedReason surfaces when the virtual machine is created and running.
+	LibvirtMachineVirtualMachineProvisionedReason = clusterv1.ProvisionedReason
+
+	// LibvirtMachineWaitingForClusterInfrastructureReason surfaces when the virtual machine is not created yet because
+	// the infrastructure of the Cluster is not provisioned.
+	LibvirtMachineWaitingForClusterInfrastructureReason = clusterv1.WaitingForClusterInfrastructureReadyReason
+
+	// LibvirtMachineWaitingForLibvirtImageReason surfaces when the virtual machine is not created yet because the
+	// LibvirtImage it references is not ready.
+	LibvirtMachineWaitingForLibvirtImageReason = "WaitingForLibvirtImage"
+
+	// LibvirtMachineWaitingForBootstrapDataReason surfaces when the virtual machine is not created yet because the
+	// bootstrap data is not available (see the BootstrapDataAvailable condition).
+	LibvirtMachineWaitingForBootstrapDataReason = clusterv1.WaitingForBootstrapDataReason
+
+	// LibvirtMachinePlacementFailedReason surfaces when no libvirt host could be found for the virtual machine, e.g.
+	// because none has enough free capacity or matches its hostSelector.
+	LibvirtMachinePlacementFailedReason = "PlacementFailed"
+
+	// LibvirtMachineProvisioningReason surfaces when the virtual machine has been created but is not running yet.
+	LibvirtMachineProvisioningReason = "Provisioning"
+
+	// LibvirtMachineProvisioningFailedReason surfaces when the virtual machine could not be created.
+	LibvirtMachineProvisioningFailedReason = "ProvisioningFailed"
+
+	// LibvirtMachineBackingImageDownloadFailedReason surfaces when the backing image could not be downloaded from its
+	// URL, e.g. because the URL is not reachable or the image does not match its checksum.
+	LibvirtMachineBackingImageDownloadFailedReason = "BackingImageDownloadFailed"
+
+	// LibvirtMachineDownloadingBackingImageReason surfaces while the backing image is being downloaded from its URL.
+	LibvirtMachineDownloadingBackingImageReason = "DownloadingBackingImage"
+
+	// LibvirtMachineVirtualMachineNotRunningReason surfaces when the virtual machine exists but is not running.
+	LibvirtMachineVirtualMachineNotRunningReason = "NotRunning"
+
+	// LibvirtMachineRecreatingReason surfaces when the virtual machine was destroyed because it drifted from the spec
+	// of the LibvirtMachine (see the DriftDetected condition), and is about to be created again.
+	LibvirtMachineRecreatingReason = "Recreating"
+
+	// LibvirtMachineDeletingReason surfaces when the LibvirtMachine and its virtual machine are being deleted.
+	LibvirtMachineDeletingReason = clusterv1.DeletingReason
+)
+
+// LibvirtMachine's BootstrapDataAvailable condition and corresponding reasons.
+const (
+	// LibvirtMachineBootstrapDataAvailableCondition documents whether the bootstrap data of the Machine is available to
+	// create the virtual machine with.
+	LibvirtMachineBootstrapDataAvailableCondition = "BootstrapDataAvailable"
+
+	// LibvirtMachineBootstrapDataAvailableReason surfaces when the bootstrap data is available.
+	LibvirtMachineBootstrapDataAvailableReason = "Available"
+
+	// LibvirtMachineBootstrapDataNotAvailableReason surfaces when the bootstrap provider has not set the bootstrap data
+	// of the Machine yet, or its Secret is still empty.
+	LibvirtMachineBootstrapDataNotAvailableReason = clusterv1.WaitingForBootstrapDataReason
+
+	// LibvirtMachineBootstrapDataInvalidReason surfaces when the Secret with the bootstrap data could not be read or
+	// has an unsupported format.
+	LibvirtMachineBootstrapDataInvalidReason = "Invalid"
+)
+
+// LibvirtMachine's AddressesAvailable condition and corresponding reasons.
+const (
+	// LibvirtMachineAddressesAvailableCondition documents whether the virtual machine has an address on its primary
+	// network interface.
+	LibvirtMachineAddressesAvailableCondition = "AddressesAvailable"
+
+	// LibvirtMachineAddressesAvailableReason surfaces when the primary network interface has an address.
+	LibvirtMachineAddressesAvailableReason = "Available"
+
+	// LibvirtMachineWaitingForAddressesReason surfaces when no address has been leased to the primary network
+	// interface yet.
+	LibvirtMachineWaitingForAddressesReason = "WaitingForAddresses"
+
+	// LibvirtMachineAddressesLookupFailedReason surfaces when the addresses of the virtual machine could not be looked
+	// up.
+	LibvirtMachineAddressesLookupFailedReason = "LookupFailed"
+)
+
+// LibvirtMachine's DriftDetected condition and corresponding reasons. The condition has negative polarity, i.e. it is
+// true if there is an issue.
+const (
+	// LibvirtMachineDriftDetectedCondition documents whether the virtual machine has drifted from the spec of the
+	// LibvirtMachine in a way which can only be reconciled by recreating it, e.g. changed additional disks or network
+	// interfaces.
+	LibvirtMachineDriftDetectedCondition = "DriftDetected"
+
+	// LibvirtMachineNoDriftReason surfaces when the virtual machine matches the spec of the LibvirtMachine.
+	LibvirtMachineNoDriftReason = "NoDrift"
+
+	// LibvirtMachineDriftedReason surfaces when the virtual machine has drifted from the spec of the LibvirtMachine and
+	// is recreated.
+	LibvirtMachineDriftedReason = "Drifted"
+)
+
+// LibvirtMachine's LibvirtConnected condition and corresponding reasons.
+const (
+	// LibvirtMachineLibvirtConnectedCondition documents whether the controller could connect and authenticate to the
+	// libvirt host of the LibvirtMachine.
+	LibvirtMachineLibvirtConnectedCondition = "LibvirtConnected"
+
+	// LibvirtMachineLibvirtConnectedReason surfaces when the controller is connected to the libvirt host.
+	LibvirtMachineLibvirtConnectedReason = "Connected"
+
+	// LibvirtMachineLibvirtCredentialsUnavailableReason surfaces when the Secret with the libvirt credentials could not
+	// be read.
+	LibvirtMachineLibvirtCredentialsUnavailableReason = "CredentialsUnavailable"
+
+	// LibvirtMachineLibvirtAuthenticationFailedReason surfaces when the libvirt host rejected the credentials, or no
+	// supported authentication method could be negotiated.
+	LibvirtMachineLibvirtAuthenticationFailedReason = "AuthenticationFailed"
+
+	// LibvirtMachineLibvirtConnectionFailedReason surfaces when the connection to the libvirt host failed for any other
+	// reason.
+	LibvirtMachineLibvirtConnectionFailedReason = "ConnectionFailed"
+)
+
+// LibvirtMachine's DiskSizeReconciled condition and corresponding reasons.
+const (
+	// LibvirtMachineDiskSizeReconciledCondition documents whether the primary disk of the virtual machine has the
+	// DiskSize of the LibvirtMachine.
+	LibvirtMachineDiskSizeReconciledCondition = "DiskSizeReconciled"
+
+	// LibvirtMachineDiskSizeReconciledReason surfaces when the primary disk has the DiskSize of the LibvirtMachine.
+	LibvirtMachineDiskSizeReconciledReason = "Reconciled"
+
+	// LibvirtMachineDiskShrinkNotSupportedReason surfaces when the primary disk is larger than the DiskSize of the
+	// LibvirtMachine, since disks can only be grown.
+	LibvirtMachineDiskShrinkNotSupportedReason = "ShrinkNotSupported"
+
+	// LibvirtMachineDiskResizeFailedReason surfaces when the primary disk could not be grown to the DiskSize of the
+	// LibvirtMachine.
+	LibvirtMachineDiskResizeFailedReason = "ResizeFailed"
+)
+
+// LibvirtMachine's ResourcesReconciled condition and corresponding reasons.
+const (
+	// LibvirtMachineResourcesReconciledCondition documents whether the virtual machine runs with the vCPUs and memory
+	// of the LibvirtMachine.
+	LibvirtMachineResourcesReconciledCondition = "ResourcesReconciled"
+
+	// LibvirtMachineResourcesReconciledReason surfaces when the virtual machine runs with the vCPUs and memory of the
+	// LibvirtMachine.
+	LibvirtMachineResourcesReconciledReason = "Reconciled"
+
+	// LibvirtMachineRestartPendingReason surfaces while the virtual machine is restarted to apply the vCPUs and memory
+	// of the LibvirtMachine: it was asked to shut down, and is stopped forcibly if it does not shut down in time.
+	LibvirtMachineRestartPendingReason = "RestartPending"
+
+	// LibvirtMachineResourcesUpdateFailedReason surfaces when the vCPUs and memory of the LibvirtMachine could not be
+	// applied to the virtual machine.
+	LibvirtMachineResourcesUpdateFailedReason = "UpdateFailed"
+)
+
 // LibvirtMachineSpec defines the desired state of LibvirtMachine
+// +kubebuilder:validation:XValidation:rule="[has(self.backingImagePath) && size(self.backingImagePath) > 0, has(self.backingImage), has(self.imageRef)].filter(s, s).size() <= 1",message="only one of backingImagePath, backingImage and imageRef can be specified"
+// +kubebuilder:validation:XValidation:rule="!has(self.maxCPU) || self.maxCPU >= self.cpu",message="maxCPU must not be less than cpu"
+// +kubebuilder:validation:XValidation:rule="!has(self.maxMemory) || self.maxMemory >= self.memory",message="maxMemory must not be less than memory"
 type LibvirtMachineSpec struct {
 	// Network is the name of the network to which the LibvirtMachine will be connected. Uses the 'default' network if not specified.
-	// Assumes that the network already exists and has DHCP enabled. TODO: Support static IPs and specify hostname per LibvirtMachine?
+	// Assumes that the network already exists and has DHCP enabled, unless NetworkConfig configures static addresses.
+	// Ignored if NetworkInterfaces is specified.
 	// +optional
 	Network *string `json:"network,omitempty"`
 
+	// NetworkInterfaces are the network interfaces of the LibvirtMachine, e.g. to connect it to a separate storage or cluster network next
+	// to the management network. The LibvirtMachine is connected to Network if not specified.
+	// +optional
+	// +listType=atomic
+	// +kubebuilder:validation:MaxItems=8
+	// +kubebuilder:validation:XValidation:rule="self.filter(i, has(i.primary) && i.primary).size() <= 1",message="only one network interface can be primary"
+	NetworkInterfaces []LibvirtMachineNetworkInterface `json:"networkInterfaces,omitempty"`
+
+	// NetworkConfig is the network configuration of the guest, e.g. static addresses, routes, bonds and VLANs. It is rendered into a
+	// cloud-init (NoCloud) network-config (version 2) file, and the configured addresses are reported in the addresses of the LibvirtMachine.
+	// The guest configures its network interfaces with DHCP if not specified; if specified, only the configured interfaces are set up.
+	// +optional
+	NetworkConfig *LibvirtMachineNetworkConfig `json:"networkConfig,omitempty"`
+
 	// StoragePool is the name of the storage pool where the LibvirtMachine's disk will be created. Uses the 'default' storage pool if not specified.
 	// Assumes that the storage pool already exists and has been started.
 	// +optional
 	StoragePool *string `json:"storagePool,omitempty"`
 
-	// CPU is the number of virtual CPUs assigned to the LibvirtMachine.
+	// CPU is the number of virtual CPUs assigned to the LibvirtMachine. A changed CPU is applied to the running LibvirtMachine in place
+	// (hotplugged) if it does not exceed MaxCPU, or otherwise with a restart of the LibvirtMachine.
 	CPU int32 `json:"cpu"`
 
-	// Memory is the amount of memory (in MiB) assigned to the LibvirtMachine.
+	// Memory is the amount of memory (in MiB) assigned to the LibvirtMachine. A changed Memory is applied to the running LibvirtMachine in
+	// place (through its memory balloon) if it does not exceed MaxMemory, or otherwise with a restart of the LibvirtMachine.
 	Memory int32 `json:"memory"`
 
-	// DiskSize is the size (in GiB) allocated to the primary operating system disk mounted to the LibvirtMachine.
+	// MaxCPU is the maximum number of virtual CPUs the LibvirtMachine can be scaled up to in place, i.e. the headroom of its CPU. Uses CPU
+	// if not specified. A changed MaxCPU is applied with a restart of the LibvirtMachine.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxCPU *int32 `json:"maxCPU,omitempty"`
+
+	// MaxMemory is the maximum amount of memory (in MiB) the LibvirtMachine can be scaled up to in place, i.e. the headroom of its Memory.
+	// Uses Memory if not specified. A changed MaxMemory is applied with a restart of the LibvirtMachine.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxMemory *int32 `json:"maxMemory,omitempty"`
+
+	// DiskSize is the size (in GiB) allocated to the primary operating system disk mounted to the LibvirtMachine. A larger DiskSize grows the
+	// disk of an existing LibvirtMachine online (e.g. for cloud-init's growpart to pick it up on the next boot); disks cannot be shrunk.
 	DiskSize int32 `json:"diskSize"`
 
+	// AdditionalDisks are blank data disks (e.g. for etcd or container storage) which are created together with the LibvirtMachine and attached
+	// after its primary operating system disk, i.e. as vdb, vdc and so on. The disks are deleted together with the LibvirtMachine.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	// +kubebuilder:validation:MaxItems=16
+	AdditionalDisks []LibvirtMachineDisk `json:"additionalDisks,omitempty"`
+
 	// BackingImagePath is a path on the libvirt target host of an image you have already downloaded and wish to use as the base image for the primary operating system disk of the LibvirtMachine.
-	BackingImagePath string `json:"backingImagePath"`
+	// One of BackingImagePath, BackingImage and ImageRef must be specified.
+	// +optional
+	BackingImagePath string `json:"backingImagePath,omitempty"`
 
 	// BackingImageFormat is the format of the backing image (e.g., "qcow2") at BackingImagePath. Uses the 'qcow2' format if not specified.
 	// +optional
 	BackingImageFormat *string `json:"backingImageFormat,omitempty"`
 
+	// BackingImage is an image which is downloaded into the StoragePool and used as the base image for the primary operating system disk of the
+	// LibvirtMachine, instead of an image at BackingImagePath. Downloaded images are cached in the storage pool by their checksum and shared by
+	// all LibvirtMachines using them.
+	// +optional
+	BackingImage *LibvirtMachineImage `json:"backingImage,omitempty"`
+
+	// ImageRef references a LibvirtImage in the namespace of the LibvirtMachine which is used as the base image for the primary operating
+	// system disk, instead of an image at BackingImagePath. The LibvirtMachine waits until the LibvirtImage is ready, and is only placed on
+	// the libvirt host of the LibvirtImage. The LibvirtImage cannot be deleted while it is referenced.
+	// +optional
+	ImageRef *corev1.LocalObjectReference `json:"imageRef,omitempty"`
+
+	// CloneMode is how the primary operating system disk is created from the base image: as a qcow2 overlay which uses the base image as its
+	// backing file ('linked'), or as an independent copy of the base image which is grown to DiskSize ('full'). Full copies take longer to
+	// create and use more space, but do not depend on the base image afterwards, which must be a volume of a storage pool on the libvirt host.
+	// Uses 'linked' if not specified. Changing the clone mode only applies to new virtual machines.
+	// +optional
+	CloneMode CloneMode `json:"cloneMode,omitempty"`
+
+	// Architecture is the CPU architecture of the LibvirtMachine, which must be supported by its libvirt host. The backing image must be built for
+	// the same architecture. Uses the 'amd64' architecture if not specified.
+	// +optional
+	Architecture Architecture `json:"architecture,omitempty"`
+
+	// AllowEmulation allows the LibvirtMachine to run on a libvirt host which only supports its architecture with (much slower) software
+	// emulation rather than KVM, e.g. an arm64 LibvirtMachine on an amd64 host. LibvirtMachines are only placed on hosts with KVM for their
+	// architecture if not set.
+	// +optional
+	AllowEmulation bool `json:"allowEmulation,omitempty"`
+
+	// Firmware configures the firmware of the LibvirtMachine, and whether it has Secure Boot and a TPM. Uses the default firmware of the
+	// architecture (BIOS on amd64, UEFI on arm64) if not specified.
+	// +optional
+	Firmware *LibvirtMachineFirmware `json:"firmware,omitempty"`
+
+	// IgnitionDelivery is how Ignition bootstrap data (i.e. a bootstrap data secret with the 'ignition' format) is delivered to the
+	// LibvirtMachine: as a QEMU fw_cfg entry ('fwcfg') or as a read-only config disk ('volume'). Uses 'fwcfg' on amd64 and arm64, and
+	// 'volume' on s390x and ppc64le (which do not support fw_cfg), if not specified. Not used for cloud-config bootstrap data.
+	// +optional
+	IgnitionDelivery IgnitionDelivery `json:"ignitionDelivery,omitempty"`
+
+	// HostSelector restricts the placement of the LibvirtMachine to the hosts of the LibvirtCluster with matching labels.
+	// Only used if the LibvirtCluster has multiple hosts.
+	// +optional
+	HostSelector map[string]string `json:"hostSelector,omitempty"`
+
 	// ProviderID is the unique identifier for this machine as exposed by the infrastructure provider.
 	// This field is required by Cluster API to link the Machine resource to the infrastructure machine.
 	// Format: libvirt:///<machine-name>
@@ -49,6 +316,327 @@ type LibvirtMachineSpec struct {
 	ProviderID string `json:"providerID,omitempty"`
 }
 
+// LibvirtMachineNetworkInterface describes a network interface of a LibvirtMachine.
+type LibvirtMachineNetworkInterface struct {
+	// Network is the name of the libvirt network to which the interface is connected. Assumes that the network already exists and has
+	// DHCP enabled.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	Network string `json:"network"`
+
+	// Model is the device model of the interface. Uses the 'virtio' model if not specified.
+	// +optional
+	// +kubebuilder:validation:Enum=virtio;e1000;e1000e;rtl8139
+	Model *string `json:"model,omitempty"`
+
+	// MACAddress is the MAC address of the interface. If not specified, a MAC address is derived from the name of the LibvirtMachine and the
+	// index of the interface, so that it stays the same when the LibvirtMachine is recreated.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^([0-9a-fA-F]{2}:){5}[0-9a-fA-F]{2}$`
+	MACAddress *string `json:"macAddress,omitempty"`
+
+	// DHCPReservation reserves an IP address and a hostname for the interface in the DHCP server of its libvirt network, so that the address
+	// survives the recreation of the LibvirtMachine and the hostname resolves in the DNS of the network. The reservation is added when the
+	// virtual machine is created and removed when it is deleted.
+	// +optional
+	DHCPReservation *LibvirtMachineDHCPReservation `json:"dhcpReservation,omitempty"`
+
+	// Primary marks the interface whose addresses are reported first in the addresses of the LibvirtMachine, i.e. the addresses Kubernetes
+	// uses for the node. The first interface is primary if no interface is marked as primary.
+	// +optional
+	Primary bool `json:"primary,omitempty"`
+}
+
+// LibvirtMachineDHCPReservation is a reservation (static lease) in the DHCP server of a libvirt network.
+type LibvirtMachineDHCPReservation struct {
+	// IPAddress is the reserved IP address, which must be within an IP range of the network for which DHCP is enabled.
+	// +required
+	IPAddress IPAddress `json:"ipAddress"`
+
+	// Hostname is the reserved hostname. Uses the name of the LibvirtMachine if not specified.
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	Hostname *string `json:"hostname,omitempty"`
+}
+
+// CIDR is an IP address with a prefix length, e.g. "192.168.122.10/24" or "fd00::10/64".
+// +kubebuilder:validation:MaxLength=64
+// +kubebuilder:validation:XValidation:rule="isCIDR(self)",message="must be an IP address with a prefix length"
+type CIDR string
+
+// IPAddress is an IPv4 or IPv6 address.
+// +kubebuilder:validation:MaxLength=64
+// +kubebuilder:validation:XValidation:rule="isIP(self)",message="must be an IP address"
+type IPAddress string
+
+// LibvirtMachineNetworkConfig is the network configuration of the guest of a LibvirtMachine.
+type LibvirtMachineNetworkConfig struct {
+	// Ethernets configure the network interfaces of the LibvirtMachine.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	// +kubebuilder:validation:MaxItems=8
+	Ethernets []LibvirtMachineEthernet `json:"ethernets,omitempty"`
+
+	// Bonds configure bonds of ethernets.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	// +kubebuilder:validation:MaxItems=8
+	Bonds []LibvirtMachineBond `json:"bonds,omitempty"`
+
+	// VLANs configure VLANs on top of ethernets or bonds.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	// +kubebuilder:validation:MaxItems=32
+	VLANs []LibvirtMachineVLAN `json:"vlans,omitempty"`
+}
+
+// LibvirtMachineNetworkDeviceConfig is the configuration of a network device (ethernet, bond or VLAN) of the guest.
+type LibvirtMachineNetworkDeviceConfig struct {
+	// Addresses are the static addresses of the device.
+	// +optional
+	// +listType=atomic
+	// +kubebuilder:validation:MaxItems=16
+	Addresses []CIDR `json:"addresses,omitempty"`
+
+	// Gateway is the default gateway of the device.
+	// +optional
+	Gateway *IPAddress `json:"gateway,omitempty"`
+
+	// Nameservers are the addresses of the DNS servers of the device.
+	// +optional
+	// +listType=atomic
+	// +kubebuilder:validation:MaxItems=8
+	Nameservers []IPAddress `json:"nameservers,omitempty"`
+
+	// SearchDomains are the DNS search domains of the device.
+	// +optional
+	// +listType=atomic
+	// +kubebuilder:validation:MaxItems=8
+	SearchDomains []string `json:"searchDomains,omitempty"`
+
+	// Routes are additional static routes of the device.
+	// +optional
+	// +listType=atomic
+	// +kubebuilder:validation:MaxItems=32
+	Routes []LibvirtMachineRoute `json:"routes,omitempty"`
+
+	// DHCP4 enables DHCP for IPv4 on the device, in addition to its static addresses.
+	// +optional
+	DHCP4 bool `json:"dhcp4,omitempty"`
+
+	// DHCP6 enables DHCP for IPv6 on the device, in addition to its static addresses.
+	// +optional
+	DHCP6 bool `json:"dhcp6,omitempty"`
+
+	// MTU is the MTU of the device.
+	// +optional
+	// +kubebuilder:validation:Minimum=576
+	// +kubebuilder:validation:Maximum=65535
+	MTU *int32 `json:"mtu,omitempty"`
+}
+
+// LibvirtMachineRoute is a static route.
+type LibvirtMachineRoute struct {
+	// To is the destination network of the route.
+	// +required
+	To CIDR `json:"to"`
+
+	// Via is the gateway of the route.
+	// +required
+	Via IPAddress `json:"via"`
+
+	// Metric is the metric of the route.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Metric *int32 `json:"metric,omitempty"`
+}
+
+// LibvirtMachineEthernet configures a network interface of a LibvirtMachine.
+type LibvirtMachineEthernet struct {
+	// Name is the name of the interface in the guest (e.g. "eth0"), by which bonds and VLANs refer to it.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=15
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9][-_.a-zA-Z0-9]*$`
+	Name string `json:"name"`
+
+	// Interface is the (0-based) index of the network interface in NetworkInterfaces, or 0 for the only network interface if NetworkInterfaces is
+	// not specified. The interface is matched by its MAC address.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Interface int32 `json:"interface,omitempty"`
+
+	LibvirtMachineNetworkDeviceConfig `json:",inline"`
+}
+
+// LibvirtMachineBond configures a bond of ethernets of a LibvirtMachine.
+type LibvirtMachineBond struct {
+	// Name is the name of the bond in the guest (e.g. "bond0").
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=15
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9][-_.a-zA-Z0-9]*$`
+	Name string `json:"name"`
+
+	// Interfaces are the names of the ethernets in the bond.
+	// +required
+	// +listType=set
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=8
+	Interfaces []string `json:"interfaces"`
+
+	// Mode is the bonding mode. Uses the 'active-backup' mode if not specified.
+	// +optional
+	// +kubebuilder:validation:Enum=balance-rr;active-backup;balance-xor;broadcast;"802.3ad";balance-tlb;balance-alb
+	Mode *string `json:"mode,omitempty"`
+
+	LibvirtMachineNetworkDeviceConfig `json:",inline"`
+}
+
+// LibvirtMachineVLAN configures a VLAN of a LibvirtMachine.
+type LibvirtMachineVLAN struct {
+	// Name is the name of the VLAN in the guest (e.g. "vlan10").
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=15
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9][-_.a-zA-Z0-9]*$`
+	Name string `json:"name"`
+
+	// ID is the VLAN ID.
+	// +required
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=4094
+	ID int32 `json:"id"`
+
+	// Link is the name of the ethernet or bond on which the VLAN is created.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	Link string `json:"link"`
+
+	LibvirtMachineNetworkDeviceConfig `json:",inline"`
+}
+
+// DiskBus is the bus through which a disk is attached to a LibvirtMachine.
+// +kubebuilder:validation:Enum=virtio;scsi;sata
+type DiskBus string
+
+const (
+	// DiskBusVirtio attaches the disk as a virtio block device (/dev/vdX).
+	DiskBusVirtio DiskBus = "virtio"
+	// DiskBusSCSI attaches the disk to a virtio-scsi controller (/dev/sdX).
+	DiskBusSCSI DiskBus = "scsi"
+	// DiskBusSATA attaches the disk to the SATA controller (/dev/sdX). Only supported on amd64.
+	DiskBusSATA DiskBus = "sata"
+)
+
+// DiskCacheMode is the host cache mode of a disk.
+// +kubebuilder:validation:Enum=none;writethrough;writeback;directsync;unsafe
+type DiskCacheMode string
+
+// LibvirtMachineDisk describes an additional data disk of a LibvirtMachine.
+type LibvirtMachineDisk struct {
+	// Name is the name of the disk, which must be unique within the LibvirtMachine. The storage volume of the disk is named
+	// "{LibvirtMachine name}-{name}.{format}".
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// Size is the size (in GiB) of the disk.
+	// +required
+	// +kubebuilder:validation:Minimum=1
+	Size int32 `json:"size"`
+
+	// StoragePool is the name of the storage pool where the disk will be created. Uses the StoragePool of the LibvirtMachine if not specified.
+	// +optional
+	StoragePool *string `json:"storagePool,omitempty"`
+
+	// Format is the format of the disk's storage volume. Uses the 'qcow2' format if not specified.
+	// +optional
+	// +kubebuilder:validation:Enum=qcow2;raw
+	Format *string `json:"format,omitempty"`
+
+	// Bus is the bus through which the disk is attached. Uses the 'virtio' bus if not specified.
+	// +optional
+	Bus DiskBus `json:"bus,omitempty"`
+
+	// CacheMode is the host cache mode of the disk. Uses the default of the hypervisor if not specified.
+	// +optional
+	CacheMode DiskCacheMode `json:"cacheMode,omitempty"`
+}
+
+// LibvirtMachineImage is a backing image which is downloaded from a URL.
+type LibvirtMachineImage struct {
+	// URL is the http or https URL of the image. The format of the image is detected automatically; only qcow2 and raw images are supported,
+	// and images compressed with gzip or bzip2 are decompressed. Converting images is out of scope: images in other formats (e.g. vmdk or
+	// vhdx) are rejected and must be converted first, e.g. with 'qemu-img convert'.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	URL string `json:"url"`
+
+	// Checksum is the SHA-256 checksum of the image (as downloaded), optionally prefixed with 'sha256:'. The downloaded image is verified
+	// against the checksum, and if it is already cached in the storage pool it is not downloaded again at all. Without a checksum, the image
+	// is downloaded to find out its checksum, which is recorded in the status of the LibvirtMachine; LibvirtMachines in the same namespace
+	// with the same URL use the image cached with the checksum recorded by another LibvirtMachine rather than downloading it again.
+	// +kubebuilder:validation:Pattern=`^(sha256:)?[0-9a-fA-F]{64}$`
+	// +optional
+	Checksum *string `json:"checksum,omitempty"`
+}
+
+// FirmwareType is the type of firmware of a LibvirtMachine.
+// +kubebuilder:validation:Enum=bios;efi
+type FirmwareType string
+
+const (
+	// FirmwareTypeBIOS is the default (BIOS) firmware of the architecture, e.g. SeaBIOS on amd64. It is not supported on arm64.
+	FirmwareTypeBIOS FirmwareType = "bios"
+	// FirmwareTypeEFI is UEFI firmware, which is selected automatically by libvirt. It is not supported on s390x and ppc64le.
+	FirmwareTypeEFI FirmwareType = "efi"
+)
+
+// CloneMode is how the primary disk of a LibvirtMachine is created from its base image.
+// +kubebuilder:validation:Enum=linked;full
+type CloneMode string
+
+const (
+	// CloneModeLinked creates the disk as a qcow2 overlay with the base image as its backing file.
+	CloneModeLinked CloneMode = "linked"
+	// CloneModeFull creates the disk as an independent copy of the base image.
+	CloneModeFull CloneMode = "full"
+)
+
+// IgnitionDelivery is how Ignition bootstrap data is delivered to a LibvirtMachine.
+// +kubebuilder:validation:Enum=fwcfg;volume
+type IgnitionDelivery string
+
+const (
+	// IgnitionDeliveryFWCfg passes the Ignition config as the QEMU fw_cfg entry 'opt/com.coreos/config'. It is not supported on s390x and ppc64le.
+	IgnitionDeliveryFWCfg IgnitionDelivery = "fwcfg"
+	// IgnitionDeliveryVolume attaches the Ignition config as a read-only virtio disk with the serial 'ignition'.
+	IgnitionDeliveryVolume IgnitionDelivery = "volume"
+)
+
+// LibvirtMachineFirmware configures the firmware of a LibvirtMachine.
+// +kubebuilder:validation:XValidation:rule="!has(self.secureBoot) || !self.secureBoot || (has(self.type) && self.type == 'efi')",message="secureBoot requires the efi firmware type"
+type LibvirtMachineFirmware struct {
+	// Type is the type of firmware. Uses the default firmware of the architecture if not specified.
+	// +optional
+	Type FirmwareType `json:"type,omitempty"`
+
+	// SecureBoot enables UEFI Secure Boot with the default (e.g. Microsoft) keys enrolled. The backing image must have a signed boot loader.
+	// Requires the efi firmware type.
+	// +optional
+	SecureBoot bool `json:"secureBoot,omitempty"`
+
+	// TPM adds an emulated TPM 2.0 device to the LibvirtMachine. Requires swtpm on the libvirt host.
+	// +optional
+	TPM bool `json:"tpm,omitempty"`
+}
+
 // LibvirtMachineInitializationStatus provides observations of the LibvirtMachine initialization process.
 // +kubebuilder:validation:MinProperties=1
 type LibvirtMachineInitializationStatus struct {
@@ -63,10 +651,15 @@ type LibvirtMachineStatus struct {
 	// conditions represent the current state of the LibvirtMachine resource.
 	// Each condition has a unique type and reflects the status of a specific aspect of the resource.
 	//
-	// Standard condition types include:
-	// - "Available": the resource is fully functional
-	// - "Progressing": the resource is being created or updated
-	// - "Degraded": the resource failed to reach or maintain its desired state
+	// Condition types include:
+	// - "Ready": summarizes the other conditions of the LibvirtMachine
+	// - "LibvirtConnected": the controller can connect to the libvirt host of the LibvirtMachine
+	// - "VirtualMachineProvisioned": the virtual machine is created and running
+	// - "BootstrapDataAvailable": the bootstrap data of the Machine is available
+	// - "AddressesAvailable": the primary network interface of the virtual machine has an address
+	// - "DiskSizeReconciled": the primary disk of the virtual machine has the diskSize of the LibvirtMachine
+	// - "ResourcesReconciled": the virtual machine runs with the cpu and memory of the LibvirtMachine
+	// - "DriftDetected": the virtual machine has drifted from the spec and is recreated (negative polarity)
 	//
 	// The status of each condition is one of True, False, or Unknown.
 	// +listType=map
@@ -78,6 +671,11 @@ type LibvirtMachineStatus struct {
 	// +optional
 	Addresses []clusterv1.MachineAddress `json:"addresses,omitempty"`
 
+	// networkInterfaces are the network interfaces of the virtual machine and their addresses.
+	// +optional
+	// +listType=atomic
+	NetworkInterfaces []LibvirtMachineNetworkInterfaceStatus `json:"networkInterfaces,omitempty"`
+
 	// ready (v1beta1) denotes that the LibvirtMachine infrastructure is fully provisioned.
 	// NOTE: this field is part of the Cluster API contract and it is used to orchestrate provisioning.
 	// The value of this field is never updated after provisioning is completed. Please use conditions
@@ -89,6 +687,64 @@ type LibvirtMachineStatus struct {
 	// NOTE: Fields in this struct are part of the Cluster API contract and are used to orchestrate initial Machine provisioning.
 	// +optional
 	Initialization LibvirtMachineInitializationStatus `json:"initialization,omitempty,omitzero"`
+
+	// host is the libvirt host on which the virtual machine is placed. It is recorded before the virtual machine is
+	// created, and all further operations on the virtual machine go to this host.
+	// +optional
+	Host *LibvirtMachineHost `json:"host,omitempty"`
+
+	// backingImage is the backing image downloaded for the virtual machine from the URL of spec.backingImage. Its
+	// checksum is used to find the image in the cache of the storage pool instead of downloading it again.
+	// +optional
+	BackingImage *LibvirtMachineBackingImageStatus `json:"backingImage,omitempty"`
+}
+
+// LibvirtMachineBackingImageStatus is the observed state of the backing image downloaded for a LibvirtMachine.
+type LibvirtMachineBackingImageStatus struct {
+	// url is the URL from which the image was downloaded.
+	// +required
+	URL string `json:"url"`
+
+	// checksum is the SHA-256 checksum of the downloaded image.
+	// +required
+	Checksum string `json:"checksum"`
+}
+
+// LibvirtMachineNetworkInterfaceStatus is the observed state of a network interface of a LibvirtMachine.
+type LibvirtMachineNetworkInterfaceStatus struct {
+	// network is the name of the libvirt network to which the interface is connected.
+	// +required
+	Network string `json:"network"`
+
+	// macAddress is the MAC address of the interface.
+	// +optional
+	MACAddress string `json:"macAddress,omitempty"`
+
+	// primary is true for the primary interface of the LibvirtMachine.
+	// +optional
+	Primary bool `json:"primary,omitempty"`
+
+	// addresses are the IP addresses leased to the interface.
+	// +optional
+	// +listType=atomic
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// LibvirtMachineHost identifies the libvirt host of a LibvirtMachine.
+type LibvirtMachineHost struct {
+	// name is the name of the host in the hosts of the LibvirtCluster. It is empty if the LibvirtCluster does not
+	// specify hosts.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// uri is the libvirt connection URI of the host.
+	// +required
+	URI string `json:"uri"`
+
+	// credentialsSecretRef references the Secret with the credentials used to connect to the host, so that the virtual
+	// machine can still be deleted once the host is removed from the LibvirtCluster or the LibvirtCluster is deleted.
+	// +optional
+	CredentialsSecretRef *corev1.SecretReference `json:"credentialsSecretRef,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -97,6 +753,7 @@ type LibvirtMachineStatus struct {
 // +kubebuilder:storageversion
 // +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".metadata.labels['cluster\\.x-k8s\\.io/cluster-name']",description="Cluster"
 // +kubebuilder:printcolumn:name="ProviderID",type="string",JSONPath=".spec.providerID",description="Provider ID"
+// +kubebuilder:printcolumn:name="Host",type="string",JSONPath=".status.host.name",description="Libvirt host",priority=1
 
 // LibvirtMachine is the Schema for the libvirtmachines API
 type LibvirtMachine struct {
@@ -115,6 +772,16 @@ type LibvirtMachine struct {
 	Status LibvirtMachineStatus `json:"status,omitzero"`
 }
 
+// GetConditions returns the set of conditions for this object.
+func (m *LibvirtMachine) GetConditions() []metav1.Condition {
+	return m.Status.Conditions
+}
+
+// SetConditions sets conditions for an API object.
+func (m *LibvirtMachine) SetConditions(conditions []metav1.Condition) {
+	m.Status.Conditions = conditions
+}
+
 // +kubebuilder:object:root=true
 
 // LibvirtMachineList contains a list of LibvirtMachine
@@ -21,8 +21,8 @@ limitations under the License.
 package v1beta2
 
 import (
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	corev1beta2 "sigs.k8s.io/cluster-api/api/core/v1beta2"
 )
@@ -33,7 +33,7 @@ func (in *LibvirtCluster) DeepCopyInto(out *LibvirtCluster) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Status.DeepCopyInto(&out.Status)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtCluster.
@@ -104,6 +104,28 @@ func (in *LibvirtClusterList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LibvirtClusterSpec) DeepCopyInto(out *LibvirtClusterSpec) {
 	*out = *in
+	if in.CredentialsSecretRef != nil {
+		in, out := &in.CredentialsSecretRef, &out.CredentialsSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]LibvirtHost, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Networks != nil {
+		in, out := &in.Networks, &out.Networks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StoragePools != nil {
+		in, out := &in.StoragePools, &out.StoragePools
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtClusterSpec.
@@ -121,7 +143,7 @@ func (in *LibvirtClusterStatus) DeepCopyInto(out *LibvirtClusterStatus) {
 	*out = *in
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
-		*out = make([]v1.Condition, len(*in))
+		*out = make([]metav1.Condition, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
@@ -201,7 +223,7 @@ func (in *LibvirtClusterTemplateList) DeepCopyObject() runtime.Object {
 func (in *LibvirtClusterTemplateResource) DeepCopyInto(out *LibvirtClusterTemplateResource) {
 	*out = *in
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtClusterTemplateResource.
@@ -230,6 +252,190 @@ func (in *LibvirtClusterTemplateSpec) DeepCopy() *LibvirtClusterTemplateSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtHost) DeepCopyInto(out *LibvirtHost) {
+	*out = *in
+	if in.CredentialsSecretRef != nil {
+		in, out := &in.CredentialsSecretRef, &out.CredentialsSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Weight != nil {
+		in, out := &in.Weight, &out.Weight
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtHost.
+func (in *LibvirtHost) DeepCopy() *LibvirtHost {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtHost)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtImage) DeepCopyInto(out *LibvirtImage) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtImage.
+func (in *LibvirtImage) DeepCopy() *LibvirtImage {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LibvirtImage) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtImageList) DeepCopyInto(out *LibvirtImageList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]LibvirtImage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtImageList.
+func (in *LibvirtImageList) DeepCopy() *LibvirtImageList {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtImageList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LibvirtImageList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtImageSource) DeepCopyInto(out *LibvirtImageSource) {
+	*out = *in
+	if in.Checksum != nil {
+		in, out := &in.Checksum, &out.Checksum
+		*out = new(string)
+		**out = **in
+	}
+	if in.Volume != nil {
+		in, out := &in.Volume, &out.Volume
+		*out = new(LibvirtImageVolume)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtImageSource.
+func (in *LibvirtImageSource) DeepCopy() *LibvirtImageSource {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtImageSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtImageSpec) DeepCopyInto(out *LibvirtImageSpec) {
+	*out = *in
+	if in.CredentialsSecretRef != nil {
+		in, out := &in.CredentialsSecretRef, &out.CredentialsSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	in.Source.DeepCopyInto(&out.Source)
+	if in.StoragePool != nil {
+		in, out := &in.StoragePool, &out.StoragePool
+		*out = new(string)
+		**out = **in
+	}
+	if in.Format != nil {
+		in, out := &in.Format, &out.Format
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtImageSpec.
+func (in *LibvirtImageSpec) DeepCopy() *LibvirtImageSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtImageSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtImageStatus) DeepCopyInto(out *LibvirtImageStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtImageStatus.
+func (in *LibvirtImageStatus) DeepCopy() *LibvirtImageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtImageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtImageVolume) DeepCopyInto(out *LibvirtImageVolume) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtImageVolume.
+func (in *LibvirtImageVolume) DeepCopy() *LibvirtImageVolume {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtImageVolume)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LibvirtMachine) DeepCopyInto(out *LibvirtMachine) {
 	*out = *in
@@ -257,6 +463,163 @@ func (in *LibvirtMachine) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineBackingImageStatus) DeepCopyInto(out *LibvirtMachineBackingImageStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineBackingImageStatus.
+func (in *LibvirtMachineBackingImageStatus) DeepCopy() *LibvirtMachineBackingImageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineBackingImageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineBond) DeepCopyInto(out *LibvirtMachineBond) {
+	*out = *in
+	if in.Interfaces != nil {
+		in, out := &in.Interfaces, &out.Interfaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Mode != nil {
+		in, out := &in.Mode, &out.Mode
+		*out = new(string)
+		**out = **in
+	}
+	in.LibvirtMachineNetworkDeviceConfig.DeepCopyInto(&out.LibvirtMachineNetworkDeviceConfig)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineBond.
+func (in *LibvirtMachineBond) DeepCopy() *LibvirtMachineBond {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineBond)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineDHCPReservation) DeepCopyInto(out *LibvirtMachineDHCPReservation) {
+	*out = *in
+	if in.Hostname != nil {
+		in, out := &in.Hostname, &out.Hostname
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineDHCPReservation.
+func (in *LibvirtMachineDHCPReservation) DeepCopy() *LibvirtMachineDHCPReservation {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineDHCPReservation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineDisk) DeepCopyInto(out *LibvirtMachineDisk) {
+	*out = *in
+	if in.StoragePool != nil {
+		in, out := &in.StoragePool, &out.StoragePool
+		*out = new(string)
+		**out = **in
+	}
+	if in.Format != nil {
+		in, out := &in.Format, &out.Format
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineDisk.
+func (in *LibvirtMachineDisk) DeepCopy() *LibvirtMachineDisk {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineDisk)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineEthernet) DeepCopyInto(out *LibvirtMachineEthernet) {
+	*out = *in
+	in.LibvirtMachineNetworkDeviceConfig.DeepCopyInto(&out.LibvirtMachineNetworkDeviceConfig)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineEthernet.
+func (in *LibvirtMachineEthernet) DeepCopy() *LibvirtMachineEthernet {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineEthernet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineFirmware) DeepCopyInto(out *LibvirtMachineFirmware) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineFirmware.
+func (in *LibvirtMachineFirmware) DeepCopy() *LibvirtMachineFirmware {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineFirmware)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineHost) DeepCopyInto(out *LibvirtMachineHost) {
+	*out = *in
+	if in.CredentialsSecretRef != nil {
+		in, out := &in.CredentialsSecretRef, &out.CredentialsSecretRef
+		*out = new(v1.SecretReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineHost.
+func (in *LibvirtMachineHost) DeepCopy() *LibvirtMachineHost {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineHost)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineImage) DeepCopyInto(out *LibvirtMachineImage) {
+	*out = *in
+	if in.Checksum != nil {
+		in, out := &in.Checksum, &out.Checksum
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineImage.
+func (in *LibvirtMachineImage) DeepCopy() *LibvirtMachineImage {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LibvirtMachineInitializationStatus) DeepCopyInto(out *LibvirtMachineInitializationStatus) {
 	*out = *in
@@ -304,6 +667,159 @@ func (in *LibvirtMachineList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineNetworkConfig) DeepCopyInto(out *LibvirtMachineNetworkConfig) {
+	*out = *in
+	if in.Ethernets != nil {
+		in, out := &in.Ethernets, &out.Ethernets
+		*out = make([]LibvirtMachineEthernet, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Bonds != nil {
+		in, out := &in.Bonds, &out.Bonds
+		*out = make([]LibvirtMachineBond, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VLANs != nil {
+		in, out := &in.VLANs, &out.VLANs
+		*out = make([]LibvirtMachineVLAN, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineNetworkConfig.
+func (in *LibvirtMachineNetworkConfig) DeepCopy() *LibvirtMachineNetworkConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineNetworkConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineNetworkDeviceConfig) DeepCopyInto(out *LibvirtMachineNetworkDeviceConfig) {
+	*out = *in
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]CIDR, len(*in))
+		copy(*out, *in)
+	}
+	if in.Gateway != nil {
+		in, out := &in.Gateway, &out.Gateway
+		*out = new(IPAddress)
+		**out = **in
+	}
+	if in.Nameservers != nil {
+		in, out := &in.Nameservers, &out.Nameservers
+		*out = make([]IPAddress, len(*in))
+		copy(*out, *in)
+	}
+	if in.SearchDomains != nil {
+		in, out := &in.SearchDomains, &out.SearchDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]LibvirtMachineRoute, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.MTU != nil {
+		in, out := &in.MTU, &out.MTU
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineNetworkDeviceConfig.
+func (in *LibvirtMachineNetworkDeviceConfig) DeepCopy() *LibvirtMachineNetworkDeviceConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineNetworkDeviceConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineNetworkInterface) DeepCopyInto(out *LibvirtMachineNetworkInterface) {
+	*out = *in
+	if in.Model != nil {
+		in, out := &in.Model, &out.Model
+		*out = new(string)
+		**out = **in
+	}
+	if in.MACAddress != nil {
+		in, out := &in.MACAddress, &out.MACAddress
+		*out = new(string)
+		**out = **in
+	}
+	if in.DHCPReservation != nil {
+		in, out := &in.DHCPReservation, &out.DHCPReservation
+		*out = new(LibvirtMachineDHCPReservation)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineNetworkInterface.
+func (in *LibvirtMachineNetworkInterface) DeepCopy() *LibvirtMachineNetworkInterface {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineNetworkInterface)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineNetworkInterfaceStatus) DeepCopyInto(out *LibvirtMachineNetworkInterfaceStatus) {
+	*out = *in
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineNetworkInterfaceStatus.
+func (in *LibvirtMachineNetworkInterfaceStatus) DeepCopy() *LibvirtMachineNetworkInterfaceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineNetworkInterfaceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineRoute) DeepCopyInto(out *LibvirtMachineRoute) {
+	*out = *in
+	if in.Metric != nil {
+		in, out := &in.Metric, &out.Metric
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineRoute.
+func (in *LibvirtMachineRoute) DeepCopy() *LibvirtMachineRoute {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineRoute)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LibvirtMachineSpec) DeepCopyInto(out *LibvirtMachineSpec) {
 	*out = *in
@@ -312,16 +828,67 @@ func (in *LibvirtMachineSpec) DeepCopyInto(out *LibvirtMachineSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.NetworkInterfaces != nil {
+		in, out := &in.NetworkInterfaces, &out.NetworkInterfaces
+		*out = make([]LibvirtMachineNetworkInterface, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NetworkConfig != nil {
+		in, out := &in.NetworkConfig, &out.NetworkConfig
+		*out = new(LibvirtMachineNetworkConfig)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.StoragePool != nil {
 		in, out := &in.StoragePool, &out.StoragePool
 		*out = new(string)
 		**out = **in
 	}
+	if in.MaxCPU != nil {
+		in, out := &in.MaxCPU, &out.MaxCPU
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxMemory != nil {
+		in, out := &in.MaxMemory, &out.MaxMemory
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AdditionalDisks != nil {
+		in, out := &in.AdditionalDisks, &out.AdditionalDisks
+		*out = make([]LibvirtMachineDisk, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.BackingImageFormat != nil {
 		in, out := &in.BackingImageFormat, &out.BackingImageFormat
 		*out = new(string)
 		**out = **in
 	}
+	if in.BackingImage != nil {
+		in, out := &in.BackingImage, &out.BackingImage
+		*out = new(LibvirtMachineImage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImageRef != nil {
+		in, out := &in.ImageRef, &out.ImageRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Firmware != nil {
+		in, out := &in.Firmware, &out.Firmware
+		*out = new(LibvirtMachineFirmware)
+		**out = **in
+	}
+	if in.HostSelector != nil {
+		in, out := &in.HostSelector, &out.HostSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineSpec.
@@ -339,7 +906,7 @@ func (in *LibvirtMachineStatus) DeepCopyInto(out *LibvirtMachineStatus) {
 	*out = *in
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
-		*out = make([]v1.Condition, len(*in))
+		*out = make([]metav1.Condition, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
@@ -349,7 +916,24 @@ func (in *LibvirtMachineStatus) DeepCopyInto(out *LibvirtMachineStatus) {
 		*out = make([]corev1beta2.MachineAddress, len(*in))
 		copy(*out, *in)
 	}
+	if in.NetworkInterfaces != nil {
+		in, out := &in.NetworkInterfaces, &out.NetworkInterfaces
+		*out = make([]LibvirtMachineNetworkInterfaceStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	out.Initialization = in.Initialization
+	if in.Host != nil {
+		in, out := &in.Host, &out.Host
+		*out = new(LibvirtMachineHost)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BackingImage != nil {
+		in, out := &in.BackingImage, &out.BackingImage
+		*out = new(LibvirtMachineBackingImageStatus)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineStatus.
@@ -459,7 +1043,7 @@ func (in *LibvirtMachineTemplateStatus) DeepCopyInto(out *LibvirtMachineTemplate
 	*out = *in
 	if in.Capacity != nil {
 		in, out := &in.Capacity, &out.Capacity
-		*out = make(corev1.ResourceList, len(*in))
+		*out = make(v1.ResourceList, len(*in))
 		for key, val := range *in {
 			(*out)[key] = val.DeepCopy()
 		}
@@ -477,6 +1061,22 @@ func (in *LibvirtMachineTemplateStatus) DeepCopy() *LibvirtMachineTemplateStatus
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtMachineVLAN) DeepCopyInto(out *LibvirtMachineVLAN) {
+	*out = *in
+	in.LibvirtMachineNetworkDeviceConfig.DeepCopyInto(&out.LibvirtMachineNetworkDeviceConfig)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtMachineVLAN.
+func (in *LibvirtMachineVLAN) DeepCopy() *LibvirtMachineVLAN {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtMachineVLAN)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeInfo) DeepCopyInto(out *NodeInfo) {
 	*out = *in
@@ -3,17 +3,25 @@ package main
 import (
 	"crypto/tls"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -23,6 +31,7 @@ import (
 	infrastructurev1beta2 "github.com/joshuagrisham/cluster-api-provider-libvirt/api/v1beta2"
 	infrav1 "github.com/joshuagrisham/cluster-api-provider-libvirt/api/v1beta2"
 	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/controller"
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -49,6 +58,7 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var watchFilterValue string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -67,6 +77,9 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&watchFilterValue, "watch-filter", "",
+		fmt.Sprintf("Label value that the controller watches to reconcile cluster-api objects. Label key is always %s. "+
+			"If unspecified, the controller watches for all cluster-api objects.", clusterv1.WatchLabel))
 	opts := zap.Options{
 		Development: true,
 	}
@@ -137,8 +150,24 @@ func main() {
 		metricsServerOptions.KeyName = metricsCertKey
 	}
 
+	// Only cache the Secrets of Cluster API (e.g. bootstrap data) to watch them, rather than every Secret in the
+	// cluster. Secrets are read from the API server, since credentials Secrets do not have the label.
+	clusterSecrets, err := labels.NewRequirement(clusterv1.ClusterNameLabel, selection.Exists, nil)
+	if err != nil {
+		setupLog.Error(err, "unable to select the Secrets to cache")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
+		Scheme: scheme,
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.Secret{}: {Label: labels.NewSelector().Add(*clusterSecrets)},
+			},
+		},
+		Client: client.Options{
+			Cache: &client.CacheOptions{DisableFor: []client.Object{&corev1.Secret{}}},
+		},
 		Metrics:                metricsServerOptions,
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
@@ -161,27 +190,62 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Share one connection per libvirt URI across all reconciles; the connections are closed when the manager stops
+	libvirtConnections := libvirtclient.NewConnectionManager()
+	if err := mgr.Add(libvirtConnections); err != nil {
+		setupLog.Error(err, "unable to set up libvirt connection manager")
+		os.Exit(1)
+	}
+
+	// Optionally use credentials from a Secret (referenced as "<namespace>/<name>") to connect to libvirt
+	var libvirtCredentialsSecret *types.NamespacedName
+	if ref := os.Getenv("LIBVIRT_CREDENTIALS_SECRET"); ref != "" {
+		namespace, name, ok := strings.Cut(ref, "/")
+		if !ok || namespace == "" || name == "" {
+			setupLog.Info("invalid env LIBVIRT_CREDENTIALS_SECRET; expected format \"<namespace>/<name>\"", "value", ref)
+			os.Exit(1)
+		}
+		libvirtCredentialsSecret = &types.NamespacedName{Namespace: namespace, Name: name}
+	}
+
 	if err := (&controller.LibvirtClusterReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		NewLibvirtClient:  libvirtConnections.Client,
+		CredentialsSecret: libvirtCredentialsSecret,
+		Recorder:          mgr.GetEventRecorderFor("libvirtcluster-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LibvirtCluster")
 		os.Exit(1)
 	}
+
 	if err := (&controller.LibvirtMachineReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		NewLibvirtClient:  libvirtConnections.Client,
+		CredentialsSecret: libvirtCredentialsSecret,
+		Recorder:          mgr.GetEventRecorderFor("libvirtmachine-controller"),
+		WatchFilterValue:  watchFilterValue,
+		DomainEvents:      libvirtConnections.DomainEvents(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LibvirtMachine")
 		os.Exit(1)
 	}
+	if err := (&controller.LibvirtImageReconciler{
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		NewLibvirtClient:  libvirtConnections.Client,
+		CredentialsSecret: libvirtCredentialsSecret,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "LibvirtImage")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
-	// Require the LIBVIRT_URI environment variable to be set
-	if os.Getenv("LIBVIRT_URI") == "" {
-		setupLog.Info("missing required env LIBVIRT_URI")
+	// Without the LIBVIRT_URI environment variable, every LibvirtCluster must set its own spec.uri
+	if libvirtclient.DefaultURI() == "" {
+		setupLog.Info("env LIBVIRT_URI is not set; LibvirtClusters without spec.uri can not be reconciled")
 		setupLog.Info("recommended value if using the default libvirt network: \"qemu+tcp://192.168.122.1/system\"")
-		os.Exit(1)
 	}
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
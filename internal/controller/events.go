@@ -0,0 +1,51 @@
+package controller
+
+// Reasons of the Kubernetes Events recorded for LibvirtMachines and LibvirtClusters, so that `kubectl describe` shows
+// what happened to them without access to the logs of the manager.
+const (
+	// eventReasonVirtualMachineCreated is recorded (Normal) when the virtual machine of a LibvirtMachine is created.
+	eventReasonVirtualMachineCreated = "VirtualMachineCreated"
+
+	// eventReasonVirtualMachineDrifted is recorded (Normal) when the virtual machine of a LibvirtMachine is destroyed
+	// to be recreated because it no longer matches the LibvirtMachine.
+	eventReasonVirtualMachineDrifted = "VirtualMachineDrifted"
+
+	// eventReasonVirtualMachineEmulated is recorded (Warning) when the virtual machine of a LibvirtMachine which allows
+	// emulation is created on a libvirt host without KVM for its architecture.
+	eventReasonVirtualMachineEmulated = "VirtualMachineEmulated"
+
+	// eventReasonVirtualMachineUpdated is recorded (Normal) when the vCPUs, memory or disk of the virtual machine of a
+	// LibvirtMachine are changed.
+	eventReasonVirtualMachineUpdated = "VirtualMachineUpdated"
+
+	// eventReasonVirtualMachineRestarted is recorded (Normal) when the virtual machine of a LibvirtMachine is restarted to
+	// apply its vCPUs and memory.
+	eventReasonVirtualMachineRestarted = "VirtualMachineRestarted"
+
+	// eventReasonVirtualMachineDeleted is recorded (Normal) when the virtual machine of a deleted LibvirtMachine is
+	// destroyed.
+	eventReasonVirtualMachineDeleted = "VirtualMachineDeleted"
+
+	// eventReasonWaitingForBootstrapData is recorded (Normal) when the creation of a virtual machine starts waiting for
+	// the bootstrap data of its Machine.
+	eventReasonWaitingForBootstrapData = "WaitingForBootstrapData"
+
+	// eventReasonAddressesAcquired is recorded (Normal) when the IP addresses of a virtual machine change, e.g. once it
+	// acquired its first IP address.
+	eventReasonAddressesAcquired = "AddressesAcquired"
+
+	// eventReasonLibvirtError is recorded (Warning) when a libvirt host can not be connected to or a libvirt operation
+	// fails.
+	eventReasonLibvirtError = "LibvirtError"
+
+	// eventReasonFinalizerRemoved is recorded (Normal) when the finalizer is removed from a deleted LibvirtMachine or
+	// LibvirtCluster.
+	eventReasonFinalizerRemoved = "FinalizerRemoved"
+
+	// eventReasonProvisioned is recorded (Normal) when a LibvirtCluster is provisioned.
+	eventReasonProvisioned = "Provisioned"
+
+	// eventReasonLibvirtHostsNotReady is recorded (Warning) when a libvirt host of a LibvirtCluster is not reachable or
+	// lacks its networks or storage pools.
+	eventReasonLibvirtHostsNotReady = "LibvirtHostsNotReady"
+)
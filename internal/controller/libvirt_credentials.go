@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient"
+)
+
+// Keys of a libvirt credentials Secret. The TLS keys match those of a kubernetes.io/tls Secret (e.g. as issued by
+// cert-manager), the SASL keys those of a kubernetes.io/basic-auth Secret and the SSH private key that of a
+// kubernetes.io/ssh-auth Secret, so that such Secrets can be referenced directly.
+const (
+	// LibvirtCredentialsCACertificateKey is the PEM-encoded CA certificate used to verify the libvirt server (qemu+tls).
+	LibvirtCredentialsCACertificateKey = "ca.crt"
+	// LibvirtCredentialsClientCertificateKey is the PEM-encoded client certificate (qemu+tls).
+	LibvirtCredentialsClientCertificateKey = corev1.TLSCertKey
+	// LibvirtCredentialsClientKeyKey is the PEM-encoded client private key (qemu+tls).
+	LibvirtCredentialsClientKeyKey = corev1.TLSPrivateKeyKey
+	// LibvirtCredentialsUsernameKey is the SASL username.
+	LibvirtCredentialsUsernameKey = corev1.BasicAuthUsernameKey
+	// LibvirtCredentialsPasswordKey is the SASL password.
+	LibvirtCredentialsPasswordKey = corev1.BasicAuthPasswordKey
+	// LibvirtCredentialsSSHPrivateKeyKey is the PEM-encoded SSH private key (qemu+ssh).
+	LibvirtCredentialsSSHPrivateKeyKey = corev1.SSHAuthPrivateKey
+	// LibvirtCredentialsSSHKnownHostsKey is the OpenSSH known_hosts file with the host keys of the libvirt hosts
+	// (qemu+ssh).
+	LibvirtCredentialsSSHKnownHostsKey = "known_hosts"
+)
+
+// errCredentialsUnavailable is returned (wrapped) by getLibvirtCredentials if the credentials Secret can not be read.
+var errCredentialsUnavailable = errors.New("libvirt credentials unavailable")
+
+// getLibvirtCredentials fetches the libvirt credentials from the referenced Secret. The Secret is read on every call
+// so that rotated credentials are picked up without restarting the manager.
+func getLibvirtCredentials(ctx context.Context, c client.Client, secretRef types.NamespacedName) (*libvirtclient.Credentials, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, secretRef, secret); err != nil {
+		return nil, fmt.Errorf("%w: failed to retrieve libvirt credentials Secret %s: %w", errCredentialsUnavailable, secretRef, err)
+	}
+
+	return &libvirtclient.Credentials{
+		CACertificate:     secret.Data[LibvirtCredentialsCACertificateKey],
+		ClientCertificate: secret.Data[LibvirtCredentialsClientCertificateKey],
+		ClientKey:         secret.Data[LibvirtCredentialsClientKeyKey],
+		Username:          string(secret.Data[LibvirtCredentialsUsernameKey]),
+		Password:          string(secret.Data[LibvirtCredentialsPasswordKey]),
+		SSHPrivateKey:     secret.Data[LibvirtCredentialsSSHPrivateKeyKey],
+		SSHKnownHosts:     secret.Data[LibvirtCredentialsSSHKnownHostsKey],
+		Owner:             secretRef.String(),
+	}, nil
+}
@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	"sigs.k8s.io/cluster-api/util"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/joshuagrisham/cluster-api-provider-libvirt/api/v1beta2"
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient"
+)
+
+// libvirtHost is a libvirt host on which LibvirtMachines can be placed.
+type libvirtHost struct {
+	name              string // empty unless the host is one of the LibvirtCluster's hosts
+	uri               string
+	credentialsSecret *types.NamespacedName
+	weight            int32
+	labels            map[string]string
+}
+
+// status returns the LibvirtMachineHost recorded for LibvirtMachines placed on the host.
+func (h *libvirtHost) status() *infrav1.LibvirtMachineHost {
+	status := &infrav1.LibvirtMachineHost{Name: h.name, URI: h.uri}
+	if h.credentialsSecret != nil {
+		status.CredentialsSecretRef = &corev1.SecretReference{Namespace: h.credentialsSecret.Namespace, Name: h.credentialsSecret.Name}
+	}
+	return status
+}
+
+// recordedLibvirtHost returns the libvirt host recorded in the status of the LibvirtMachine, independent of the hosts
+// of its LibvirtCluster, or nil if no host is recorded.
+func recordedLibvirtHost(libvirtMachine *infrav1.LibvirtMachine) *libvirtHost {
+	recorded := libvirtMachine.Status.Host
+	if recorded == nil {
+		return nil
+	}
+	host := &libvirtHost{name: recorded.Name, uri: recorded.URI}
+	if ref := recorded.CredentialsSecretRef; ref != nil {
+		host.credentialsSecret = &types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+		if host.credentialsSecret.Namespace == "" {
+			host.credentialsSecret.Namespace = libvirtMachine.Namespace
+		}
+	}
+	return host
+}
+
+// String returns the name of the host, or its URI if it has no name.
+func (h *libvirtHost) String() string {
+	if h.name != "" {
+		return h.name
+	}
+	return h.uri
+}
+
+// newLibvirtClient returns a LibvirtClient for the libvirt host from the factory, using the credentials from the
+// host's Secret (if any).
+func newLibvirtClient(ctx context.Context, c client.Client, factory libvirtclient.LibvirtClientFactory, host *libvirtHost) (libvirtclient.LibvirtClient, error) {
+	var credentials *libvirtclient.Credentials
+	if host.credentialsSecret != nil {
+		var err error
+		credentials, err = getLibvirtCredentials(ctx, c, *host.credentialsSecret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	libvirtClient, err := factory(host.uri, credentials)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get libvirt client")
+	}
+	return libvirtClient, nil
+}
+
+// getLibvirtHosts returns the libvirt hosts of the LibvirtCluster: its hosts if specified, else its uri, else the
+// default libvirt host of the manager (also if libvirtCluster is nil).
+func (r *LibvirtMachineReconciler) getLibvirtHosts(libvirtCluster *infrav1.LibvirtCluster) []*libvirtHost {
+	return getLibvirtHosts(libvirtCluster, r.CredentialsSecret)
+}
+
+// getLibvirtHosts returns the libvirt hosts of the LibvirtCluster, using the default libvirt host of the manager with
+// the given credentials Secret if the LibvirtCluster specifies neither hosts nor a uri.
+func getLibvirtHosts(libvirtCluster *infrav1.LibvirtCluster, credentialsSecret *types.NamespacedName) []*libvirtHost {
+	if libvirtCluster == nil || (len(libvirtCluster.Spec.Hosts) == 0 && libvirtCluster.Spec.URI == "") {
+		return []*libvirtHost{{uri: libvirtclient.DefaultURI(), credentialsSecret: credentialsSecret, weight: 1}}
+	}
+
+	secretRef := func(ref *corev1.LocalObjectReference) *types.NamespacedName {
+		if ref == nil {
+			return nil
+		}
+		return &types.NamespacedName{Namespace: libvirtCluster.Namespace, Name: ref.Name}
+	}
+
+	if len(libvirtCluster.Spec.Hosts) == 0 {
+		return []*libvirtHost{{
+			uri:               libvirtCluster.Spec.URI,
+			credentialsSecret: secretRef(libvirtCluster.Spec.CredentialsSecretRef),
+			weight:            1,
+		}}
+	}
+
+	hosts := make([]*libvirtHost, 0, len(libvirtCluster.Spec.Hosts))
+	for _, host := range libvirtCluster.Spec.Hosts {
+		weight := int32(1)
+		if host.Weight != nil {
+			weight = *host.Weight
+		}
+		hosts = append(hosts, &libvirtHost{
+			name:              host.Name,
+			uri:               host.URI,
+			credentialsSecret: secretRef(host.CredentialsSecretRef),
+			weight:            weight,
+			labels:            host.Labels,
+		})
+	}
+	return hosts
+}
+
+// findLibvirtMachineHost returns the host of the LibvirtMachine among the given hosts: the host recorded in its status
+// or the only host, else nil if the LibvirtMachine has not been placed yet. The host is recorded before the virtual
+// machine is created, so the hosts are not searched for the virtual machine (except for LibvirtMachines provisioned
+// before, see searchLibvirtMachineHost).
+func findLibvirtMachineHost(hosts []*libvirtHost, libvirtMachine *infrav1.LibvirtMachine) (*libvirtHost, error) {
+	if recorded := libvirtMachine.Status.Host; recorded != nil {
+		for _, host := range hosts {
+			if (recorded.Name != "" && host.name == recorded.Name) || (recorded.Name == "" && host.uri == recorded.URI) {
+				return host, nil
+			}
+		}
+		if recorded.Name != "" {
+			return nil, errors.Errorf("libvirt host %q of LibvirtMachine %s/%s is no longer in the hosts of the LibvirtCluster", recorded.Name, libvirtMachine.Namespace, libvirtMachine.Name)
+		}
+		return nil, errors.Errorf("libvirt host %s of LibvirtMachine %s/%s is no longer the host of the LibvirtCluster", recorded.URI, libvirtMachine.Namespace, libvirtMachine.Name)
+	}
+
+	if len(hosts) == 1 {
+		return hosts[0], nil
+	}
+	return nil, nil
+}
+
+// searchLibvirtMachineHost searches the hosts for the virtual machine of a LibvirtMachine which was provisioned before
+// the host of LibvirtMachines was recorded in their status. It returns nil if none of the hosts has the virtual
+// machine, and an error if a host can not be searched, so that the virtual machine is neither created a second time
+// nor forgotten while it may exist on a host.
+func (r *LibvirtMachineReconciler) searchLibvirtMachineHost(ctx context.Context, hosts []*libvirtHost, externalMachine *libvirtclient.LibvirtClientMachine) (*libvirtHost, error) {
+	for _, host := range hosts {
+		libvirtClient, err := r.newLibvirtClient(ctx, host)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to search libvirt host %s for virtual machine '%s'", host, externalMachine.Name)
+		}
+		if libvirtClient.Exists(externalMachine) {
+			return host, nil
+		}
+	}
+	return nil, nil
+}
+
+// placeLibvirtMachine selects the host on which the virtual machine of the LibvirtMachine is created, among the hosts
+// with a weight above 0 whose labels match the hostSelector of the LibvirtMachine and which support its architecture
+// (with KVM, unless the LibvirtMachine allows emulation) and have enough free memory.
+// Hosts are preferred by their weight multiplied by the share of memory and physical CPUs which remain free after
+// placing the virtual machine. Control plane machines are placed on hosts without other control plane machines of
+// the cluster if possible.
+func (r *LibvirtMachineReconciler) placeLibvirtMachine(ctx context.Context, hosts []*libvirtHost, cluster *clusterv1.Cluster, machine *clusterv1.Machine, libvirtMachine *infrav1.LibvirtMachine) (*libvirtHost, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	var controlPlaneHosts map[string]int
+	if util.IsControlPlaneMachine(machine) {
+		var err error
+		if controlPlaneHosts, err = r.getControlPlaneHosts(ctx, cluster, libvirtMachine); err != nil {
+			return nil, err
+		}
+	}
+
+	selector := labels.SelectorFromSet(libvirtMachine.Spec.HostSelector)
+	memory := uint64(libvirtMachine.Spec.Memory) * 1024 * 1024
+	architecture := libvirtclient.DefaultArchitecture
+	if libvirtMachine.Spec.Architecture != "" {
+		architecture = string(libvirtMachine.Spec.Architecture)
+	}
+
+	var (
+		selected      *libvirtHost
+		selectedScore float64
+		selectedCP    int
+		errs          []error
+	)
+	for _, host := range hosts {
+		if host.weight <= 0 || !selector.Matches(labels.Set(host.labels)) {
+			continue
+		}
+
+		libvirtClient, err := r.newLibvirtClient(ctx, host)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to connect to libvirt host %s", host))
+			continue
+		}
+		info, err := libvirtClient.GetHostInfo()
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to get capacity of libvirt host %s", host))
+			continue
+		}
+		if !slices.Contains(info.Architectures, architecture) {
+			log.V(4).Info(fmt.Sprintf("libvirt host %s does not support the architecture %s of LibvirtMachine %s/%s", host, architecture, libvirtMachine.Namespace, libvirtMachine.Name))
+			continue
+		}
+		if slices.Contains(info.Emulated, architecture) && !libvirtMachine.Spec.AllowEmulation {
+			log.V(4).Info(fmt.Sprintf("libvirt host %s only supports the architecture %s of LibvirtMachine %s/%s with emulation, which is not allowed", host, architecture, libvirtMachine.Namespace, libvirtMachine.Name))
+			continue
+		}
+		if info.FreeMemory < memory || info.Memory == 0 || info.CPUs == 0 {
+			log.V(4).Info(fmt.Sprintf("libvirt host %s does not have enough free memory for LibvirtMachine %s/%s", host, libvirtMachine.Namespace, libvirtMachine.Name))
+			continue
+		}
+
+		freeMemory := float64(info.FreeMemory-memory) / float64(info.Memory)
+		// vCPUs may be overcommitted, so the share of free CPUs is at least 0
+		freeCPUs := max(0, (float64(info.CPUs)-float64(info.AllocatedCPUs)-float64(libvirtMachine.Spec.CPU))/float64(info.CPUs))
+		score := float64(host.weight) * (freeMemory + freeCPUs) / 2
+		controlPlanes := controlPlaneHosts[host.name]
+
+		if selected == nil || controlPlanes < selectedCP || (controlPlanes == selectedCP && score > selectedScore) {
+			selected, selectedScore, selectedCP = host, score, controlPlanes
+		}
+	}
+
+	if selected == nil {
+		err := errors.Errorf("no libvirt host matching the hostSelector %v supports the architecture %s and has enough free memory for LibvirtMachine %s/%s", libvirtMachine.Spec.HostSelector, architecture, libvirtMachine.Namespace, libvirtMachine.Name)
+		if len(errs) > 0 {
+			err = errors.Wrap(kerrors.NewAggregate(errs), err.Error())
+		}
+		return nil, err
+	}
+	for _, err := range errs {
+		log.Info(fmt.Sprintf("skipped libvirt host for placement: %v", err))
+	}
+
+	log.Info(fmt.Sprintf("placing LibvirtMachine %s/%s on libvirt host %s", libvirtMachine.Namespace, libvirtMachine.Name, selected))
+	return selected, nil
+}
+
+// getControlPlaneHosts returns the number of control plane machines of the cluster (other than the LibvirtMachine)
+// per host name.
+func (r *LibvirtMachineReconciler) getControlPlaneHosts(ctx context.Context, cluster *clusterv1.Cluster, libvirtMachine *infrav1.LibvirtMachine) (map[string]int, error) {
+	machines := &clusterv1.MachineList{}
+	if err := r.List(ctx, machines,
+		client.InNamespace(cluster.Namespace),
+		client.MatchingLabels{clusterv1.ClusterNameLabel: cluster.Name},
+		client.HasLabels{clusterv1.MachineControlPlaneLabel},
+	); err != nil {
+		return nil, errors.Wrap(err, "failed to list control plane machines")
+	}
+
+	hosts := map[string]int{}
+	for _, machine := range machines.Items {
+		if machine.Spec.InfrastructureRef.Name == libvirtMachine.Name {
+			continue
+		}
+		other := &infrav1.LibvirtMachine{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: machine.Namespace, Name: machine.Spec.InfrastructureRef.Name}, other); err != nil {
+			if client.IgnoreNotFound(err) == nil {
+				continue
+			}
+			return nil, errors.Wrapf(err, "failed to get LibvirtMachine of control plane machine %s", machine.Name)
+		}
+		if other.Status.Host != nil {
+			hosts[other.Status.Host.Name]++
+		}
+	}
+	return hosts, nil
+}
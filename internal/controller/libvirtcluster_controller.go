@@ -3,15 +3,25 @@ package controller
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 
 	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	clog "sigs.k8s.io/cluster-api/util/log"
 	"sigs.k8s.io/cluster-api/util/patch"
 
@@ -21,18 +31,30 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	infrav1 "github.com/joshuagrisham/cluster-api-provider-libvirt/api/v1beta2"
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient"
 )
 
 // LibvirtClusterReconciler reconciles a LibvirtCluster object
 type LibvirtClusterReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// NewLibvirtClient returns the LibvirtClient used to check the libvirt hosts (e.g. libvirtclient.ConnectionManager.Client)
+	NewLibvirtClient libvirtclient.LibvirtClientFactory
+
+	// CredentialsSecret optionally references a Secret with the credentials used to connect to libvirt
+	CredentialsSecret *types.NamespacedName
+
+	// Recorder records Kubernetes Events for LibvirtClusters
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=libvirtclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=libvirtclusters/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=libvirtclusters/finalizers,verbs=update
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets;,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -59,7 +81,7 @@ func (r *LibvirtClusterReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 
 	// Always patch at the end
 	defer func() {
-		if err := patchHelper.Patch(ctx, libvirtCluster); err != nil {
+		if err := patchLibvirtCluster(ctx, patchHelper, libvirtCluster); err != nil {
 			log.Error(err, fmt.Sprintf("failed to patch LibvirtCluster %s/%s", libvirtCluster.Namespace, libvirtCluster.Name))
 			if rerr == nil {
 				rerr = err
@@ -99,28 +121,196 @@ func (r *LibvirtClusterReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	// Handle deleted instances
 	if !libvirtCluster.DeletionTimestamp.IsZero() {
 		log.Info(fmt.Sprintf("deleting LibvirtCluster %s/%s", libvirtCluster.Namespace, libvirtCluster.Name))
-		controllerutil.RemoveFinalizer(libvirtCluster, infrav1.MachineFinalizer)
+		if controllerutil.RemoveFinalizer(libvirtCluster, infrav1.MachineFinalizer) {
+			r.Recorder.Event(libvirtCluster, corev1.EventTypeNormal, eventReasonFinalizerRemoved, "Removed the finalizer")
+		}
 		return reconcile.Result{}, nil
 	}
 
-	// Mark the LibvirtCluster as "provisioned"
+	// Check the libvirt hosts, networks and storage pools before marking the LibvirtCluster as "provisioned". Once
+	// provisioned, the LibvirtCluster stays provisioned but its conditions keep reflecting the state of the hosts.
+	previousConditions := libvirtHostConditions(libvirtCluster)
+	if err := r.checkLibvirtHosts(ctx, libvirtCluster); err != nil {
+		log.Info(fmt.Sprintf("libvirt hosts of LibvirtCluster %s/%s are not ready: %v", libvirtCluster.Namespace, libvirtCluster.Name, err))
+		// Only record an Event when the state of the hosts changes, rather than on every requeue
+		if !slices.Equal(libvirtHostConditions(libvirtCluster), previousConditions) {
+			r.Recorder.Event(libvirtCluster, corev1.EventTypeWarning, eventReasonLibvirtHostsNotReady, err.Error())
+		}
+		return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	if !libvirtCluster.Status.Initialization.Provisioned {
+		libvirtCluster.Status.Ready = true                      // v1beta1
+		libvirtCluster.Status.Initialization.Provisioned = true // v1beta2
+		log.Info(fmt.Sprintf("LibvirtCluster %s/%s is provisioned", libvirtCluster.Namespace, libvirtCluster.Name))
+		r.Recorder.Event(libvirtCluster, corev1.EventTypeNormal, eventReasonProvisioned, "The libvirt hosts, networks and storage pools are ready")
+	}
+
+	// Periodically check the libvirt hosts again so that the conditions reflect their current state
+	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+}
+
+// libvirtHostConditions returns the status, reason and message of the conditions of the LibvirtCluster which reflect
+// the state of its libvirt hosts.
+func libvirtHostConditions(libvirtCluster *infrav1.LibvirtCluster) []string {
+	var states []string
+	for _, conditionType := range []string{
+		infrav1.LibvirtClusterLibvirtReachableCondition,
+		infrav1.LibvirtClusterNetworkReadyCondition,
+		infrav1.LibvirtClusterStoragePoolReadyCondition,
+	} {
+		if condition := conditions.Get(libvirtCluster, conditionType); condition != nil {
+			states = append(states, fmt.Sprintf("%s/%s/%s/%s", conditionType, condition.Status, condition.Reason, condition.Message))
+		}
+	}
+	return states
+}
+
+// patchLibvirtCluster sets the Ready condition of the LibvirtCluster from its other conditions and patches it.
+func patchLibvirtCluster(ctx context.Context, patchHelper *patch.Helper, libvirtCluster *infrav1.LibvirtCluster) error {
+	if err := conditions.SetSummaryCondition(libvirtCluster, libvirtCluster, infrav1.LibvirtClusterReadyCondition,
+		conditions.ForConditionTypes{
+			infrav1.LibvirtClusterLibvirtReachableCondition,
+			infrav1.LibvirtClusterNetworkReadyCondition,
+			infrav1.LibvirtClusterStoragePoolReadyCondition,
+		},
+		conditions.CustomMergeStrategy{
+			MergeStrategy: conditions.DefaultMergeStrategy(
+				conditions.ComputeReasonFunc(conditions.GetDefaultComputeMergeReasonFunc(
+					infrav1.LibvirtClusterNotReadyReason,
+					infrav1.LibvirtClusterReadyUnknownReason,
+					infrav1.LibvirtClusterReadyReason,
+				)),
+			),
+		},
+	); err != nil {
+		return errors.Wrapf(err, "failed to set the %s condition", infrav1.LibvirtClusterReadyCondition)
+	}
+
+	return patchHelper.Patch(ctx, libvirtCluster, patch.WithOwnedConditions{Conditions: []string{
+		infrav1.LibvirtClusterReadyCondition,
+		infrav1.LibvirtClusterLibvirtReachableCondition,
+		infrav1.LibvirtClusterNetworkReadyCondition,
+		infrav1.LibvirtClusterStoragePoolReadyCondition,
+	}})
+}
+
+// libvirtHostsCheck collects the issues found for one condition of a LibvirtCluster across its libvirt hosts.
+type libvirtHostsCheck struct {
+	status   metav1.ConditionStatus
+	reason   string
+	messages []string
+}
+
+// newLibvirtHostsCheck returns a check which passes with the given reason unless an issue is added.
+func newLibvirtHostsCheck(reason string) *libvirtHostsCheck {
+	return &libvirtHostsCheck{status: metav1.ConditionTrue, reason: reason}
+}
+
+// add records an issue. The status and reason are taken from the first issue, but issues which are known to fail
+// (False) take precedence over issues where the state could not be determined (Unknown).
+func (c *libvirtHostsCheck) add(status metav1.ConditionStatus, reason string, message string) {
+	if c.status == metav1.ConditionTrue || (c.status == metav1.ConditionUnknown && status == metav1.ConditionFalse) {
+		c.status, c.reason = status, reason
+	}
+	c.messages = append(c.messages, message)
+}
+
+// set sets the condition of the given type of the LibvirtCluster from the check.
+func (c *libvirtHostsCheck) set(libvirtCluster *infrav1.LibvirtCluster, conditionType string) {
+	conditions.Set(libvirtCluster, metav1.Condition{
+		Type:    conditionType,
+		Status:  c.status,
+		Reason:  c.reason,
+		Message: strings.Join(c.messages, "; "),
+	})
+}
+
+// checkLibvirtHosts checks that all libvirt hosts of the LibvirtCluster are reachable and that its networks and
+// storage pools exist and are active on each of them, and sets the LibvirtReachable, NetworkReady and
+// StoragePoolReady conditions accordingly. It returns the issues found, or nil if all checks passed.
+func (r *LibvirtClusterReconciler) checkLibvirtHosts(ctx context.Context, libvirtCluster *infrav1.LibvirtCluster) error {
+	networks := libvirtCluster.Spec.Networks
+	if len(networks) == 0 {
+		networks = []string{"default"}
+	}
+	storagePools := libvirtCluster.Spec.StoragePools
+	if len(storagePools) == 0 {
+		storagePools = []string{"default"}
+	}
+
+	reachable := newLibvirtHostsCheck(infrav1.LibvirtClusterLibvirtReachableReason)
+	networkReady := newLibvirtHostsCheck(infrav1.LibvirtClusterNetworkReadyReason)
+	storagePoolReady := newLibvirtHostsCheck(infrav1.LibvirtClusterStoragePoolReadyReason)
+	var errs []error
 
-	// TODO: Should we do potentially do any of the following first?
-	// - Validate network exists (or create if not?)
-	// - Validate storage pool exists (or create if not?)
-	// - Set up some kind of load balancer VM e.g. HAProxy (if we want to provision a separate load balancer VM for the control plane endpoint?)
+	// fail records an issue of a network or storage pool on a libvirt host
+	fail := func(check *libvirtHostsCheck, status metav1.ConditionStatus, reason string, message string) {
+		check.add(status, reason, message)
+		errs = append(errs, errors.New(message))
+	}
 
-	libvirtCluster.Status.Ready = true                      // v1beta1
-	libvirtCluster.Status.Initialization.Provisioned = true // v1beta2
-	log.Info(fmt.Sprintf("LibvirtCluster %s/%s is provisioned", libvirtCluster.Namespace, libvirtCluster.Name))
+	for _, host := range getLibvirtHosts(libvirtCluster, r.CredentialsSecret) {
+		libvirtClient, err := newLibvirtClient(ctx, r.Client, r.NewLibvirtClient, host)
+		if err != nil {
+			reason := infrav1.LibvirtClusterLibvirtUnreachableReason
+			switch {
+			case errors.Is(err, errCredentialsUnavailable):
+				reason = infrav1.LibvirtClusterLibvirtCredentialsUnavailableReason
+			case errors.Is(err, libvirtclient.ErrAuthenticationFailed):
+				reason = infrav1.LibvirtClusterLibvirtAuthenticationFailedReason
+			}
+			reachable.add(metav1.ConditionFalse, reason, fmt.Sprintf("libvirt host %s: %v", host, err))
+			errs = append(errs, errors.Wrapf(err, "failed to connect to libvirt host %s", host))
+			message := fmt.Sprintf("libvirt host %s is not reachable", host)
+			networkReady.add(metav1.ConditionUnknown, infrav1.LibvirtClusterNetworkLibvirtUnreachableReason, message)
+			storagePoolReady.add(metav1.ConditionUnknown, infrav1.LibvirtClusterStoragePoolLibvirtUnreachableReason, message)
+			continue
+		}
 
-	// TODO: Per the Cluster API contract, we SHOULD also set Conditions here as well.
+		for _, name := range networks {
+			network, err := libvirtClient.GetNetwork(name)
+			switch {
+			case errors.Is(err, libvirtclient.ErrNotFound):
+				fail(networkReady, metav1.ConditionFalse, infrav1.LibvirtClusterNetworkNotFoundReason,
+					fmt.Sprintf("network %s does not exist on libvirt host %s", name, host))
+			case err != nil:
+				fail(networkReady, metav1.ConditionUnknown, infrav1.LibvirtClusterNetworkLibvirtUnreachableReason,
+					fmt.Sprintf("failed to get network %s on libvirt host %s: %v", name, host, err))
+			case !network.Active:
+				fail(networkReady, metav1.ConditionFalse, infrav1.LibvirtClusterNetworkNotActiveReason,
+					fmt.Sprintf("network %s is not active on libvirt host %s", name, host))
+			}
+		}
 
-	return reconcile.Result{}, nil
+		for _, name := range storagePools {
+			pool, err := libvirtClient.GetStoragePool(name)
+			switch {
+			case errors.Is(err, libvirtclient.ErrNotFound):
+				fail(storagePoolReady, metav1.ConditionFalse, infrav1.LibvirtClusterStoragePoolNotFoundReason,
+					fmt.Sprintf("storage pool %s does not exist on libvirt host %s", name, host))
+			case err != nil:
+				fail(storagePoolReady, metav1.ConditionUnknown, infrav1.LibvirtClusterStoragePoolLibvirtUnreachableReason,
+					fmt.Sprintf("failed to get storage pool %s on libvirt host %s: %v", name, host, err))
+			case !pool.Active:
+				fail(storagePoolReady, metav1.ConditionFalse, infrav1.LibvirtClusterStoragePoolNotActiveReason,
+					fmt.Sprintf("storage pool %s is not active on libvirt host %s", name, host))
+			}
+		}
+	}
+
+	reachable.set(libvirtCluster, infrav1.LibvirtClusterLibvirtReachableCondition)
+	networkReady.set(libvirtCluster, infrav1.LibvirtClusterNetworkReadyCondition)
+	storagePoolReady.set(libvirtCluster, infrav1.LibvirtClusterStoragePoolReadyCondition)
+
+	return kerrors.NewAggregate(errs)
 }
 
 // SetupWithManager sets up the controller with the Manager
 func (r *LibvirtClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.NewLibvirtClient == nil {
+		return errors.New("LibvirtClusterReconciler requires NewLibvirtClient to be set")
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrav1.LibvirtCluster{}).
 		Named("libvirtcluster").
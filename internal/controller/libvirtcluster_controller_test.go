@@ -2,16 +2,25 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	infrav1 "github.com/joshuagrisham/cluster-api-provider-libvirt/api/v1beta2"
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient"
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient/fake"
 )
 
 var _ = Describe("LibvirtCluster Controller", func() {
@@ -65,4 +74,167 @@ var _ = Describe("LibvirtCluster Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When reconciling a LibvirtCluster owned by a Cluster", func() {
+		const (
+			namespace   = "default"
+			clusterName = "test-libvirtcluster"
+		)
+
+		ctx := context.Background()
+
+		clusterKey := types.NamespacedName{Name: clusterName, Namespace: namespace}
+
+		var (
+			libvirt    *fake.LibvirtClient
+			recorder   *record.FakeRecorder
+			reconciler *LibvirtClusterReconciler
+		)
+
+		// recordedEvents returns the Events recorded since the last call as "<type> <reason> <message>"
+		recordedEvents := func() []string {
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			return events
+		}
+
+		getLibvirtCluster := func() *infrav1.LibvirtCluster {
+			libvirtCluster := &infrav1.LibvirtCluster{}
+			Expect(k8sClient.Get(ctx, clusterKey, libvirtCluster)).To(Succeed())
+			return libvirtCluster
+		}
+
+		reconcileCluster := func() reconcile.Result {
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: clusterKey})
+			Expect(err).NotTo(HaveOccurred())
+			return result
+		}
+
+		BeforeEach(func() {
+			libvirt = fake.NewLibvirtClient().AddStoragePool("default").AddNetwork("default")
+			recorder = record.NewFakeRecorder(100)
+			reconciler = &LibvirtClusterReconciler{
+				Client:           k8sClient,
+				Scheme:           k8sClient.Scheme(),
+				NewLibvirtClient: libvirt.Factory(),
+				Recorder:         recorder,
+			}
+
+			By("creating a Cluster and its LibvirtCluster")
+			cluster := &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: namespace},
+				Spec: clusterv1.ClusterSpec{
+					InfrastructureRef: clusterv1.ContractVersionedObjectReference{
+						APIGroup: infrav1.GroupVersion.Group,
+						Kind:     "LibvirtCluster",
+						Name:     clusterName,
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+			Expect(k8sClient.Create(ctx, &infrav1.LibvirtCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      clusterName,
+					Namespace: namespace,
+					OwnerReferences: []metav1.OwnerReference{{
+						APIVersion: clusterv1.GroupVersion.String(),
+						Kind:       "Cluster",
+						Name:       cluster.Name,
+						UID:        cluster.UID,
+					}},
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			libvirtCluster := &infrav1.LibvirtCluster{}
+			if err := k8sClient.Get(ctx, clusterKey, libvirtCluster); err == nil {
+				controllerutil.RemoveFinalizer(libvirtCluster, infrav1.MachineFinalizer)
+				Expect(k8sClient.Update(ctx, libvirtCluster)).To(Succeed())
+				Expect(k8sClient.Delete(ctx, libvirtCluster)).To(Succeed())
+			}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: namespace},
+			}))).To(Succeed())
+		})
+
+		It("should provision the LibvirtCluster once the libvirt host, network and storage pool are ready", func() {
+			result := reconcileCluster()
+			Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
+
+			libvirtCluster := getLibvirtCluster()
+			Expect(libvirtCluster.Status.Initialization.Provisioned).To(BeTrue())
+			Expect(libvirtCluster.Status.Ready).To(BeTrue())
+			for _, conditionType := range []string{
+				infrav1.LibvirtClusterReadyCondition,
+				infrav1.LibvirtClusterLibvirtReachableCondition,
+				infrav1.LibvirtClusterNetworkReadyCondition,
+				infrav1.LibvirtClusterStoragePoolReadyCondition,
+			} {
+				Expect(conditions.IsTrue(libvirtCluster, conditionType)).To(BeTrue(), conditionType)
+			}
+			Expect(recordedEvents()).To(ConsistOf(HavePrefix("Normal Provisioned")))
+
+			By("recording the Event only when it is provisioned")
+			reconcileCluster()
+			Expect(recordedEvents()).To(BeEmpty())
+		})
+
+		It("should not provision the LibvirtCluster while its network or storage pool is missing", func() {
+			By("referencing a network and storage pool which do not exist")
+			libvirtCluster := getLibvirtCluster()
+			libvirtCluster.Spec.Networks = []string{"default", "missing"}
+			libvirtCluster.Spec.StoragePools = []string{"missing"}
+			Expect(k8sClient.Update(ctx, libvirtCluster)).To(Succeed())
+
+			result := reconcileCluster()
+			Expect(result.RequeueAfter).To(Equal(30 * time.Second))
+
+			libvirtCluster = getLibvirtCluster()
+			Expect(libvirtCluster.Status.Initialization.Provisioned).To(BeFalse())
+			Expect(conditions.IsTrue(libvirtCluster, infrav1.LibvirtClusterLibvirtReachableCondition)).To(BeTrue())
+			network := conditions.Get(libvirtCluster, infrav1.LibvirtClusterNetworkReadyCondition)
+			Expect(network).NotTo(BeNil())
+			Expect(network.Status).To(Equal(metav1.ConditionFalse))
+			Expect(network.Reason).To(Equal(infrav1.LibvirtClusterNetworkNotFoundReason))
+			Expect(network.Message).To(ContainSubstring("network missing does not exist"))
+			Expect(conditions.GetReason(libvirtCluster, infrav1.LibvirtClusterStoragePoolReadyCondition)).To(Equal(infrav1.LibvirtClusterStoragePoolNotFoundReason))
+			Expect(conditions.IsFalse(libvirtCluster, infrav1.LibvirtClusterReadyCondition)).To(BeTrue())
+			Expect(recordedEvents()).To(ConsistOf(And(HavePrefix("Warning LibvirtHostsNotReady"), ContainSubstring("network missing does not exist"))))
+
+			By("not recording the Event again while the hosts stay the same")
+			reconcileCluster()
+			Expect(recordedEvents()).To(BeEmpty())
+
+			By("creating the missing network and storage pool")
+			libvirt.AddNetwork("missing").AddStoragePool("missing")
+			reconcileCluster()
+
+			libvirtCluster = getLibvirtCluster()
+			Expect(libvirtCluster.Status.Initialization.Provisioned).To(BeTrue())
+			Expect(conditions.IsTrue(libvirtCluster, infrav1.LibvirtClusterReadyCondition)).To(BeTrue())
+		})
+
+		It("should report a libvirt host which is not reachable", func() {
+			reconciler.NewLibvirtClient = func(uri string, credentials *libvirtclient.Credentials) (libvirtclient.LibvirtClient, error) {
+				return nil, fmt.Errorf("failed to connect to libvirt at %s: connection refused", uri)
+			}
+
+			result := reconcileCluster()
+			Expect(result.RequeueAfter).To(Equal(30 * time.Second))
+
+			libvirtCluster := getLibvirtCluster()
+			Expect(libvirtCluster.Status.Initialization.Provisioned).To(BeFalse())
+			reachable := conditions.Get(libvirtCluster, infrav1.LibvirtClusterLibvirtReachableCondition)
+			Expect(reachable).NotTo(BeNil())
+			Expect(reachable.Status).To(Equal(metav1.ConditionFalse))
+			Expect(reachable.Reason).To(Equal(infrav1.LibvirtClusterLibvirtUnreachableReason))
+			Expect(reachable.Message).To(ContainSubstring("connection refused"))
+			Expect(conditions.IsUnknown(libvirtCluster, infrav1.LibvirtClusterNetworkReadyCondition)).To(BeTrue())
+			Expect(conditions.GetReason(libvirtCluster, infrav1.LibvirtClusterStoragePoolReadyCondition)).To(Equal(infrav1.LibvirtClusterStoragePoolLibvirtUnreachableReason))
+			Expect(conditions.IsFalse(libvirtCluster, infrav1.LibvirtClusterReadyCondition)).To(BeTrue())
+		})
+	})
 })
@@ -0,0 +1,307 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infrav1 "github.com/joshuagrisham/cluster-api-provider-libvirt/api/v1beta2"
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient"
+)
+
+// LibvirtImageReconciler reconciles a LibvirtImage object
+type LibvirtImageReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// NewLibvirtClient returns the LibvirtClient used to manage images (e.g. libvirtclient.ConnectionManager.Client)
+	NewLibvirtClient libvirtclient.LibvirtClientFactory
+
+	// CredentialsSecret optionally references a Secret with the credentials used to connect to libvirt
+	CredentialsSecret *types.NamespacedName
+}
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=libvirtimages,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=libvirtimages/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=libvirtimages/finalizers,verbs=update
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=libvirtmachines,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets;,verbs=get;list;watch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.22.4/pkg/reconcile
+func (r *LibvirtImageReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, rerr error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	// Fetch the LibvirtImage instance
+	libvirtImage := &infrav1.LibvirtImage{}
+	if err := r.Get(ctx, req.NamespacedName, libvirtImage); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// Initialize patch helper early
+	patchHelper, err := patch.NewHelper(libvirtImage, r.Client)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Always patch at the end
+	defer func() {
+		if err := patchHelper.Patch(ctx, libvirtImage); err != nil {
+			log.Error(err, fmt.Sprintf("failed to patch LibvirtImage %s/%s", libvirtImage.Namespace, libvirtImage.Name))
+			if rerr == nil {
+				rerr = err
+			}
+		}
+	}()
+
+	// Handle deleted instances
+	if !libvirtImage.DeletionTimestamp.IsZero() {
+		return r.deleteLibvirtImage(ctx, libvirtImage)
+	}
+
+	// If the LibvirtImage doesn't have our finalizer, add it
+	controllerutil.AddFinalizer(libvirtImage, infrav1.ImageFinalizer)
+
+	libvirtClient, err := newLibvirtClient(ctx, r.Client, r.NewLibvirtClient, r.getLibvirtHost(libvirtImage))
+	if err != nil {
+		setLibvirtImageNotReady(libvirtImage, infrav1.LibvirtImageConnectionFailedReason, err)
+		return reconcile.Result{}, err
+	}
+
+	image, reason, err := r.getImage(libvirtClient, libvirtImage)
+	if reason == infrav1.LibvirtImageDownloadingReason {
+		// Requeue until the image has been downloaded in the background
+		log.Info(err.Error())
+		setLibvirtImageNotReady(libvirtImage, reason, err)
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+	if err != nil {
+		setLibvirtImageNotReady(libvirtImage, reason, err)
+		return reconcile.Result{}, err
+	}
+
+	if !libvirtImage.Status.Ready {
+		log.Info(fmt.Sprintf("LibvirtImage %s/%s is ready at '%s'", libvirtImage.Namespace, libvirtImage.Name, image.Path))
+	}
+	libvirtImage.Status.Ready = true
+	libvirtImage.Status.Path = image.Path
+	libvirtImage.Status.Format = image.Format
+	libvirtImage.Status.Size = int64(image.Capacity)
+	libvirtImage.Status.Checksum = image.Checksum
+	conditions.Set(libvirtImage, metav1.Condition{
+		Type:   infrav1.LibvirtImageReadyCondition,
+		Status: metav1.ConditionTrue,
+		Reason: infrav1.LibvirtImageReadyReason,
+	})
+
+	// Requeue to check every 5 minutes that the image still exists
+	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *LibvirtImageReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.NewLibvirtClient == nil {
+		return errors.New("LibvirtImageReconciler requires NewLibvirtClient to be set")
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.LibvirtImage{}).
+		// Reconcile images which are being deleted as soon as the LibvirtMachines using them are gone
+		Watches(&infrav1.LibvirtMachine{}, handler.EnqueueRequestsFromMapFunc(libvirtMachineToLibvirtImage)).
+		Named("libvirtimage").
+		Complete(r)
+}
+
+// libvirtMachineToLibvirtImage maps a LibvirtMachine to a reconcile request for the LibvirtImage it references.
+func libvirtMachineToLibvirtImage(_ context.Context, o client.Object) []reconcile.Request {
+	libvirtMachine, ok := o.(*infrav1.LibvirtMachine)
+	if !ok || libvirtMachine.Spec.ImageRef == nil {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: libvirtMachine.Namespace, Name: libvirtMachine.Spec.ImageRef.Name}}}
+}
+
+// getLibvirtHost returns the libvirt host of the LibvirtImage: its uri if specified, else the default libvirt host of
+// the manager.
+func (r *LibvirtImageReconciler) getLibvirtHost(libvirtImage *infrav1.LibvirtImage) *libvirtHost {
+	if libvirtImage.Spec.URI == "" {
+		return &libvirtHost{uri: libvirtclient.DefaultURI(), credentialsSecret: r.CredentialsSecret}
+	}
+	host := &libvirtHost{uri: libvirtImage.Spec.URI}
+	if ref := libvirtImage.Spec.CredentialsSecretRef; ref != nil {
+		host.credentialsSecret = &types.NamespacedName{Namespace: libvirtImage.Namespace, Name: ref.Name}
+	}
+	return host
+}
+
+// getImage returns the image of the LibvirtImage from its source, downloading it into the storage pool if necessary.
+// On error, it also returns the reason for the Ready condition.
+func (r *LibvirtImageReconciler) getImage(libvirtClient libvirtclient.LibvirtClient, libvirtImage *infrav1.LibvirtImage) (*libvirtclient.Image, string, error) {
+	source := libvirtImage.Spec.Source
+	format := ptr.Deref(libvirtImage.Spec.Format, "qcow2")
+
+	var (
+		volume *libvirtclient.StorageVolume
+		err    error
+	)
+	switch {
+	case source.URL != "":
+		// Once downloaded, the checksum of the image in the status avoids downloading it again to find it in the cache
+		checksum := ptr.Deref(source.Checksum, libvirtImage.Status.Checksum)
+		image, err := libvirtClient.DownloadImage(ptr.Deref(libvirtImage.Spec.StoragePool, "default"), source.URL, checksum)
+		if errors.Is(err, libvirtclient.ErrImageDownloadInProgress) {
+			return nil, infrav1.LibvirtImageDownloadingReason, errors.Errorf("downloading image '%s'", source.URL)
+		}
+		if err != nil {
+			return nil, infrav1.LibvirtImageDownloadFailedReason, errors.Wrapf(err, "failed to download image '%s'", source.URL)
+		}
+		if libvirtImage.Spec.Format != nil && image.Format != format {
+			return nil, infrav1.LibvirtImageFormatMismatchReason, errors.Errorf("image '%s' has the format %s, expected %s", source.URL, image.Format, format)
+		}
+		return image, "", nil
+	case source.Volume != nil:
+		volume, err = libvirtClient.GetStorageVolume(source.Volume.Pool, source.Volume.Name)
+	default:
+		volume, err = libvirtClient.GetStorageVolumeByPath(source.Path)
+	}
+	if err != nil {
+		reason := infrav1.LibvirtImageConnectionFailedReason
+		if errors.Is(err, libvirtclient.ErrNotFound) {
+			reason = infrav1.LibvirtImageSourceNotFoundReason
+		}
+		return nil, reason, errors.Wrap(err, "failed to get image")
+	}
+	return &libvirtclient.Image{StorageVolume: *volume, Format: format}, "", nil
+}
+
+// setLibvirtImageNotReady marks the LibvirtImage as not ready with the given reason and error.
+func setLibvirtImageNotReady(libvirtImage *infrav1.LibvirtImage, reason string, err error) {
+	libvirtImage.Status.Ready = false
+	conditions.Set(libvirtImage, metav1.Condition{
+		Type:    infrav1.LibvirtImageReadyCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: err.Error(),
+	})
+}
+
+// setLibvirtImageDeletionBlocked sets the reason of the Ready condition of the LibvirtImage to DeletionBlocked, keeping
+// its status, since the image remains available to the LibvirtMachines and linked clones using it.
+func setLibvirtImageDeletionBlocked(libvirtImage *infrav1.LibvirtImage, message string) {
+	status := metav1.ConditionFalse
+	if libvirtImage.Status.Ready {
+		status = metav1.ConditionTrue
+	}
+	conditions.Set(libvirtImage, metav1.Condition{
+		Type:    infrav1.LibvirtImageReadyCondition,
+		Status:  status,
+		Reason:  infrav1.LibvirtImageDeletionBlockedReason,
+		Message: message,
+	})
+}
+
+// deleteLibvirtImage removes the finalizer of the LibvirtImage once no LibvirtMachines reference it and no linked
+// clones use its image anymore. The storage volume of a downloaded image is deleted as well, unless other
+// LibvirtImages share it.
+func (r *LibvirtImageReconciler) deleteLibvirtImage(ctx context.Context, libvirtImage *infrav1.LibvirtImage) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	// LibvirtMachines which have not been created yet also block the deletion, since they would wait for the image
+	libvirtMachines := &infrav1.LibvirtMachineList{}
+	if err := r.List(ctx, libvirtMachines, client.InNamespace(libvirtImage.Namespace)); err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "failed to list LibvirtMachines")
+	}
+	var users []string
+	for _, libvirtMachine := range libvirtMachines.Items {
+		if libvirtMachine.Spec.ImageRef != nil && libvirtMachine.Spec.ImageRef.Name == libvirtImage.Name {
+			users = append(users, libvirtMachine.Name)
+		}
+	}
+	if len(users) > 0 {
+		log.Info(fmt.Sprintf("waiting for LibvirtMachines %v to be deleted before deleting LibvirtImage %s/%s", users, libvirtImage.Namespace, libvirtImage.Name))
+		setLibvirtImageDeletionBlocked(libvirtImage, fmt.Sprintf("LibvirtImage is used by LibvirtMachines %v", users))
+		return reconcile.Result{}, nil
+	}
+
+	if libvirtImage.Status.Path == "" {
+		// The image was never available, so nothing can use it
+		log.Info(fmt.Sprintf("deleting LibvirtImage %s/%s", libvirtImage.Namespace, libvirtImage.Name))
+		controllerutil.RemoveFinalizer(libvirtImage, infrav1.ImageFinalizer)
+		return reconcile.Result{}, nil
+	}
+
+	libvirtClient, err := newLibvirtClient(ctx, r.Client, r.NewLibvirtClient, r.getLibvirtHost(libvirtImage))
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Volumes outside of Kubernetes (e.g. disks of virtual machines created manually) may use the image as well
+	clones, err := libvirtClient.GetLinkedClones(libvirtImage.Status.Path)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "failed to get linked clones of image '%s'", libvirtImage.Status.Path)
+	}
+	if len(clones) > 0 {
+		log.Info(fmt.Sprintf("waiting for linked clones %v to be deleted before deleting LibvirtImage %s/%s", clones, libvirtImage.Namespace, libvirtImage.Name))
+		setLibvirtImageDeletionBlocked(libvirtImage, fmt.Sprintf("image is used by linked clones %v", clones))
+		return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	// Only downloaded images are managed by the LibvirtImage; volumes and paths are left alone
+	if libvirtImage.Spec.Source.URL != "" {
+		shared, err := r.isImageShared(ctx, libvirtImage)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if !shared {
+			poolName := ptr.Deref(libvirtImage.Spec.StoragePool, "default")
+			name := libvirtclient.ImageVolumeName(libvirtImage.Status.Checksum, libvirtImage.Status.Format)
+			log.Info(fmt.Sprintf("deleting storage volume '%s' of LibvirtImage %s/%s", name, libvirtImage.Namespace, libvirtImage.Name))
+			if err := libvirtClient.DeleteStorageVolume(poolName, name); err != nil && !errors.Is(err, libvirtclient.ErrNotFound) {
+				return reconcile.Result{}, errors.Wrapf(err, "failed to delete storage volume '%s'", name)
+			}
+		}
+	}
+
+	log.Info(fmt.Sprintf("deleting LibvirtImage %s/%s", libvirtImage.Namespace, libvirtImage.Name))
+	controllerutil.RemoveFinalizer(libvirtImage, infrav1.ImageFinalizer)
+	return reconcile.Result{}, nil
+}
+
+// isImageShared returns true if another LibvirtImage (in any namespace) on the same libvirt host uses the image of the
+// LibvirtImage.
+func (r *LibvirtImageReconciler) isImageShared(ctx context.Context, libvirtImage *infrav1.LibvirtImage) (bool, error) {
+	libvirtImages := &infrav1.LibvirtImageList{}
+	if err := r.List(ctx, libvirtImages); err != nil {
+		return false, errors.Wrap(err, "failed to list LibvirtImages")
+	}
+	uri := r.getLibvirtHost(libvirtImage).uri
+	for _, other := range libvirtImages.Items {
+		if other.UID != libvirtImage.UID && other.Status.Path == libvirtImage.Status.Path && r.getLibvirtHost(&other).uri == uri {
+			return true, nil
+		}
+	}
+	return false, nil
+}
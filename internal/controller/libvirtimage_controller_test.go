@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1 "github.com/joshuagrisham/cluster-api-provider-libvirt/api/v1beta2"
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient"
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient/fake"
+)
+
+var _ = Describe("LibvirtImage Controller", func() {
+	const (
+		namespace = "default"
+		imageName = "test-image"
+		imageURL  = "https://cloud-images.example.com/noble-server-cloudimg-amd64.img"
+		checksum  = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	)
+
+	ctx := context.Background()
+
+	imageKey := types.NamespacedName{Name: imageName, Namespace: namespace}
+	imageVolume := libvirtclient.ImageVolumeName(checksum, "qcow2")
+
+	var (
+		libvirt    *fake.LibvirtClient
+		reconciler *LibvirtImageReconciler
+	)
+
+	getLibvirtImage := func() *infrav1.LibvirtImage {
+		libvirtImage := &infrav1.LibvirtImage{}
+		Expect(k8sClient.Get(ctx, imageKey, libvirtImage)).To(Succeed())
+		return libvirtImage
+	}
+
+	reconcileImage := func() (reconcile.Result, error) {
+		return reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: imageKey})
+	}
+
+	createImage := func(name string, source infrav1.LibvirtImageSource) {
+		Expect(k8sClient.Create(ctx, &infrav1.LibvirtImage{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       infrav1.LibvirtImageSpec{Source: source},
+		})).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		libvirt = fake.NewLibvirtClient().AddStoragePool("default").AddNetwork("default")
+		reconciler = &LibvirtImageReconciler{
+			Client:           k8sClient,
+			Scheme:           k8sClient.Scheme(),
+			NewLibvirtClient: libvirt.Factory(),
+		}
+	})
+
+	AfterEach(func() {
+		libvirtImages := &infrav1.LibvirtImageList{}
+		Expect(k8sClient.List(ctx, libvirtImages, client.InNamespace(namespace))).To(Succeed())
+		for _, libvirtImage := range libvirtImages.Items {
+			controllerutil.RemoveFinalizer(&libvirtImage, infrav1.ImageFinalizer)
+			Expect(k8sClient.Update(ctx, &libvirtImage)).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, &libvirtImage))).To(Succeed())
+		}
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, &infrav1.LibvirtMachine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: namespace}}))).To(Succeed())
+	})
+
+	It("should download an image from a URL into the storage pool", func() {
+		createImage(imageName, infrav1.LibvirtImageSource{URL: imageURL, Checksum: ptr.To("sha256:" + checksum)})
+
+		result, err := reconcileImage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
+
+		libvirtImage := getLibvirtImage()
+		Expect(libvirtImage.Finalizers).To(ContainElement(infrav1.ImageFinalizer))
+		Expect(libvirtImage.Status.Ready).To(BeTrue())
+		Expect(libvirtImage.Status.Path).To(Equal("/default/" + imageVolume))
+		Expect(libvirtImage.Status.Format).To(Equal("qcow2"))
+		Expect(libvirtImage.Status.Size).To(BeNumerically(">", 0))
+		Expect(libvirtImage.Status.Checksum).To(Equal(checksum))
+		Expect(conditions.IsTrue(libvirtImage, infrav1.LibvirtImageReadyCondition)).To(BeTrue())
+		Expect(libvirt.Volumes("default")).To(ConsistOf(imageVolume))
+	})
+
+	It("should requeue until the image has been downloaded in the background", func() {
+		createImage(imageName, infrav1.LibvirtImageSource{URL: imageURL})
+
+		libvirt.SetDownloading(imageURL, true)
+		result, err := reconcileImage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(10 * time.Second))
+		libvirtImage := getLibvirtImage()
+		Expect(libvirtImage.Status.Ready).To(BeFalse())
+		Expect(conditions.GetReason(libvirtImage, infrav1.LibvirtImageReadyCondition)).To(Equal(infrav1.LibvirtImageDownloadingReason))
+
+		libvirt.SetDownloading(imageURL, false)
+		_, err = reconcileImage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getLibvirtImage().Status.Ready).To(BeTrue())
+	})
+
+	It("should report a format mismatch of a downloaded image", func() {
+		createImage(imageName, infrav1.LibvirtImageSource{URL: imageURL})
+		libvirtImage := getLibvirtImage()
+		libvirtImage.Spec.Format = ptr.To("raw")
+		Expect(k8sClient.Update(ctx, libvirtImage)).To(Succeed())
+
+		_, err := reconcileImage()
+		Expect(err).To(MatchError(ContainSubstring("has the format qcow2, expected raw")))
+		libvirtImage = getLibvirtImage()
+		Expect(libvirtImage.Status.Ready).To(BeFalse())
+		Expect(conditions.GetReason(libvirtImage, infrav1.LibvirtImageReadyCondition)).To(Equal(infrav1.LibvirtImageFormatMismatchReason))
+	})
+
+	It("should use an existing volume once it exists", func() {
+		createImage(imageName, infrav1.LibvirtImageSource{Volume: &infrav1.LibvirtImageVolume{Pool: "default", Name: "base.qcow2"}})
+
+		_, err := reconcileImage()
+		Expect(err).To(MatchError(libvirtclient.ErrNotFound))
+		libvirtImage := getLibvirtImage()
+		Expect(libvirtImage.Status.Ready).To(BeFalse())
+		Expect(conditions.GetReason(libvirtImage, infrav1.LibvirtImageReadyCondition)).To(Equal(infrav1.LibvirtImageSourceNotFoundReason))
+
+		path := libvirt.AddStorageVolume("default", "base.qcow2", 2*1024*1024*1024)
+		_, err = reconcileImage()
+		Expect(err).NotTo(HaveOccurred())
+		libvirtImage = getLibvirtImage()
+		Expect(libvirtImage.Status.Ready).To(BeTrue())
+		Expect(libvirtImage.Status.Path).To(Equal(path))
+		Expect(libvirtImage.Status.Size).To(Equal(int64(2 * 1024 * 1024 * 1024)))
+		Expect(libvirtImage.Status.Checksum).To(BeEmpty())
+
+		By("keeping the volume when the LibvirtImage is deleted")
+		Expect(k8sClient.Delete(ctx, libvirtImage)).To(Succeed())
+		_, err = reconcileImage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, imageKey, &infrav1.LibvirtImage{}))).To(BeTrue())
+		Expect(libvirt.Volumes("default")).To(ConsistOf("base.qcow2"))
+	})
+
+	It("should use an existing image by its path with the given format", func() {
+		path := libvirt.AddStorageVolume("default", "base.img", 1024)
+		createImage(imageName, infrav1.LibvirtImageSource{Path: path})
+		libvirtImage := getLibvirtImage()
+		libvirtImage.Spec.Format = ptr.To("raw")
+		Expect(k8sClient.Update(ctx, libvirtImage)).To(Succeed())
+
+		_, err := reconcileImage()
+		Expect(err).NotTo(HaveOccurred())
+		libvirtImage = getLibvirtImage()
+		Expect(libvirtImage.Status.Ready).To(BeTrue())
+		Expect(libvirtImage.Status.Path).To(Equal(path))
+		Expect(libvirtImage.Status.Format).To(Equal("raw"))
+	})
+
+	It("should require exactly one immutable source", func() {
+		err := k8sClient.Create(ctx, &infrav1.LibvirtImage{
+			ObjectMeta: metav1.ObjectMeta{Name: imageName, Namespace: namespace},
+			Spec:       infrav1.LibvirtImageSpec{Source: infrav1.LibvirtImageSource{URL: imageURL, Path: "/images/base.qcow2"}},
+		})
+		Expect(err).To(MatchError(ContainSubstring("exactly one of url, volume and path must be specified")))
+
+		createImage(imageName, infrav1.LibvirtImageSource{URL: imageURL})
+		libvirtImage := getLibvirtImage()
+		libvirtImage.Spec.Source.URL = "https://cloud-images.example.com/other.img"
+		Expect(k8sClient.Update(ctx, libvirtImage)).To(MatchError(ContainSubstring("source is immutable")))
+	})
+
+	It("should block the deletion while LibvirtMachines or linked clones use the image", func() {
+		createImage(imageName, infrav1.LibvirtImageSource{URL: imageURL, Checksum: ptr.To(checksum)})
+		_, err := reconcileImage()
+		Expect(err).NotTo(HaveOccurred())
+		path := getLibvirtImage().Status.Path
+
+		libvirtMachine := &infrav1.LibvirtMachine{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: namespace},
+			Spec: infrav1.LibvirtMachineSpec{
+				CPU:      2,
+				Memory:   2048,
+				DiskSize: 20,
+				ImageRef: &corev1.LocalObjectReference{Name: imageName},
+			},
+		}
+		Expect(k8sClient.Create(ctx, libvirtMachine)).To(Succeed())
+		Expect(libvirt.Create(&libvirtclient.LibvirtClientMachine{
+			Name:               "test-machine",
+			NetworkName:        "default",
+			StoragePoolName:    "default",
+			BackingImagePath:   path,
+			BackingImageFormat: "qcow2",
+		})).To(Succeed())
+
+		By("waiting for the LibvirtMachine to be deleted")
+		Expect(k8sClient.Delete(ctx, getLibvirtImage())).To(Succeed())
+		_, err = reconcileImage()
+		Expect(err).NotTo(HaveOccurred())
+		libvirtImage := getLibvirtImage()
+		Expect(libvirtImage.Finalizers).To(ContainElement(infrav1.ImageFinalizer))
+		Expect(conditions.GetReason(libvirtImage, infrav1.LibvirtImageReadyCondition)).To(Equal(infrav1.LibvirtImageDeletionBlockedReason))
+		Expect(conditions.GetMessage(libvirtImage, infrav1.LibvirtImageReadyCondition)).To(ContainSubstring("test-machine"))
+
+		By("waiting for the linked clone to be deleted")
+		Expect(k8sClient.Delete(ctx, libvirtMachine)).To(Succeed())
+		result, err := reconcileImage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(30 * time.Second))
+		Expect(conditions.GetMessage(getLibvirtImage(), infrav1.LibvirtImageReadyCondition)).To(ContainSubstring("linked clones [test-machine.qcow2]"))
+
+		By("deleting the downloaded image")
+		Expect(libvirt.Destroy(&libvirtclient.LibvirtClientMachine{Name: "test-machine", StoragePoolName: "default"})).To(Succeed())
+		_, err = reconcileImage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, imageKey, &infrav1.LibvirtImage{}))).To(BeTrue())
+		Expect(libvirt.Volumes("default")).To(BeEmpty())
+	})
+
+	It("should keep a downloaded image shared with another LibvirtImage", func() {
+		for _, name := range []string{imageName, "other-image"} {
+			createImage(name, infrav1.LibvirtImageSource{URL: imageURL, Checksum: ptr.To(checksum)})
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(k8sClient.Delete(ctx, getLibvirtImage())).To(Succeed())
+		_, err := reconcileImage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, imageKey, &infrav1.LibvirtImage{}))).To(BeTrue())
+		Expect(libvirt.Volumes("default")).To(ConsistOf(imageVolume))
+	})
+})
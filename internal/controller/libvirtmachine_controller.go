@@ -4,43 +4,84 @@ import (
 	"context"
 	"fmt"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 
 	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	clog "sigs.k8s.io/cluster-api/util/log"
 	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
 
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	infrav1 "github.com/joshuagrisham/cluster-api-provider-libvirt/api/v1beta2"
 	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient"
 )
 
+// restartShutdownTimeout is how long a virtual machine which is restarted to apply its vCPUs and memory is given to shut
+// down before it is stopped forcibly.
+const restartShutdownTimeout = 2 * time.Minute
+
+// libvirtMachineNameField is the field by which LibvirtMachines are listed for the lifecycle events of their virtual
+// machines, which are named like them. The API server supports it as a field selector, and the cache of the manager
+// indexes it.
+const libvirtMachineNameField = "metadata.name"
+
 // LibvirtMachineReconciler reconciles a LibvirtMachine object
 type LibvirtMachineReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// NewLibvirtClient returns the LibvirtClient used to manage virtual machines (e.g. libvirtclient.ConnectionManager.Client)
+	NewLibvirtClient libvirtclient.LibvirtClientFactory
+
+	// CredentialsSecret optionally references a Secret with the credentials used to connect to libvirt
+	CredentialsSecret *types.NamespacedName
+
+	// Recorder records Kubernetes Events for LibvirtMachines
+	Recorder record.EventRecorder
+
+	// WatchFilterValue is the label value used to filter the watched objects (see clusterv1.WatchLabel)
+	WatchFilterValue string
+
+	// DomainEvents optionally provides the lifecycle events of the virtual machines (e.g.
+	// libvirtclient.ConnectionManager.DomainEvents), so that LibvirtMachines are reconciled as soon as their virtual
+	// machine is stopped or crashes
+	DomainEvents <-chan libvirtclient.DomainEvent
 }
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=libvirtmachines,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=libvirtmachines/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=libvirtmachines/finalizers,verbs=update
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=libvirtimages,verbs=get;list;watch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;machinesets;machines,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=secrets;,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -76,7 +117,7 @@ func (r *LibvirtMachineReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 
 	// Always patch at the end
 	defer func() {
-		if err := patchHelper.Patch(ctx, libvirtMachine); err != nil {
+		if err := patchLibvirtMachine(ctx, patchHelper, libvirtMachine); err != nil {
 			log.Error(err, fmt.Sprintf("failed to patch LibvirtMachine %s/%s", libvirtMachine.Namespace, libvirtMachine.Name))
 			if rerr == nil {
 				rerr = err
@@ -125,9 +166,10 @@ func (r *LibvirtMachineReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		Name:      cluster.Spec.InfrastructureRef.Name,
 	}
 	if err := r.Get(ctx, libvirtClusterName, libvirtCluster); err != nil {
-		// Handle deletion of orphaned LibvirtMachines in case the LibvirtCluster is already deleted
+		// Handle deletion of orphaned LibvirtMachines in case the LibvirtCluster is already deleted, using the libvirt
+		// host recorded in their status
 		if !libvirtMachine.DeletionTimestamp.IsZero() {
-			return deleteExternalMachine(ctx, libvirtMachine, externalMachine)
+			return r.deleteLibvirtMachine(ctx, nil, libvirtMachine, externalMachine)
 		}
 		log.Info("LibvirtCluster is not available yet")
 		return reconcile.Result{}, nil
@@ -145,7 +187,7 @@ func (r *LibvirtMachineReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 
 	// Handle deleted instances
 	if !libvirtMachine.DeletionTimestamp.IsZero() {
-		return deleteExternalMachine(ctx, libvirtMachine, externalMachine)
+		return r.deleteLibvirtMachine(ctx, libvirtCluster, libvirtMachine, externalMachine)
 	}
 
 	// Do nothing if the Cluster's infrastructureRef is not defined
@@ -157,81 +199,238 @@ func (r *LibvirtMachineReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	// Do nothing if the Cluster is not yet marked as provisioned
 	if cluster.Status.Initialization.InfrastructureProvisioned == nil || *cluster.Status.Initialization.InfrastructureProvisioned != true {
 		log.Info(fmt.Sprintf("Cluster %s/%s is not provisioned yet", cluster.Namespace, cluster.Name))
+		setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition, metav1.ConditionFalse,
+			infrav1.LibvirtMachineWaitingForClusterInfrastructureReason, fmt.Sprintf("Waiting for the infrastructure of Cluster %s to be provisioned", cluster.Name))
 		return reconcile.Result{}, nil
 	}
 
+	// Use the image of the referenced LibvirtImage as the backing image, once it is ready
+	var imageURI string
+	if libvirtMachine.Spec.ImageRef != nil {
+		libvirtImage, err := r.getLibvirtImage(ctx, libvirtMachine)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if libvirtImage == nil {
+			log.Info(fmt.Sprintf("waiting for LibvirtImage %s/%s to become ready", libvirtMachine.Namespace, libvirtMachine.Spec.ImageRef.Name))
+			setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition, metav1.ConditionFalse,
+				infrav1.LibvirtMachineWaitingForLibvirtImageReason, fmt.Sprintf("Waiting for LibvirtImage %s to become ready", libvirtMachine.Spec.ImageRef.Name))
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+		}
+		externalMachine.BackingImagePath = libvirtImage.Status.Path
+		externalMachine.BackingImageFormat = libvirtImage.Status.Format
+		imageURI = libvirtImage.Spec.URI
+		if imageURI == "" {
+			imageURI = libvirtclient.DefaultURI()
+		}
+	}
+
+	// Find the libvirt host of the LibvirtMachine, or place it on one of the LibvirtCluster's hosts
+	hosts := r.getLibvirtHosts(libvirtCluster)
+	host, err := findLibvirtMachineHost(hosts, libvirtMachine)
+	if host == nil && err == nil && libvirtMachine.Spec.ProviderID != "" {
+		// A LibvirtMachine provisioned before its host was recorded may be on any of the hosts
+		host, err = r.searchLibvirtMachineHost(ctx, hosts, externalMachine)
+	}
+	if host == nil && err == nil {
+		// A LibvirtMachine with a LibvirtImage can only be placed on the libvirt host of the image
+		if imageURI != "" {
+			hosts = slices.DeleteFunc(slices.Clone(hosts), func(host *libvirtHost) bool { return host.uri != imageURI })
+		}
+		host, err = r.placeLibvirtMachine(ctx, hosts, cluster, machine, libvirtMachine)
+	}
+	if err != nil {
+		setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition, metav1.ConditionFalse,
+			infrav1.LibvirtMachinePlacementFailedReason, err.Error())
+		return reconcile.Result{}, err
+	}
+	if imageURI != "" && host.uri != imageURI {
+		return reconcile.Result{}, errors.Errorf("libvirt host %s of LibvirtMachine %s/%s is not the libvirt host %s of LibvirtImage %s", host, libvirtMachine.Namespace, libvirtMachine.Name, imageURI, libvirtMachine.Spec.ImageRef.Name)
+	}
+	libvirtMachine.Status.Host = host.status()
+
+	// Get a LibvirtClient for the libvirt host
+	libvirtClient, err := r.getLibvirtClient(ctx, host, libvirtMachine)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
 	// Recreate the machine if it exists but is not reconciled
-	if externalMachine.Exists() && !externalMachine.IsReconciled() {
+	if libvirtClient.Exists(externalMachine) && !libvirtClient.IsReconciled(externalMachine) {
 		log.Info(fmt.Sprintf("destroying out-of-sync virtual machine '%s'", externalMachine.Name))
-		if err := externalMachine.Destroy(); err != nil {
+		setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineDriftDetectedCondition, metav1.ConditionTrue,
+			infrav1.LibvirtMachineDriftedReason, fmt.Sprintf("Virtual machine '%s' does not match the additional disks or network interfaces of the LibvirtMachine and is recreated", externalMachine.Name))
+		if err := libvirtClient.Destroy(externalMachine); err != nil {
+			r.Recorder.Eventf(libvirtMachine, corev1.EventTypeWarning, eventReasonLibvirtError, "Failed to destroy out-of-sync virtual machine '%s': %v", externalMachine.Name, err)
 			return reconcile.Result{}, errors.Wrapf(err, "failed to destroy out-of-sync virtual machine '%s'", externalMachine.Name)
 		}
+		r.Recorder.Eventf(libvirtMachine, corev1.EventTypeNormal, eventReasonVirtualMachineDrifted, "Destroyed virtual machine '%s' to recreate it, as it does not match the additional disks or network interfaces of the LibvirtMachine", externalMachine.Name)
+		setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition, metav1.ConditionFalse,
+			infrav1.LibvirtMachineRecreatingReason, fmt.Sprintf("Virtual machine '%s' was destroyed to be recreated", externalMachine.Name))
+		setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineAddressesAvailableCondition, metav1.ConditionFalse,
+			infrav1.LibvirtMachineWaitingForAddressesReason, "Waiting for the virtual machine to be recreated")
 		libvirtMachine.Spec.ProviderID = ""
 		libvirtMachine.Status.Addresses = nil
+		libvirtMachine.Status.NetworkInterfaces = nil
 		libvirtMachine.Status.Ready = false                      // v1beta1
 		libvirtMachine.Status.Initialization.Provisioned = false // v1beta2
 		return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
 	// Create the machine if it does not yet exist
-	if !externalMachine.Exists() {
+	if !libvirtClient.Exists(externalMachine) {
 
 		// Make sure the bootstrap data secret is available and populated.
+		// The LibvirtMachine is reconciled again when the Machine or the Secret is updated.
 		if machine.Spec.Bootstrap.DataSecretName == nil {
 			log.Info(fmt.Sprintf("waiting for the bootstrap provider controller to set bootstrap data for LibvirtMachine %s/%s", libvirtMachine.Namespace, libvirtMachine.Name))
-			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+			r.setWaitingForBootstrapData(libvirtMachine, "Waiting for the bootstrap provider to set the bootstrap data of the Machine")
+			return reconcile.Result{}, nil
 		}
 
 		// Get the bootstrap data
-		bootstrapData, err := r.getBootstrapData(ctx, libvirtMachine.Namespace, *machine.Spec.Bootstrap.DataSecretName)
+		bootstrapData, bootstrapFormat, err := r.getBootstrapData(ctx, libvirtMachine.Namespace, *machine.Spec.Bootstrap.DataSecretName)
 		if err != nil {
+			setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineBootstrapDataAvailableCondition, metav1.ConditionFalse,
+				infrav1.LibvirtMachineBootstrapDataInvalidReason, err.Error())
+			setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition, metav1.ConditionFalse,
+				infrav1.LibvirtMachineWaitingForBootstrapDataReason, "Waiting for valid bootstrap data")
 			return reconcile.Result{}, err
 		}
 		if bootstrapData == "" {
 			log.Info(fmt.Sprintf("bootstrap data is not available yet for LibvirtMachine %s/%s", libvirtMachine.Namespace, libvirtMachine.Name))
-			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+			r.setWaitingForBootstrapData(libvirtMachine, fmt.Sprintf("Waiting for the bootstrap data Secret %s to be populated", *machine.Spec.Bootstrap.DataSecretName))
+			return reconcile.Result{}, nil
 		}
 		externalMachine.UserData = bootstrapData
+		externalMachine.BootstrapFormat = bootstrapFormat
+		setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineBootstrapDataAvailableCondition, metav1.ConditionTrue,
+			infrav1.LibvirtMachineBootstrapDataAvailableReason, "")
+
+		// Record the host before creating the virtual machine, so that the virtual machine can be found (e.g. to delete
+		// it) even if patching the LibvirtMachine fails afterwards
+		if err := patchLibvirtMachine(ctx, patchHelper, libvirtMachine); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "failed to record the libvirt host of LibvirtMachine %s/%s", libvirtMachine.Namespace, libvirtMachine.Name)
+		}
+
+		// Download the backing image into the storage pool, unless it is cached there
+		if backingImage := libvirtMachine.Spec.BackingImage; backingImage != nil {
+			image, err := r.downloadBackingImage(ctx, libvirtClient, libvirtMachine, externalMachine.StoragePoolName)
+			if errors.Is(err, libvirtclient.ErrImageDownloadInProgress) {
+				// Requeue until the image has been downloaded in the background
+				log.Info(fmt.Sprintf("downloading backing image '%s' of LibvirtMachine %s/%s", backingImage.URL, libvirtMachine.Namespace, libvirtMachine.Name))
+				setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition, metav1.ConditionFalse,
+					infrav1.LibvirtMachineDownloadingBackingImageReason, fmt.Sprintf("Downloading backing image '%s'", backingImage.URL))
+				return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+			}
+			if err != nil {
+				setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition, metav1.ConditionFalse,
+					infrav1.LibvirtMachineBackingImageDownloadFailedReason, err.Error())
+				r.Recorder.Eventf(libvirtMachine, corev1.EventTypeWarning, eventReasonLibvirtError, "Failed to download backing image '%s': %v", backingImage.URL, err)
+				return reconcile.Result{}, errors.Wrapf(err, "failed to download backing image '%s'", backingImage.URL)
+			}
+			externalMachine.BackingImagePath = image.Path
+			externalMachine.BackingImageFormat = image.Format
+		}
 
-		if err := externalMachine.Create(); err != nil {
+		if err := libvirtClient.Create(externalMachine); err != nil {
+			setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition, metav1.ConditionFalse,
+				infrav1.LibvirtMachineProvisioningFailedReason, err.Error())
+			r.Recorder.Eventf(libvirtMachine, corev1.EventTypeWarning, eventReasonLibvirtError, "Failed to create virtual machine '%s': %v", externalMachine.Name, err)
 			return reconcile.Result{}, errors.Wrapf(err, "failed to create virtual machine '%s'", externalMachine.Name)
 		}
 		log.Info(fmt.Sprintf("creating virtual machine '%s'", externalMachine.Name))
+		r.Recorder.Eventf(libvirtMachine, corev1.EventTypeNormal, eventReasonVirtualMachineCreated, "Created virtual machine '%s' on libvirt host %s", externalMachine.Name, host)
+		if externalMachine.AllowEmulation {
+			if info, err := libvirtClient.GetHostInfo(); err == nil && slices.Contains(info.Emulated, externalMachine.Architecture) {
+				log.Info(fmt.Sprintf("virtual machine '%s' uses emulation, as libvirt host %s does not support KVM for %s guests", externalMachine.Name, host, externalMachine.Architecture))
+				r.Recorder.Eventf(libvirtMachine, corev1.EventTypeWarning, eventReasonVirtualMachineEmulated, "Virtual machine '%s' uses emulation, as libvirt host %s does not support KVM for %s guests", externalMachine.Name, host, externalMachine.Architecture)
+			}
+		}
+		setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition, metav1.ConditionFalse,
+			infrav1.LibvirtMachineProvisioningReason, fmt.Sprintf("Virtual machine '%s' is being created", externalMachine.Name))
 		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
 
 	}
 
+	setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineDriftDetectedCondition, metav1.ConditionFalse,
+		infrav1.LibvirtMachineNoDriftReason, "")
+
+	// Apply changed vCPUs and memory to the existing machine, in place where possible
+	if result, err := r.updateResources(ctx, libvirtClient, libvirtMachine, externalMachine); err != nil || !result.IsZero() {
+		return result, err
+	}
+
+	// Grow the disk of the existing machine to the disk size
+	if err := r.resizeDisk(ctx, libvirtClient, libvirtMachine, externalMachine); err != nil {
+		return reconcile.Result{}, err
+	}
+
 	// Now that the machine exists, update the LibvirtMachine resource per the Cluster API contract
 
 	libvirtMachine.Spec.ProviderID = fmt.Sprintf("libvirt:///%s", externalMachine.Name)
 
 	// Check if the machine is ready (running)
-	if !externalMachine.IsReady() {
+	if !libvirtClient.IsReady(externalMachine) {
 		// Machine exists and is reconciled but not yet ready - requeue to check again
 		log.Info(fmt.Sprintf("waiting for virtual machine '%s' to become ready", externalMachine.Name))
+		setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition, metav1.ConditionFalse,
+			infrav1.LibvirtMachineVirtualMachineNotRunningReason, fmt.Sprintf("Virtual machine '%s' is not running", externalMachine.Name))
 		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
 	}
+	setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition, metav1.ConditionTrue,
+		infrav1.LibvirtMachineVirtualMachineProvisionedReason, "")
 
 	// Update the LibvirtMachine status with the VM's IP addresses
-	addresses, err := externalMachine.GetIPAddresses()
+	addresses, err := libvirtClient.GetIPAddresses(externalMachine)
 	if err != nil {
+		setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineAddressesAvailableCondition, metav1.ConditionFalse,
+			infrav1.LibvirtMachineAddressesLookupFailedReason, err.Error())
+		r.Recorder.Eventf(libvirtMachine, corev1.EventTypeWarning, eventReasonLibvirtError, "Failed to get the IP addresses of virtual machine '%s': %v", externalMachine.Name, err)
 		return reconcile.Result{}, errors.Wrapf(err, "failed to get IP addresses for virtual machine '%s'", externalMachine.Name)
 	}
-	if len(addresses) == 0 {
+	if !slices.ContainsFunc(addresses, func(iface libvirtclient.InterfaceAddresses) bool { return iface.Primary && len(iface.Addresses) > 0 }) {
 		log.Info(fmt.Sprintf("waiting for IP address to be assigned to virtual machine '%s'", externalMachine.Name))
+		setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineAddressesAvailableCondition, metav1.ConditionFalse,
+			infrav1.LibvirtMachineWaitingForAddressesReason, fmt.Sprintf("Waiting for an IP address to be assigned to the primary network interface of virtual machine '%s'", externalMachine.Name))
 		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
 	}
+	// Report the addresses of the primary interface first, since Kubernetes uses the first address for the node
+	slices.SortStableFunc(addresses, func(a, b libvirtclient.InterfaceAddresses) int {
+		switch {
+		case a.Primary == b.Primary:
+			return 0
+		case a.Primary:
+			return -1
+		}
+		return 1
+	})
 	var machineAddresses []clusterv1.MachineAddress
-	for _, address := range addresses {
-		machineAddresses = append(machineAddresses, clusterv1.MachineAddress{
-			Type:    clusterv1.MachineExternalIP, // Assume that all addresses are external? (since the host should be bridged to the libvirt network and can access them)
-			Address: address,
+	var ipAddresses []string
+	networkInterfaces := make([]infrav1.LibvirtMachineNetworkInterfaceStatus, 0, len(addresses))
+	for _, iface := range addresses {
+		for _, address := range iface.Addresses {
+			machineAddresses = append(machineAddresses, clusterv1.MachineAddress{
+				Type:    clusterv1.MachineExternalIP, // Assume that all addresses are external? (since the host should be bridged to the libvirt network and can access them)
+				Address: address,
+			})
+		}
+		ipAddresses = append(ipAddresses, iface.Addresses...)
+		networkInterfaces = append(networkInterfaces, infrav1.LibvirtMachineNetworkInterfaceStatus{
+			Network:    iface.NetworkName,
+			MACAddress: iface.MACAddress,
+			Primary:    iface.Primary,
+			Addresses:  iface.Addresses,
 		})
 	}
 	if !slices.Equal(libvirtMachine.Status.Addresses, machineAddresses) {
-		log.Info(fmt.Sprintf("got IP addresses for virtual machine '%s': %v", externalMachine.Name, addresses))
+		log.Info(fmt.Sprintf("got IP addresses for virtual machine '%s': %v", externalMachine.Name, machineAddresses))
+		r.Recorder.Eventf(libvirtMachine, corev1.EventTypeNormal, eventReasonAddressesAcquired, "Virtual machine '%s' acquired the IP addresses %s", externalMachine.Name, strings.Join(ipAddresses, ", "))
 	}
 	libvirtMachine.Status.Addresses = machineAddresses
+	libvirtMachine.Status.NetworkInterfaces = networkInterfaces
+	setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineAddressesAvailableCondition, metav1.ConditionTrue,
+		infrav1.LibvirtMachineAddressesAvailableReason, "")
 
 	// Mark the LibvirtMachine as "provisioned"
 	if !libvirtMachine.Status.Initialization.Provisioned {
@@ -240,61 +439,508 @@ func (r *LibvirtMachineReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	libvirtMachine.Status.Ready = true                      // v1beta1
 	libvirtMachine.Status.Initialization.Provisioned = true // v1beta2
 
-	// TODO: Per the Cluster API contract, we SHOULD also set Conditions here as well.
-
-	// Requeue to check every 5 minutes to handle drift just in case the VM goes down or gets modified
+	// Requeue to check every 5 minutes to handle drift just in case the VM gets modified, or goes down while the
+	// lifecycle events of its libvirt host are not received (e.g. while reconnecting)
 	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
 
 }
 
 // SetupWithManager sets up the controller with the Manager
 func (r *LibvirtMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&infrav1.LibvirtMachine{}).
-		Named("libvirtmachine").
-		Complete(r)
+	if r.NewLibvirtClient == nil {
+		return errors.New("LibvirtMachineReconciler requires NewLibvirtClient to be set")
+	}
+
+	predicateLog := mgr.GetLogger().WithValues("controller", "libvirtmachine")
+	clusterToLibvirtMachines, err := util.ClusterToTypedObjectsMapper(mgr.GetClient(), &infrav1.LibvirtMachineList{}, mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.LibvirtMachine{},
+			builder.WithPredicates(predicates.ResourceNotPausedAndHasFilterLabel(mgr.GetScheme(), predicateLog, r.WatchFilterValue)),
+		).
+		// Reconcile as soon as the Machine gets its bootstrap data
+		Watches(&clusterv1.Machine{},
+			handler.EnqueueRequestsFromMapFunc(util.MachineToInfrastructureMapFunc(infrav1.GroupVersion.WithKind("LibvirtMachine"))),
+			builder.WithPredicates(predicates.ResourceHasFilterLabel(mgr.GetScheme(), predicateLog, r.WatchFilterValue)),
+		).
+		// Reconcile as soon as the Cluster is provisioned or unpaused
+		Watches(&clusterv1.Cluster{},
+			handler.EnqueueRequestsFromMapFunc(clusterToLibvirtMachines),
+			builder.WithPredicates(predicates.All(mgr.GetScheme(), predicateLog,
+				predicates.ClusterPausedTransitionsOrInfrastructureProvisioned(mgr.GetScheme(), predicateLog),
+				predicates.ResourceHasFilterLabel(mgr.GetScheme(), predicateLog, r.WatchFilterValue),
+			)),
+		).
+		// Reconcile as soon as the bootstrap data Secret is populated
+		Watches(&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.secretToLibvirtMachines),
+			builder.WithPredicates(
+				predicate.NewPredicateFuncs(isBootstrapDataSecret),
+				predicates.ResourceHasFilterLabel(mgr.GetScheme(), predicateLog, r.WatchFilterValue),
+			),
+		).
+		Named("libvirtmachine")
+
+	// Reconcile as soon as a virtual machine is stopped, crashes or is otherwise changed on its libvirt host
+	if r.DomainEvents != nil {
+		if err := mgr.GetFieldIndexer().IndexField(context.Background(), &infrav1.LibvirtMachine{}, libvirtMachineNameField, func(o client.Object) []string {
+			return []string{o.GetName()}
+		}); err != nil {
+			return errors.Wrap(err, "failed to index LibvirtMachines by name")
+		}
+		events := make(chan event.TypedGenericEvent[libvirtclient.DomainEvent])
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case domainEvent := <-r.DomainEvents:
+					select {
+					case events <- event.TypedGenericEvent[libvirtclient.DomainEvent]{Object: domainEvent}:
+					case <-ctx.Done():
+						return nil
+					}
+				}
+			}
+		})); err != nil {
+			return errors.Wrap(err, "failed to add the libvirt domain events runnable")
+		}
+		b = b.WatchesRawSource(source.Channel(events, handler.TypedEnqueueRequestsFromMapFunc(r.domainEventToLibvirtMachines)))
+	}
+
+	return b.Complete(r)
+}
+
+// domainEventToLibvirtMachines maps a lifecycle event of a virtual machine to reconcile requests for the
+// LibvirtMachines named like the virtual machine which are (or may be) placed on the libvirt host of the event.
+func (r *LibvirtMachineReconciler) domainEventToLibvirtMachines(ctx context.Context, domainEvent libvirtclient.DomainEvent) []reconcile.Request {
+	libvirtMachines := &infrav1.LibvirtMachineList{}
+	if err := r.List(ctx, libvirtMachines, client.MatchingFields{libvirtMachineNameField: domainEvent.Domain}); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, fmt.Sprintf("failed to list LibvirtMachines for the %s event of virtual machine '%s'", domainEvent.Event, domainEvent.Domain))
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, libvirtMachine := range libvirtMachines.Items {
+		if libvirtMachine.Status.Host != nil && libvirtMachine.Status.Host.URI != domainEvent.URI {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&libvirtMachine)})
+	}
+	return requests
+}
+
+// isBootstrapDataSecret returns true if the object is a Secret created by Cluster API, e.g. with the bootstrap data of
+// a Machine, and labeled with the name of its cluster.
+func isBootstrapDataSecret(o client.Object) bool {
+	secret, ok := o.(*corev1.Secret)
+	if !ok || secret.Type != clusterv1.ClusterSecretType {
+		return false
+	}
+	_, ok = secret.Labels[clusterv1.ClusterNameLabel]
+	return ok
+}
+
+// secretToLibvirtMachines maps a bootstrap data Secret to reconcile requests for the LibvirtMachines of the Machines
+// which use it. Only the Machines of the Secret's cluster are considered if the Secret has the cluster name label.
+func (r *LibvirtMachineReconciler) secretToLibvirtMachines(ctx context.Context, o client.Object) []reconcile.Request {
+	opts := []client.ListOption{client.InNamespace(o.GetNamespace())}
+	if clusterName, ok := o.GetLabels()[clusterv1.ClusterNameLabel]; ok {
+		opts = append(opts, client.MatchingLabels{clusterv1.ClusterNameLabel: clusterName})
+	}
+	machines := &clusterv1.MachineList{}
+	if err := r.List(ctx, machines, opts...); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, fmt.Sprintf("failed to list Machines using Secret %s/%s", o.GetNamespace(), o.GetName()))
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, machine := range machines.Items {
+		if ptr.Deref(machine.Spec.Bootstrap.DataSecretName, "") != o.GetName() ||
+			machine.Spec.InfrastructureRef.APIGroup != infrav1.GroupVersion.Group ||
+			machine.Spec.InfrastructureRef.Kind != "LibvirtMachine" {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: machine.Namespace,
+			Name:      machine.Spec.InfrastructureRef.Name,
+		}})
+	}
+	return requests
+}
+
+// patchLibvirtMachine sets the Ready condition of the LibvirtMachine as the summary of its other conditions and patches
+// it.
+func patchLibvirtMachine(ctx context.Context, patchHelper *patch.Helper, libvirtMachine *infrav1.LibvirtMachine) error {
+	if err := conditions.SetSummaryCondition(libvirtMachine, libvirtMachine, infrav1.LibvirtMachineReadyCondition,
+		conditions.ForConditionTypes{
+			infrav1.LibvirtMachineLibvirtConnectedCondition,
+			infrav1.LibvirtMachineVirtualMachineProvisionedCondition,
+			infrav1.LibvirtMachineBootstrapDataAvailableCondition,
+			infrav1.LibvirtMachineAddressesAvailableCondition,
+			infrav1.LibvirtMachineDiskSizeReconciledCondition,
+			infrav1.LibvirtMachineResourcesReconciledCondition,
+			infrav1.LibvirtMachineDriftDetectedCondition,
+		},
+		// Only set once the virtual machine is created (or about to be)
+		conditions.IgnoreTypesIfMissing{
+			infrav1.LibvirtMachineBootstrapDataAvailableCondition,
+			infrav1.LibvirtMachineAddressesAvailableCondition,
+			infrav1.LibvirtMachineDiskSizeReconciledCondition,
+			infrav1.LibvirtMachineResourcesReconciledCondition,
+			infrav1.LibvirtMachineDriftDetectedCondition,
+		},
+		conditions.CustomMergeStrategy{
+			MergeStrategy: conditions.DefaultMergeStrategy(
+				// DriftDetected has negative polarity
+				conditions.GetPriorityFunc(conditions.GetDefaultMergePriorityFunc(infrav1.LibvirtMachineDriftDetectedCondition)),
+				conditions.ComputeReasonFunc(conditions.GetDefaultComputeMergeReasonFunc(
+					infrav1.LibvirtMachineNotReadyReason,
+					infrav1.LibvirtMachineReadyUnknownReason,
+					infrav1.LibvirtMachineReadyReason,
+				)),
+			),
+		},
+	); err != nil {
+		return errors.Wrapf(err, "failed to set the %s condition", infrav1.LibvirtMachineReadyCondition)
+	}
+
+	return patchHelper.Patch(ctx, libvirtMachine, patch.WithOwnedConditions{Conditions: []string{
+		infrav1.LibvirtMachineReadyCondition,
+		infrav1.LibvirtMachineLibvirtConnectedCondition,
+		infrav1.LibvirtMachineVirtualMachineProvisionedCondition,
+		infrav1.LibvirtMachineBootstrapDataAvailableCondition,
+		infrav1.LibvirtMachineAddressesAvailableCondition,
+		infrav1.LibvirtMachineDiskSizeReconciledCondition,
+		infrav1.LibvirtMachineResourcesReconciledCondition,
+		infrav1.LibvirtMachineDriftDetectedCondition,
+	}})
+}
+
+// setLibvirtMachineCondition sets the condition of the given type of the LibvirtMachine.
+func setLibvirtMachineCondition(libvirtMachine *infrav1.LibvirtMachine, conditionType string, status metav1.ConditionStatus, reason string, message string) {
+	conditions.Set(libvirtMachine, metav1.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// setWaitingForBootstrapData sets the conditions of a LibvirtMachine whose virtual machine cannot be created yet
+// because its bootstrap data is not available, and records an Event when it starts waiting.
+func (r *LibvirtMachineReconciler) setWaitingForBootstrapData(libvirtMachine *infrav1.LibvirtMachine, message string) {
+	if conditions.GetReason(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition) != infrav1.LibvirtMachineWaitingForBootstrapDataReason {
+		r.Recorder.Event(libvirtMachine, corev1.EventTypeNormal, eventReasonWaitingForBootstrapData, message)
+	}
+	setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineBootstrapDataAvailableCondition, metav1.ConditionFalse,
+		infrav1.LibvirtMachineBootstrapDataNotAvailableReason, message)
+	setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition, metav1.ConditionFalse,
+		infrav1.LibvirtMachineWaitingForBootstrapDataReason, message)
+}
+
+// getLibvirtClient returns a LibvirtClient for the libvirt host and sets the LibvirtConnected condition of the
+// LibvirtMachine accordingly.
+func (r *LibvirtMachineReconciler) getLibvirtClient(ctx context.Context, host *libvirtHost, libvirtMachine *infrav1.LibvirtMachine) (libvirtclient.LibvirtClient, error) {
+	libvirtClient, err := r.newLibvirtClient(ctx, host)
+	if err != nil {
+		reason := infrav1.LibvirtMachineLibvirtConnectionFailedReason
+		switch {
+		case errors.Is(err, errCredentialsUnavailable):
+			reason = infrav1.LibvirtMachineLibvirtCredentialsUnavailableReason
+		case errors.Is(err, libvirtclient.ErrAuthenticationFailed):
+			reason = infrav1.LibvirtMachineLibvirtAuthenticationFailedReason
+		}
+		conditions.Set(libvirtMachine, metav1.Condition{
+			Type:    infrav1.LibvirtMachineLibvirtConnectedCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: err.Error(),
+		})
+		r.Recorder.Eventf(libvirtMachine, corev1.EventTypeWarning, eventReasonLibvirtError, "Failed to connect to libvirt host %s: %v", host, err)
+		return nil, err
+	}
+	conditions.Set(libvirtMachine, metav1.Condition{
+		Type:   infrav1.LibvirtMachineLibvirtConnectedCondition,
+		Status: metav1.ConditionTrue,
+		Reason: infrav1.LibvirtMachineLibvirtConnectedReason,
+	})
+	return libvirtClient, nil
+}
+
+// resizeDisk grows the primary disk of the virtual machine to the disk size of the LibvirtMachine and sets the
+// DiskSizeReconciled condition accordingly. A disk larger than the disk size is only reported in the condition, as it
+// cannot be shrunk.
+func (r *LibvirtMachineReconciler) resizeDisk(ctx context.Context, libvirtClient libvirtclient.LibvirtClient, libvirtMachine *infrav1.LibvirtMachine, externalMachine *libvirtclient.LibvirtClientMachine) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	resized, err := libvirtClient.ResizeDisk(externalMachine)
+	if err != nil {
+		reason := infrav1.LibvirtMachineDiskResizeFailedReason
+		if errors.Is(err, libvirtclient.ErrDiskShrink) {
+			reason = infrav1.LibvirtMachineDiskShrinkNotSupportedReason
+		}
+		conditions.Set(libvirtMachine, metav1.Condition{
+			Type:    infrav1.LibvirtMachineDiskSizeReconciledCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: err.Error(),
+		})
+		if reason == infrav1.LibvirtMachineDiskShrinkNotSupportedReason {
+			log.Info(fmt.Sprintf("not shrinking the disk of virtual machine '%s': %v", externalMachine.Name, err))
+			return nil
+		}
+		r.Recorder.Eventf(libvirtMachine, corev1.EventTypeWarning, eventReasonLibvirtError, "Failed to resize the disk of virtual machine '%s': %v", externalMachine.Name, err)
+		return errors.Wrapf(err, "failed to resize the disk of virtual machine '%s'", externalMachine.Name)
+	}
+	if resized {
+		log.Info(fmt.Sprintf("resized the disk of virtual machine '%s' to %d GiB", externalMachine.Name, externalMachine.DiskSize))
+		r.Recorder.Eventf(libvirtMachine, corev1.EventTypeNormal, eventReasonVirtualMachineUpdated, "Resized the disk of virtual machine '%s' to %d GiB", externalMachine.Name, externalMachine.DiskSize)
+	}
+	conditions.Set(libvirtMachine, metav1.Condition{
+		Type:   infrav1.LibvirtMachineDiskSizeReconciledCondition,
+		Status: metav1.ConditionTrue,
+		Reason: infrav1.LibvirtMachineDiskSizeReconciledReason,
+	})
+	return nil
+}
+
+// updateResources applies the vCPUs and memory of the LibvirtMachine to its virtual machine. A virtual machine which has
+// to be restarted to apply them is asked to shut down without waiting for it, and a result to requeue is returned until
+// it is started again: once it is shut off, or after stopping it forcibly if it did not shut down within
+// restartShutdownTimeout.
+func (r *LibvirtMachineReconciler) updateResources(ctx context.Context, libvirtClient libvirtclient.LibvirtClient, libvirtMachine *infrav1.LibvirtMachine, externalMachine *libvirtclient.LibvirtClientMachine) (reconcile.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	updated, err := libvirtClient.UpdateResources(externalMachine)
+	restartRequired := errors.Is(err, libvirtclient.ErrRestartRequired)
+	if err != nil && !restartRequired {
+		conditions.Set(libvirtMachine, metav1.Condition{
+			Type:    infrav1.LibvirtMachineResourcesReconciledCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  infrav1.LibvirtMachineResourcesUpdateFailedReason,
+			Message: err.Error(),
+		})
+		r.Recorder.Eventf(libvirtMachine, corev1.EventTypeWarning, eventReasonLibvirtError, "Failed to update the vCPUs and memory of virtual machine '%s': %v", externalMachine.Name, err)
+		return reconcile.Result{}, errors.Wrapf(err, "failed to update the vCPUs and memory of virtual machine '%s'", externalMachine.Name)
+	}
+	if updated {
+		log.Info(fmt.Sprintf("updated the vCPUs and memory of virtual machine '%s'", externalMachine.Name))
+		r.Recorder.Eventf(libvirtMachine, corev1.EventTypeNormal, eventReasonVirtualMachineUpdated, "Updated virtual machine '%s' to %d vCPUs and %d MiB of memory", externalMachine.Name, externalMachine.CPU, externalMachine.Memory)
+	}
+
+	// The last transition of a pending restart is when the virtual machine was asked to shut down
+	condition := conditions.Get(libvirtMachine, infrav1.LibvirtMachineResourcesReconciledCondition)
+	pending := condition != nil && condition.Reason == infrav1.LibvirtMachineRestartPendingReason
+	if restartRequired || pending {
+		force := pending && time.Since(condition.LastTransitionTime.Time) > restartShutdownTimeout
+		if pending && !force && libvirtClient.IsReady(externalMachine) {
+			// Wait for the virtual machine to shut down, without asking it again
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+		}
+		if force {
+			log.Info(fmt.Sprintf("stopping virtual machine '%s', as it did not shut down within %s", externalMachine.Name, restartShutdownTimeout))
+		}
+		restarted, err := libvirtClient.Restart(externalMachine, force)
+		if err != nil {
+			r.Recorder.Eventf(libvirtMachine, corev1.EventTypeWarning, eventReasonLibvirtError, "Failed to restart virtual machine '%s': %v", externalMachine.Name, err)
+			return reconcile.Result{}, errors.Wrapf(err, "failed to restart virtual machine '%s'", externalMachine.Name)
+		}
+		if !restarted {
+			if !pending {
+				log.Info(fmt.Sprintf("shutting down virtual machine '%s' to restart it", externalMachine.Name))
+				// Replace a failed condition as well, so that its last transition is now
+				conditions.Delete(libvirtMachine, infrav1.LibvirtMachineResourcesReconciledCondition)
+				conditions.Set(libvirtMachine, metav1.Condition{
+					Type:    infrav1.LibvirtMachineResourcesReconciledCondition,
+					Status:  metav1.ConditionFalse,
+					Reason:  infrav1.LibvirtMachineRestartPendingReason,
+					Message: fmt.Sprintf("Virtual machine '%s' is shut down to be restarted with %d vCPUs and %d MiB of memory", externalMachine.Name, externalMachine.CPU, externalMachine.Memory),
+				})
+			}
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+		}
+		log.Info(fmt.Sprintf("restarted virtual machine '%s'", externalMachine.Name))
+		r.Recorder.Eventf(libvirtMachine, corev1.EventTypeNormal, eventReasonVirtualMachineRestarted, "Restarted virtual machine '%s' to apply %d vCPUs and %d MiB of memory", externalMachine.Name, externalMachine.CPU, externalMachine.Memory)
+	}
+
+	conditions.Set(libvirtMachine, metav1.Condition{
+		Type:   infrav1.LibvirtMachineResourcesReconciledCondition,
+		Status: metav1.ConditionTrue,
+		Reason: infrav1.LibvirtMachineResourcesReconciledReason,
+	})
+	return reconcile.Result{}, nil
+}
+
+// newLibvirtClient returns a LibvirtClient for the libvirt host, using the credentials from its Secret (if any).
+func (r *LibvirtMachineReconciler) newLibvirtClient(ctx context.Context, host *libvirtHost) (libvirtclient.LibvirtClient, error) {
+	return newLibvirtClient(ctx, r.Client, r.NewLibvirtClient, host)
+}
+
+// deleteLibvirtMachine deletes the virtual machine of the LibvirtMachine from its libvirt host (if it has been created)
+// and removes the finalizer. libvirtCluster is nil if the LibvirtCluster has already been deleted.
+func (r *LibvirtMachineReconciler) deleteLibvirtMachine(ctx context.Context, libvirtCluster *infrav1.LibvirtCluster, libvirtMachine *infrav1.LibvirtMachine, externalMachine *libvirtclient.LibvirtClientMachine) (ctrl.Result, error) {
+	setLibvirtMachineCondition(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition, metav1.ConditionFalse,
+		infrav1.LibvirtMachineDeletingReason, fmt.Sprintf("Virtual machine '%s' is being deleted", externalMachine.Name))
+
+	// Use the host recorded in the status, so that the virtual machine is deleted even if its host was removed from the
+	// LibvirtCluster or the LibvirtCluster is already deleted
+	host := recordedLibvirtHost(libvirtMachine)
+	if host == nil && libvirtMachine.Spec.ProviderID != "" {
+		// A LibvirtMachine provisioned before its host was recorded may be on any of the hosts. Its finalizer is kept
+		// until its virtual machine is found and deleted, as a host which fails to look it up may still have it.
+		hosts := r.getLibvirtHosts(libvirtCluster)
+		var err error
+		host, err = findLibvirtMachineHost(hosts, libvirtMachine)
+		if host == nil && err == nil {
+			host, err = r.searchLibvirtMachineHost(ctx, hosts, externalMachine)
+			if host == nil && err == nil {
+				err = errors.Errorf("virtual machine '%s' of provisioned LibvirtMachine %s/%s was not found on any libvirt host; remove its finalizer once it is deleted", externalMachine.Name, libvirtMachine.Namespace, libvirtMachine.Name)
+			}
+		}
+		if err != nil {
+			r.Recorder.Eventf(libvirtMachine, corev1.EventTypeWarning, eventReasonLibvirtError, "Failed to find the libvirt host of virtual machine '%s': %v", externalMachine.Name, err)
+			return reconcile.Result{}, err
+		}
+	}
+	if host == nil {
+		// The LibvirtMachine was never placed on any host, so there is no virtual machine to delete
+		log := ctrl.LoggerFrom(ctx)
+		log.Info(fmt.Sprintf("deleting LibvirtMachine %s/%s", libvirtMachine.Namespace, libvirtMachine.Name))
+		r.removeFinalizer(libvirtMachine)
+		return reconcile.Result{}, nil
+	}
+
+	libvirtClient, err := r.getLibvirtClient(ctx, host, libvirtMachine)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	return r.deleteExternalMachine(ctx, libvirtClient, libvirtMachine, externalMachine)
 }
 
 // deleteExternalMachine handles deletion of the externalMachine and its associated resouces (volumes, etc)
-func deleteExternalMachine(ctx context.Context, libvirtMachine *infrav1.LibvirtMachine, externalMachine *libvirtclient.LibvirtClientMachine) (ctrl.Result, error) {
+func (r *LibvirtMachineReconciler) deleteExternalMachine(ctx context.Context, libvirtClient libvirtclient.LibvirtClient, libvirtMachine *infrav1.LibvirtMachine, externalMachine *libvirtclient.LibvirtClientMachine) (ctrl.Result, error) {
 	log := ctrl.LoggerFrom(ctx)
 
-	if externalMachine.Exists() {
+	if libvirtClient.Exists(externalMachine) {
 		log.Info(fmt.Sprintf("deleting virtual machine '%s'", externalMachine.Name))
-		if err := externalMachine.Destroy(); err != nil {
+		if err := libvirtClient.Destroy(externalMachine); err != nil {
+			r.Recorder.Eventf(libvirtMachine, corev1.EventTypeWarning, eventReasonLibvirtError, "Failed to delete virtual machine '%s': %v", externalMachine.Name, err)
 			return reconcile.Result{RequeueAfter: 30 * time.Second}, errors.Wrap(err, "failed to destroy LibvirtMachine")
 		}
+		r.Recorder.Eventf(libvirtMachine, corev1.EventTypeNormal, eventReasonVirtualMachineDeleted, "Deleted virtual machine '%s'", externalMachine.Name)
 	}
 	log.Info(fmt.Sprintf("deleting LibvirtMachine %s/%s", libvirtMachine.Namespace, libvirtMachine.Name))
-	controllerutil.RemoveFinalizer(libvirtMachine, infrav1.MachineFinalizer)
+	r.removeFinalizer(libvirtMachine)
 
 	return reconcile.Result{}, nil
 }
 
-// getBootstrapData retrieves and returns the bootstrap data from the specified secret
-func (r *LibvirtMachineReconciler) getBootstrapData(ctx context.Context, namespace string, dataSecretName string) (string, error) {
+// removeFinalizer removes the finalizer from the deleted LibvirtMachine and records an Event.
+func (r *LibvirtMachineReconciler) removeFinalizer(libvirtMachine *infrav1.LibvirtMachine) {
+	if controllerutil.RemoveFinalizer(libvirtMachine, infrav1.MachineFinalizer) {
+		r.Recorder.Event(libvirtMachine, corev1.EventTypeNormal, eventReasonFinalizerRemoved, "Removed the finalizer after deleting the virtual machine")
+	}
+}
+
+// getLibvirtImage returns the LibvirtImage referenced by the LibvirtMachine, or nil if it does not exist or is not
+// ready yet.
+func (r *LibvirtMachineReconciler) getLibvirtImage(ctx context.Context, libvirtMachine *infrav1.LibvirtMachine) (*infrav1.LibvirtImage, error) {
+	libvirtImage := &infrav1.LibvirtImage{}
+	key := client.ObjectKey{Namespace: libvirtMachine.Namespace, Name: libvirtMachine.Spec.ImageRef.Name}
+	if err := r.Get(ctx, key, libvirtImage); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to retrieve LibvirtImage '%s'", key.Name)
+	}
+	if !libvirtImage.Status.Ready {
+		return nil, nil
+	}
+	return libvirtImage, nil
+}
+
+// getBootstrapData retrieves and returns the bootstrap data and its format ("cloud-config" or "ignition") from the specified secret
+func (r *LibvirtMachineReconciler) getBootstrapData(ctx context.Context, namespace string, dataSecretName string) (string, string, error) {
 	s := &corev1.Secret{}
 	key := client.ObjectKey{Namespace: namespace, Name: dataSecretName}
 	if err := r.Get(ctx, key, s); err != nil {
-		return "", errors.Wrapf(err, "failed to retrieve bootstrap data secret '%s'", dataSecretName)
+		return "", "", errors.Wrapf(err, "failed to retrieve bootstrap data secret '%s'", dataSecretName)
 	}
 
 	value, ok := s.Data["value"]
 	if !ok {
-		return "", errors.New(fmt.Sprintf("error retrieving bootstrap data: secret '%s' is missing the 'value' key", dataSecretName))
+		return "", "", errors.New(fmt.Sprintf("error retrieving bootstrap data: secret '%s' is missing the 'value' key", dataSecretName))
 	}
 	valueString := string(value)
 
 	format, ok := s.Data["format"]
 	formatString := string(format)
 	if !ok {
-		formatString = "cloud-config"
+		formatString = libvirtclient.BootstrapFormatCloudConfig
+	}
+	if formatString != libvirtclient.BootstrapFormatCloudConfig && formatString != libvirtclient.BootstrapFormatIgnition {
+		return "", "", errors.Errorf("unsupported bootstrap data format: %s", formatString)
+	}
+
+	return valueString, formatString, nil
+}
+
+// downloadBackingImage returns the backing image of the LibvirtMachine from the storage pool, where it is downloaded in
+// the background unless it is cached there (see LibvirtClient.DownloadImage), and records its checksum in the status of
+// the LibvirtMachine. Once recorded, the checksum avoids downloading the image again to find it in the cache, also for
+// the other LibvirtMachines with the same URL (see findCachedBackingImage).
+func (r *LibvirtMachineReconciler) downloadBackingImage(ctx context.Context, libvirtClient libvirtclient.LibvirtClient, libvirtMachine *infrav1.LibvirtMachine, storagePoolName string) (*libvirtclient.Image, error) {
+	backingImage := libvirtMachine.Spec.BackingImage
+	checksum := ptr.Deref(backingImage.Checksum, "")
+	if status := libvirtMachine.Status.BackingImage; checksum == "" && status != nil && status.URL == backingImage.URL {
+		checksum = status.Checksum
+	}
+	if checksum == "" {
+		image, err := r.findCachedBackingImage(ctx, libvirtClient, libvirtMachine, storagePoolName)
+		if err != nil {
+			return nil, err
+		}
+		if image != nil {
+			libvirtMachine.Status.BackingImage = &infrav1.LibvirtMachineBackingImageStatus{URL: backingImage.URL, Checksum: image.Checksum}
+			return image, nil
+		}
 	}
-	if formatString != "cloud-config" {
-		return "", errors.Errorf("unsupported bootstrap data format: %s", formatString)
+	image, err := libvirtClient.DownloadImage(storagePoolName, backingImage.URL, checksum)
+	if err != nil {
+		return nil, err
 	}
+	libvirtMachine.Status.BackingImage = &infrav1.LibvirtMachineBackingImageStatus{URL: backingImage.URL, Checksum: image.Checksum}
+	return image, nil
+}
 
-	return valueString, nil
+// findCachedBackingImage returns the backing image of the LibvirtMachine from the cache in the storage pool, using the
+// checksums which other LibvirtMachines in its namespace recorded for its URL, or nil if none of them is cached.
+func (r *LibvirtMachineReconciler) findCachedBackingImage(ctx context.Context, libvirtClient libvirtclient.LibvirtClient, libvirtMachine *infrav1.LibvirtMachine, storagePoolName string) (*libvirtclient.Image, error) {
+	libvirtMachines := &infrav1.LibvirtMachineList{}
+	if err := r.List(ctx, libvirtMachines, client.InNamespace(libvirtMachine.Namespace)); err != nil {
+		return nil, errors.Wrap(err, "failed to list LibvirtMachines")
+	}
+	var checksums []string
+	for _, other := range libvirtMachines.Items {
+		status := other.Status.BackingImage
+		if status == nil || status.URL != libvirtMachine.Spec.BackingImage.URL || status.Checksum == "" || slices.Contains(checksums, status.Checksum) {
+			continue
+		}
+		checksums = append(checksums, status.Checksum)
+		image, err := libvirtClient.GetImage(storagePoolName, status.Checksum)
+		if errors.Is(err, libvirtclient.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return image, nil
+	}
+	return nil, nil
 }
 
 // getLibvirtClientMachine gets a new LibvirtClientMachine instance from a LibvirtMachine
@@ -314,6 +960,43 @@ func getLibvirtClientMachine(libvirtMachine *infrav1.LibvirtMachine) *libvirtcli
 		backingImageFormat = *libvirtMachine.Spec.BackingImageFormat
 	}
 
+	architecture := libvirtclient.DefaultArchitecture
+	if libvirtMachine.Spec.Architecture != "" {
+		architecture = string(libvirtMachine.Spec.Architecture)
+	}
+
+	firmware := infrav1.LibvirtMachineFirmware{}
+	if libvirtMachine.Spec.Firmware != nil {
+		firmware = *libvirtMachine.Spec.Firmware
+	}
+
+	additionalDisks := make([]libvirtclient.LibvirtClientDisk, 0, len(libvirtMachine.Spec.AdditionalDisks))
+	for _, disk := range libvirtMachine.Spec.AdditionalDisks {
+		additionalDisks = append(additionalDisks, libvirtclient.LibvirtClientDisk{
+			Name:            disk.Name,
+			Size:            disk.Size,
+			StoragePoolName: ptr.Deref(disk.StoragePool, ""),
+			Format:          ptr.Deref(disk.Format, ""),
+			Bus:             string(disk.Bus),
+			Cache:           string(disk.CacheMode),
+		})
+	}
+
+	networkInterfaces := make([]libvirtclient.LibvirtClientNetworkInterface, 0, len(libvirtMachine.Spec.NetworkInterfaces))
+	for _, iface := range libvirtMachine.Spec.NetworkInterfaces {
+		networkInterface := libvirtclient.LibvirtClientNetworkInterface{
+			NetworkName: iface.Network,
+			Model:       ptr.Deref(iface.Model, ""),
+			MACAddress:  ptr.Deref(iface.MACAddress, ""),
+			Primary:     iface.Primary,
+		}
+		if iface.DHCPReservation != nil {
+			networkInterface.ReservedIPAddress = string(iface.DHCPReservation.IPAddress)
+			networkInterface.ReservedHostname = ptr.Deref(iface.DHCPReservation.Hostname, "")
+		}
+		networkInterfaces = append(networkInterfaces, networkInterface)
+	}
+
 	return &libvirtclient.LibvirtClientMachine{
 		// NOTE: ideally, we could use "{namespace}-{name}" like this: fmt.Sprintf("%s-%s", libvirtMachine.Namespace, libvirtMachine.Name)
 		// but because this will become the hostname of the VM, this name can be too long in some cases (e.g. when created as part of a ClusterClass)
@@ -322,8 +1005,78 @@ func getLibvirtClientMachine(libvirtMachine *infrav1.LibvirtMachine) *libvirtcli
 		StoragePoolName:    storagePoolName,
 		CPU:                libvirtMachine.Spec.CPU,
 		Memory:             libvirtMachine.Spec.Memory,
+		MaxCPU:             ptr.Deref(libvirtMachine.Spec.MaxCPU, 0),
+		MaxMemory:          ptr.Deref(libvirtMachine.Spec.MaxMemory, 0),
 		DiskSize:           libvirtMachine.Spec.DiskSize,
 		BackingImagePath:   libvirtMachine.Spec.BackingImagePath,
 		BackingImageFormat: backingImageFormat,
+		CloneMode:          string(libvirtMachine.Spec.CloneMode),
+		Architecture:       architecture,
+		AllowEmulation:     libvirtMachine.Spec.AllowEmulation,
+		Firmware:           string(firmware.Type),
+		SecureBoot:         firmware.SecureBoot,
+		TPM:                firmware.TPM,
+		IgnitionDelivery:   string(libvirtMachine.Spec.IgnitionDelivery),
+		AdditionalDisks:    additionalDisks,
+		NetworkInterfaces:  networkInterfaces,
+		NetworkConfig:      getNetworkConfig(libvirtMachine.Spec.NetworkConfig),
+	}
+}
+
+// getNetworkConfig converts the NetworkConfig of a LibvirtMachine into the NetworkConfig of a LibvirtClientMachine
+func getNetworkConfig(networkConfig *infrav1.LibvirtMachineNetworkConfig) *libvirtclient.NetworkConfig {
+	if networkConfig == nil {
+		return nil
+	}
+
+	toStrings := func(values []infrav1.IPAddress) []string {
+		var strs []string
+		for _, value := range values {
+			strs = append(strs, string(value))
+		}
+		return strs
+	}
+	deviceConfig := func(config infrav1.LibvirtMachineNetworkDeviceConfig) libvirtclient.NetworkDeviceConfig {
+		device := libvirtclient.NetworkDeviceConfig{
+			Gateway:       string(ptr.Deref(config.Gateway, "")),
+			Nameservers:   toStrings(config.Nameservers),
+			SearchDomains: config.SearchDomains,
+			DHCP4:         config.DHCP4,
+			DHCP6:         config.DHCP6,
+			MTU:           ptr.Deref(config.MTU, 0),
+		}
+		for _, address := range config.Addresses {
+			device.Addresses = append(device.Addresses, string(address))
+		}
+		for _, route := range config.Routes {
+			device.Routes = append(device.Routes, libvirtclient.NetworkRoute{To: string(route.To), Via: string(route.Via), Metric: route.Metric})
+		}
+		return device
+	}
+
+	config := &libvirtclient.NetworkConfig{}
+	for _, ethernet := range networkConfig.Ethernets {
+		config.Ethernets = append(config.Ethernets, libvirtclient.NetworkEthernet{
+			Name:                ethernet.Name,
+			Interface:           int(ethernet.Interface),
+			NetworkDeviceConfig: deviceConfig(ethernet.LibvirtMachineNetworkDeviceConfig),
+		})
+	}
+	for _, bond := range networkConfig.Bonds {
+		config.Bonds = append(config.Bonds, libvirtclient.NetworkBond{
+			Name:                bond.Name,
+			Interfaces:          bond.Interfaces,
+			Mode:                ptr.Deref(bond.Mode, ""),
+			NetworkDeviceConfig: deviceConfig(bond.LibvirtMachineNetworkDeviceConfig),
+		})
+	}
+	for _, vlan := range networkConfig.VLANs {
+		config.VLANs = append(config.VLANs, libvirtclient.NetworkVLAN{
+			Name:                vlan.Name,
+			ID:                  vlan.ID,
+			Link:                vlan.Link,
+			NetworkDeviceConfig: deviceConfig(vlan.LibvirtMachineNetworkDeviceConfig),
+		})
 	}
+	return config
 }
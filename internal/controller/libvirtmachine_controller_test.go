@@ -2,16 +2,29 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	infrav1 "github.com/joshuagrisham/cluster-api-provider-libvirt/api/v1beta2"
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient"
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient/fake"
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient/libvirtxml"
 )
 
 var _ = Describe("LibvirtMachine Controller", func() {
@@ -65,4 +78,1301 @@ var _ = Describe("LibvirtMachine Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When reconciling a LibvirtMachine owned by a Machine in a provisioned Cluster", func() {
+		const (
+			namespace   = "default"
+			clusterName = "test-cluster"
+			machineName = "test-machine"
+			secretName  = "test-machine-bootstrap"
+			userData    = "#cloud-config\nhostname: test-machine\n"
+		)
+
+		ctx := context.Background()
+
+		machineKey := types.NamespacedName{Name: machineName, Namespace: namespace}
+
+		var (
+			libvirt    *fake.LibvirtClient
+			recorder   *record.FakeRecorder
+			reconciler *LibvirtMachineReconciler
+		)
+
+		// recordedEvents returns the Events recorded since the last call as "<type> <reason> <message>"
+		recordedEvents := func() []string {
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			return events
+		}
+
+		getLibvirtMachine := func() *infrav1.LibvirtMachine {
+			libvirtMachine := &infrav1.LibvirtMachine{}
+			Expect(k8sClient.Get(ctx, machineKey, libvirtMachine)).To(Succeed())
+			return libvirtMachine
+		}
+
+		reconcileMachine := func() reconcile.Result {
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: machineKey})
+			Expect(err).NotTo(HaveOccurred())
+			return result
+		}
+
+		BeforeEach(func() {
+			libvirt = fake.NewLibvirtClient().AddStoragePool("default").AddNetwork("default")
+			recorder = record.NewFakeRecorder(1000)
+			reconciler = &LibvirtMachineReconciler{
+				Client:           k8sClient,
+				Scheme:           k8sClient.Scheme(),
+				NewLibvirtClient: libvirt.Factory(),
+				Recorder:         recorder,
+			}
+
+			By("creating the bootstrap data Secret")
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: namespace},
+				Data: map[string][]byte{
+					"value":  []byte(userData),
+					"format": []byte("cloud-config"),
+				},
+			})).To(Succeed())
+
+			By("creating a provisioned Cluster and its LibvirtCluster")
+			cluster := &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: namespace},
+				Spec: clusterv1.ClusterSpec{
+					InfrastructureRef: clusterv1.ContractVersionedObjectReference{
+						APIGroup: infrav1.GroupVersion.Group,
+						Kind:     "LibvirtCluster",
+						Name:     clusterName,
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+			cluster.Status.Initialization.InfrastructureProvisioned = ptr.To(true)
+			Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+
+			Expect(k8sClient.Create(ctx, &infrav1.LibvirtCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: namespace},
+			})).To(Succeed())
+
+			By("creating a Machine and its LibvirtMachine")
+			machine := &clusterv1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      machineName,
+					Namespace: namespace,
+					Labels:    map[string]string{clusterv1.ClusterNameLabel: clusterName},
+				},
+				Spec: clusterv1.MachineSpec{
+					ClusterName: clusterName,
+					Bootstrap:   clusterv1.Bootstrap{DataSecretName: ptr.To(secretName)},
+					InfrastructureRef: clusterv1.ContractVersionedObjectReference{
+						APIGroup: infrav1.GroupVersion.Group,
+						Kind:     "LibvirtMachine",
+						Name:     machineName,
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, machine)).To(Succeed())
+
+			Expect(k8sClient.Create(ctx, &infrav1.LibvirtMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      machineName,
+					Namespace: namespace,
+					Labels:    map[string]string{clusterv1.ClusterNameLabel: clusterName},
+					OwnerReferences: []metav1.OwnerReference{{
+						APIVersion: clusterv1.GroupVersion.String(),
+						Kind:       "Machine",
+						Name:       machine.Name,
+						UID:        machine.UID,
+					}},
+				},
+				Spec: infrav1.LibvirtMachineSpec{
+					CPU:              2,
+					Memory:           2048,
+					DiskSize:         20,
+					BackingImagePath: "/images/base.qcow2",
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			libvirtMachine := &infrav1.LibvirtMachine{}
+			if err := k8sClient.Get(ctx, machineKey, libvirtMachine); err == nil {
+				controllerutil.RemoveFinalizer(libvirtMachine, infrav1.MachineFinalizer)
+				Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+				// A LibvirtMachine which is already being deleted is gone once its finalizer is removed
+				Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, libvirtMachine))).To(Succeed())
+			}
+			for _, obj := range []client.Object{
+				&clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: machineName, Namespace: namespace}},
+				&infrav1.LibvirtCluster{ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: namespace}},
+				&clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: namespace}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: namespace}},
+			} {
+				Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, obj))).To(Succeed())
+			}
+		})
+
+		It("should create the virtual machine with the bootstrap data", func() {
+			Expect(reconcileMachine().RequeueAfter).To(Equal(10 * time.Second))
+
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Running).To(BeTrue())
+			Expect(domain.Machine.CPU).To(Equal(int32(2)))
+			Expect(domain.Machine.Memory).To(Equal(int32(2048)))
+			Expect(domain.Machine.NetworkName).To(Equal("default"))
+			Expect(domain.Machine.BackingImageFormat).To(Equal("qcow2"))
+			Expect(domain.Machine.Architecture).To(Equal("amd64"))
+			Expect(domain.Machine.UserData).To(Equal(userData))
+			Expect(libvirt.Volumes("default")).To(ConsistOf(machineName+".qcow2", machineName+"-cloudinit.iso"))
+
+			Expect(getLibvirtMachine().Finalizers).To(ContainElement(infrav1.MachineFinalizer))
+			Expect(recordedEvents()).To(ConsistOf(HavePrefix("Normal VirtualMachineCreated Created virtual machine '" + machineName + "'")))
+		})
+
+		It("should create the virtual machine with the firmware options", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.Firmware = &infrav1.LibvirtMachineFirmware{Type: infrav1.FirmwareTypeEFI, SecureBoot: true, TPM: true}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			Expect(reconcileMachine().RequeueAfter).To(Equal(10 * time.Second))
+
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.Firmware).To(Equal("efi"))
+			Expect(domain.Machine.SecureBoot).To(BeTrue())
+			Expect(domain.Machine.TPM).To(BeTrue())
+		})
+
+		It("should reject Secure Boot without the efi firmware type", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.Firmware = &infrav1.LibvirtMachineFirmware{SecureBoot: true}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(MatchError(ContainSubstring("secureBoot requires the efi firmware type")))
+		})
+
+		It("should create the virtual machine with Ignition bootstrap data instead of a cloud-init ISO", func() {
+			const ignition = `{"ignition":{"version":"3.4.0"}}`
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: secretName, Namespace: namespace}, secret)).To(Succeed())
+			secret.Data["value"] = []byte(ignition)
+			secret.Data["format"] = []byte("ignition")
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.IgnitionDelivery = infrav1.IgnitionDeliveryVolume
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			Expect(reconcileMachine().RequeueAfter).To(Equal(10 * time.Second))
+
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.UserData).To(Equal(ignition))
+			Expect(domain.Machine.BootstrapFormat).To(Equal("ignition"))
+			Expect(domain.Machine.IgnitionDelivery).To(Equal("volume"))
+			Expect(libvirt.Volumes("default")).To(ConsistOf(machineName+".qcow2", machineName+"-ignition.ign"))
+
+			Expect(k8sClient.Delete(ctx, getLibvirtMachine())).To(Succeed())
+			reconcileMachine()
+			Expect(libvirt.Volumes("default")).To(BeEmpty())
+		})
+
+		It("should reject unsupported bootstrap data formats", func() {
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: secretName, Namespace: namespace}, secret)).To(Succeed())
+			secret.Data["format"] = []byte("mime")
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: machineKey})
+			Expect(err).To(MatchError(ContainSubstring("unsupported bootstrap data format: mime")))
+			libvirtMachine := getLibvirtMachine()
+			Expect(conditions.GetReason(libvirtMachine, infrav1.LibvirtMachineBootstrapDataAvailableCondition)).To(Equal(infrav1.LibvirtMachineBootstrapDataInvalidReason))
+			Expect(conditions.GetMessage(libvirtMachine, infrav1.LibvirtMachineBootstrapDataAvailableCondition)).To(ContainSubstring("mime"))
+		})
+
+		It("should wait for the bootstrap data before creating the virtual machine", func() {
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: secretName, Namespace: namespace}, secret)).To(Succeed())
+			secret.Data["value"] = []byte{}
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+
+			// The Secret is watched, so there is no need to poll for it
+			Expect(reconcileMachine().RequeueAfter).To(BeZero())
+
+			_, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeFalse())
+			libvirtMachine := getLibvirtMachine()
+			Expect(conditions.IsFalse(libvirtMachine, infrav1.LibvirtMachineBootstrapDataAvailableCondition)).To(BeTrue())
+			Expect(conditions.GetReason(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition)).To(Equal(infrav1.LibvirtMachineWaitingForBootstrapDataReason))
+			Expect(conditions.GetReason(libvirtMachine, infrav1.LibvirtMachineReadyCondition)).To(Equal(infrav1.LibvirtMachineNotReadyReason))
+			Expect(conditions.GetMessage(libvirtMachine, infrav1.LibvirtMachineReadyCondition)).To(ContainSubstring("to be populated"))
+			Expect(recordedEvents()).To(ConsistOf(HavePrefix("Normal WaitingForBootstrapData")))
+
+			By("recording the Event only when it starts waiting")
+			reconcileMachine()
+			Expect(recordedEvents()).To(BeEmpty())
+		})
+
+		It("should map the Machine, Cluster and bootstrap data Secret to the LibvirtMachine", func() {
+			request := reconcile.Request{NamespacedName: machineKey}
+
+			machine := &clusterv1.Machine{}
+			Expect(k8sClient.Get(ctx, machineKey, machine)).To(Succeed())
+			mapMachine := util.MachineToInfrastructureMapFunc(infrav1.GroupVersion.WithKind("LibvirtMachine"))
+			Expect(mapMachine(ctx, machine)).To(ConsistOf(request))
+
+			mapCluster, err := util.ClusterToTypedObjectsMapper(k8sClient, &infrav1.LibvirtMachineList{}, k8sClient.Scheme())
+			Expect(err).NotTo(HaveOccurred())
+			cluster := &clusterv1.Cluster{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: clusterName, Namespace: namespace}, cluster)).To(Succeed())
+			Expect(mapCluster(ctx, cluster)).To(ConsistOf(request))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: secretName, Namespace: namespace}, secret)).To(Succeed())
+			Expect(reconciler.secretToLibvirtMachines(ctx, secret)).To(ConsistOf(request))
+
+			By("ignoring Secrets of other clusters and Secrets not used for bootstrap data")
+			secret.Labels = map[string]string{clusterv1.ClusterNameLabel: "other-cluster"}
+			Expect(reconciler.secretToLibvirtMachines(ctx, secret)).To(BeEmpty())
+			other := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: namespace}}
+			Expect(reconciler.secretToLibvirtMachines(ctx, other)).To(BeEmpty())
+
+			By("only watching the Secrets of Cluster API")
+			Expect(isBootstrapDataSecret(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{clusterv1.ClusterNameLabel: clusterName}},
+				Type:       clusterv1.ClusterSecretType,
+			})).To(BeTrue())
+			Expect(isBootstrapDataSecret(&corev1.Secret{Type: clusterv1.ClusterSecretType})).To(BeFalse())
+			Expect(isBootstrapDataSecret(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{clusterv1.ClusterNameLabel: clusterName}},
+				Type:       corev1.SecretTypeOpaque,
+			})).To(BeFalse())
+		})
+
+		It("should map the lifecycle events of its virtual machine to the LibvirtMachine", func() {
+			reconcileMachine()
+			host := getLibvirtMachine().Status.Host
+			Expect(host).NotTo(BeNil())
+
+			Expect(reconciler.domainEventToLibvirtMachines(ctx, libvirtclient.DomainEvent{URI: host.URI, Domain: machineName, Event: "Crashed"})).
+				To(ConsistOf(reconcile.Request{NamespacedName: machineKey}))
+
+			By("ignoring events of other virtual machines and libvirt hosts")
+			Expect(reconciler.domainEventToLibvirtMachines(ctx, libvirtclient.DomainEvent{URI: host.URI, Domain: "other", Event: "Crashed"})).To(BeEmpty())
+			Expect(reconciler.domainEventToLibvirtMachines(ctx, libvirtclient.DomainEvent{URI: "qemu+tcp://other/system", Domain: machineName, Event: "Crashed"})).To(BeEmpty())
+		})
+
+		It("should wait for the virtual machine to be running", func() {
+			reconcileMachine()
+			Expect(libvirt.SetRunning(machineName, false)).To(Succeed())
+
+			Expect(reconcileMachine().RequeueAfter).To(Equal(10 * time.Second))
+
+			libvirtMachine := getLibvirtMachine()
+			Expect(libvirtMachine.Spec.ProviderID).To(Equal("libvirt:///" + machineName))
+			Expect(libvirtMachine.Status.Initialization.Provisioned).To(BeFalse())
+			Expect(conditions.GetReason(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition)).To(Equal(infrav1.LibvirtMachineVirtualMachineNotRunningReason))
+		})
+
+		It("should mark the LibvirtMachine as provisioned once the virtual machine has an IP address", func() {
+			reconcileMachine()
+
+			By("waiting for an IP address")
+			Expect(reconcileMachine().RequeueAfter).To(Equal(10 * time.Second))
+			libvirtMachine := getLibvirtMachine()
+			Expect(libvirtMachine.Status.Initialization.Provisioned).To(BeFalse())
+			Expect(conditions.IsTrue(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition)).To(BeTrue())
+			Expect(conditions.GetReason(libvirtMachine, infrav1.LibvirtMachineAddressesAvailableCondition)).To(Equal(infrav1.LibvirtMachineWaitingForAddressesReason))
+			Expect(conditions.IsFalse(libvirtMachine, infrav1.LibvirtMachineReadyCondition)).To(BeTrue())
+
+			By("leasing an IP address to the virtual machine")
+			libvirt.SetLeases(machineName, "192.168.122.10")
+			recordedEvents()
+			Expect(reconcileMachine().RequeueAfter).To(Equal(5 * time.Minute))
+			Expect(recordedEvents()).To(ConsistOf("Normal AddressesAcquired Virtual machine '" + machineName + "' acquired the IP addresses 192.168.122.10"))
+
+			libvirtMachine = getLibvirtMachine()
+			Expect(libvirtMachine.Status.Addresses).To(ConsistOf(clusterv1.MachineAddress{
+				Type:    clusterv1.MachineExternalIP,
+				Address: "192.168.122.10",
+			}))
+			Expect(libvirtMachine.Status.Ready).To(BeTrue())
+			Expect(libvirtMachine.Status.Initialization.Provisioned).To(BeTrue())
+			for _, conditionType := range []string{
+				infrav1.LibvirtMachineReadyCondition,
+				infrav1.LibvirtMachineLibvirtConnectedCondition,
+				infrav1.LibvirtMachineVirtualMachineProvisionedCondition,
+				infrav1.LibvirtMachineBootstrapDataAvailableCondition,
+				infrav1.LibvirtMachineAddressesAvailableCondition,
+				infrav1.LibvirtMachineDiskSizeReconciledCondition,
+			} {
+				Expect(conditions.IsTrue(libvirtMachine, conditionType)).To(BeTrue(), conditionType)
+			}
+			Expect(conditions.IsFalse(libvirtMachine, infrav1.LibvirtMachineDriftDetectedCondition)).To(BeTrue())
+		})
+
+		It("should report the addresses of each network interface with the primary interface first", func() {
+			libvirt.AddNetwork("storage")
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.NetworkInterfaces = []infrav1.LibvirtMachineNetworkInterface{
+				{Network: "storage", MACAddress: ptr.To("52:54:00:12:34:56")},
+				{Network: "default", Primary: true},
+			}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			reconcileMachine()
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.Interfaces()).To(HaveLen(2))
+
+			By("waiting for an IP address of the primary interface")
+			libvirt.SetInterfaceLeases(machineName, 0, "10.0.0.10")
+			Expect(reconcileMachine().RequeueAfter).To(Equal(10 * time.Second))
+			Expect(getLibvirtMachine().Status.Initialization.Provisioned).To(BeFalse())
+
+			libvirt.SetLeases(machineName, "192.168.122.10")
+			Expect(reconcileMachine().RequeueAfter).To(Equal(5 * time.Minute))
+
+			libvirtMachine = getLibvirtMachine()
+			Expect(libvirtMachine.Status.Addresses).To(Equal([]clusterv1.MachineAddress{
+				{Type: clusterv1.MachineExternalIP, Address: "192.168.122.10"},
+				{Type: clusterv1.MachineExternalIP, Address: "10.0.0.10"},
+			}))
+			Expect(libvirtMachine.Status.NetworkInterfaces).To(Equal([]infrav1.LibvirtMachineNetworkInterfaceStatus{
+				{Network: "default", MACAddress: domain.Machine.MACAddress(1), Primary: true, Addresses: []string{"192.168.122.10"}},
+				{Network: "storage", MACAddress: "52:54:00:12:34:56", Addresses: []string{"10.0.0.10"}},
+			}))
+			Expect(libvirtMachine.Status.Initialization.Provisioned).To(BeTrue())
+		})
+
+		It("should reserve the IP address of the virtual machine in its network until it is deleted", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.NetworkInterfaces = []infrav1.LibvirtMachineNetworkInterface{{
+				Network:         "default",
+				DHCPReservation: &infrav1.LibvirtMachineDHCPReservation{IPAddress: "192.168.122.10"},
+			}}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			reconcileMachine()
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			mac := domain.Machine.MACAddress(0)
+			Expect(libvirt.DHCPHosts("default")).To(ConsistOf(libvirtxml.NetworkDHCPHost{MAC: mac, Name: machineName, IP: "192.168.122.10"}))
+
+			By("keeping the MAC address and the reservation when the virtual machine is recreated")
+			libvirtMachine = getLibvirtMachine()
+			libvirtMachine.Spec.NetworkInterfaces[0].Model = ptr.To("e1000e")
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+			Expect(reconcileMachine().RequeueAfter).To(Equal(30 * time.Second))
+			reconcileMachine()
+			domain, ok = libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.MACAddress(0)).To(Equal(mac))
+			Expect(libvirt.DHCPHosts("default")).To(ConsistOf(libvirtxml.NetworkDHCPHost{MAC: mac, Name: machineName, IP: "192.168.122.10"}))
+
+			By("removing the reservation when the virtual machine is deleted")
+			Expect(k8sClient.Delete(ctx, getLibvirtMachine())).To(Succeed())
+			reconcileMachine()
+			Expect(libvirt.DHCPHosts("default")).To(BeEmpty())
+		})
+
+		It("should report the static addresses of the network config without waiting for DHCP leases", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.NetworkConfig = &infrav1.LibvirtMachineNetworkConfig{
+				Ethernets: []infrav1.LibvirtMachineEthernet{{
+					Name: "eth0",
+					LibvirtMachineNetworkDeviceConfig: infrav1.LibvirtMachineNetworkDeviceConfig{
+						Addresses: []infrav1.CIDR{"192.168.122.10/24"},
+						Gateway:   ptr.To[infrav1.IPAddress]("192.168.122.1"),
+					},
+				}},
+			}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			reconcileMachine()
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.NetworkConfig.Ethernets).To(ConsistOf(libvirtclient.NetworkEthernet{
+				Name: "eth0",
+				NetworkDeviceConfig: libvirtclient.NetworkDeviceConfig{
+					Addresses: []string{"192.168.122.10/24"},
+					Gateway:   "192.168.122.1",
+				},
+			}))
+
+			Expect(reconcileMachine().RequeueAfter).To(Equal(5 * time.Minute))
+			libvirtMachine = getLibvirtMachine()
+			Expect(libvirtMachine.Status.Addresses).To(Equal([]clusterv1.MachineAddress{
+				{Type: clusterv1.MachineExternalIP, Address: "192.168.122.10"},
+			}))
+			Expect(libvirtMachine.Status.Initialization.Provisioned).To(BeTrue())
+		})
+
+		It("should reject invalid static addresses", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.NetworkConfig = &infrav1.LibvirtMachineNetworkConfig{
+				Ethernets: []infrav1.LibvirtMachineEthernet{{
+					Name: "eth0",
+					LibvirtMachineNetworkDeviceConfig: infrav1.LibvirtMachineNetworkDeviceConfig{
+						Addresses: []infrav1.CIDR{"192.168.122.10"},
+					},
+				}},
+			}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(MatchError(ContainSubstring("must be an IP address with a prefix length")))
+		})
+
+		It("should reject more than one primary network interface", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.NetworkInterfaces = []infrav1.LibvirtMachineNetworkInterface{
+				{Network: "default", Primary: true},
+				{Network: "storage", Primary: true},
+			}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(MatchError(ContainSubstring("only one network interface can be primary")))
+		})
+
+		It("should recreate the virtual machine when it has drifted from the spec", func() {
+			reconcileMachine()
+			libvirt.SetLeases(machineName, "192.168.122.10")
+			reconcileMachine()
+
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.NetworkInterfaces = []infrav1.LibvirtMachineNetworkInterface{{Network: "default", Model: ptr.To("e1000e")}}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			By("destroying the out-of-sync virtual machine")
+			recordedEvents()
+			Expect(reconcileMachine().RequeueAfter).To(Equal(30 * time.Second))
+			_, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeFalse())
+			Expect(recordedEvents()).To(ConsistOf(HavePrefix("Normal VirtualMachineDrifted Destroyed virtual machine '" + machineName + "'")))
+			libvirtMachine = getLibvirtMachine()
+			Expect(libvirtMachine.Spec.ProviderID).To(BeEmpty())
+			Expect(libvirtMachine.Status.Addresses).To(BeEmpty())
+			Expect(libvirtMachine.Status.Initialization.Provisioned).To(BeFalse())
+			Expect(conditions.IsTrue(libvirtMachine, infrav1.LibvirtMachineDriftDetectedCondition)).To(BeTrue())
+			Expect(conditions.GetReason(libvirtMachine, infrav1.LibvirtMachineVirtualMachineProvisionedCondition)).To(Equal(infrav1.LibvirtMachineRecreatingReason))
+			Expect(conditions.IsFalse(libvirtMachine, infrav1.LibvirtMachineReadyCondition)).To(BeTrue())
+
+			By("creating it again with the new spec")
+			reconcileMachine()
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.Interfaces()[0].Model).To(Equal("e1000e"))
+		})
+
+		It("should scale the vCPUs and memory of the virtual machine in place", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.MaxCPU = ptr.To(int32(4))
+			libvirtMachine.Spec.MaxMemory = ptr.To(int32(8192))
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+			reconcileMachine()
+			libvirt.SetLeases(machineName, "192.168.122.10")
+			reconcileMachine()
+
+			By("applying changes within the maximums without a restart")
+			libvirtMachine = getLibvirtMachine()
+			libvirtMachine.Spec.CPU = 4
+			libvirtMachine.Spec.Memory = 8192
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+			reconcileMachine()
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.CPU).To(Equal(int32(4)))
+			Expect(domain.Machine.Memory).To(Equal(int32(8192)))
+			Expect(domain.Restarts).To(BeZero())
+			Expect(getLibvirtMachine().Status.Initialization.Provisioned).To(BeTrue())
+
+			By("shutting down the virtual machine without waiting for it when a maximum changes")
+			libvirtMachine = getLibvirtMachine()
+			libvirtMachine.Spec.MaxCPU = ptr.To(int32(8))
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+			Expect(reconcileMachine().RequeueAfter).To(BeNumerically(">", 0))
+			domain, _ = libvirt.Domain(machineName)
+			Expect(domain.Machine.MaxCPU).To(Equal(int32(8)))
+			Expect(domain.Shutdowns).To(Equal(1))
+			Expect(domain.Restarts).To(BeZero())
+			Expect(conditions.GetReason(getLibvirtMachine(), infrav1.LibvirtMachineResourcesReconciledCondition)).To(Equal(infrav1.LibvirtMachineRestartPendingReason))
+
+			By("waiting for it to shut down")
+			Expect(reconcileMachine().RequeueAfter).To(BeNumerically(">", 0))
+			domain, _ = libvirt.Domain(machineName)
+			Expect(domain.Shutdowns).To(Equal(1))
+			Expect(domain.Restarts).To(BeZero())
+
+			By("starting it again once it is shut off")
+			Expect(libvirt.SetRunning(machineName, false)).To(Succeed())
+			reconcileMachine()
+			domain, _ = libvirt.Domain(machineName)
+			Expect(domain.Running).To(BeTrue())
+			Expect(domain.Restarts).To(Equal(1))
+			libvirtMachine = getLibvirtMachine()
+			Expect(conditions.GetReason(libvirtMachine, infrav1.LibvirtMachineResourcesReconciledCondition)).To(Equal(infrav1.LibvirtMachineResourcesReconciledReason))
+			Expect(libvirtMachine.Spec.ProviderID).NotTo(BeEmpty())
+			Expect(recordedEvents()).To(ContainElement(ContainSubstring(eventReasonVirtualMachineRestarted)))
+		})
+
+		It("should stop a virtual machine which does not shut down in time to restart it", func() {
+			reconcileMachine()
+			libvirt.SetLeases(machineName, "192.168.122.10")
+			reconcileMachine()
+
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.MaxMemory = ptr.To(int32(8192))
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+			reconcileMachine()
+			domain, _ := libvirt.Domain(machineName)
+			Expect(domain.Shutdowns).To(Equal(1))
+
+			By("stopping it once the shutdown timed out")
+			libvirtMachine = getLibvirtMachine()
+			condition := conditions.Get(libvirtMachine, infrav1.LibvirtMachineResourcesReconciledCondition)
+			Expect(condition).NotTo(BeNil())
+			condition.LastTransitionTime = metav1.NewTime(time.Now().Add(-restartShutdownTimeout - time.Minute))
+			conditions.Delete(libvirtMachine, infrav1.LibvirtMachineResourcesReconciledCondition)
+			conditions.Set(libvirtMachine, *condition)
+			Expect(k8sClient.Status().Update(ctx, libvirtMachine)).To(Succeed())
+			reconcileMachine()
+			domain, _ = libvirt.Domain(machineName)
+			Expect(domain.Running).To(BeTrue())
+			Expect(domain.Restarts).To(Equal(1))
+			Expect(conditions.IsTrue(getLibvirtMachine(), infrav1.LibvirtMachineResourcesReconciledCondition)).To(BeTrue())
+		})
+
+		It("should grow the disk of the virtual machine and reject shrinking it", func() {
+			reconcileMachine()
+			libvirt.SetLeases(machineName, "192.168.122.10")
+			reconcileMachine()
+			Expect(conditions.GetReason(getLibvirtMachine(), infrav1.LibvirtMachineDiskSizeReconciledCondition)).To(Equal(infrav1.LibvirtMachineDiskSizeReconciledReason))
+
+			By("growing the disk")
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.DiskSize = 40
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+			reconcileMachine()
+			disk, err := libvirt.GetStorageVolume("default", machineName+".qcow2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(disk.Capacity).To(Equal(uint64(40 * 1024 * 1024 * 1024)))
+			domain, _ := libvirt.Domain(machineName)
+			Expect(domain.Machine.DiskSize).To(Equal(int32(40)))
+
+			By("reporting a smaller disk size in the condition without recreating the virtual machine")
+			libvirtMachine = getLibvirtMachine()
+			libvirtMachine.Spec.DiskSize = 20
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+			reconcileMachine()
+			libvirtMachine = getLibvirtMachine()
+			Expect(conditions.IsFalse(libvirtMachine, infrav1.LibvirtMachineDiskSizeReconciledCondition)).To(BeTrue())
+			Expect(conditions.GetReason(libvirtMachine, infrav1.LibvirtMachineDiskSizeReconciledCondition)).To(Equal(infrav1.LibvirtMachineDiskShrinkNotSupportedReason))
+			Expect(libvirtMachine.Status.Initialization.Provisioned).To(BeTrue())
+			disk, _ = libvirt.GetStorageVolume("default", machineName+".qcow2")
+			Expect(disk.Capacity).To(Equal(uint64(40 * 1024 * 1024 * 1024)))
+		})
+
+		It("should reject a maximum less than the vCPUs or memory", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.MaxCPU = ptr.To(libvirtMachine.Spec.CPU - 1)
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(MatchError(ContainSubstring("maxCPU must not be less than cpu")))
+			libvirtMachine = getLibvirtMachine()
+			libvirtMachine.Spec.MaxMemory = ptr.To(libvirtMachine.Spec.Memory - 1)
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(MatchError(ContainSubstring("maxMemory must not be less than memory")))
+		})
+
+		It("should create, recreate and delete the additional disks of the virtual machine", func() {
+			libvirt.AddStoragePool("fast")
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.AdditionalDisks = []infrav1.LibvirtMachineDisk{
+				{Name: "etcd", Size: 10, StoragePool: ptr.To("fast"), CacheMode: "none"},
+			}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			reconcileMachine()
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.AdditionalDisks).To(ConsistOf(libvirtclient.LibvirtClientDisk{
+				Name: "etcd", Size: 10, StoragePoolName: "fast", Cache: "none",
+			}))
+			Expect(libvirt.Volumes("fast")).To(ConsistOf(machineName + "-etcd.qcow2"))
+
+			By("recreating the virtual machine when a disk is added")
+			libvirtMachine = getLibvirtMachine()
+			libvirtMachine.Spec.AdditionalDisks = append(libvirtMachine.Spec.AdditionalDisks,
+				infrav1.LibvirtMachineDisk{Name: "data", Size: 100, Format: ptr.To("raw"), Bus: infrav1.DiskBusSCSI})
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+			Expect(reconcileMachine().RequeueAfter).To(Equal(30 * time.Second))
+			Expect(libvirt.Volumes("fast")).To(BeEmpty())
+			reconcileMachine()
+			Expect(libvirt.Volumes("fast")).To(ConsistOf(machineName + "-etcd.qcow2"))
+			Expect(libvirt.Volumes("default")).To(ConsistOf(machineName+".qcow2", machineName+"-cloudinit.iso", machineName+"-data.raw"))
+
+			By("deleting the disks together with the virtual machine")
+			Expect(k8sClient.Delete(ctx, getLibvirtMachine())).To(Succeed())
+			reconcileMachine()
+			Expect(libvirt.Volumes("fast")).To(BeEmpty())
+			Expect(libvirt.Volumes("default")).To(BeEmpty())
+		})
+
+		It("should remove the volumes of a virtual machine which could not be created and create it on retry", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.AdditionalDisks = []infrav1.LibvirtMachineDisk{
+				{Name: "data", Size: 100},
+				{Name: "etcd", Size: 10, StoragePool: ptr.To("fast")},
+			}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			By("failing to create the additional disk in a missing storage pool")
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: machineKey})
+			Expect(err).To(MatchError(ContainSubstring("failed to get storage pool 'fast'")))
+			_, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeFalse())
+			Expect(libvirt.Volumes("default")).To(BeEmpty())
+
+			By("recreating the volumes left over by an interrupted attempt and reusing those of additional disks")
+			libvirt.AddStorageVolume("default", machineName+".qcow2", 1)
+			libvirt.AddStorageVolume("default", machineName+"-data.qcow2", 100)
+			libvirt.AddStoragePool("fast")
+			reconcileMachine()
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.AdditionalDisks).To(HaveLen(2))
+			Expect(libvirt.Volumes("default")).To(ConsistOf(machineName+".qcow2", machineName+"-cloudinit.iso", machineName+"-data.qcow2"))
+			Expect(libvirt.Volumes("fast")).To(ConsistOf(machineName + "-etcd.qcow2"))
+			volume, err := libvirt.GetStorageVolume("default", machineName+".qcow2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volume.Capacity).To(Equal(uint64(20 * 1024 * 1024 * 1024)))
+			volume, err = libvirt.GetStorageVolume("default", machineName+"-data.qcow2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volume.Capacity).To(Equal(uint64(100)))
+		})
+
+		It("should use a cached backing image downloaded from a URL and keep it when the virtual machine is deleted", func() {
+			const checksum = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+			imageVolume := libvirtclient.ImageVolumeName(checksum, "qcow2")
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.BackingImagePath = ""
+			libvirtMachine.Spec.BackingImage = &infrav1.LibvirtMachineImage{
+				URL:      "https://cloud-images.example.com/noble-server-cloudimg-amd64.img",
+				Checksum: ptr.To("sha256:" + checksum),
+			}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			reconcileMachine()
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.BackingImagePath).To(Equal("/default/" + imageVolume))
+			Expect(libvirt.Volumes("default")).To(ConsistOf(machineName+".qcow2", machineName+"-cloudinit.iso", imageVolume))
+
+			Expect(k8sClient.Delete(ctx, getLibvirtMachine())).To(Succeed())
+			reconcileMachine()
+			Expect(libvirt.Volumes("default")).To(ConsistOf(imageVolume))
+		})
+
+		It("should record the checksum of a backing image downloaded without a checksum and not download it again", func() {
+			const url = "https://cloud-images.example.com/noble-server-cloudimg-amd64.img"
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.BackingImagePath = ""
+			libvirtMachine.Spec.BackingImage = &infrav1.LibvirtMachineImage{URL: url}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			reconcileMachine()
+			Expect(libvirt.Downloads(url)).To(Equal(1))
+			status := getLibvirtMachine().Status.BackingImage
+			Expect(status).NotTo(BeNil())
+			Expect(status.URL).To(Equal(url))
+			Expect(status.Checksum).NotTo(BeEmpty())
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.BackingImagePath).To(Equal("/default/" + libvirtclient.ImageVolumeName(status.Checksum, "qcow2")))
+
+			// Recreating the virtual machine finds the image in the cache by its recorded checksum
+			Expect(libvirt.Destroy(&domain.Machine)).To(Succeed())
+			reconcileMachine()
+			_, ok = libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(libvirt.Downloads(url)).To(Equal(1))
+		})
+
+		It("should requeue until the backing image has been downloaded in the background", func() {
+			const url = "https://cloud-images.example.com/noble-server-cloudimg-amd64.img"
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.BackingImagePath = ""
+			libvirtMachine.Spec.BackingImage = &infrav1.LibvirtMachineImage{URL: url}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			libvirt.SetDownloading(url, true)
+			result := reconcileMachine()
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			_, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeFalse())
+			condition := conditions.Get(getLibvirtMachine(), infrav1.LibvirtMachineVirtualMachineProvisionedCondition)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Reason).To(Equal(infrav1.LibvirtMachineDownloadingBackingImageReason))
+
+			libvirt.SetDownloading(url, false)
+			reconcileMachine()
+			_, ok = libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+		})
+
+		It("should use the checksum recorded by other LibvirtMachines to find a backing image in the cache", func() {
+			const (
+				url      = "https://cloud-images.example.com/noble-server-cloudimg-amd64.img"
+				checksum = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+			)
+			imageVolume := libvirtclient.ImageVolumeName(checksum, "qcow2")
+			libvirt.AddStorageVolume("default", imageVolume, 1<<30)
+			otherLibvirtMachine := &infrav1.LibvirtMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: "other-machine", Namespace: namespace},
+				Spec: infrav1.LibvirtMachineSpec{
+					CPU:          2,
+					Memory:       2048,
+					DiskSize:     20,
+					BackingImage: &infrav1.LibvirtMachineImage{URL: url},
+				},
+			}
+			Expect(k8sClient.Create(ctx, otherLibvirtMachine)).To(Succeed())
+			otherLibvirtMachine.Status.BackingImage = &infrav1.LibvirtMachineBackingImageStatus{URL: url, Checksum: checksum}
+			Expect(k8sClient.Status().Update(ctx, otherLibvirtMachine)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, otherLibvirtMachine)).To(Succeed())
+			})
+
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.BackingImagePath = ""
+			libvirtMachine.Spec.BackingImage = &infrav1.LibvirtMachineImage{URL: url}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			reconcileMachine()
+			Expect(libvirt.Downloads(url)).To(Equal(0))
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.BackingImagePath).To(Equal("/default/" + imageVolume))
+			Expect(getLibvirtMachine().Status.BackingImage.Checksum).To(Equal(checksum))
+		})
+
+		It("should not create the virtual machine if its backing image can not be downloaded", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.BackingImagePath = ""
+			libvirtMachine.Spec.StoragePool = ptr.To("missing")
+			libvirtMachine.Spec.BackingImage = &infrav1.LibvirtMachineImage{URL: "https://cloud-images.example.com/image.img"}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: machineKey})
+			Expect(err).To(HaveOccurred())
+			_, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeFalse())
+			condition := conditions.Get(getLibvirtMachine(), infrav1.LibvirtMachineVirtualMachineProvisionedCondition)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Reason).To(Equal(infrav1.LibvirtMachineBackingImageDownloadFailedReason))
+		})
+
+		It("should reject both a backing image path and URL", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.BackingImage = &infrav1.LibvirtMachineImage{URL: "https://cloud-images.example.com/image.img"}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(MatchError(ContainSubstring("only one of backingImagePath, backingImage and imageRef can be specified")))
+		})
+
+		It("should wait for the LibvirtImage and use it as the backing image", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.BackingImagePath = ""
+			libvirtMachine.Spec.ImageRef = &corev1.LocalObjectReference{Name: "test-image"}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			Expect(reconcileMachine().RequeueAfter).To(Equal(10 * time.Second))
+			_, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeFalse())
+
+			By("creating the LibvirtImage")
+			libvirtImage := &infrav1.LibvirtImage{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-image", Namespace: namespace},
+				Spec: infrav1.LibvirtImageSpec{
+					Source: infrav1.LibvirtImageSource{Volume: &infrav1.LibvirtImageVolume{Pool: "default", Name: "base.raw"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, libvirtImage)).To(Succeed())
+			defer func() { Expect(k8sClient.Delete(ctx, libvirtImage)).To(Succeed()) }()
+			Expect(reconcileMachine().RequeueAfter).To(Equal(10 * time.Second))
+			_, ok = libvirt.Domain(machineName)
+			Expect(ok).To(BeFalse())
+
+			By("using the image once the LibvirtImage is ready")
+			libvirtImage.Status = infrav1.LibvirtImageStatus{Ready: true, Path: "/default/base.raw", Format: "raw"}
+			Expect(k8sClient.Status().Update(ctx, libvirtImage)).To(Succeed())
+			reconcileMachine()
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.BackingImagePath).To(Equal("/default/base.raw"))
+			Expect(domain.Machine.BackingImageFormat).To(Equal("raw"))
+		})
+
+		It("should create the disk as a full copy of the backing image", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.CloneMode = infrav1.CloneModeFull
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+			reconcileMachine()
+			domain, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+			Expect(domain.Machine.CloneMode).To(Equal(libvirtclient.CloneModeFull))
+			Expect(libvirt.GetLinkedClones("/images/base.qcow2")).To(BeEmpty())
+		})
+
+		It("should reject more than one backing image source", func() {
+			libvirtMachine := getLibvirtMachine()
+			libvirtMachine.Spec.ImageRef = &corev1.LocalObjectReference{Name: "test-image"}
+			Expect(k8sClient.Update(ctx, libvirtMachine)).To(MatchError(ContainSubstring("only one of backingImagePath, backingImage and imageRef can be specified")))
+		})
+
+		It("should destroy the virtual machine and remove the finalizer when deleted", func() {
+			reconcileMachine()
+			Expect(k8sClient.Delete(ctx, getLibvirtMachine())).To(Succeed())
+
+			recordedEvents()
+			reconcileMachine()
+
+			_, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeFalse())
+			Expect(libvirt.Volumes("default")).To(BeEmpty())
+			err := k8sClient.Get(ctx, machineKey, &infrav1.LibvirtMachine{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			Expect(recordedEvents()).To(ConsistOf(
+				"Normal VirtualMachineDeleted Deleted virtual machine '"+machineName+"'",
+				HavePrefix("Normal FinalizerRemoved"),
+			))
+		})
+
+		It("should connect with the credentials Secret and report authentication failures", func() {
+			credentialsKey := types.NamespacedName{Name: "libvirt-credentials", Namespace: namespace}
+			credentialsSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: credentialsKey.Name, Namespace: credentialsKey.Namespace},
+				Data: map[string][]byte{
+					"username": []byte("caplv"),
+					"password": []byte("wrong"),
+				},
+			}
+			Expect(k8sClient.Create(ctx, credentialsSecret)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, credentialsSecret)).To(Succeed())
+			})
+
+			var credentials *libvirtclient.Credentials
+			reconciler.CredentialsSecret = &credentialsKey
+			reconciler.NewLibvirtClient = func(uri string, c *libvirtclient.Credentials) (libvirtclient.LibvirtClient, error) {
+				credentials = c
+				return nil, fmt.Errorf("failed to connect to libvirt: %w", libvirtclient.ErrAuthenticationFailed)
+			}
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: machineKey})
+			Expect(err).To(MatchError(libvirtclient.ErrAuthenticationFailed))
+			Expect(credentials).NotTo(BeNil())
+			Expect(credentials.Username).To(Equal("caplv"))
+			Expect(credentials.Password).To(Equal("wrong"))
+
+			condition := conditions.Get(getLibvirtMachine(), infrav1.LibvirtMachineLibvirtConnectedCondition)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(infrav1.LibvirtMachineLibvirtAuthenticationFailedReason))
+			Expect(recordedEvents()).To(ConsistOf(HavePrefix("Warning LibvirtError Failed to connect to libvirt host")))
+
+			By("connecting once the credentials are fixed")
+			reconciler.NewLibvirtClient = libvirt.Factory()
+			reconcileMachine()
+			condition = conditions.Get(getLibvirtMachine(), infrav1.LibvirtMachineLibvirtConnectedCondition)
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should connect to the URI of the LibvirtCluster with its credentials Secret", func() {
+			credentialsSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "libvirt-host-2-credentials", Namespace: namespace},
+				Data: map[string][]byte{
+					"username": []byte("caplv"),
+					"password": []byte("s3cr3t"),
+				},
+			}
+			Expect(k8sClient.Create(ctx, credentialsSecret)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, credentialsSecret)).To(Succeed())
+			})
+
+			libvirtCluster := &infrav1.LibvirtCluster{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: clusterName, Namespace: namespace}, libvirtCluster)).To(Succeed())
+			libvirtCluster.Spec.URI = "qemu+tls://libvirt-host-2.example.com/system"
+			libvirtCluster.Spec.CredentialsSecretRef = &corev1.LocalObjectReference{Name: credentialsSecret.Name}
+			Expect(k8sClient.Update(ctx, libvirtCluster)).To(Succeed())
+
+			var (
+				uri         string
+				credentials *libvirtclient.Credentials
+			)
+			reconciler.CredentialsSecret = &types.NamespacedName{Name: "libvirt-credentials", Namespace: "caplv-system"}
+			reconciler.NewLibvirtClient = func(u string, c *libvirtclient.Credentials) (libvirtclient.LibvirtClient, error) {
+				uri, credentials = u, c
+				return libvirt, nil
+			}
+
+			reconcileMachine()
+			Expect(uri).To(Equal("qemu+tls://libvirt-host-2.example.com/system"))
+			Expect(credentials).NotTo(BeNil())
+			Expect(credentials.Username).To(Equal("caplv"))
+			Expect(credentials.Password).To(Equal("s3cr3t"))
+			_, ok := libvirt.Domain(machineName)
+			Expect(ok).To(BeTrue())
+		})
+
+		Context("with multiple libvirt hosts", func() {
+			var hostA, hostB *fake.LibvirtClient
+
+			setHosts := func(hosts ...infrav1.LibvirtHost) {
+				libvirtCluster := &infrav1.LibvirtCluster{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: clusterName, Namespace: namespace}, libvirtCluster)).To(Succeed())
+				libvirtCluster.Spec.Hosts = hosts
+				Expect(k8sClient.Update(ctx, libvirtCluster)).To(Succeed())
+			}
+
+			BeforeEach(func() {
+				hostA = fake.NewLibvirtClient().AddStoragePool("default").AddNetwork("default").SetHostCapacity(4, 8192)
+				hostB = fake.NewLibvirtClient().AddStoragePool("default").AddNetwork("default").SetHostCapacity(16, 65536)
+				reconciler.NewLibvirtClient = func(uri string, _ *libvirtclient.Credentials) (libvirtclient.LibvirtClient, error) {
+					switch uri {
+					case "qemu+tcp://host-a/system":
+						return hostA, nil
+					case "qemu+tcp://host-b/system":
+						return hostB, nil
+					}
+					return nil, fmt.Errorf("unknown libvirt host %s", uri)
+				}
+				setHosts(
+					infrav1.LibvirtHost{Name: "a", URI: "qemu+tcp://host-a/system", Labels: map[string]string{"zone": "a"}},
+					infrav1.LibvirtHost{Name: "b", URI: "qemu+tcp://host-b/system", Labels: map[string]string{"zone": "b"}},
+				)
+			})
+
+			It("should place the virtual machine on the host with the most free capacity and keep using it", func() {
+				reconcileMachine()
+				_, ok := hostB.Domain(machineName)
+				Expect(ok).To(BeTrue())
+				Expect(getLibvirtMachine().Status.Host).To(Equal(&infrav1.LibvirtMachineHost{Name: "b", URI: "qemu+tcp://host-b/system"}))
+
+				By("preferring the other host by weight")
+				setHosts(
+					infrav1.LibvirtHost{Name: "a", URI: "qemu+tcp://host-a/system", Weight: ptr.To[int32](100)},
+					infrav1.LibvirtHost{Name: "b", URI: "qemu+tcp://host-b/system", Weight: ptr.To[int32](0)},
+				)
+				hostB.SetLeases(machineName, "192.168.122.10")
+				Expect(reconcileMachine().RequeueAfter).To(Equal(5 * time.Minute))
+				Expect(getLibvirtMachine().Status.Initialization.Provisioned).To(BeTrue())
+				_, ok = hostA.Domain(machineName)
+				Expect(ok).To(BeFalse())
+
+				By("deleting the virtual machine from its host")
+				Expect(k8sClient.Delete(ctx, getLibvirtMachine())).To(Succeed())
+				reconcileMachine()
+				_, ok = hostB.Domain(machineName)
+				Expect(ok).To(BeFalse())
+			})
+
+			It("should delete the virtual machine from its host after the LibvirtCluster is gone", func() {
+				credentialsSecret := &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "host-b-credentials", Namespace: namespace},
+					Data: map[string][]byte{
+						"username": []byte("caplv"),
+						"password": []byte("s3cr3t"),
+					},
+				}
+				Expect(k8sClient.Create(ctx, credentialsSecret)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(k8sClient.Delete(ctx, credentialsSecret)).To(Succeed())
+				})
+				setHosts(
+					infrav1.LibvirtHost{Name: "a", URI: "qemu+tcp://host-a/system"},
+					infrav1.LibvirtHost{Name: "b", URI: "qemu+tcp://host-b/system", CredentialsSecretRef: &corev1.LocalObjectReference{Name: credentialsSecret.Name}},
+				)
+
+				reconcileMachine()
+				_, ok := hostB.Domain(machineName)
+				Expect(ok).To(BeTrue())
+				Expect(getLibvirtMachine().Status.Host).To(Equal(&infrav1.LibvirtMachineHost{
+					Name:                 "b",
+					URI:                  "qemu+tcp://host-b/system",
+					CredentialsSecretRef: &corev1.SecretReference{Namespace: namespace, Name: credentialsSecret.Name},
+				}))
+
+				By("deleting the LibvirtCluster and then the LibvirtMachine")
+				Expect(k8sClient.Delete(ctx, &infrav1.LibvirtCluster{ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: namespace}})).To(Succeed())
+				Expect(k8sClient.Delete(ctx, getLibvirtMachine())).To(Succeed())
+
+				var credentials *libvirtclient.Credentials
+				factory := reconciler.NewLibvirtClient
+				reconciler.NewLibvirtClient = func(uri string, c *libvirtclient.Credentials) (libvirtclient.LibvirtClient, error) {
+					credentials = c
+					return factory(uri, c)
+				}
+				reconcileMachine()
+				_, ok = hostB.Domain(machineName)
+				Expect(ok).To(BeFalse())
+				Expect(credentials).NotTo(BeNil())
+				Expect(credentials.Username).To(Equal("caplv"))
+				err := k8sClient.Get(ctx, machineKey, &infrav1.LibvirtMachine{})
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+			})
+
+			It("should delete the virtual machine from its host after the host is removed from the LibvirtCluster", func() {
+				reconcileMachine()
+				_, ok := hostB.Domain(machineName)
+				Expect(ok).To(BeTrue())
+
+				setHosts(infrav1.LibvirtHost{Name: "a", URI: "qemu+tcp://host-a/system"})
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: machineKey})
+				Expect(err).To(MatchError(ContainSubstring("is no longer in the hosts of the LibvirtCluster")))
+
+				Expect(k8sClient.Delete(ctx, getLibvirtMachine())).To(Succeed())
+				reconcileMachine()
+				_, ok = hostB.Domain(machineName)
+				Expect(ok).To(BeFalse())
+				err = k8sClient.Get(ctx, machineKey, &infrav1.LibvirtMachine{})
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+			})
+
+			// forgetHost removes the host from the status of the LibvirtMachine, like for LibvirtMachines provisioned
+			// before their host was recorded
+			forgetHost := func() {
+				libvirtMachine := getLibvirtMachine()
+				Expect(libvirtMachine.Spec.ProviderID).NotTo(BeEmpty())
+				libvirtMachine.Status.Host = nil
+				Expect(k8sClient.Status().Update(ctx, libvirtMachine)).To(Succeed())
+			}
+
+			It("should search the hosts for the virtual machine of a LibvirtMachine provisioned before its host was recorded", func() {
+				reconcileMachine()
+				hostB.SetLeases(machineName, "192.168.122.10")
+				reconcileMachine()
+				forgetHost()
+
+				By("finding the virtual machine instead of placing it again")
+				setHosts(
+					infrav1.LibvirtHost{Name: "a", URI: "qemu+tcp://host-a/system", Weight: ptr.To[int32](100)},
+					infrav1.LibvirtHost{Name: "b", URI: "qemu+tcp://host-b/system", Weight: ptr.To[int32](1)},
+				)
+				reconcileMachine()
+				_, ok := hostA.Domain(machineName)
+				Expect(ok).To(BeFalse())
+				Expect(getLibvirtMachine().Status.Host).To(Equal(&infrav1.LibvirtMachineHost{Name: "b", URI: "qemu+tcp://host-b/system"}))
+
+				By("deleting the virtual machine from the host which has it")
+				forgetHost()
+				Expect(k8sClient.Delete(ctx, getLibvirtMachine())).To(Succeed())
+				reconcileMachine()
+				_, ok = hostB.Domain(machineName)
+				Expect(ok).To(BeFalse())
+				err := k8sClient.Get(ctx, machineKey, &infrav1.LibvirtMachine{})
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+			})
+
+			It("should keep a LibvirtMachine provisioned before its host was recorded while its virtual machine is not found", func() {
+				reconcileMachine()
+				hostB.SetLeases(machineName, "192.168.122.10")
+				reconcileMachine()
+				forgetHost()
+				Expect(hostB.Destroy(&libvirtclient.LibvirtClientMachine{Name: machineName, StoragePoolName: "default"})).To(Succeed())
+
+				Expect(k8sClient.Delete(ctx, getLibvirtMachine())).To(Succeed())
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: machineKey})
+				Expect(err).To(MatchError(ContainSubstring("was not found on any libvirt host")))
+				Expect(getLibvirtMachine().Finalizers).To(ContainElement(infrav1.MachineFinalizer))
+			})
+
+			Context("while a host is unreachable", func() {
+				BeforeEach(func() {
+					reconciler.NewLibvirtClient = func(uri string, _ *libvirtclient.Credentials) (libvirtclient.LibvirtClient, error) {
+						if uri == "qemu+tcp://host-a/system" {
+							return hostA, nil
+						}
+						return nil, fmt.Errorf("connection refused")
+					}
+				})
+
+				It("should place the virtual machine on a reachable host", func() {
+					reconcileMachine()
+					_, ok := hostA.Domain(machineName)
+					Expect(ok).To(BeTrue())
+				})
+
+				It("should not place a LibvirtMachine provisioned before its host was recorded again", func() {
+					reconciler.NewLibvirtClient = func(uri string, _ *libvirtclient.Credentials) (libvirtclient.LibvirtClient, error) {
+						if uri == "qemu+tcp://host-a/system" {
+							return hostA, nil
+						}
+						return hostB, nil
+					}
+					reconcileMachine()
+					hostB.SetLeases(machineName, "192.168.122.10")
+					reconcileMachine()
+					forgetHost()
+					reconciler.NewLibvirtClient = func(uri string, _ *libvirtclient.Credentials) (libvirtclient.LibvirtClient, error) {
+						if uri == "qemu+tcp://host-a/system" {
+							return hostA, nil
+						}
+						return nil, fmt.Errorf("connection refused")
+					}
+
+					_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: machineKey})
+					Expect(err).To(MatchError(ContainSubstring("failed to search libvirt host")))
+					_, ok := hostA.Domain(machineName)
+					Expect(ok).To(BeFalse())
+
+					Expect(k8sClient.Delete(ctx, getLibvirtMachine())).To(Succeed())
+					_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: machineKey})
+					Expect(err).To(MatchError(ContainSubstring("failed to search libvirt host")))
+					Expect(getLibvirtMachine().Finalizers).To(ContainElement(infrav1.MachineFinalizer))
+				})
+
+				It("should delete a LibvirtMachine which was never placed", func() {
+					libvirtMachine := getLibvirtMachine()
+					libvirtMachine.Spec.HostSelector = map[string]string{"zone": "c"}
+					Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+					_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: machineKey})
+					Expect(err).To(MatchError(ContainSubstring("no libvirt host matching")))
+
+					Expect(k8sClient.Delete(ctx, getLibvirtMachine())).To(Succeed())
+					reconcileMachine()
+					err = k8sClient.Get(ctx, machineKey, &infrav1.LibvirtMachine{})
+					Expect(errors.IsNotFound(err)).To(BeTrue())
+				})
+			})
+
+			It("should only place the virtual machine on the host of its LibvirtImage", func() {
+				libvirtImage := &infrav1.LibvirtImage{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-image", Namespace: namespace},
+					Spec: infrav1.LibvirtImageSpec{
+						URI:    "qemu+tcp://host-a/system",
+						Source: infrav1.LibvirtImageSource{Path: "/images/base.qcow2"},
+					},
+				}
+				Expect(k8sClient.Create(ctx, libvirtImage)).To(Succeed())
+				defer func() { Expect(k8sClient.Delete(ctx, libvirtImage)).To(Succeed()) }()
+				libvirtImage.Status = infrav1.LibvirtImageStatus{Ready: true, Path: "/images/base.qcow2", Format: "qcow2"}
+				Expect(k8sClient.Status().Update(ctx, libvirtImage)).To(Succeed())
+
+				libvirtMachine := getLibvirtMachine()
+				libvirtMachine.Spec.BackingImagePath = ""
+				libvirtMachine.Spec.ImageRef = &corev1.LocalObjectReference{Name: "test-image"}
+				Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+				reconcileMachine()
+				domain, ok := hostA.Domain(machineName)
+				Expect(ok).To(BeTrue())
+				Expect(domain.Machine.BackingImagePath).To(Equal("/images/base.qcow2"))
+				Expect(getLibvirtMachine().Status.Host).To(Equal(&infrav1.LibvirtMachineHost{Name: "a", URI: "qemu+tcp://host-a/system"}))
+			})
+
+			It("should only place the virtual machine on hosts matching its hostSelector", func() {
+				libvirtMachine := getLibvirtMachine()
+				libvirtMachine.Spec.HostSelector = map[string]string{"zone": "c"}
+				Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: machineKey})
+				Expect(err).To(MatchError(ContainSubstring("no libvirt host matching")))
+				Expect(getLibvirtMachine().Status.Host).To(BeNil())
+
+				libvirtMachine = getLibvirtMachine()
+				libvirtMachine.Spec.HostSelector = map[string]string{"zone": "a"}
+				Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+				reconcileMachine()
+				_, ok := hostA.Domain(machineName)
+				Expect(ok).To(BeTrue())
+			})
+
+			It("should only place the virtual machine on hosts supporting its architecture", func() {
+				hostA.SetHostArchitectures("amd64", "arm64")
+				libvirtMachine := getLibvirtMachine()
+				libvirtMachine.Spec.Architecture = infrav1.ArchitectureArm64
+				Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+				reconcileMachine()
+				domain, ok := hostA.Domain(machineName)
+				Expect(ok).To(BeTrue())
+				Expect(domain.Machine.Architecture).To(Equal("arm64"))
+			})
+
+			It("should only place the virtual machine on hosts emulating its architecture if it allows emulation", func() {
+				hostA.SetHostArchitectures("amd64", "arm64").SetHostEmulatedArchitectures("arm64")
+				libvirtMachine := getLibvirtMachine()
+				libvirtMachine.Spec.Architecture = infrav1.ArchitectureArm64
+				Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: machineKey})
+				Expect(err).To(MatchError(ContainSubstring("no libvirt host matching")))
+				Expect(getLibvirtMachine().Status.Host).To(BeNil())
+
+				libvirtMachine = getLibvirtMachine()
+				libvirtMachine.Spec.AllowEmulation = true
+				Expect(k8sClient.Update(ctx, libvirtMachine)).To(Succeed())
+				recordedEvents()
+				reconcileMachine()
+				domain, ok := hostA.Domain(machineName)
+				Expect(ok).To(BeTrue())
+				Expect(domain.Machine.AllowEmulation).To(BeTrue())
+				Expect(recordedEvents()).To(ContainElement(
+					"Warning VirtualMachineEmulated Virtual machine '" + machineName + "' uses emulation, as libvirt host a does not support KVM for arm64 guests",
+				))
+			})
+
+			It("should not place the virtual machine on a host without enough free memory", func() {
+				hostB.SetHostCapacity(16, 1024)
+				reconcileMachine()
+				_, ok := hostA.Domain(machineName)
+				Expect(ok).To(BeTrue())
+			})
+
+			It("should spread control plane machines across hosts", func() {
+				const otherName = "test-other-control-plane"
+
+				machine := &clusterv1.Machine{}
+				Expect(k8sClient.Get(ctx, machineKey, machine)).To(Succeed())
+				machine.Labels[clusterv1.MachineControlPlaneLabel] = ""
+				Expect(k8sClient.Update(ctx, machine)).To(Succeed())
+
+				By("creating another control plane machine on the host with the most free capacity")
+				other := &clusterv1.Machine{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      otherName,
+						Namespace: namespace,
+						Labels:    map[string]string{clusterv1.ClusterNameLabel: clusterName, clusterv1.MachineControlPlaneLabel: ""},
+					},
+					Spec: clusterv1.MachineSpec{
+						ClusterName: clusterName,
+						Bootstrap:   clusterv1.Bootstrap{DataSecretName: ptr.To(secretName)},
+						InfrastructureRef: clusterv1.ContractVersionedObjectReference{
+							APIGroup: infrav1.GroupVersion.Group,
+							Kind:     "LibvirtMachine",
+							Name:     otherName,
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, other)).To(Succeed())
+				otherLibvirtMachine := &infrav1.LibvirtMachine{
+					ObjectMeta: metav1.ObjectMeta{Name: otherName, Namespace: namespace},
+					Spec: infrav1.LibvirtMachineSpec{
+						CPU:              2,
+						Memory:           2048,
+						DiskSize:         20,
+						BackingImagePath: "/images/base.qcow2",
+					},
+				}
+				Expect(k8sClient.Create(ctx, otherLibvirtMachine)).To(Succeed())
+				otherLibvirtMachine.Status.Host = &infrav1.LibvirtMachineHost{Name: "b", URI: "qemu+tcp://host-b/system"}
+				Expect(k8sClient.Status().Update(ctx, otherLibvirtMachine)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(k8sClient.Delete(ctx, otherLibvirtMachine)).To(Succeed())
+					Expect(k8sClient.Delete(ctx, other)).To(Succeed())
+				})
+
+				reconcileMachine()
+				_, ok := hostA.Domain(machineName)
+				Expect(ok).To(BeTrue())
+				Expect(getLibvirtMachine().Status.Host.Name).To(Equal("a"))
+			})
+		})
+	})
 })
@@ -2,8 +2,10 @@ package controller
 
 import (
 	"context"
+	"go/build"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -11,6 +13,7 @@ import (
 
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -50,11 +53,17 @@ var _ = BeforeSuite(func() {
 	err = infrastructurev1beta2.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = clusterv1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	// +kubebuilder:scaffold:scheme
 
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
-		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
+		CRDDirectoryPaths: []string{
+			filepath.Join("..", "..", "config", "crd", "bases"),
+			getClusterAPICRDDir(),
+		},
 		ErrorIfCRDPathMissing: true,
 	}
 
@@ -102,3 +111,21 @@ func getFirstFoundEnvTestBinaryDir() string {
 	}
 	return ""
 }
+
+// getClusterAPICRDDir returns the directory containing the Cluster API CRDs (Cluster, Machine, etc) from the
+// version of the sigs.k8s.io/cluster-api module in the Go module cache that this test binary was built with.
+func getClusterAPICRDDir() string {
+	modCache := os.Getenv("GOMODCACHE")
+	if modCache == "" {
+		modCache = filepath.Join(build.Default.GOPATH, "pkg", "mod")
+	}
+	version := ""
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "sigs.k8s.io/cluster-api" {
+				version = dep.Version
+			}
+		}
+	}
+	return filepath.Join(modCache, "sigs.k8s.io", "cluster-api@"+version, "config", "crd", "bases")
+}
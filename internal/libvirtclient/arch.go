@@ -0,0 +1,177 @@
+package libvirtclient
+
+import (
+	"fmt"
+	"slices"
+
+	"k8s.io/utils/ptr"
+
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient/libvirtxml"
+)
+
+// DefaultArchitecture is the architecture of VMs which do not specify one.
+const DefaultArchitecture = "amd64"
+
+// Firmware types of VMs.
+const (
+	// FirmwareBIOS is the default firmware of the architecture (e.g. SeaBIOS on amd64).
+	FirmwareBIOS = "bios"
+	// FirmwareEFI is UEFI firmware, which is selected automatically by libvirt.
+	FirmwareEFI = "efi"
+)
+
+// architecture describes how VMs of a (Kubernetes) architecture are defined in libvirt.
+type architecture struct {
+	arch      string   // libvirt architecture
+	machine   string   // machine type
+	firmwares []string // supported firmware types ("bios" is the default firmware of the machine type); the first is the default
+	cpuMode   string   // CPU mode, if the machine type's default CPU model can not be used with KVM
+
+	// UEFI on x86 requires ACPI, and Secure Boot requires SMM to protect the UEFI variables
+	efiRequiresACPI       bool
+	secureBootRequiresSMM bool
+
+	// QEMU fw_cfg is available to pass Ignition configs; they are attached as a disk otherwise
+	fwCfg bool
+
+	// The cloud-init ISO is attached as a cdrom to this bus; buses other than sata need a virtio-scsi controller
+	cdromBus string
+	cdromDev string
+
+	// Serial port and console targets; libvirt chooses the default of the machine type if nil
+	serialTarget  *libvirtxml.DomainChardevTarget
+	consoleTarget *libvirtxml.DomainChardevTarget
+}
+
+// architectures are the supported architectures by their Kubernetes name.
+var architectures = map[string]architecture{
+	"amd64": {
+		arch:                  "x86_64",
+		machine:               "q35",
+		firmwares:             []string{FirmwareBIOS, FirmwareEFI},
+		efiRequiresACPI:       true,
+		secureBootRequiresSMM: true,
+		fwCfg:                 true,
+		cdromBus:              "sata",
+		cdromDev:              "sda",
+		serialTarget: &libvirtxml.DomainChardevTarget{
+			Type:  "isa-serial",
+			Port:  ptr.To[uint](0),
+			Model: &libvirtxml.DomainChardevModel{Name: "isa-serial"},
+		},
+		consoleTarget: &libvirtxml.DomainChardevTarget{Type: "serial", Port: ptr.To[uint](0)},
+	},
+	"arm64": {
+		arch:      "aarch64",
+		machine:   "virt",
+		firmwares: []string{FirmwareEFI},
+		cpuMode:   "host-passthrough",
+		fwCfg:     true,
+		cdromBus:  "scsi",
+		cdromDev:  "sda",
+	},
+	"s390x": {
+		arch:      "s390x",
+		machine:   "s390-ccw-virtio",
+		firmwares: []string{FirmwareBIOS},
+		cdromBus:  "scsi",
+		cdromDev:  "sda",
+	},
+	"ppc64le": {
+		arch:      "ppc64le",
+		machine:   "pseries",
+		firmwares: []string{FirmwareBIOS},
+		cdromBus:  "scsi",
+		cdromDev:  "sda",
+	},
+}
+
+// getArchitecture returns the architecture with the given Kubernetes name, or the default architecture if empty.
+func getArchitecture(name string) (architecture, error) {
+	if name == "" {
+		name = DefaultArchitecture
+	}
+	arch, ok := architectures[name]
+	if !ok {
+		return architecture{}, fmt.Errorf("unsupported architecture '%s'", name)
+	}
+	return arch, nil
+}
+
+// firmware returns the firmware type of the VM, i.e. the requested firmware type or else the default of the
+// architecture, and validates that the VM's firmware options are supported.
+func (a architecture) firmware(vm *LibvirtClientMachine) (string, error) {
+	firmware := vm.Firmware
+	if firmware == "" {
+		firmware = a.firmwares[0]
+	}
+	if !slices.Contains(a.firmwares, firmware) {
+		return "", fmt.Errorf("firmware '%s' is not supported for %s guests", firmware, a.arch)
+	}
+	if vm.SecureBoot && firmware != FirmwareEFI {
+		return "", fmt.Errorf("secure boot requires the '%s' firmware", FirmwareEFI)
+	}
+	return firmware, nil
+}
+
+// domainType returns the domain type for VMs of the architecture on a host with the given capabilities, i.e. "kvm"
+// if the host can run them with hardware virtualization or else "qemu" (emulation), if allowed. It returns an error if
+// the host does not support the architecture or its machine type at all, or only with emulation which is not allowed.
+func (a architecture) domainType(capabilities *libvirtxml.Capabilities, allowEmulation bool) (string, error) {
+	domainTypes := a.domainTypes(capabilities)
+	switch {
+	case slices.Contains(domainTypes, "kvm"):
+		return "kvm", nil
+	case slices.Contains(domainTypes, "qemu") && allowEmulation:
+		return "qemu", nil
+	case slices.Contains(domainTypes, "qemu"):
+		return "", fmt.Errorf("libvirt host (%s) only supports %s guests with emulation, which is not allowed", capabilities.Host.CPU.Arch, a.arch)
+	}
+	return "", fmt.Errorf("libvirt host (%s) does not support %s guests with machine type '%s'", capabilities.Host.CPU.Arch, a.arch, a.machine)
+}
+
+// domainTypes returns the domain types with which a host with the given capabilities supports VMs of the architecture.
+func (a architecture) domainTypes(capabilities *libvirtxml.Capabilities) []string {
+	var domainTypes []string
+	for _, guest := range capabilities.Guests {
+		if guest.OSType != "hvm" || guest.Arch.Name != a.arch {
+			continue
+		}
+		if !slices.ContainsFunc(guest.Arch.Machines, func(m libvirtxml.CapabilityGuestMachine) bool {
+			return m.Name == a.machine || m.Canonical == a.machine
+		}) {
+			continue
+		}
+		for _, domain := range guest.Arch.Domains {
+			domainTypes = append(domainTypes, domain.Type)
+		}
+	}
+	return domainTypes
+}
+
+// supportedArchitectures returns the sorted (Kubernetes) names of the architectures supported by a host with the
+// given capabilities.
+func supportedArchitectures(capabilities *libvirtxml.Capabilities) []string {
+	var names []string
+	for name, arch := range architectures {
+		if len(arch.domainTypes(capabilities)) > 0 {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// emulatedArchitectures returns the sorted (Kubernetes) names of the architectures which a host with the given
+// capabilities only supports with emulation, i.e. without KVM.
+func emulatedArchitectures(capabilities *libvirtxml.Capabilities) []string {
+	var names []string
+	for name, arch := range architectures {
+		domainTypes := arch.domainTypes(capabilities)
+		if len(domainTypes) > 0 && !slices.Contains(domainTypes, "kvm") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
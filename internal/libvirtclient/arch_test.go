@@ -0,0 +1,154 @@
+package libvirtclient
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient/libvirtxml"
+)
+
+// capabilitiesXML is (abbreviated) output of ConnectGetCapabilities on an x86_64 host which can emulate aarch64.
+const capabilitiesXML = `<capabilities>
+  <host>
+    <uuid>4c4c4544-0044-3010-8053-b4c04f4e3732</uuid>
+    <cpu>
+      <arch>x86_64</arch>
+      <model>Skylake-Client-IBRS</model>
+    </cpu>
+  </host>
+  <guest>
+    <os_type>hvm</os_type>
+    <arch name='x86_64'>
+      <wordsize>64</wordsize>
+      <emulator>/usr/bin/qemu-system-x86_64</emulator>
+      <machine maxCpus='255'>pc-i440fx-8.2</machine>
+      <machine canonical='pc-i440fx-8.2' maxCpus='255'>pc</machine>
+      <machine maxCpus='288'>pc-q35-8.2</machine>
+      <machine canonical='pc-q35-8.2' maxCpus='288'>q35</machine>
+      <domain type='qemu'/>
+      <domain type='kvm'/>
+    </arch>
+  </guest>
+  <guest>
+    <os_type>hvm</os_type>
+    <arch name='aarch64'>
+      <wordsize>64</wordsize>
+      <emulator>/usr/bin/qemu-system-aarch64</emulator>
+      <machine maxCpus='512'>virt-8.2</machine>
+      <machine canonical='virt-8.2' maxCpus='512'>virt</machine>
+      <domain type='qemu'/>
+    </arch>
+  </guest>
+</capabilities>`
+
+func TestArchitectureDomainType(t *testing.T) {
+	g := NewWithT(t)
+
+	capabilities := &libvirtxml.Capabilities{}
+	g.Expect(capabilities.Unmarshal(capabilitiesXML)).To(Succeed())
+	g.Expect(capabilities.Host.CPU.Arch).To(Equal("x86_64"))
+
+	amd64, err := getArchitecture("")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(amd64.domainType(capabilities, false)).To(Equal("kvm"))
+
+	arm64, err := getArchitecture("arm64")
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = arm64.domainType(capabilities, false)
+	g.Expect(err).To(MatchError(ContainSubstring("only supports aarch64 guests with emulation")))
+	g.Expect(arm64.domainType(capabilities, true)).To(Equal("qemu"))
+
+	s390x, err := getArchitecture("s390x")
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = s390x.domainType(capabilities, true)
+	g.Expect(err).To(MatchError(ContainSubstring("does not support s390x guests")))
+
+	g.Expect(supportedArchitectures(capabilities)).To(Equal([]string{"amd64", "arm64"}))
+	g.Expect(emulatedArchitectures(capabilities)).To(Equal([]string{"arm64"}))
+
+	_, err = getArchitecture("riscv64")
+	g.Expect(err).To(MatchError(ContainSubstring("unsupported architecture")))
+}
+
+func TestMachineDomain(t *testing.T) {
+	g := NewWithT(t)
+
+	vm := &LibvirtClientMachine{Name: "test-machine", NetworkName: "default", CPU: 2, Memory: 2048}
+
+	amd64, _ := getArchitecture("amd64")
+	domain := vm.domain(amd64, FirmwareBIOS, "kvm", "/k8s/test-machine.qcow2", "/k8s/test-machine-cloudinit.iso", nil)
+	g.Expect(domain.OS.Type).To(Equal(libvirtxml.DomainOSType{Arch: "x86_64", Machine: "q35", Value: "hvm"}))
+	g.Expect(domain.OS.Firmware).To(BeEmpty())
+	g.Expect(domain.CPU).To(BeNil())
+	g.Expect(domain.Devices.Controllers).To(BeEmpty())
+	g.Expect(domain.Devices.Disks[1].Target).To(Equal(libvirtxml.DomainDiskTarget{Dev: "sda", Bus: "sata"}))
+	g.Expect(domain.Devices.Serials[0].Target.Type).To(Equal("isa-serial"))
+	g.Expect(domain.Features).To(BeNil())
+	g.Expect(domain.Devices.TPMs).To(BeEmpty())
+
+	arm64, _ := getArchitecture("arm64")
+	domain = vm.domain(arm64, FirmwareEFI, "kvm", "/k8s/test-machine.qcow2", "/k8s/test-machine-cloudinit.iso", nil)
+	g.Expect(domain.OS.Type).To(Equal(libvirtxml.DomainOSType{Arch: "aarch64", Machine: "virt", Value: "hvm"}))
+	g.Expect(domain.OS.Firmware).To(Equal("efi"))
+	g.Expect(domain.CPU).To(Equal(&libvirtxml.DomainCPU{Mode: "host-passthrough"}))
+	g.Expect(domain.Devices.Controllers).To(ConsistOf(libvirtxml.DomainController{Type: "scsi", Model: "virtio-scsi"}))
+	g.Expect(domain.Devices.Disks[1].Target).To(Equal(libvirtxml.DomainDiskTarget{Dev: "sda", Bus: "scsi"}))
+	g.Expect(domain.Devices.Serials[0].Target).To(BeNil())
+
+	data, err := domain.Marshal()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(data).To(ContainSubstring(`<os firmware="efi">`))
+}
+
+func TestArchitectureFirmware(t *testing.T) {
+	g := NewWithT(t)
+
+	amd64, _ := getArchitecture("amd64")
+	g.Expect(amd64.firmware(&LibvirtClientMachine{})).To(Equal(FirmwareBIOS))
+	g.Expect(amd64.firmware(&LibvirtClientMachine{Firmware: FirmwareEFI, SecureBoot: true})).To(Equal(FirmwareEFI))
+	_, err := amd64.firmware(&LibvirtClientMachine{SecureBoot: true})
+	g.Expect(err).To(MatchError(ContainSubstring("secure boot requires the 'efi' firmware")))
+
+	arm64, _ := getArchitecture("arm64")
+	g.Expect(arm64.firmware(&LibvirtClientMachine{SecureBoot: true})).To(Equal(FirmwareEFI))
+	_, err = arm64.firmware(&LibvirtClientMachine{Firmware: FirmwareBIOS})
+	g.Expect(err).To(MatchError(ContainSubstring("firmware 'bios' is not supported for aarch64 guests")))
+
+	s390x, _ := getArchitecture("s390x")
+	_, err = s390x.firmware(&LibvirtClientMachine{Firmware: FirmwareEFI})
+	g.Expect(err).To(MatchError(ContainSubstring("firmware 'efi' is not supported for s390x guests")))
+}
+
+func TestMachineDomainSecureBoot(t *testing.T) {
+	g := NewWithT(t)
+
+	vm := &LibvirtClientMachine{Name: "test-machine", NetworkName: "default", CPU: 2, Memory: 2048, Firmware: FirmwareEFI, SecureBoot: true, TPM: true}
+
+	amd64, _ := getArchitecture("amd64")
+	domain := vm.domain(amd64, FirmwareEFI, "kvm", "/k8s/test-machine.qcow2", "/k8s/test-machine-cloudinit.iso", nil)
+	g.Expect(domain.OS.Firmware).To(Equal("efi"))
+	g.Expect(domain.OS.FirmwareFeatures.Features).To(ConsistOf(
+		libvirtxml.DomainOSFirmwareFeature{Enabled: "yes", Name: "enrolled-keys"},
+		libvirtxml.DomainOSFirmwareFeature{Enabled: "yes", Name: "secure-boot"},
+	))
+	g.Expect(domain.OS.Loader).To(Equal(&libvirtxml.DomainOSLoader{Secure: "yes"}))
+	g.Expect(domain.Features.ACPI).NotTo(BeNil())
+	g.Expect(domain.Features.SMM).To(Equal(&libvirtxml.DomainFeatureState{State: "on"}))
+	g.Expect(domain.Devices.TPMs).To(ConsistOf(libvirtxml.DomainTPM{Backend: libvirtxml.DomainTPMBackend{Type: "emulator", Version: "2.0"}}))
+
+	data, err := domain.Marshal()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(data).To(ContainSubstring(`<feature enabled="yes" name="secure-boot"></feature>`))
+	g.Expect(data).To(ContainSubstring(`<loader secure="yes"></loader>`))
+	g.Expect(data).To(ContainSubstring(`<backend type="emulator" version="2.0"></backend>`))
+
+	vm.SecureBoot = false
+	domain = vm.domain(amd64, FirmwareEFI, "kvm", "/k8s/test-machine.qcow2", "/k8s/test-machine-cloudinit.iso", nil)
+	g.Expect(domain.OS.FirmwareFeatures.Features).To(ConsistOf(
+		libvirtxml.DomainOSFirmwareFeature{Enabled: "no", Name: "enrolled-keys"},
+		libvirtxml.DomainOSFirmwareFeature{Enabled: "no", Name: "secure-boot"},
+	))
+	g.Expect(domain.OS.Loader).To(BeNil())
+	g.Expect(domain.Features.SMM).To(BeNil())
+}
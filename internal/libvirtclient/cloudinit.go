@@ -0,0 +1,283 @@
+package libvirtclient
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"sigs.k8s.io/yaml"
+)
+
+// NetworkConfig is the network configuration of the guest of a VM, which is written to its cloud-init ISO as a
+// NoCloud network-config (version 2) file.
+type NetworkConfig struct {
+	Ethernets []NetworkEthernet
+	Bonds     []NetworkBond
+	VLANs     []NetworkVLAN
+}
+
+// NetworkDeviceConfig is the configuration of a network device (ethernet, bond or VLAN) of the guest.
+type NetworkDeviceConfig struct {
+	Addresses     []string // IP addresses with prefix length, e.g. "192.168.122.10/24"
+	Gateway       string   // default gateway
+	Nameservers   []string
+	SearchDomains []string
+	Routes        []NetworkRoute
+	DHCP4         bool
+	DHCP6         bool
+	MTU           int32 // uses the default MTU if 0
+}
+
+// NetworkRoute is a static route.
+type NetworkRoute struct {
+	To     string // destination network, e.g. "10.0.0.0/8"
+	Via    string
+	Metric *int32
+}
+
+// NetworkEthernet configures the network interface of the VM with the given index (see LibvirtClientMachine.Interfaces).
+type NetworkEthernet struct {
+	Name      string
+	Interface int
+	NetworkDeviceConfig
+}
+
+// NetworkBond configures a bond of the ethernets with the given names.
+type NetworkBond struct {
+	Name       string
+	Interfaces []string
+	Mode       string // defaults to 'active-backup'
+	NetworkDeviceConfig
+}
+
+// NetworkVLAN configures a VLAN on top of the ethernet or bond with the given name.
+type NetworkVLAN struct {
+	Name string
+	ID   int32
+	Link string
+	NetworkDeviceConfig
+}
+
+// networkConfigV2 is a (netplan compatible) network-config version 2 document.
+type networkConfigV2 struct {
+	Version   int                        `json:"version"`
+	Ethernets map[string]networkDeviceV2 `json:"ethernets,omitempty"`
+	Bonds     map[string]networkDeviceV2 `json:"bonds,omitempty"`
+	VLANs     map[string]networkDeviceV2 `json:"vlans,omitempty"`
+}
+
+type networkDeviceV2 struct {
+	Match       *networkMatchV2       `json:"match,omitempty"`
+	SetName     string                `json:"set-name,omitempty"`
+	Interfaces  []string              `json:"interfaces,omitempty"`
+	Parameters  *networkBondParamsV2  `json:"parameters,omitempty"`
+	ID          *int32                `json:"id,omitempty"`
+	Link        string                `json:"link,omitempty"`
+	DHCP4       bool                  `json:"dhcp4"`
+	DHCP6       bool                  `json:"dhcp6"`
+	Addresses   []string              `json:"addresses,omitempty"`
+	Routes      []networkRouteV2      `json:"routes,omitempty"`
+	Nameservers *networkNameserversV2 `json:"nameservers,omitempty"`
+	MTU         int32                 `json:"mtu,omitempty"`
+}
+
+type networkMatchV2 struct {
+	MACAddress string `json:"macaddress"`
+}
+
+type networkBondParamsV2 struct {
+	Mode string `json:"mode"`
+}
+
+type networkRouteV2 struct {
+	To     string `json:"to"`
+	Via    string `json:"via"`
+	Metric *int32 `json:"metric,omitempty"`
+}
+
+type networkNameserversV2 struct {
+	Addresses []string `json:"addresses,omitempty"`
+	Search    []string `json:"search,omitempty"`
+}
+
+// device returns the network-config version 2 representation of the device configuration.
+func (d NetworkDeviceConfig) device() networkDeviceV2 {
+	device := networkDeviceV2{
+		DHCP4:     d.DHCP4,
+		DHCP6:     d.DHCP6,
+		Addresses: d.Addresses,
+		MTU:       d.MTU,
+	}
+	if d.Gateway != "" {
+		device.Routes = append(device.Routes, networkRouteV2{To: "default", Via: d.Gateway})
+	}
+	for _, route := range d.Routes {
+		device.Routes = append(device.Routes, networkRouteV2{To: route.To, Via: route.Via, Metric: route.Metric})
+	}
+	if len(d.Nameservers) > 0 || len(d.SearchDomains) > 0 {
+		device.Nameservers = &networkNameserversV2{Addresses: d.Nameservers, Search: d.SearchDomains}
+	}
+	return device
+}
+
+// validate returns an error if an address, gateway, nameserver or route of the device is invalid.
+func (d NetworkDeviceConfig) validate(name string) error {
+	for _, address := range d.Addresses {
+		if _, err := netip.ParsePrefix(address); err != nil {
+			return fmt.Errorf("invalid address '%s' of network device '%s': %v", address, name, err)
+		}
+	}
+	for _, address := range append([]string{d.Gateway}, d.Nameservers...) {
+		if _, err := netip.ParseAddr(address); address != "" && err != nil {
+			return fmt.Errorf("invalid IP address '%s' of network device '%s': %v", address, name, err)
+		}
+	}
+	for _, route := range d.Routes {
+		if _, err := netip.ParsePrefix(route.To); err != nil {
+			return fmt.Errorf("invalid route destination '%s' of network device '%s': %v", route.To, name, err)
+		}
+		if _, err := netip.ParseAddr(route.Via); err != nil {
+			return fmt.Errorf("invalid route gateway '%s' of network device '%s': %v", route.Via, name, err)
+		}
+	}
+	return nil
+}
+
+// networkConfig returns the NoCloud network-config file of the VM, or an empty string if the VM has no NetworkConfig.
+// The ethernets are matched by the MAC addresses of the VM's interfaces, which must all be set (see
+// withMACAddresses).
+func (vm *LibvirtClientMachine) networkConfig() (string, error) {
+	if vm.NetworkConfig == nil {
+		return "", nil
+	}
+
+	interfaces := vm.Interfaces()
+	config := networkConfigV2{Version: 2}
+	names := map[string]bool{}
+	for _, ethernet := range vm.NetworkConfig.Ethernets {
+		if ethernet.Interface < 0 || ethernet.Interface >= len(interfaces) {
+			return "", fmt.Errorf("ethernet '%s' refers to network interface %d, but the VM has %d network interfaces", ethernet.Name, ethernet.Interface, len(interfaces))
+		}
+		if err := ethernet.validate(ethernet.Name); err != nil {
+			return "", err
+		}
+		device := ethernet.device()
+		device.Match = &networkMatchV2{MACAddress: interfaces[ethernet.Interface].MACAddress}
+		device.SetName = ethernet.Name
+		if config.Ethernets == nil {
+			config.Ethernets = map[string]networkDeviceV2{}
+		}
+		config.Ethernets[ethernet.Name] = device
+		names[ethernet.Name] = true
+	}
+	for _, bond := range vm.NetworkConfig.Bonds {
+		for _, name := range bond.Interfaces {
+			if _, ok := config.Ethernets[name]; !ok {
+				return "", fmt.Errorf("bond '%s' refers to unknown ethernet '%s'", bond.Name, name)
+			}
+		}
+		if err := bond.validate(bond.Name); err != nil {
+			return "", err
+		}
+		mode := bond.Mode
+		if mode == "" {
+			mode = "active-backup"
+		}
+		device := bond.device()
+		device.Interfaces = bond.Interfaces
+		device.Parameters = &networkBondParamsV2{Mode: mode}
+		if config.Bonds == nil {
+			config.Bonds = map[string]networkDeviceV2{}
+		}
+		config.Bonds[bond.Name] = device
+		names[bond.Name] = true
+	}
+	for _, vlan := range vm.NetworkConfig.VLANs {
+		if !names[vlan.Link] {
+			return "", fmt.Errorf("VLAN '%s' refers to unknown ethernet or bond '%s'", vlan.Name, vlan.Link)
+		}
+		if err := vlan.validate(vlan.Name); err != nil {
+			return "", err
+		}
+		device := vlan.device()
+		device.ID = &vlan.ID
+		device.Link = vlan.Link
+		if config.VLANs == nil {
+			config.VLANs = map[string]networkDeviceV2{}
+		}
+		config.VLANs[vlan.Name] = device
+	}
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to render network-config: %v", err)
+	}
+	return string(data), nil
+}
+
+// StaticAddresses returns the static IP addresses (without prefix length) configured in the VM's NetworkConfig by the
+// index of the network interface they are assigned to. Addresses of bonds are assigned to the interface of their first
+// ethernet, and addresses of VLANs to the interface of their link.
+func (vm *LibvirtClientMachine) StaticAddresses() map[int][]string {
+	if vm.NetworkConfig == nil {
+		return nil
+	}
+
+	interfaces := map[string]int{} // device name -> interface index
+	for _, ethernet := range vm.NetworkConfig.Ethernets {
+		interfaces[ethernet.Name] = ethernet.Interface
+	}
+	for _, bond := range vm.NetworkConfig.Bonds {
+		if len(bond.Interfaces) > 0 {
+			if i, ok := interfaces[bond.Interfaces[0]]; ok {
+				interfaces[bond.Name] = i
+			}
+		}
+	}
+
+	addresses := map[int][]string{}
+	add := func(name string, config NetworkDeviceConfig) {
+		i, ok := interfaces[name]
+		if !ok {
+			return
+		}
+		for _, address := range config.Addresses {
+			if prefix, err := netip.ParsePrefix(address); err == nil {
+				addresses[i] = append(addresses[i], prefix.Addr().String())
+			}
+		}
+	}
+	for _, ethernet := range vm.NetworkConfig.Ethernets {
+		add(ethernet.Name, ethernet.NetworkDeviceConfig)
+	}
+	for _, bond := range vm.NetworkConfig.Bonds {
+		add(bond.Name, bond.NetworkDeviceConfig)
+	}
+	for _, vlan := range vm.NetworkConfig.VLANs {
+		add(vlan.Link, vlan.NetworkDeviceConfig)
+	}
+	return addresses
+}
+
+// withMACAddresses returns a copy of the VM whose network interfaces all have MAC addresses (see MACAddress), so that
+// they can be referred to in its network-config and DHCP reservations.
+func (vm *LibvirtClientMachine) withMACAddresses() *LibvirtClientMachine {
+	copied := *vm
+	copied.NetworkInterfaces = vm.Interfaces()
+	for i := range copied.NetworkInterfaces {
+		copied.NetworkInterfaces[i].MACAddress = vm.MACAddress(i)
+	}
+	return &copied
+}
+
+// AddStaticAddresses adds the static addresses of the VM (see StaticAddresses) in front of the leased addresses of its
+// interfaces.
+func (vm *LibvirtClientMachine) AddStaticAddresses(addresses []InterfaceAddresses) {
+	for i, static := range vm.StaticAddresses() {
+		if i >= len(addresses) {
+			continue
+		}
+		leased := slices.DeleteFunc(addresses[i].Addresses, func(address string) bool { return slices.Contains(static, address) })
+		addresses[i].Addresses = append(slices.Clone(static), leased...)
+	}
+}
@@ -0,0 +1,152 @@
+package libvirtclient
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestMachineNetworkConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	vm := &LibvirtClientMachine{
+		Name: "test-machine",
+		NetworkInterfaces: []LibvirtClientNetworkInterface{
+			{NetworkName: "management", MACAddress: "52:54:00:00:00:01"},
+			{NetworkName: "storage", MACAddress: "52:54:00:00:00:02"},
+			{NetworkName: "storage", MACAddress: "52:54:00:00:00:03"},
+		},
+		NetworkConfig: &NetworkConfig{
+			Ethernets: []NetworkEthernet{
+				{Name: "eth0", Interface: 0, NetworkDeviceConfig: NetworkDeviceConfig{
+					Addresses:     []string{"192.168.122.10/24"},
+					Gateway:       "192.168.122.1",
+					Nameservers:   []string{"192.168.122.1"},
+					SearchDomains: []string{"example.com"},
+				}},
+				{Name: "eth1", Interface: 1},
+				{Name: "eth2", Interface: 2},
+			},
+			Bonds: []NetworkBond{
+				{Name: "bond0", Interfaces: []string{"eth1", "eth2"}, NetworkDeviceConfig: NetworkDeviceConfig{MTU: 9000}},
+			},
+			VLANs: []NetworkVLAN{
+				{Name: "vlan10", ID: 10, Link: "bond0", NetworkDeviceConfig: NetworkDeviceConfig{
+					Addresses: []string{"10.0.10.10/24", "fd00::10/64"},
+					Routes:    []NetworkRoute{{To: "10.0.0.0/8", Via: "10.0.10.1"}},
+				}},
+			},
+		},
+	}
+
+	networkConfig, err := vm.networkConfig()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(networkConfig).To(Equal(`bonds:
+  bond0:
+    dhcp4: false
+    dhcp6: false
+    interfaces:
+    - eth1
+    - eth2
+    mtu: 9000
+    parameters:
+      mode: active-backup
+ethernets:
+  eth0:
+    addresses:
+    - 192.168.122.10/24
+    dhcp4: false
+    dhcp6: false
+    match:
+      macaddress: "52:54:00:00:00:01"
+    nameservers:
+      addresses:
+      - 192.168.122.1
+      search:
+      - example.com
+    routes:
+    - to: default
+      via: 192.168.122.1
+    set-name: eth0
+  eth1:
+    dhcp4: false
+    dhcp6: false
+    match:
+      macaddress: "52:54:00:00:00:02"
+    set-name: eth1
+  eth2:
+    dhcp4: false
+    dhcp6: false
+    match:
+      macaddress: "52:54:00:00:00:03"
+    set-name: eth2
+version: 2
+vlans:
+  vlan10:
+    addresses:
+    - 10.0.10.10/24
+    - fd00::10/64
+    dhcp4: false
+    dhcp6: false
+    id: 10
+    link: bond0
+    routes:
+    - to: 10.0.0.0/8
+      via: 10.0.10.1
+`))
+
+	g.Expect(vm.StaticAddresses()).To(Equal(map[int][]string{
+		0: {"192.168.122.10"},
+		1: {"10.0.10.10", "fd00::10"},
+	}))
+
+	addresses := []InterfaceAddresses{
+		{NetworkName: "management", Primary: true, Addresses: []string{"192.168.122.50", "192.168.122.10"}},
+		{NetworkName: "storage"},
+		{NetworkName: "storage"},
+	}
+	vm.AddStaticAddresses(addresses)
+	g.Expect(addresses[0].Addresses).To(Equal([]string{"192.168.122.10", "192.168.122.50"}))
+	g.Expect(addresses[1].Addresses).To(Equal([]string{"10.0.10.10", "fd00::10"}))
+	g.Expect(addresses[2].Addresses).To(BeEmpty())
+}
+
+func TestMachineNetworkConfigErrors(t *testing.T) {
+	g := NewWithT(t)
+
+	vm := &LibvirtClientMachine{Name: "test-machine", NetworkName: "default"}
+	g.Expect(vm.networkConfig()).To(BeEmpty())
+
+	vm.NetworkConfig = &NetworkConfig{Ethernets: []NetworkEthernet{{Name: "eth1", Interface: 1}}}
+	_, err := vm.networkConfig()
+	g.Expect(err).To(MatchError("ethernet 'eth1' refers to network interface 1, but the VM has 1 network interfaces"))
+
+	vm.NetworkConfig = &NetworkConfig{Ethernets: []NetworkEthernet{{Name: "eth0", NetworkDeviceConfig: NetworkDeviceConfig{Addresses: []string{"192.168.122.10"}}}}}
+	_, err = vm.networkConfig()
+	g.Expect(err).To(MatchError(ContainSubstring("invalid address '192.168.122.10' of network device 'eth0'")))
+
+	vm.NetworkConfig = &NetworkConfig{Bonds: []NetworkBond{{Name: "bond0", Interfaces: []string{"eth0"}}}}
+	_, err = vm.networkConfig()
+	g.Expect(err).To(MatchError("bond 'bond0' refers to unknown ethernet 'eth0'"))
+
+	vm.NetworkConfig = &NetworkConfig{VLANs: []NetworkVLAN{{Name: "vlan10", ID: 10, Link: "eth0"}}}
+	_, err = vm.networkConfig()
+	g.Expect(err).To(MatchError("VLAN 'vlan10' refers to unknown ethernet or bond 'eth0'"))
+}
+
+func TestMachineWithMACAddresses(t *testing.T) {
+	g := NewWithT(t)
+
+	vm := &LibvirtClientMachine{Name: "test-machine", NetworkName: "default"}
+	withMACs := vm.withMACAddresses()
+	g.Expect(vm.NetworkInterfaces).To(BeEmpty())
+	g.Expect(withMACs.NetworkInterfaces).To(HaveLen(1))
+	g.Expect(withMACs.NetworkInterfaces[0].NetworkName).To(Equal("default"))
+	g.Expect(withMACs.NetworkInterfaces[0].MACAddress).To(MatchRegexp(`^52:54:00(:[0-9a-f]{2}){3}$`))
+
+	vm.NetworkConfig = &NetworkConfig{Ethernets: []NetworkEthernet{{Name: "eth0", NetworkDeviceConfig: NetworkDeviceConfig{DHCP4: true}}}}
+	networkConfig, err := vm.withMACAddresses().networkConfig()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(networkConfig).To(ContainSubstring(withMACs.NetworkInterfaces[0].MACAddress))
+	g.Expect(networkConfig).To(ContainSubstring("dhcp4: true"))
+}
@@ -0,0 +1,350 @@
+package libvirtclient
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+const (
+	// DefaultKeepaliveInterval is how often idle connections are checked for liveness.
+	DefaultKeepaliveInterval = 30 * time.Second
+	// DefaultKeepaliveTimeout is how long a liveness check may take before the connection is considered dead.
+	DefaultKeepaliveTimeout = 10 * time.Second
+	// DefaultMinReconnectDelay is the delay before reconnecting after the first failed connection attempt.
+	DefaultMinReconnectDelay = 1 * time.Second
+	// DefaultMaxReconnectDelay is the maximum delay between reconnection attempts.
+	DefaultMaxReconnectDelay = 2 * time.Minute
+	// DefaultIdleTimeout is how long a connection may go unused before it is closed, e.g. after its host was removed
+	// from all LibvirtClusters. It is longer than the interval in which LibvirtMachines and LibvirtClusters are
+	// reconciled periodically, so that the connections to hosts in use are kept.
+	DefaultIdleTimeout = 15 * time.Minute
+)
+
+// ConnectionManager keeps one shared libvirt connection per URI and credentials for the lifetime of the manager
+// process. Connections are opened lazily, checked for liveness periodically, re-established with exponential backoff
+// when they drop or when the credentials of their owner change, and closed when they are idle for IdleTimeout or the
+// manager stops. The lifecycle events of the domains on the connected hosts are published on DomainEvents.
+type ConnectionManager struct {
+	KeepaliveInterval time.Duration
+	KeepaliveTimeout  time.Duration
+	MinReconnectDelay time.Duration
+	MaxReconnectDelay time.Duration
+	IdleTimeout       time.Duration
+
+	mu          sync.Mutex
+	connections map[connectionKey]*connection
+	owners      map[ownerKey]connectionKey // connection currently used by each owner of credentials
+	stopped     bool
+
+	events chan DomainEvent
+
+	// connect opens a new connection to the given URI; overridden in tests
+	connect func(uri *url.URL, credentials *Credentials) (*libvirt.Libvirt, error)
+	// lifecycleEvents subscribes to the domain lifecycle events of a connection; overridden in tests
+	lifecycleEvents func(client *libvirt.Libvirt) (<-chan libvirt.DomainEventLifecycleMsg, error)
+}
+
+// NewConnectionManager returns a new ConnectionManager with default settings.
+func NewConnectionManager() *ConnectionManager {
+	return &ConnectionManager{
+		KeepaliveInterval: DefaultKeepaliveInterval,
+		KeepaliveTimeout:  DefaultKeepaliveTimeout,
+		MinReconnectDelay: DefaultMinReconnectDelay,
+		MaxReconnectDelay: DefaultMaxReconnectDelay,
+		IdleTimeout:       DefaultIdleTimeout,
+		connections:       map[connectionKey]*connection{},
+		owners:            map[ownerKey]connectionKey{},
+		events:            make(chan DomainEvent, domainEventsBuffer),
+		connect:           connect,
+		lifecycleEvents:   lifecycleEvents,
+	}
+}
+
+// Client returns a LibvirtClient which uses the shared connection to the given URI, authenticating with the given
+// (optional) credentials. The connection is established first, so that connection and authentication errors (see
+// ErrAuthenticationFailed) are returned here rather than from the LibvirtClient's methods. It has the signature of a
+// LibvirtClientFactory.
+func (m *ConnectionManager) Client(uri string, credentials *Credentials) (LibvirtClient, error) {
+	conn, err := m.connection(uri, credentials)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.get(); err != nil {
+		return nil, err
+	}
+	return &libvirtClient{conn: conn}, nil
+}
+
+// connectionKey identifies a shared connection: callers only share a connection to a URI if their credentials match.
+type connectionKey struct {
+	uri         string
+	fingerprint string
+}
+
+// ownerKey identifies the owner of the credentials (see Credentials.Owner) used for a URI.
+type ownerKey struct {
+	uri   string
+	owner string
+}
+
+// connection returns the (possibly not yet connected) shared connection for the given URI and credentials. If the
+// owner of the credentials previously used different credentials for the URI (e.g. because they were rotated), it no
+// longer uses the previous connection, which is closed once no other owner uses it.
+func (m *ConnectionManager) connection(uri string, credentials *Credentials) (*connection, error) {
+	if uri == "" {
+		return nil, fmt.Errorf("a libvirt URI (e.g. the LIBVIRT_URI or LIBVIRT_DEFAULT_URI environment variable) must be set in order to connect to libvirt")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped {
+		return nil, fmt.Errorf("libvirt connection manager is stopped")
+	}
+
+	key := connectionKey{uri: uri, fingerprint: credentials.fingerprint()}
+	conn, ok := m.connections[key]
+	if !ok {
+		urlParsed, err := url.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse libvirt URI: %v", err)
+		}
+		conn = &connection{manager: m, name: uri, uri: urlParsed, credentials: credentials, owners: map[string]struct{}{}}
+		m.connections[key] = conn
+	}
+	conn.touch()
+
+	if owner := credentials.owner(); owner != "" {
+		if previous, ok := m.owners[ownerKey{uri: uri, owner: owner}]; ok && previous != key {
+			slog.Info("libvirt credentials changed; reconnecting", "uri", conn.uri.Redacted(), "owner", owner)
+			m.release(previous, owner)
+		}
+		m.owners[ownerKey{uri: uri, owner: owner}] = key
+		conn.owners[owner] = struct{}{}
+	}
+	return conn, nil
+}
+
+// release removes the owner from the connection with the given key, and closes the connection once it has no owners
+// left. Connections without any owner (e.g. those without credentials) are kept until they are idle (see evictIdle).
+// The caller must hold m.mu.
+func (m *ConnectionManager) release(key connectionKey, owner string) {
+	conn, ok := m.connections[key]
+	if !ok {
+		return
+	}
+	delete(conn.owners, owner)
+	if len(conn.owners) == 0 {
+		delete(m.connections, key)
+		go conn.close()
+	}
+}
+
+// Start checks the liveness of all open connections and closes idle ones every KeepaliveInterval until the context is
+// cancelled, and then closes all connections. It implements the controller-runtime manager.Runnable interface.
+func (m *ConnectionManager) Start(ctx context.Context) error {
+	ticker := time.NewTicker(m.KeepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.close()
+			return nil
+		case <-ticker.C:
+			m.evictIdle(time.Now())
+			m.mu.Lock()
+			connections := make([]*connection, 0, len(m.connections))
+			for _, conn := range m.connections {
+				connections = append(connections, conn)
+			}
+			m.mu.Unlock()
+
+			for _, conn := range connections {
+				conn.keepalive()
+			}
+		}
+	}
+}
+
+// NeedLeaderElection returns false so that connections are managed (and closed) on every replica.
+func (m *ConnectionManager) NeedLeaderElection() bool {
+	return false
+}
+
+// evictIdle closes the connections which were not used for IdleTimeout, e.g. those to hosts which were removed from
+// all LibvirtClusters. They are opened again if they are used afterwards.
+func (m *ConnectionManager) evictIdle(now time.Time) {
+	m.mu.Lock()
+	var idle []*connection
+	for key, conn := range m.connections {
+		if now.Sub(conn.lastUse()) < m.IdleTimeout {
+			continue
+		}
+		delete(m.connections, key)
+		for owner, ownerConn := range m.owners {
+			if ownerConn == key {
+				delete(m.owners, owner)
+			}
+		}
+		idle = append(idle, conn)
+	}
+	m.mu.Unlock()
+
+	for _, conn := range idle {
+		slog.Debug("closing idle libvirt connection", "uri", conn.uri.Redacted())
+		conn.close()
+	}
+}
+
+// close disconnects all connections and prevents new ones from being opened.
+func (m *ConnectionManager) close() {
+	m.mu.Lock()
+	m.stopped = true
+	connections := m.connections
+	m.connections = map[connectionKey]*connection{}
+	m.owners = map[ownerKey]connectionKey{}
+	m.mu.Unlock()
+
+	for _, conn := range connections {
+		conn.close()
+	}
+}
+
+// reconnectDelay returns the delay before the next connection attempt after the given number of consecutive failures.
+func (m *ConnectionManager) reconnectDelay(failures int) time.Duration {
+	delay := m.MinReconnectDelay
+	for i := 1; i < failures && delay < m.MaxReconnectDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, m.MaxReconnectDelay)
+}
+
+// connection is a shared libvirt connection to a single URI with a single set of credentials.
+type connection struct {
+	manager     *ConnectionManager
+	name        string // URI as given to ConnectionManager.Client
+	uri         *url.URL
+	credentials *Credentials
+	owners      map[string]struct{} // owners of the credentials which use the connection; guarded by manager.mu
+
+	mu          sync.Mutex
+	client      *libvirt.Libvirt
+	closed      bool      // the connection was removed from the manager and must not reconnect
+	lastUsed    time.Time // time the connection was last requested
+	failures    int       // number of consecutive failed connection attempts
+	nextAttempt time.Time // earliest time of the next connection attempt
+	lastErr     error     // error from the last failed connection attempt
+}
+
+// touch records that the connection is used.
+func (c *connection) touch() {
+	c.mu.Lock()
+	c.lastUsed = time.Now()
+	c.mu.Unlock()
+}
+
+// lastUse returns the time the connection was last requested.
+func (c *connection) lastUse() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastUsed
+}
+
+// get returns the connected libvirt client, (re)connecting first if needed. A closed connection does not reconnect, so
+// that LibvirtClients which still hold it (e.g. after the credentials of its owner changed) do not open untracked
+// connections; they fail until a new LibvirtClient is requested from the ConnectionManager.
+func (c *connection) get() (*libvirt.Libvirt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, fmt.Errorf("libvirt connection to %s is closed", c.uri.Redacted())
+	}
+	c.lastUsed = time.Now()
+
+	if c.client != nil && c.client.IsConnected() {
+		return c.client, nil
+	}
+	if c.client != nil {
+		slog.Info("libvirt connection lost; reconnecting", "uri", c.uri.Redacted())
+		c.client = nil
+	}
+
+	if wait := time.Until(c.nextAttempt); wait > 0 {
+		return nil, fmt.Errorf("failed to connect to libvirt (retrying in %s): %w", wait.Round(time.Second), c.lastErr)
+	}
+
+	client, err := c.manager.connect(c.uri, c.credentials)
+	if err != nil {
+		c.failures++
+		c.lastErr = err
+		c.nextAttempt = time.Now().Add(c.manager.reconnectDelay(c.failures))
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+
+	slog.Debug("connected to libvirt", "uri", c.uri.Redacted())
+	go c.watchDomainEvents(client)
+	c.client = client
+	c.failures = 0
+	c.lastErr = nil
+	c.nextAttempt = time.Time{}
+	return c.client, nil
+}
+
+// keepalive checks that the connection still responds and drops it if not, so that the next call to get reconnects.
+func (c *connection) keepalive() {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+
+	if client == nil || !client.IsConnected() {
+		return
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := client.ConnectGetLibVersion()
+		result <- err
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-time.After(c.manager.KeepaliveTimeout):
+		err = fmt.Errorf("timed out after %s", c.manager.KeepaliveTimeout)
+	}
+	if err == nil {
+		return
+	}
+
+	slog.Warn("libvirt connection failed keepalive check; dropping it", "uri", c.uri.Redacted(), "error", err)
+	c.mu.Lock()
+	if c.client == client {
+		c.client = nil
+	}
+	c.mu.Unlock()
+	go client.Disconnect() //nolint:errcheck // the connection is already considered dead
+}
+
+// close disconnects the connection if it is open, and prevents it from reconnecting.
+func (c *connection) close() {
+	c.mu.Lock()
+	client := c.client
+	c.client = nil
+	c.closed = true
+	c.mu.Unlock()
+
+	if client == nil || !client.IsConnected() {
+		return
+	}
+	if err := client.Disconnect(); err != nil {
+		slog.Warn("failed closing connection to libvirt", "uri", c.uri.Redacted(), "error", err)
+	}
+}
@@ -0,0 +1,304 @@
+package libvirtclient
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/digitalocean/go-libvirt/libvirttest"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const testURI = "qemu+tcp://192.168.122.1/system"
+
+// testServer counts connection attempts to mock libvirt servers and fails them while fail is set.
+type testServer struct {
+	attempts atomic.Int32
+	fail     atomic.Bool
+	last     atomic.Pointer[libvirttest.MockLibvirt] // mock server of the last successful connection
+}
+
+// newTestConnectionManager returns a ConnectionManager which connects to a new mock libvirt server on every attempt.
+func newTestConnectionManager(server *testServer) *ConnectionManager {
+	m := NewConnectionManager()
+	m.MinReconnectDelay = 10 * time.Millisecond
+	m.MaxReconnectDelay = 40 * time.Millisecond
+	m.connect = func(uri *url.URL, credentials *Credentials) (*libvirt.Libvirt, error) {
+		server.attempts.Add(1)
+		if server.fail.Load() {
+			return nil, errors.New("connection refused")
+		}
+		mock := libvirttest.New()
+		l := libvirt.NewWithDialer(mock)
+		if err := l.ConnectToURI(libvirt.RemoteURI(uri)); err != nil {
+			return nil, err
+		}
+		server.last.Store(mock)
+		return l, nil
+	}
+	// The mock libvirt server does not support events
+	m.lifecycleEvents = func(client *libvirt.Libvirt) (<-chan libvirt.DomainEventLifecycleMsg, error) {
+		events := make(chan libvirt.DomainEventLifecycleMsg)
+		go func() {
+			<-client.Disconnected()
+			close(events)
+		}()
+		return events, nil
+	}
+	return m
+}
+
+func TestConnectionManagerSharesConnectionPerURI(t *testing.T) {
+	g := NewWithT(t)
+
+	server := &testServer{}
+	m := newTestConnectionManager(server)
+
+	first, err := m.connection(testURI, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	second, err := m.connection(testURI, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(second).To(BeIdenticalTo(first))
+
+	l1, err := first.get()
+	g.Expect(err).NotTo(HaveOccurred())
+	l2, err := second.get()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(l2).To(BeIdenticalTo(l1))
+	g.Expect(server.attempts.Load()).To(Equal(int32(1)))
+
+	_, err = m.connection("", nil)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestConnectionManagerReconnectsOnCredentialsChange(t *testing.T) {
+	g := NewWithT(t)
+
+	server := &testServer{}
+	m := newTestConnectionManager(server)
+
+	credentials := &Credentials{ClientCertificate: []byte("cert"), ClientKey: []byte("key"), Owner: "default/libvirt"}
+	conn, err := m.connection(testURI, credentials)
+	g.Expect(err).NotTo(HaveOccurred())
+	l, err := conn.get()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// Equal credentials share the connection
+	same, err := m.connection(testURI, &Credentials{ClientCertificate: []byte("cert"), ClientKey: []byte("key"), Owner: "default/libvirt"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(same).To(BeIdenticalTo(conn))
+
+	// Rotated credentials of the same owner replace the connection and close the old one
+	rotated, err := m.connection(testURI, &Credentials{ClientCertificate: []byte("cert2"), ClientKey: []byte("key2"), Owner: "default/libvirt"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rotated).NotTo(BeIdenticalTo(conn))
+	g.Eventually(l.IsConnected).Should(BeFalse())
+
+	_, err = rotated.get()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(server.attempts.Load()).To(Equal(int32(2)))
+
+	// Clients which still hold the closed connection do not reconnect it
+	_, err = conn.get()
+	g.Expect(err).To(MatchError(ContainSubstring("closed")))
+	g.Expect(server.attempts.Load()).To(Equal(int32(2)))
+
+	// Returning to the previous credentials opens a new connection rather than reusing the closed one
+	previous, err := m.connection(testURI, credentials)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(previous).NotTo(BeIdenticalTo(conn))
+	g.Expect(previous).NotTo(BeIdenticalTo(rotated))
+}
+
+func TestConnectionManagerSeparatesCredentialsOfDifferentOwners(t *testing.T) {
+	g := NewWithT(t)
+
+	server := &testServer{}
+	m := newTestConnectionManager(server)
+
+	first, err := m.connection(testURI, &Credentials{Username: "first", Password: "secret", Owner: "default/first"})
+	g.Expect(err).NotTo(HaveOccurred())
+	l1, err := first.get()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	second, err := m.connection(testURI, &Credentials{Username: "second", Password: "secret", Owner: "default/second"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(second).NotTo(BeIdenticalTo(first))
+	l2, err := second.get()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// Alternating between the owners neither closes nor replaces their connections
+	for range 3 {
+		conn, err := m.connection(testURI, &Credentials{Username: "first", Password: "secret", Owner: "default/first"})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(conn).To(BeIdenticalTo(first))
+		conn, err = m.connection(testURI, &Credentials{Username: "second", Password: "secret", Owner: "default/second"})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(conn).To(BeIdenticalTo(second))
+	}
+	g.Consistently(l1.IsConnected, 100*time.Millisecond).Should(BeTrue())
+	g.Expect(l2.IsConnected()).To(BeTrue())
+	g.Expect(server.attempts.Load()).To(Equal(int32(2)))
+
+	// Equal credentials of different owners share a connection, which stays open while either owner uses it
+	shared, err := m.connection(testURI, &Credentials{Username: "first", Password: "secret", Owner: "default/copy"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(shared).To(BeIdenticalTo(first))
+	_, err = m.connection(testURI, &Credentials{Username: "rotated", Password: "secret", Owner: "default/first"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Consistently(l1.IsConnected, 100*time.Millisecond).Should(BeTrue())
+}
+
+func TestConnectionManagerReconnectsWithBackoff(t *testing.T) {
+	g := NewWithT(t)
+
+	server := &testServer{}
+	server.fail.Store(true)
+	m := newTestConnectionManager(server)
+
+	conn, err := m.connection(testURI, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	_, err = conn.get()
+	g.Expect(err).To(MatchError(ContainSubstring("connection refused")))
+	g.Expect(server.attempts.Load()).To(Equal(int32(1)))
+
+	// Attempts within the backoff window fail fast without dialing
+	_, err = conn.get()
+	g.Expect(err).To(MatchError(ContainSubstring("retrying in")))
+	g.Expect(server.attempts.Load()).To(Equal(int32(1)))
+
+	server.fail.Store(false)
+	g.Eventually(func() error {
+		_, err := conn.get()
+		return err
+	}).Should(Succeed())
+	g.Expect(server.attempts.Load()).To(Equal(int32(2)))
+}
+
+func TestConnectionManagerReconnectsDroppedConnection(t *testing.T) {
+	g := NewWithT(t)
+
+	server := &testServer{}
+	m := newTestConnectionManager(server)
+
+	conn, err := m.connection(testURI, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	l, err := conn.get()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// Drop the connection from the server side
+	g.Expect(server.last.Load().Test.Close()).To(Succeed())
+	g.Eventually(l.IsConnected).Should(BeFalse())
+
+	reconnected, err := conn.get()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(reconnected).NotTo(BeIdenticalTo(l))
+	g.Expect(reconnected.IsConnected()).To(BeTrue())
+	g.Expect(server.attempts.Load()).To(Equal(int32(2)))
+}
+
+func TestConnectionManagerReconnectDelay(t *testing.T) {
+	g := NewWithT(t)
+
+	m := NewConnectionManager()
+	g.Expect(m.reconnectDelay(1)).To(Equal(1 * time.Second))
+	g.Expect(m.reconnectDelay(2)).To(Equal(2 * time.Second))
+	g.Expect(m.reconnectDelay(4)).To(Equal(8 * time.Second))
+	g.Expect(m.reconnectDelay(100)).To(Equal(2 * time.Minute))
+}
+
+func TestConnectionManagerEvictsIdleConnections(t *testing.T) {
+	g := NewWithT(t)
+
+	server := &testServer{}
+	m := newTestConnectionManager(server)
+
+	credentials := &Credentials{ClientCertificate: []byte("cert"), ClientKey: []byte("key"), Owner: "default/libvirt"}
+	owned, err := m.connection(testURI, credentials)
+	g.Expect(err).NotTo(HaveOccurred())
+	l1, err := owned.get()
+	g.Expect(err).NotTo(HaveOccurred())
+	unowned, err := m.connection("qemu+tcp://192.168.122.2/system", nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	l2, err := unowned.get()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// Connections in use are kept
+	m.evictIdle(time.Now().Add(m.IdleTimeout / 2))
+	g.Expect(l1.IsConnected()).To(BeTrue())
+	g.Expect(l2.IsConnected()).To(BeTrue())
+
+	m.evictIdle(time.Now().Add(m.IdleTimeout))
+	g.Eventually(l1.IsConnected).Should(BeFalse())
+	g.Eventually(l2.IsConnected).Should(BeFalse())
+	_, err = owned.get()
+	g.Expect(err).To(MatchError(ContainSubstring("closed")))
+	g.Expect(server.attempts.Load()).To(Equal(int32(2)))
+
+	// Evicted connections are opened again when they are used
+	reopened, err := m.connection(testURI, credentials)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(reopened).NotTo(BeIdenticalTo(owned))
+	_, err = reopened.get()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(server.attempts.Load()).To(Equal(int32(3)))
+}
+
+func TestConnectionManagerClosesConnectionsOnStop(t *testing.T) {
+	g := NewWithT(t)
+
+	server := &testServer{}
+	m := newTestConnectionManager(server)
+	m.KeepaliveInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() { stopped <- m.Start(ctx) }()
+
+	conn, err := m.connection(testURI, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	l, err := conn.get()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// Healthy connections survive keepalive checks
+	g.Consistently(l.IsConnected, 50*time.Millisecond).Should(BeTrue())
+
+	cancel()
+	g.Eventually(stopped).Should(Receive(BeNil()))
+	g.Expect(l.IsConnected()).To(BeFalse())
+
+	_, err = m.Client(testURI, nil)
+	g.Expect(err).To(MatchError(ContainSubstring("stopped")))
+}
+
+func TestConnectionManagerPublishesDomainEvents(t *testing.T) {
+	g := NewWithT(t)
+
+	server := &testServer{}
+	m := newTestConnectionManager(server)
+	events := make(chan libvirt.DomainEventLifecycleMsg)
+	m.lifecycleEvents = func(client *libvirt.Libvirt) (<-chan libvirt.DomainEventLifecycleMsg, error) {
+		return events, nil
+	}
+
+	_, err := m.Client(testURI, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	dropped := testutil.ToFloat64(domainEventsDropped.WithLabelValues(testURI))
+
+	events <- libvirt.DomainEventLifecycleMsg{Dom: libvirt.Domain{Name: "test-machine"}, Event: int32(libvirt.DomainEventCrashed)}
+	g.Eventually(m.DomainEvents()).Should(Receive(Equal(DomainEvent{URI: testURI, Domain: "test-machine", Event: "Crashed"})))
+
+	// Events are dropped rather than blocking the connection when nobody receives them
+	for range domainEventsBuffer + 1 {
+		events <- libvirt.DomainEventLifecycleMsg{Dom: libvirt.Domain{Name: "test-machine"}, Event: int32(libvirt.DomainEventStopped)}
+	}
+	close(events)
+	g.Eventually(m.DomainEvents).Should(HaveLen(domainEventsBuffer))
+	g.Eventually(func() float64 { return testutil.ToFloat64(domainEventsDropped.WithLabelValues(testURI)) - dropped }).Should(Equal(1.0))
+}
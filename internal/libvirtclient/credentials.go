@@ -0,0 +1,76 @@
+package libvirtclient
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// Credentials holds the secret material used to connect to a libvirt daemon, typically loaded from a Kubernetes
+// Secret. A nil *Credentials means that no credentials are used beyond what libvirt reads from the local filesystem.
+type Credentials struct {
+	// CACertificate is the PEM-encoded CA bundle used to verify the certificate of a qemu+tls server. If empty, the
+	// system CA bundle is used.
+	CACertificate []byte
+	// ClientCertificate is the PEM-encoded client certificate presented to a qemu+tls server.
+	ClientCertificate []byte
+	// ClientKey is the PEM-encoded private key of ClientCertificate.
+	ClientKey []byte
+
+	// Username and Password are used for SASL authentication, if the libvirt server requires it.
+	Username string
+	Password string
+
+	// SSHPrivateKey is the PEM-encoded (unencrypted) private key used to authenticate qemu+ssh connections.
+	SSHPrivateKey []byte
+	// SSHKnownHosts is an OpenSSH known_hosts file which lists the host keys (or certificate authorities) of the
+	// qemu+ssh servers.
+	SSHKnownHosts []byte
+
+	// Owner identifies where the credentials come from (e.g. the "<namespace>/<name>" of their Secret), so that
+	// connections using previous credentials of the same owner are closed when the credentials are rotated. It is not
+	// part of the credentials' fingerprint: equal credentials from different owners share their connections.
+	Owner string
+}
+
+// owner returns the owner of the credentials, or an empty string for nil credentials.
+func (c *Credentials) owner() string {
+	if c == nil {
+		return ""
+	}
+	return c.Owner
+}
+
+// hasTLS returns true if any TLS material is set.
+func (c *Credentials) hasTLS() bool {
+	return c != nil && (len(c.CACertificate) > 0 || len(c.ClientCertificate) > 0 || len(c.ClientKey) > 0)
+}
+
+// hasSASL returns true if a SASL username is set.
+func (c *Credentials) hasSASL() bool {
+	return c != nil && c.Username != ""
+}
+
+// hasSSH returns true if an SSH private key is set.
+func (c *Credentials) hasSSH() bool {
+	return c != nil && len(c.SSHPrivateKey) > 0
+}
+
+// fingerprint returns a hash of the credentials, so that connections are only shared by callers with equal
+// credentials. A nil *Credentials has an empty fingerprint.
+func (c *Credentials) fingerprint() string {
+	if c == nil {
+		return ""
+	}
+	h := sha256.New()
+	fields := [][]byte{
+		c.CACertificate, c.ClientCertificate, c.ClientKey,
+		[]byte(c.Username), []byte(c.Password),
+		c.SSHPrivateKey, c.SSHKnownHosts,
+	}
+	for _, field := range fields {
+		_ = binary.Write(h, binary.BigEndian, uint64(len(field)))
+		h.Write(field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,193 @@
+package libvirtclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/digitalocean/go-libvirt/socket"
+	"github.com/digitalocean/go-libvirt/socket/dialers"
+)
+
+const (
+	// defaultTLSPort is the default port of the libvirtd TLS listener.
+	defaultTLSPort = "16514"
+	// defaultDialTimeout is the default timeout for establishing a connection to libvirtd.
+	defaultDialTimeout = 20 * time.Second
+)
+
+// connect opens a new connection to the given URI. Transports which have credentials set are dialed using those
+// credentials; all other connections are opened the same way as libvirt.ConnectToURI does. Authentication errors are
+// wrapped with ErrAuthenticationFailed.
+func connect(uri *url.URL, credentials *Credentials) (*libvirt.Libvirt, error) {
+	dialer, err := newDialer(uri, credentials)
+	if err != nil {
+		return nil, err
+	}
+	if dialer == nil {
+		l, err := libvirt.ConnectToURI(uri)
+		return l, wrapAuthError(err)
+	}
+
+	l := libvirt.NewWithDialer(dialer)
+	if err := l.ConnectToURI(libvirt.RemoteURI(uri)); err != nil {
+		return nil, wrapAuthError(err)
+	}
+	return l, nil
+}
+
+// newDialer returns a dialer for the transport of the given URI which uses the given credentials, or nil if the
+// default go-libvirt dialer should be used instead.
+func newDialer(uri *url.URL, credentials *Credentials) (socket.Dialer, error) {
+	var dialer socket.Dialer
+	switch transport(uri) {
+	case "tls":
+		if credentials.hasTLS() {
+			tlsDialer, err := newTLSDialer(uri, credentials)
+			if err != nil {
+				return nil, err
+			}
+			dialer = tlsDialer
+		}
+	case "ssh", "libssh", "libssh2":
+		if credentials.hasSSH() {
+			sshDialer, err := newSSHDialer(uri, credentials)
+			if err != nil {
+				return nil, err
+			}
+			dialer = sshDialer
+		}
+	}
+
+	if credentials.hasSASL() {
+		if dialer == nil {
+			var err error
+			if dialer, err = defaultDialer(uri); err != nil {
+				return nil, err
+			}
+		}
+		dialer = &saslDialer{dialer: dialer, username: credentials.Username, password: credentials.Password}
+	}
+
+	return dialer, nil
+}
+
+// defaultDialer returns the go-libvirt dialer for the transport of the given URI, configured from the URI the same
+// way as libvirt.ConnectToURI does.
+func defaultDialer(uri *url.URL) (socket.Dialer, error) {
+	switch t := transport(uri); t {
+	case "unix":
+		options := []dialers.LocalOption{}
+		if s := uri.Query().Get("socket"); s != "" {
+			options = append(options, dialers.WithSocket(s))
+		}
+		return dialers.NewLocal(options...), nil
+	case "tcp":
+		options := []dialers.RemoteOption{}
+		if port := uri.Port(); port != "" {
+			options = append(options, dialers.UsePort(port))
+		}
+		return dialers.NewRemote(uri.Hostname(), options...), nil
+	case "tls":
+		options := []dialers.TLSOption{}
+		if port := uri.Port(); port != "" {
+			options = append(options, dialers.UseTLSPort(port))
+		}
+		if pkiPath := uri.Query().Get("pkipath"); pkiPath != "" {
+			options = append(options, dialers.UsePKIPath(pkiPath))
+		}
+		return dialers.NewTLS(uri.Hostname(), options...), nil
+	default:
+		return nil, fmt.Errorf("libvirt transport %q is not supported with credentials", t)
+	}
+}
+
+// transport returns the transport part of a libvirt URI scheme (e.g. "tls" for "qemu+tls"), following the same
+// defaults as libvirt.
+func transport(uri *url.URL) string {
+	if scheme := strings.SplitN(uri.Scheme, "+", 2); len(scheme) > 1 {
+		return scheme[1]
+	}
+	if uri.Host != "" {
+		return "tls"
+	}
+	return "unix"
+}
+
+// tlsDialer dials a libvirtd TLS listener using in-memory certificates.
+type tlsDialer struct {
+	address string
+	config  *tls.Config
+	timeout time.Duration
+}
+
+// newTLSDialer returns a dialer for the qemu+tls URI using the CA certificate, client certificate and key from the
+// given credentials. The server certificate is always verified against the host name of the URI.
+func newTLSDialer(uri *url.URL, credentials *Credentials) (*tlsDialer, error) {
+	config := &tls.Config{
+		ServerName: uri.Hostname(),
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(credentials.CACertificate) > 0 {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(credentials.CACertificate) {
+			return nil, errors.New("invalid TLS CA certificate: no PEM-encoded certificates found")
+		}
+	}
+
+	if len(credentials.ClientCertificate) > 0 || len(credentials.ClientKey) > 0 {
+		cert, err := tls.X509KeyPair(credentials.ClientCertificate, credentials.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	port := uri.Port()
+	if port == "" {
+		port = defaultTLSPort
+	}
+
+	return &tlsDialer{
+		address: net.JoinHostPort(uri.Hostname(), port),
+		config:  config,
+		timeout: defaultDialTimeout,
+	}, nil
+}
+
+// Dial implements socket.Dialer.
+func (d *tlsDialer) Dial() (net.Conn, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: d.timeout}, "tcp", d.address, d.config)
+	if err != nil {
+		return nil, err
+	}
+
+	// After the TLS handshake, libvirtd writes a single byte which indicates whether its own checks of the client
+	// certificate (e.g. tls_allowed_dn_list) succeeded
+	if err := conn.SetReadDeadline(time.Now().Add(d.timeout)); err != nil {
+		conn.Close() //nolint:errcheck
+		return nil, err
+	}
+	status := make([]byte, 1)
+	if _, err := conn.Read(status); err != nil {
+		conn.Close() //nolint:errcheck
+		return nil, fmt.Errorf("failed reading TLS verification status from libvirt: %v", err)
+	}
+	if status[0] != 1 {
+		conn.Close() //nolint:errcheck
+		return nil, fmt.Errorf("%w: libvirt rejected the TLS client certificate", ErrAuthenticationFailed)
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		conn.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,218 @@
+package libvirtclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// testCertificate is a PEM-encoded certificate and private key.
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+	kpem []byte
+}
+
+// newTestCertificate issues a certificate from template, signed by parent (or self-signed if parent is nil).
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+	t.Helper()
+	g := NewWithT(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	g.Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	g.Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	return &testCertificate{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		kpem: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func newTestCA(t *testing.T) *testCertificate {
+	return newTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+// startTestTLSServer starts a libvirtd-like TLS listener for the host name "localhost" which requires client
+// certificates issued by ca, and writes status after each successful handshake. It returns the listener port.
+func startTestTLSServer(t *testing.T, ca *testCertificate, status byte) string {
+	t.Helper()
+	g := NewWithT(t)
+
+	server := newTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	serverCert, err := tls.X509KeyPair(server.pem, server.kpem)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	t.Cleanup(func() { listener.Close() }) //nolint:errcheck
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close() //nolint:errcheck
+				if err := conn.(*tls.Conn).Handshake(); err != nil {
+					return
+				}
+				if _, err := conn.Write([]byte{status}); err != nil {
+					return
+				}
+				_, _ = conn.Read(make([]byte, 1)) // wait for the client to close the connection
+			}()
+		}
+	}()
+
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	g.Expect(err).NotTo(HaveOccurred())
+	return port
+}
+
+// newTestClientCredentials returns credentials with a client certificate issued by ca, trusting trustedCA.
+func newTestClientCredentials(t *testing.T, ca *testCertificate, trustedCA *testCertificate) *Credentials {
+	client := newTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "caplv"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	return &Credentials{
+		CACertificate:     trustedCA.pem,
+		ClientCertificate: client.pem,
+		ClientKey:         client.kpem,
+	}
+}
+
+func dialTLS(t *testing.T, uri string, credentials *Credentials) error {
+	t.Helper()
+	g := NewWithT(t)
+
+	u, err := url.Parse(uri)
+	g.Expect(err).NotTo(HaveOccurred())
+	dialer, err := newDialer(u, credentials)
+	if err != nil {
+		return err
+	}
+	g.Expect(dialer).NotTo(BeNil())
+
+	conn, err := dialer.Dial()
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestTLSDialer(t *testing.T) {
+	ca := newTestCA(t)
+	port := startTestTLSServer(t, ca, 1)
+
+	t.Run("connects with valid credentials", func(t *testing.T) {
+		g := NewWithT(t)
+		err := dialTLS(t, fmt.Sprintf("qemu+tls://localhost:%s/system", port), newTestClientCredentials(t, ca, ca))
+		g.Expect(err).NotTo(HaveOccurred())
+	})
+
+	t.Run("checks the server host name", func(t *testing.T) {
+		g := NewWithT(t)
+		err := dialTLS(t, fmt.Sprintf("qemu+tls://127.0.0.1:%s/system", port), newTestClientCredentials(t, ca, ca))
+		g.Expect(err).To(MatchError(ContainSubstring("127.0.0.1")))
+	})
+
+	t.Run("checks the server CA", func(t *testing.T) {
+		g := NewWithT(t)
+		err := dialTLS(t, fmt.Sprintf("qemu+tls://localhost:%s/system", port), newTestClientCredentials(t, ca, newTestCA(t)))
+		g.Expect(err).To(MatchError(ContainSubstring("unknown authority")))
+	})
+
+	t.Run("fails with an untrusted client certificate", func(t *testing.T) {
+		g := NewWithT(t)
+		err := dialTLS(t, fmt.Sprintf("qemu+tls://localhost:%s/system", port), newTestClientCredentials(t, newTestCA(t), ca))
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("fails with invalid credentials", func(t *testing.T) {
+		g := NewWithT(t)
+		err := dialTLS(t, fmt.Sprintf("qemu+tls://localhost:%s/system", port), &Credentials{CACertificate: []byte("not a certificate")})
+		g.Expect(err).To(MatchError(ContainSubstring("invalid TLS CA certificate")))
+
+		credentials := newTestClientCredentials(t, ca, ca)
+		credentials.ClientKey = nil
+		err = dialTLS(t, fmt.Sprintf("qemu+tls://localhost:%s/system", port), credentials)
+		g.Expect(err).To(MatchError(ContainSubstring("invalid TLS client certificate")))
+	})
+}
+
+func TestTLSDialerRejectedByServer(t *testing.T) {
+	g := NewWithT(t)
+
+	ca := newTestCA(t)
+	port := startTestTLSServer(t, ca, 0)
+
+	err := dialTLS(t, fmt.Sprintf("qemu+tls://localhost:%s/system", port), newTestClientCredentials(t, ca, ca))
+	g.Expect(err).To(MatchError(ContainSubstring("rejected")))
+}
+
+func TestNewDialerDefaults(t *testing.T) {
+	g := NewWithT(t)
+
+	credentials := &Credentials{CACertificate: []byte("ca")}
+	for uri, creds := range map[string]*Credentials{
+		"qemu+tcp://192.168.122.1/system": credentials,
+		"qemu:///system":                  credentials,
+		"qemu+tls://192.168.122.1/system": nil,
+		"qemu://192.168.122.1/system":     {},
+	} {
+		u, err := url.Parse(uri)
+		g.Expect(err).NotTo(HaveOccurred())
+		dialer, err := newDialer(u, creds)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(dialer).To(BeNil(), uri)
+	}
+}
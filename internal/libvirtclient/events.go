@@ -0,0 +1,100 @@
+package libvirtclient
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// domainEventsBuffer is the number of domain events buffered for the receiver of ConnectionManager.DomainEvents.
+const domainEventsBuffer = 100
+
+// domainEventsDropped counts the domain events of each libvirt host which were dropped because the receiver of
+// ConnectionManager.DomainEvents did not keep up. It is served on the metrics endpoint of the manager.
+var domainEventsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "caplv_libvirt_domain_events_dropped_total",
+	Help: "Number of libvirt domain lifecycle events dropped because their receiver did not keep up",
+}, []string{"uri"})
+
+func init() {
+	metrics.Registry.MustRegister(domainEventsDropped)
+}
+
+// DomainEvent is a lifecycle event of a domain on a libvirt host.
+type DomainEvent struct {
+	URI    string // URI of the libvirt host
+	Domain string // name of the domain
+	Event  string // type of the event, e.g. "Started", "Stopped" or "Crashed"
+}
+
+// domainEventNames are the names of libvirt's domain lifecycle event types.
+var domainEventNames = map[libvirt.DomainEventType]string{
+	libvirt.DomainEventDefined:     "Defined",
+	libvirt.DomainEventUndefined:   "Undefined",
+	libvirt.DomainEventStarted:     "Started",
+	libvirt.DomainEventSuspended:   "Suspended",
+	libvirt.DomainEventResumed:     "Resumed",
+	libvirt.DomainEventStopped:     "Stopped",
+	libvirt.DomainEventShutdown:    "Shutdown",
+	libvirt.DomainEventPmsuspended: "PMSuspended",
+	libvirt.DomainEventCrashed:     "Crashed",
+}
+
+// domainEventName returns the name of the domain lifecycle event type.
+func domainEventName(eventType int32) string {
+	if name, ok := domainEventNames[libvirt.DomainEventType(eventType)]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// DomainEvents returns the lifecycle events of the domains on all libvirt hosts the ConnectionManager is connected to,
+// e.g. when a domain is stopped or crashes. Hosts are only watched while they are connected, and events are dropped
+// when the channel is full (counted by the caplv_libvirt_domain_events_dropped_total metric).
+func (m *ConnectionManager) DomainEvents() <-chan DomainEvent {
+	return m.events
+}
+
+// lifecycleEvents subscribes to the domain lifecycle events of the libvirt client. The events stop (and the channel is
+// closed) when the client is disconnected.
+func lifecycleEvents(client *libvirt.Libvirt) (<-chan libvirt.DomainEventLifecycleMsg, error) {
+	return client.LifecycleEvents(context.Background())
+}
+
+// watchDomainEvents forwards the lifecycle events of the domains on the connected libvirt client to the
+// ConnectionManager until the client is disconnected.
+func (c *connection) watchDomainEvents(client *libvirt.Libvirt) {
+	events, err := c.manager.lifecycleEvents(client)
+	if err != nil {
+		if client.IsConnected() {
+			slog.Warn("failed to subscribe to libvirt domain events", "uri", c.uri.Redacted(), "error", err)
+		}
+		return
+	}
+
+	// Only the first of consecutively dropped events is logged as a warning, so that a burst of events does not flood
+	// the log
+	var dropped uint64
+	for msg := range events {
+		event := DomainEvent{URI: c.name, Domain: msg.Dom.Name, Event: domainEventName(msg.Event)}
+		slog.Debug("received libvirt domain event", "uri", c.uri.Redacted(), "domain", event.Domain, "event", event.Event)
+		select {
+		case c.manager.events <- event:
+			if dropped > 0 {
+				slog.Info("resumed forwarding libvirt domain events", "uri", c.uri.Redacted(), "dropped", dropped)
+				dropped = 0
+			}
+		default:
+			if dropped == 0 {
+				slog.Warn("dropping libvirt domain events, as their receiver does not keep up", "uri", c.uri.Redacted(), "domain", event.Domain, "event", event.Event)
+			} else {
+				slog.Debug("dropped libvirt domain event", "uri", c.uri.Redacted(), "domain", event.Domain, "event", event.Event)
+			}
+			dropped++
+			domainEventsDropped.WithLabelValues(c.uri.Redacted()).Inc()
+		}
+	}
+}
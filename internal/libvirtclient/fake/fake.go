@@ -0,0 +1,614 @@
+// Package fake provides an in-memory implementation of libvirtclient.LibvirtClient for use in tests.
+package fake
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient"
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient/libvirtxml"
+)
+
+const gib = 1024 * 1024 * 1024
+
+// Domain is the state of a domain tracked by the fake LibvirtClient.
+type Domain struct {
+	// Machine is a copy of the LibvirtClientMachine the domain was created from.
+	Machine libvirtclient.LibvirtClientMachine
+	// Running is true if the domain is running.
+	Running bool
+	// Restarts is the number of times the domain was restarted to apply changes to its resources.
+	Restarts int
+	// Shutdowns is the number of times the running domain was asked to shut down. The fake domain does not shut down by
+	// itself; use SetRunning to shut it down.
+	Shutdowns int
+
+	restartRequired bool // the domain has to be restarted to apply the maximums of its resources
+}
+
+// LibvirtClient is a stateful, in-memory libvirtclient.LibvirtClient which tracks domains, volumes, storage pools,
+// networks and DHCP leases.
+type LibvirtClient struct {
+	mu        sync.Mutex
+	domains   map[string]*Domain
+	pools     map[string]*libvirtclient.StoragePool
+	volumes   map[string]map[string]*libvirtclient.StorageVolume // pool name -> volume name -> volume
+	networks  map[string]*libvirtclient.Network
+	leases    map[string]map[int][]string             // domain name -> interface index -> leased IP addresses
+	hosts     map[string][]libvirtxml.NetworkDHCPHost // network name -> DHCP reservations
+	cpus      uint32
+	memory    uint64 // in bytes
+	archs     []string
+	emulated  []string        // architectures of archs which are only supported with emulation
+	downloads map[string]int  // image URL -> number of downloads
+	pending   map[string]bool // image URL -> whether downloads are in progress
+}
+
+var _ libvirtclient.LibvirtClient = &LibvirtClient{}
+
+// NewLibvirtClient returns a new, empty fake LibvirtClient.
+func NewLibvirtClient() *LibvirtClient {
+	return &LibvirtClient{
+		domains:   map[string]*Domain{},
+		pools:     map[string]*libvirtclient.StoragePool{},
+		volumes:   map[string]map[string]*libvirtclient.StorageVolume{},
+		networks:  map[string]*libvirtclient.Network{},
+		leases:    map[string]map[int][]string{},
+		hosts:     map[string][]libvirtxml.NetworkDHCPHost{},
+		cpus:      8,
+		memory:    32 * gib,
+		archs:     []string{libvirtclient.DefaultArchitecture},
+		downloads: map[string]int{},
+		pending:   map[string]bool{},
+	}
+}
+
+// Factory returns a libvirtclient.LibvirtClientFactory which always returns this fake LibvirtClient.
+func (c *LibvirtClient) Factory() libvirtclient.LibvirtClientFactory {
+	return func(uri string, credentials *libvirtclient.Credentials) (libvirtclient.LibvirtClient, error) {
+		return c, nil
+	}
+}
+
+// AddStoragePool adds an active storage pool with the given name.
+func (c *LibvirtClient) AddStoragePool(name string) *LibvirtClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pools[name] = &libvirtclient.StoragePool{Name: name, Active: true}
+	if _, ok := c.volumes[name]; !ok {
+		c.volumes[name] = map[string]*libvirtclient.StorageVolume{}
+	}
+	return c
+}
+
+// AddNetwork adds an active network with the given name.
+func (c *LibvirtClient) AddNetwork(name string) *LibvirtClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.networks[name] = &libvirtclient.Network{Name: name, Active: true}
+	return c
+}
+
+// SetHostCapacity sets the number of physical CPUs and the memory (in MiB) of the host, which default to 8 CPUs and
+// 32 GiB.
+func (c *LibvirtClient) SetHostCapacity(cpus uint32, memory uint64) *LibvirtClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cpus = cpus
+	c.memory = memory * 1024 * 1024
+	return c
+}
+
+// SetHostArchitectures sets the VM architectures supported by the host, which default to DefaultArchitecture.
+func (c *LibvirtClient) SetHostArchitectures(architectures ...string) *LibvirtClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.archs = architectures
+	return c
+}
+
+// SetHostEmulatedArchitectures sets the VM architectures which the host only supports with emulation; they must also
+// be set with SetHostArchitectures.
+func (c *LibvirtClient) SetHostEmulatedArchitectures(architectures ...string) *LibvirtClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.emulated = architectures
+	return c
+}
+
+// SetLeases sets the IP addresses leased to the primary interface of the domain with the given name.
+func (c *LibvirtClient) SetLeases(domainName string, addresses ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	primary := 0
+	if domain, ok := c.domains[domainName]; ok {
+		primary = slices.IndexFunc(domain.Machine.Interfaces(), func(iface libvirtclient.LibvirtClientNetworkInterface) bool { return iface.Primary })
+	}
+	c.setLeases(domainName, primary, addresses)
+}
+
+// SetInterfaceLeases sets the IP addresses leased to the interface with the given index of the domain with the given
+// name.
+func (c *LibvirtClient) SetInterfaceLeases(domainName string, index int, addresses ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setLeases(domainName, index, addresses)
+}
+
+func (c *LibvirtClient) setLeases(domainName string, index int, addresses []string) {
+	if c.leases[domainName] == nil {
+		c.leases[domainName] = map[int][]string{}
+	}
+	c.leases[domainName][index] = addresses
+}
+
+// SetRunning sets the running state of the domain with the given name.
+func (c *LibvirtClient) SetRunning(domainName string, running bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	domain, ok := c.domains[domainName]
+	if !ok {
+		return fmt.Errorf("domain '%s' %w", domainName, libvirtclient.ErrNotFound)
+	}
+	domain.Running = running
+	return nil
+}
+
+// Domain returns a copy of the domain with the given name, if it exists.
+func (c *LibvirtClient) Domain(name string) (Domain, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	domain, ok := c.domains[name]
+	if !ok {
+		return Domain{}, false
+	}
+	return *domain, true
+}
+
+// DHCPHosts returns the DHCP reservations of the network with the given name.
+func (c *LibvirtClient) DHCPHosts(networkName string) []libvirtxml.NetworkDHCPHost {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.hosts[networkName])
+}
+
+// Volumes returns the sorted names of all volumes in the given storage pool.
+func (c *LibvirtClient) Volumes(poolName string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for name := range c.volumes[poolName] {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// AddStorageVolume adds a volume with the given name and capacity (in bytes) to the given storage pool, which must
+// exist, and returns its path.
+func (c *LibvirtClient) AddStorageVolume(poolName string, name string, capacity uint64) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	path := fmt.Sprintf("/%s/%s", poolName, name)
+	c.volumes[poolName][name] = &libvirtclient.StorageVolume{Name: name, Path: path, Capacity: capacity}
+	return path
+}
+
+// Downloads returns the number of times the image at the URL was downloaded, i.e. DownloadImage was called without a
+// checksum or the image was not cached.
+func (c *LibvirtClient) Downloads(url string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.downloads[url]
+}
+
+// SetDownloading sets whether the downloads of the image at the URL are in progress, i.e. whether DownloadImage returns
+// ErrImageDownloadInProgress rather than downloading the image.
+func (c *LibvirtClient) SetDownloading(url string, downloading bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[url] = downloading
+}
+
+// downloadImage adds the volume of the image at the URL to the storage pool unless it exists. The fake does not
+// download images; the URL stands in for the content if there is no checksum.
+func (c *LibvirtClient) downloadImage(poolName string, url string, checksum string) *libvirtclient.Image {
+	checksum = strings.ToLower(strings.TrimPrefix(checksum, "sha256:"))
+	download := checksum == ""
+	if download {
+		checksum = fmt.Sprintf("%x", sha256.Sum256([]byte(url)))
+	}
+	name := libvirtclient.ImageVolumeName(checksum, "qcow2")
+	pool := c.volumes[poolName]
+	_, cached := pool[name]
+	if download || !cached {
+		c.downloads[url]++
+	}
+	if !cached {
+		pool[name] = &libvirtclient.StorageVolume{Name: name, Path: fmt.Sprintf("/%s/%s", poolName, name), Capacity: gib}
+	}
+	return &libvirtclient.Image{StorageVolume: *pool[name], Format: "qcow2", Checksum: checksum}
+}
+
+func (c *LibvirtClient) Create(vm *libvirtclient.LibvirtClientMachine) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(vm.Name) > 63 {
+		return fmt.Errorf("VM name '%s' is too long; must be 63 characters or less", vm.Name)
+	}
+	if _, ok := c.domains[vm.Name]; ok {
+		return fmt.Errorf("domain '%s' already exists", vm.Name)
+	}
+	if vm.BackingImagePath == "" {
+		return fmt.Errorf("VM '%s' has no backing image path", vm.Name)
+	}
+	if vm.CloneMode != "" && vm.CloneMode != libvirtclient.CloneModeLinked && vm.CloneMode != libvirtclient.CloneModeFull {
+		return fmt.Errorf("unsupported clone mode '%s'", vm.CloneMode)
+	}
+	architecture := vm.Architecture
+	if architecture == "" {
+		architecture = libvirtclient.DefaultArchitecture
+	}
+	if !slices.Contains(c.archs, architecture) {
+		return fmt.Errorf("libvirt host does not support %s guests", architecture)
+	}
+	if slices.Contains(c.emulated, architecture) && !vm.AllowEmulation {
+		return fmt.Errorf("libvirt host only supports %s guests with emulation, which is not allowed", architecture)
+	}
+	if _, ok := c.pools[vm.StoragePoolName]; !ok {
+		return fmt.Errorf("failed to get storage pool '%s': %w", vm.StoragePoolName, libvirtclient.ErrNotFound)
+	}
+	for _, iface := range vm.Interfaces() {
+		if _, ok := c.networks[iface.NetworkName]; !ok {
+			return fmt.Errorf("failed to get network '%s': %w", iface.NetworkName, libvirtclient.ErrNotFound)
+		}
+	}
+
+	machine := *vm
+
+	// Like the real LibvirtClient, recreate the primary disk and bootstrap data volumes left over by an earlier attempt,
+	// reuse the volumes of additional disks, and remove what was created if creating the VM fails partway
+	pool := c.volumes[vm.StoragePoolName]
+	for _, name := range []string{vm.DiskVolumeName(), vm.CloudInitVolumeName(), vm.IgnitionVolumeName()} {
+		delete(pool, name)
+	}
+	hosts := maps.Clone(c.hosts)
+	var created [][2]string // pool and name of the created volumes
+	rollback := func() {
+		for _, volume := range created {
+			delete(c.volumes[volume[0]], volume[1])
+		}
+		c.hosts = hosts
+	}
+
+	pool[vm.BootstrapVolumeName()] = &libvirtclient.StorageVolume{
+		Name:     vm.BootstrapVolumeName(),
+		Path:     fmt.Sprintf("/%s/%s", vm.StoragePoolName, vm.BootstrapVolumeName()),
+		Capacity: uint64(len(vm.UserData)),
+	}
+	pool[vm.DiskVolumeName()] = &libvirtclient.StorageVolume{
+		Name:     vm.DiskVolumeName(),
+		Path:     fmt.Sprintf("/%s/%s", vm.StoragePoolName, vm.DiskVolumeName()),
+		Capacity: uint64(vm.DiskSize) * gib,
+	}
+	created = append(created, [2]string{vm.StoragePoolName, vm.BootstrapVolumeName()}, [2]string{vm.StoragePoolName, vm.DiskVolumeName()})
+
+	for i, iface := range vm.Interfaces() {
+		if iface.ReservedIPAddress == "" {
+			continue
+		}
+		host := libvirtxml.NetworkDHCPHost{MAC: vm.MACAddress(i), Name: iface.ReservedHostname, IP: iface.ReservedIPAddress}
+		if host.Name == "" {
+			host.Name = vm.Name
+		}
+		networkHosts := slices.DeleteFunc(slices.Clone(c.hosts[iface.NetworkName]), func(existing libvirtxml.NetworkDHCPHost) bool { return existing.MAC == host.MAC })
+		if slices.ContainsFunc(networkHosts, func(existing libvirtxml.NetworkDHCPHost) bool {
+			return existing.IP == host.IP || existing.Name == host.Name
+		}) {
+			rollback()
+			return fmt.Errorf("failed to reserve IP address '%s' in network '%s': there is an existing dhcp host entry", host.IP, iface.NetworkName)
+		}
+		c.hosts[iface.NetworkName] = append(networkHosts, host)
+	}
+
+	for _, disk := range vm.AdditionalDisks {
+		poolName := vm.AdditionalDiskStoragePoolName(disk)
+		diskPool, ok := c.volumes[poolName]
+		if !ok {
+			rollback()
+			return fmt.Errorf("failed to create additional disk '%s': failed to get storage pool '%s': %w", disk.Name, poolName, libvirtclient.ErrNotFound)
+		}
+		if _, ok := diskPool[vm.AdditionalDiskVolumeName(disk)]; ok {
+			continue
+		}
+		diskPool[vm.AdditionalDiskVolumeName(disk)] = &libvirtclient.StorageVolume{
+			Name:     vm.AdditionalDiskVolumeName(disk),
+			Path:     fmt.Sprintf("/%s/%s", poolName, vm.AdditionalDiskVolumeName(disk)),
+			Capacity: uint64(disk.Size) * gib,
+		}
+		created = append(created, [2]string{poolName, vm.AdditionalDiskVolumeName(disk)})
+	}
+	machine.AdditionalDisks = slices.Clone(vm.AdditionalDisks)
+	machine.NetworkInterfaces = slices.Clone(vm.NetworkInterfaces)
+	c.domains[vm.Name] = &Domain{Machine: machine, Running: true}
+	return nil
+}
+
+func (c *LibvirtClient) Destroy(vm *libvirtclient.LibvirtClientMachine) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	domain, ok := c.domains[vm.Name]
+	if !ok {
+		return fmt.Errorf("failed to lookup domain: domain '%s' %w", vm.Name, libvirtclient.ErrNotFound)
+	}
+	delete(c.domains, vm.Name)
+	delete(c.leases, vm.Name)
+
+	if pool, ok := c.volumes[vm.StoragePoolName]; ok {
+		delete(pool, vm.DiskVolumeName())
+		delete(pool, vm.CloudInitVolumeName())
+		delete(pool, vm.IgnitionVolumeName())
+	}
+	// Like the libvirt client, delete both the additional disks and DHCP reservations of the VM and those the domain
+	// was created with
+	for _, machine := range []*libvirtclient.LibvirtClientMachine{vm, &domain.Machine} {
+		for _, disk := range machine.AdditionalDisks {
+			if pool, ok := c.volumes[machine.AdditionalDiskStoragePoolName(disk)]; ok {
+				delete(pool, machine.AdditionalDiskVolumeName(disk))
+			}
+		}
+		for i, iface := range machine.Interfaces() {
+			c.hosts[iface.NetworkName] = slices.DeleteFunc(c.hosts[iface.NetworkName], func(existing libvirtxml.NetworkDHCPHost) bool {
+				return existing.MAC == machine.MACAddress(i)
+			})
+		}
+	}
+	return nil
+}
+
+func (c *LibvirtClient) Exists(vm *libvirtclient.LibvirtClientMachine) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.domains[vm.Name]
+	return ok
+}
+
+func (c *LibvirtClient) IsReconciled(vm *libvirtclient.LibvirtClientMachine) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	domain, ok := c.domains[vm.Name]
+	if !ok {
+		return false
+	}
+	return slices.Equal(domain.Machine.AdditionalDisks, vm.AdditionalDisks) &&
+		slices.Equal(domain.Machine.Interfaces(), vm.Interfaces())
+}
+
+func (c *LibvirtClient) UpdateResources(vm *libvirtclient.LibvirtClientMachine) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	domain, ok := c.domains[vm.Name]
+	if !ok {
+		return false, fmt.Errorf("domain '%s' %w", vm.Name, libvirtclient.ErrNotFound)
+	}
+	machine := &domain.Machine
+	maxCPU, maxMemory := max(machine.MaxCPU, machine.CPU), max(machine.MaxMemory, machine.Memory)
+	desiredMaxCPU, desiredMaxMemory := max(vm.MaxCPU, vm.CPU), max(vm.MaxMemory, vm.Memory)
+	changed := machine.CPU != vm.CPU || machine.Memory != vm.Memory || maxCPU != desiredMaxCPU || maxMemory != desiredMaxMemory
+	machine.CPU, machine.Memory, machine.MaxCPU, machine.MaxMemory = vm.CPU, vm.Memory, vm.MaxCPU, vm.MaxMemory
+	// Like the libvirt client, a running domain has to be restarted if its maximums change
+	if domain.Running && (maxCPU != desiredMaxCPU || maxMemory != desiredMaxMemory) {
+		domain.restartRequired = true
+	}
+	if domain.Running && domain.restartRequired {
+		return changed, fmt.Errorf("domain '%s' has to be restarted to apply its vCPUs and memory: %w", vm.Name, libvirtclient.ErrRestartRequired)
+	}
+	return changed, nil
+}
+
+func (c *LibvirtClient) Restart(vm *libvirtclient.LibvirtClientMachine, force bool) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	domain, ok := c.domains[vm.Name]
+	if !ok {
+		return false, fmt.Errorf("domain '%s' %w", vm.Name, libvirtclient.ErrNotFound)
+	}
+	if domain.Running && !force {
+		domain.Shutdowns++
+		return false, nil
+	}
+	domain.Running = true
+	domain.Restarts++
+	domain.restartRequired = false
+	return true, nil
+}
+
+func (c *LibvirtClient) ResizeDisk(vm *libvirtclient.LibvirtClientMachine) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	domain, ok := c.domains[vm.Name]
+	if !ok {
+		return false, fmt.Errorf("domain '%s' %w", vm.Name, libvirtclient.ErrNotFound)
+	}
+	vol, ok := c.volumes[vm.StoragePoolName][vm.DiskVolumeName()]
+	if !ok {
+		return false, fmt.Errorf("storage volume '%s' %w", vm.DiskVolumeName(), libvirtclient.ErrNotFound)
+	}
+	size := uint64(vm.DiskSize) * gib
+	switch {
+	case vol.Capacity == size:
+		return false, nil
+	case vol.Capacity > size:
+		return false, fmt.Errorf("storage volume '%s' has a capacity of %d bytes, more than the disk size of %d GiB: %w", vm.DiskVolumeName(), vol.Capacity, vm.DiskSize, libvirtclient.ErrDiskShrink)
+	}
+	vol.Capacity = size
+	domain.Machine.DiskSize = vm.DiskSize
+	return true, nil
+}
+
+func (c *LibvirtClient) IsReady(vm *libvirtclient.LibvirtClientMachine) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	domain, ok := c.domains[vm.Name]
+	return ok && domain.Running
+}
+
+func (c *LibvirtClient) GetIPAddresses(vm *libvirtclient.LibvirtClientMachine) ([]libvirtclient.InterfaceAddresses, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	domain, ok := c.domains[vm.Name]
+	if !ok {
+		return nil, fmt.Errorf("domain '%s' %w", vm.Name, libvirtclient.ErrNotFound)
+	}
+	if !domain.Running {
+		return nil, fmt.Errorf("Error: VM %s is not running", vm.Name)
+	}
+	var addresses []libvirtclient.InterfaceAddresses
+	for i, iface := range domain.Machine.Interfaces() {
+		addresses = append(addresses, libvirtclient.InterfaceAddresses{
+			NetworkName: iface.NetworkName,
+			MACAddress:  domain.Machine.MACAddress(i),
+			Primary:     iface.Primary,
+			Addresses:   slices.Clone(c.leases[vm.Name][i]),
+		})
+	}
+	vm.AddStaticAddresses(addresses)
+	return addresses, nil
+}
+
+func (c *LibvirtClient) GetStoragePool(name string) (*libvirtclient.StoragePool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pool, ok := c.pools[name]
+	if !ok {
+		return nil, fmt.Errorf("storage pool '%s' %w", name, libvirtclient.ErrNotFound)
+	}
+	result := *pool
+	return &result, nil
+}
+
+func (c *LibvirtClient) GetStorageVolume(poolName string, name string) (*libvirtclient.StorageVolume, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pools[poolName]; !ok {
+		return nil, fmt.Errorf("storage pool '%s' %w", poolName, libvirtclient.ErrNotFound)
+	}
+	vol, ok := c.volumes[poolName][name]
+	if !ok {
+		return nil, fmt.Errorf("storage volume '%s' in pool '%s' %w", name, poolName, libvirtclient.ErrNotFound)
+	}
+	result := *vol
+	return &result, nil
+}
+
+func (c *LibvirtClient) GetNetwork(name string) (*libvirtclient.Network, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	network, ok := c.networks[name]
+	if !ok {
+		return nil, fmt.Errorf("network '%s' %w", name, libvirtclient.ErrNotFound)
+	}
+	result := *network
+	return &result, nil
+}
+
+func (c *LibvirtClient) GetHostInfo() (*libvirtclient.HostInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info := &libvirtclient.HostInfo{CPUs: c.cpus, Memory: c.memory, FreeMemory: c.memory, Architectures: slices.Clone(c.archs), Emulated: slices.Clone(c.emulated)}
+	for _, domain := range c.domains {
+		if !domain.Running {
+			continue
+		}
+		info.AllocatedCPUs += uint32(domain.Machine.CPU)
+		info.FreeMemory -= min(uint64(domain.Machine.Memory)*1024*1024, info.FreeMemory)
+	}
+	return info, nil
+}
+
+func (c *LibvirtClient) GetStorageVolumeByPath(path string) (*libvirtclient.StorageVolume, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, pool := range c.volumes {
+		for _, vol := range pool {
+			if vol.Path == path {
+				result := *vol
+				return &result, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("storage volume '%s' %w", path, libvirtclient.ErrNotFound)
+}
+
+func (c *LibvirtClient) DeleteStorageVolume(poolName string, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pools[poolName]; !ok {
+		return fmt.Errorf("storage pool '%s' %w", poolName, libvirtclient.ErrNotFound)
+	}
+	if _, ok := c.volumes[poolName][name]; !ok {
+		return fmt.Errorf("storage volume '%s' in pool '%s' %w", name, poolName, libvirtclient.ErrNotFound)
+	}
+	delete(c.volumes[poolName], name)
+	return nil
+}
+
+func (c *LibvirtClient) DownloadImage(poolName string, url string, checksum string) (*libvirtclient.Image, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pools[poolName]; !ok {
+		return nil, fmt.Errorf("failed to get storage pool '%s': %w", poolName, libvirtclient.ErrNotFound)
+	}
+	if c.pending[url] {
+		if image, ok := c.cachedImage(poolName, checksum); ok {
+			return image, nil
+		}
+		return nil, libvirtclient.ErrImageDownloadInProgress
+	}
+	return c.downloadImage(poolName, url, checksum), nil
+}
+
+func (c *LibvirtClient) GetImage(poolName string, checksum string) (*libvirtclient.Image, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pools[poolName]; !ok {
+		return nil, fmt.Errorf("failed to get storage pool '%s': %w", poolName, libvirtclient.ErrNotFound)
+	}
+	image, ok := c.cachedImage(poolName, checksum)
+	if !ok {
+		return nil, fmt.Errorf("image with checksum %s in storage pool '%s' %w", checksum, poolName, libvirtclient.ErrNotFound)
+	}
+	return image, nil
+}
+
+// cachedImage returns the volume of the image with the checksum in the storage pool, if it exists.
+func (c *LibvirtClient) cachedImage(poolName string, checksum string) (*libvirtclient.Image, bool) {
+	checksum = strings.ToLower(strings.TrimPrefix(checksum, "sha256:"))
+	if checksum == "" {
+		return nil, false
+	}
+	volume, ok := c.volumes[poolName][libvirtclient.ImageVolumeName(checksum, "qcow2")]
+	if !ok {
+		return nil, false
+	}
+	return &libvirtclient.Image{StorageVolume: *volume, Format: "qcow2", Checksum: checksum}, true
+}
+
+func (c *LibvirtClient) GetLinkedClones(path string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var clones []string
+	for _, domain := range c.domains {
+		if domain.Machine.BackingImagePath == path && domain.Machine.CloneMode != libvirtclient.CloneModeFull {
+			clones = append(clones, domain.Machine.DiskVolumeName())
+		}
+	}
+	slices.Sort(clones)
+	return clones, nil
+}
@@ -0,0 +1,108 @@
+package libvirtclient
+
+import (
+	"fmt"
+
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient/libvirtxml"
+)
+
+// Bootstrap data formats of VMs.
+const (
+	// BootstrapFormatCloudConfig is cloud-init user data, which is written to a NoCloud ISO attached as a cdrom.
+	BootstrapFormatCloudConfig = "cloud-config"
+	// BootstrapFormatIgnition is an Ignition config (e.g. for Flatcar or Fedora CoreOS), which is delivered as
+	// configured by the VM's IgnitionDelivery.
+	BootstrapFormatIgnition = "ignition"
+)
+
+// Ways to deliver the Ignition config of a VM.
+const (
+	// IgnitionDeliveryFWCfg passes the Ignition config as a QEMU fw_cfg entry, from which Ignition reads it on the
+	// "qemu" platform.
+	IgnitionDeliveryFWCfg = "fwcfg"
+	// IgnitionDeliveryVolume attaches the Ignition config as a read-only virtio disk, from which Ignition reads it on
+	// the "qemu" platform of architectures without fw_cfg.
+	IgnitionDeliveryVolume = "volume"
+)
+
+const (
+	ignitionFWCfgName  = "opt/com.coreos/config" // name of the fw_cfg entry
+	ignitionDiskSerial = "ignition"              // serial of the disk (/dev/disk/by-id/virtio-ignition)
+)
+
+// IgnitionVolumeName returns the name of the VM's Ignition config volume.
+func (vm *LibvirtClientMachine) IgnitionVolumeName() string {
+	return fmt.Sprintf("%s-ignition.ign", vm.Name)
+}
+
+// BootstrapVolumeName returns the name of the volume with the VM's bootstrap data, i.e. its cloud-init ISO volume or
+// its Ignition config volume.
+func (vm *LibvirtClientMachine) BootstrapVolumeName() string {
+	if vm.isIgnition() {
+		return vm.IgnitionVolumeName()
+	}
+	return vm.CloudInitVolumeName()
+}
+
+func (vm *LibvirtClientMachine) isIgnition() bool {
+	return vm.BootstrapFormat == BootstrapFormatIgnition
+}
+
+// withBootstrapDelivery validates the bootstrap format of the VM and returns a copy of it whose IgnitionDelivery is
+// set to the requested delivery or else the default of the architecture if it has an Ignition config.
+func (vm *LibvirtClientMachine) withBootstrapDelivery(arch architecture) (*LibvirtClientMachine, error) {
+	copied := *vm
+	switch vm.BootstrapFormat {
+	case "", BootstrapFormatCloudConfig:
+		return &copied, nil
+	case BootstrapFormatIgnition:
+	default:
+		return nil, fmt.Errorf("unsupported bootstrap data format '%s'", vm.BootstrapFormat)
+	}
+
+	if vm.NetworkConfig != nil {
+		return nil, fmt.Errorf("network configuration requires '%s' bootstrap data; configure the network in the Ignition config instead", BootstrapFormatCloudConfig)
+	}
+	switch vm.IgnitionDelivery {
+	case "":
+		copied.IgnitionDelivery = IgnitionDeliveryVolume
+		if arch.fwCfg {
+			copied.IgnitionDelivery = IgnitionDeliveryFWCfg
+		}
+	case IgnitionDeliveryFWCfg:
+		if !arch.fwCfg {
+			return nil, fmt.Errorf("Ignition delivery '%s' is not supported for %s guests", IgnitionDeliveryFWCfg, arch.arch)
+		}
+	case IgnitionDeliveryVolume:
+	default:
+		return nil, fmt.Errorf("unsupported Ignition delivery '%s'", vm.IgnitionDelivery)
+	}
+	return &copied, nil
+}
+
+// addIgnitionConfig adds the Ignition config at the given path to the domain of the VM, either as a fw_cfg entry or
+// as a read-only disk after its additional disks.
+func (vm *LibvirtClientMachine) addIgnitionConfig(domain *libvirtxml.Domain, path string) {
+	if vm.IgnitionDelivery == IgnitionDeliveryVolume {
+		next := 1
+		for _, target := range vm.additionalDiskTargets() {
+			if target.Bus == "virtio" {
+				next++
+			}
+		}
+		domain.Devices.Disks = append(domain.Devices.Disks, libvirtxml.DomainDisk{
+			Type:     "file",
+			Device:   "disk",
+			Driver:   &libvirtxml.DomainDiskDriver{Name: "qemu", Type: "raw"},
+			Source:   &libvirtxml.DomainDiskSource{File: path},
+			Target:   libvirtxml.DomainDiskTarget{Dev: diskDevName("vd", next), Bus: "virtio"},
+			Serial:   ignitionDiskSerial,
+			ReadOnly: &struct{}{},
+		})
+		return
+	}
+	domain.SysInfo = append(domain.SysInfo, libvirtxml.DomainSysInfo{
+		Type:    "fwcfg",
+		Entries: []libvirtxml.DomainSysInfoEntry{{Name: ignitionFWCfgName, File: path}},
+	})
+}
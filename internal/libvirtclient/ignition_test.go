@@ -0,0 +1,86 @@
+package libvirtclient
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient/libvirtxml"
+)
+
+func TestMachineWithBootstrapDelivery(t *testing.T) {
+	g := NewWithT(t)
+
+	amd64, _ := getArchitecture("amd64")
+	s390x, _ := getArchitecture("s390x")
+
+	vm := &LibvirtClientMachine{Name: "test-machine"}
+	g.Expect(vm.withBootstrapDelivery(amd64)).To(Equal(vm))
+	g.Expect(vm.BootstrapVolumeName()).To(Equal("test-machine-cloudinit.iso"))
+
+	vm.BootstrapFormat = BootstrapFormatIgnition
+	g.Expect(vm.BootstrapVolumeName()).To(Equal("test-machine-ignition.ign"))
+	g.Expect(vm.withBootstrapDelivery(amd64)).To(HaveField("IgnitionDelivery", IgnitionDeliveryFWCfg))
+	g.Expect(vm.withBootstrapDelivery(s390x)).To(HaveField("IgnitionDelivery", IgnitionDeliveryVolume))
+	g.Expect(vm.IgnitionDelivery).To(BeEmpty())
+
+	vm.IgnitionDelivery = IgnitionDeliveryVolume
+	g.Expect(vm.withBootstrapDelivery(amd64)).To(HaveField("IgnitionDelivery", IgnitionDeliveryVolume))
+
+	vm.IgnitionDelivery = IgnitionDeliveryFWCfg
+	_, err := vm.withBootstrapDelivery(s390x)
+	g.Expect(err).To(MatchError("Ignition delivery 'fwcfg' is not supported for s390x guests"))
+
+	vm.NetworkConfig = &NetworkConfig{}
+	_, err = vm.withBootstrapDelivery(amd64)
+	g.Expect(err).To(MatchError(ContainSubstring("network configuration requires 'cloud-config' bootstrap data")))
+
+	vm.BootstrapFormat = "mime"
+	_, err = vm.withBootstrapDelivery(amd64)
+	g.Expect(err).To(MatchError("unsupported bootstrap data format 'mime'"))
+}
+
+func TestMachineDomainIgnition(t *testing.T) {
+	g := NewWithT(t)
+
+	vm := &LibvirtClientMachine{
+		Name:             "test-machine",
+		NetworkName:      "default",
+		CPU:              2,
+		Memory:           2048,
+		BootstrapFormat:  BootstrapFormatIgnition,
+		IgnitionDelivery: IgnitionDeliveryFWCfg,
+		AdditionalDisks:  []LibvirtClientDisk{{Name: "etcd", Size: 10}, {Name: "data", Size: 100, Bus: "scsi"}},
+	}
+	amd64, _ := getArchitecture("amd64")
+	additionalDiskPaths := []string{"/k8s/test-machine-etcd.qcow2", "/k8s/test-machine-data.qcow2"}
+
+	// fw_cfg: no cdrom or Ignition disk
+	domain := vm.domain(amd64, FirmwareBIOS, "kvm", "/k8s/test-machine.qcow2", "/k8s/test-machine-ignition.ign", additionalDiskPaths)
+	g.Expect(domain.SysInfo).To(Equal([]libvirtxml.DomainSysInfo{{
+		Type:    "fwcfg",
+		Entries: []libvirtxml.DomainSysInfoEntry{{Name: "opt/com.coreos/config", File: "/k8s/test-machine-ignition.ign"}},
+	}}))
+	g.Expect(domain.Devices.Disks).To(HaveLen(3))
+	g.Expect(domain.Devices.Disks).NotTo(ContainElement(HaveField("Device", "cdrom")))
+
+	data, err := domain.Marshal()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(data).To(ContainSubstring(`<entry name="opt/com.coreos/config" file="/k8s/test-machine-ignition.ign"></entry>`))
+
+	// Volume: a read-only virtio disk after the virtio additional disks
+	vm.IgnitionDelivery = IgnitionDeliveryVolume
+	domain = vm.domain(amd64, FirmwareBIOS, "kvm", "/k8s/test-machine.qcow2", "/k8s/test-machine-ignition.ign", additionalDiskPaths)
+	g.Expect(domain.SysInfo).To(BeEmpty())
+	g.Expect(domain.Devices.Disks).To(HaveLen(4))
+	g.Expect(domain.Devices.Disks[3]).To(Equal(libvirtxml.DomainDisk{
+		Type:     "file",
+		Device:   "disk",
+		Driver:   &libvirtxml.DomainDiskDriver{Name: "qemu", Type: "raw"},
+		Source:   &libvirtxml.DomainDiskSource{File: "/k8s/test-machine-ignition.ign"},
+		Target:   libvirtxml.DomainDiskTarget{Dev: "vdc", Bus: "virtio"},
+		Serial:   "ignition",
+		ReadOnly: &struct{}{},
+	}))
+	g.Expect(additionalDiskSources(domain)).To(Equal(additionalDiskPaths))
+}
@@ -0,0 +1,404 @@
+package libvirtclient
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient/libvirtxml"
+)
+
+// imageVolumePrefix is the name prefix of the storage volumes of downloaded backing images.
+const imageVolumePrefix = "caplv-image-"
+
+// imageFormats are the formats of downloaded backing images, which are detected from their content. Images are not
+// converted, so images in other formats (e.g. vmdk or vhdx) are rejected.
+var imageFormats = []string{"qcow2", "raw"}
+
+// unsupportedImageFormats are the magic numbers of image formats and compressions which are detected and rejected,
+// rather than being used as raw images.
+var unsupportedImageFormats = map[string]string{
+	"KDMV":             "vmdk",
+	"vhdxfile":         "vhdx",
+	"conectix":         "vpc",
+	"\xfd7zXZ\x00":     "xz compressed",
+	"\x28\xb5\x2f\xfd": "zstd compressed",
+}
+
+// imageHTTPClient downloads backing images. Its timeouts limit connecting to the server and waiting for its response,
+// and the download as a whole; downloads are also cancelled with the context of the caller.
+var imageHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	Timeout: 30 * time.Minute,
+}
+
+// imageDownloadRetention is how long the image of a finished download is returned to the VMs waiting for it, before
+// the image is downloaded again (if it has no checksum) or looked up in the cache.
+const imageDownloadRetention = 10 * time.Minute
+
+// imageDownload is a download of a backing image in the background. Its result is set before done is closed.
+type imageDownload struct {
+	done     chan struct{}
+	image    *Image
+	err      error
+	finished time.Time
+}
+
+// imageDownloads are the downloads of backing images by libvirt host, storage pool, URL and checksum. Downloading
+// each image only once keeps concurrently created VMs from uploading the same image twice or using it before it has
+// been uploaded completely, and the result of a download of an image without a checksum tells the VMs which wait for
+// it which cached image to use.
+var imageDownloads = struct {
+	sync.Mutex
+	downloads map[string]*imageDownload
+}{downloads: map[string]*imageDownload{}}
+
+// awaitImageDownload returns the image of the finished download with the given key. Otherwise, it starts the download
+// in the background unless it is in progress already, and returns ErrImageDownloadInProgress. A failed download is
+// returned once, so that the next call downloads the image again.
+func awaitImageDownload(key string, download func() (*Image, error)) (*Image, error) {
+	imageDownloads.Lock()
+	defer imageDownloads.Unlock()
+
+	for k, d := range imageDownloads.downloads {
+		if d.isDone() && time.Since(d.finished) > imageDownloadRetention {
+			delete(imageDownloads.downloads, k)
+		}
+	}
+
+	if d, ok := imageDownloads.downloads[key]; ok {
+		if !d.isDone() {
+			return nil, ErrImageDownloadInProgress
+		}
+		if d.err != nil {
+			delete(imageDownloads.downloads, key)
+			return nil, d.err
+		}
+		return d.image, nil
+	}
+
+	d := &imageDownload{done: make(chan struct{})}
+	imageDownloads.downloads[key] = d
+	go func() {
+		d.image, d.err = download()
+		d.finished = time.Now()
+		close(d.done)
+	}()
+	return nil, ErrImageDownloadInProgress
+}
+
+// forgetImageDownload removes the finished download with the given key, e.g. because its image was deleted.
+func forgetImageDownload(key string) {
+	imageDownloads.Lock()
+	defer imageDownloads.Unlock()
+	if d, ok := imageDownloads.downloads[key]; ok && d.isDone() {
+		delete(imageDownloads.downloads, key)
+	}
+}
+
+// isDone returns true if the download finished.
+func (d *imageDownload) isDone() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ImageVolumeName returns the name of the storage volume of a downloaded backing image with the given (SHA-256)
+// checksum and format. Images are cached by their checksum, so VMs with the same image share the volume.
+func ImageVolumeName(checksum string, format string) string {
+	return fmt.Sprintf("%s%s.%s", imageVolumePrefix, strings.ToLower(checksum), format)
+}
+
+// normalizeChecksum returns the hex-encoded SHA-256 checksum, which may be prefixed with "sha256:".
+func normalizeChecksum(checksum string) string {
+	return strings.ToLower(strings.TrimPrefix(checksum, "sha256:"))
+}
+
+// Image is a backing image in a storage pool.
+type Image struct {
+	StorageVolume
+	Format   string // format of the image (qcow2 or raw)
+	Checksum string // SHA-256 checksum of the image as downloaded; empty if it was not downloaded
+}
+
+// DownloadImage returns the image at the URL from the storage pool (see ImageVolumeName) if it is cached there, and
+// otherwise downloads it in the background (see awaitImageDownload).
+func (c *libvirtClient) DownloadImage(poolName string, url string, checksum string) (*Image, error) {
+	if err := c.openClient(); err != nil {
+		return nil, err
+	}
+
+	pool, err := c.client.StoragePoolLookupByName(poolName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage pool '%s': %v", poolName, err)
+	}
+
+	// Without a checksum, the image has to be downloaded to find out whether it is cached
+	checksum = normalizeChecksum(checksum)
+	if checksum != "" {
+		if image, ok := c.lookupImageVolume(pool, checksum); ok {
+			slog.Debug("using cached image", "url", url, "path", image.Path)
+			return image, nil
+		}
+	}
+
+	// The download uses its own client, since it outlives this one
+	key := strings.Join([]string{c.conn.name, poolName, url, checksum}, " ")
+	download := func() (*Image, error) {
+		return (&libvirtClient{conn: c.conn}).downloadImage(poolName, url, checksum)
+	}
+	image, err := awaitImageDownload(key, download)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := c.lookupImageVolume(pool, image.Checksum); ok {
+		return cached, nil
+	}
+	// The image was deleted since it was downloaded
+	forgetImageDownload(key)
+	return awaitImageDownload(key, download)
+}
+
+func (c *libvirtClient) GetImage(poolName string, checksum string) (*Image, error) {
+	if err := c.openClient(); err != nil {
+		return nil, err
+	}
+
+	pool, err := c.client.StoragePoolLookupByName(poolName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage pool '%s': %v", poolName, err)
+	}
+	image, ok := c.lookupImageVolume(pool, normalizeChecksum(checksum))
+	if !ok {
+		return nil, fmt.Errorf("image with checksum %s in storage pool '%s' %w", checksum, poolName, ErrNotFound)
+	}
+	return image, nil
+}
+
+// downloadImage downloads the image at the URL into a new volume in the storage pool, unless it turns out to be cached
+// there.
+func (c *libvirtClient) downloadImage(poolName string, url string, checksum string) (*Image, error) {
+	slog.Info("downloading image", "url", url)
+	file, format, checksum, err := fetchImage(context.Background(), url, checksum)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// The connection may have been dropped while downloading
+	if err := c.openClient(); err != nil {
+		return nil, err
+	}
+	pool, err := c.client.StoragePoolLookupByName(poolName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage pool '%s': %v", poolName, err)
+	}
+	if image, ok := c.lookupImageVolume(pool, checksum); ok {
+		slog.Debug("using cached image", "url", url, "path", image.Path)
+		return image, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %v", err)
+	}
+	size := info.Size()
+
+	// The volume is created as raw, since its content (and not libvirt) determines its format
+	name := ImageVolumeName(checksum, format)
+	volumeXML, err := (&libvirtxml.StorageVolume{
+		Name:     name,
+		Capacity: &libvirtxml.Memory{Unit: "bytes", Value: uint64(size)},
+		Target: &libvirtxml.StorageVolumeTarget{
+			Format: &libvirtxml.StorageVolumeFormat{Type: "raw"},
+		},
+	}).Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render storage volume XML: %v", err)
+	}
+	vol, err := c.client.StorageVolCreateXML(pool, volumeXML, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage volume '%s': %v", name, err)
+	}
+	if err := c.client.StorageVolUpload(vol, file, 0, uint64(size), 0); err != nil {
+		// Do not leave an incomplete image behind in the cache
+		if err := c.client.StorageVolDelete(vol, 0); err != nil {
+			slog.Warn("failed to delete incomplete image volume", "volume", name, "error", err)
+		}
+		return nil, fmt.Errorf("failed to upload image to storage volume '%s': %v", name, err)
+	}
+
+	path, err := c.client.StorageVolGetPath(vol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get path of storage volume '%s': %v", name, err)
+	}
+	slog.Info("downloaded image", "url", url, "path", path, "format", format, "size", size)
+	return &Image{
+		StorageVolume: StorageVolume{Name: name, Path: path, Capacity: uint64(size), Allocation: uint64(size)},
+		Format:        format,
+		Checksum:      checksum,
+	}, nil
+}
+
+// lookupImageVolume returns the volume of the image with the given checksum in the storage pool, if it exists.
+func (c *libvirtClient) lookupImageVolume(pool libvirt.StoragePool, checksum string) (*Image, bool) {
+	for _, format := range imageFormats {
+		vol, err := c.client.StorageVolLookupByName(pool, ImageVolumeName(checksum, format))
+		if err != nil {
+			continue
+		}
+		volume, err := c.getStorageVolume(vol)
+		if err != nil {
+			slog.Warn("failed to get image volume", "volume", vol.Name, "error", err)
+			continue
+		}
+		return &Image{StorageVolume: *volume, Format: format, Checksum: checksum}, true
+	}
+	return nil, false
+}
+
+func (c *libvirtClient) GetLinkedClones(path string) ([]string, error) {
+	if err := c.openClient(); err != nil {
+		return nil, err
+	}
+
+	pools, _, err := c.client.ConnectListAllStoragePools(1, libvirt.ConnectListStoragePoolsActive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage pools: %v", err)
+	}
+	var clones []string
+	for _, pool := range pools {
+		vols, _, err := c.client.StoragePoolListAllVolumes(pool, 1, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list volumes of storage pool '%s': %v", pool.Name, err)
+		}
+		for _, vol := range vols {
+			data, err := c.client.StorageVolGetXMLDesc(vol, 0)
+			if err != nil {
+				// The volume may have been deleted in the meantime
+				slog.Debug("failed to get storage volume XML", "volume", vol.Name, "error", err)
+				continue
+			}
+			volume := &libvirtxml.StorageVolume{}
+			if err := volume.Unmarshal(data); err != nil {
+				return nil, fmt.Errorf("failed to parse XML of storage volume '%s': %v", vol.Name, err)
+			}
+			if volume.BackingStore != nil && volume.BackingStore.Path == path {
+				clones = append(clones, vol.Name)
+			}
+		}
+	}
+	return clones, nil
+}
+
+// fetchImage downloads the image at the given URL and decompresses it into a temporary file while downloading, so
+// that only the decompressed image is stored. It returns the file (at its start), the format of the image and the
+// SHA-256 checksum of the downloaded content, which must match the given checksum (if not empty).
+func fetchImage(ctx context.Context, url string, checksum string) (*os.File, string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to download backing image '%s': %v", url, err)
+	}
+	resp, err := imageHTTPClient.Do(req)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to download backing image '%s': %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", "", fmt.Errorf("failed to download backing image '%s': %s", url, resp.Status)
+	}
+
+	hash := sha256.New()
+	body := io.TeeReader(resp.Body, hash)
+	reader, format, err := imageReader(body)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer reader.Close()
+
+	file, err := os.CreateTemp("", "caplv-image-*")
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to create temporary file for backing image: %v", err)
+	}
+	fail := func(err error) (*os.File, string, string, error) {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, "", "", err
+	}
+
+	if _, err := io.Copy(file, reader); err != nil {
+		return fail(fmt.Errorf("failed to download backing image '%s': %w", url, err))
+	}
+	// The checksum covers the whole download, including any data after the end of the compressed image
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return fail(fmt.Errorf("failed to download backing image '%s': %w", url, err))
+	}
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if checksum != "" && actual != checksum {
+		return fail(fmt.Errorf("checksum of backing image '%s' is %s, expected %s", url, actual, checksum))
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fail(fmt.Errorf("failed to read backing image: %v", err))
+	}
+	return file, format, actual, nil
+}
+
+// imageReader returns a reader of the (gzip or bzip2 compressed) image and its format, i.e. qcow2 or else raw. It
+// returns an error for images in other known formats, which would otherwise be used as raw images.
+func imageReader(r io.Reader) (io.ReadCloser, string, error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(4)
+	var reader io.ReadCloser = io.NopCloser(buffered)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decompress backing image: %v", err)
+		}
+		reader = gz
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		reader = io.NopCloser(bzip2.NewReader(buffered))
+	}
+
+	decompressed := bufio.NewReader(reader)
+	magic, _ = decompressed.Peek(8)
+	for prefix, format := range unsupportedImageFormats {
+		if bytes.HasPrefix(magic, []byte(prefix)) {
+			reader.Close()
+			return nil, "", fmt.Errorf("backing image has the unsupported format %s; only qcow2 and raw images are supported", format)
+		}
+	}
+	format := "raw"
+	if bytes.HasPrefix(magic, []byte("QFI\xfb")) {
+		format = "qcow2"
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{decompressed, reader}, format, nil
+}
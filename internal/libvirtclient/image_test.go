@@ -0,0 +1,135 @@
+package libvirtclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestImageVolumeName(t *testing.T) {
+	g := NewWithT(t)
+
+	checksum := normalizeChecksum("sha256:ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789")
+	g.Expect(checksum).To(Equal("abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"))
+	g.Expect(ImageVolumeName(checksum, "qcow2")).To(Equal("caplv-image-abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789.qcow2"))
+}
+
+func TestFetchImage(t *testing.T) {
+	g := NewWithT(t)
+
+	image := append([]byte("QFI\xfb"), bytes.Repeat([]byte{0}, 1024)...)
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write(image)
+	g.Expect(gz.Close()).To(Succeed())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.qcow2":
+			_, _ = w.Write(image)
+		case "/image.qcow2.gz":
+			_, _ = w.Write(compressed.Bytes())
+		case "/image.raw":
+			_, _ = w.Write([]byte("raw image"))
+		case "/image.vmdk":
+			_, _ = w.Write([]byte("KDMV\x01\x00\x00\x00"))
+		case "/slow.qcow2":
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	hash := sha256.Sum256(compressed.Bytes())
+	checksum := hex.EncodeToString(hash[:])
+
+	// Compressed qcow2 image with a checksum, which is decompressed while downloading
+	file, format, actual, err := fetchImage(context.Background(), server.URL+"/image.qcow2.gz", checksum)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(file.Name())
+	defer file.Close()
+	g.Expect(actual).To(Equal(checksum))
+	g.Expect(format).To(Equal("qcow2"))
+	g.Expect(io.ReadAll(file)).To(Equal(image))
+
+	// Uncompressed images without a checksum
+	for path, expected := range map[string]string{"/image.qcow2": "qcow2", "/image.raw": "raw"} {
+		file, format, _, err := fetchImage(context.Background(), server.URL+path, "")
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(format).To(Equal(expected), path)
+		file.Close()
+		os.Remove(file.Name())
+	}
+
+	_, _, _, err = fetchImage(context.Background(), server.URL+"/image.qcow2", checksum)
+	g.Expect(err).To(MatchError(ContainSubstring("expected " + checksum)))
+
+	_, _, _, err = fetchImage(context.Background(), server.URL+"/missing.qcow2", "")
+	g.Expect(err).To(MatchError(ContainSubstring("404 Not Found")))
+
+	// Images in formats other than qcow2 and raw are rejected
+	_, _, _, err = fetchImage(context.Background(), server.URL+"/image.vmdk", "")
+	g.Expect(err).To(MatchError(ContainSubstring("unsupported format vmdk")))
+
+	// Downloads are cancelled with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, _, _, err = fetchImage(ctx, server.URL+"/slow.qcow2", "")
+	g.Expect(err).To(MatchError(context.DeadlineExceeded))
+}
+
+func TestAwaitImageDownload(t *testing.T) {
+	g := NewWithT(t)
+
+	key := "qemu:///system default https://example.com/image.qcow2 "
+	release := make(chan struct{})
+	var downloads atomic.Int32
+	download := func() (*Image, error) {
+		downloads.Add(1)
+		<-release
+		return &Image{Format: "qcow2", Checksum: "abc"}, nil
+	}
+
+	// The image is downloaded once in the background
+	_, err := awaitImageDownload(key, download)
+	g.Expect(err).To(MatchError(ErrImageDownloadInProgress))
+	_, err = awaitImageDownload(key, download)
+	g.Expect(err).To(MatchError(ErrImageDownloadInProgress))
+
+	close(release)
+	g.Eventually(func() (*Image, error) { return awaitImageDownload(key, download) }).Should(HaveField("Checksum", "abc"))
+	g.Expect(awaitImageDownload(key, download)).To(HaveField("Checksum", "abc"))
+	g.Expect(downloads.Load()).To(Equal(int32(1)))
+
+	// A forgotten download starts again
+	forgetImageDownload(key)
+	_, err = awaitImageDownload(key, download)
+	g.Expect(err).To(MatchError(ErrImageDownloadInProgress))
+	g.Eventually(func() (*Image, error) { return awaitImageDownload(key, download) }).Should(HaveField("Checksum", "abc"))
+	g.Expect(downloads.Load()).To(Equal(int32(2)))
+
+	// A failed download is returned once
+	failing := "qemu:///system default https://example.com/missing.qcow2 "
+	failed := func() (*Image, error) { return nil, errors.New("404 Not Found") }
+	_, err = awaitImageDownload(failing, failed)
+	g.Expect(err).To(MatchError(ErrImageDownloadInProgress))
+	g.Eventually(func() error {
+		_, err := awaitImageDownload(failing, failed)
+		return err
+	}).Should(MatchError("404 Not Found"))
+	_, err = awaitImageDownload(failing, failed)
+	g.Expect(err).To(MatchError(ErrImageDownloadInProgress))
+}
@@ -2,98 +2,510 @@ package libvirtclient
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"log/slog"
-	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/digitalocean/go-libvirt"
 	"github.com/kdomanski/iso9660"
+
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient/libvirtxml"
+)
+
+// ErrNotFound is returned (wrapped) by the lookup functions of a LibvirtClient when the requested resource does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrAuthenticationFailed is returned (wrapped) when a connection to libvirt fails because the libvirt host rejected
+// the credentials, or because no supported authentication method could be negotiated.
+var ErrAuthenticationFailed = errors.New("libvirt authentication failed")
+
+// ErrDiskShrink is returned (wrapped) by ResizeDisk when the disk of a VM is larger than its DiskSize, since disks
+// cannot be shrunk.
+var ErrDiskShrink = errors.New("disk cannot be shrunk")
+
+// ErrRestartRequired is returned (wrapped) by UpdateResources when the running domain of a VM has to be restarted to
+// apply its vCPUs and memory.
+var ErrRestartRequired = errors.New("domain has to be restarted")
+
+// ErrImageDownloadInProgress is returned by DownloadImage while the image is being downloaded in the background.
+var ErrImageDownloadInProgress = errors.New("image download in progress")
+
+// LibvirtClient manages virtual machines and looks up their related resources on a libvirt host.
+type LibvirtClient interface {
+	// Create creates and starts the VM along with its disk and bootstrap data (cloud-init ISO or Ignition config)
+	// volumes. If it fails, the volumes and DHCP reservations created so far are removed again, so that it can be
+	// retried.
+	Create(vm *LibvirtClientMachine) error
+	// Destroy stops and undefines the VM and deletes its volumes.
+	Destroy(vm *LibvirtClientMachine) error
+	// Exists returns true if a domain with the VM's name is defined.
+	Exists(vm *LibvirtClientMachine) bool
+	// IsReconciled returns true if the domain matches the desired state of the VM.
+	IsReconciled(vm *LibvirtClientMachine) bool
+	// UpdateResources applies the vCPUs and memory of the VM to its domain. Changes within the maximum vCPUs and memory
+	// the domain was started with are applied to the running domain in place; if a maximum changes or a change cannot
+	// be applied in place, an ErrRestartRequired is returned until the domain is restarted (see Restart). Returns true
+	// if the domain was changed.
+	UpdateResources(vm *LibvirtClientMachine) (bool, error)
+	// Restart restarts the domain of the VM without waiting for it: a running domain is asked to shut down, or stopped
+	// forcibly if force is true, and a shut off domain is started again. Returns true once the domain was started.
+	Restart(vm *LibvirtClientMachine, force bool) (bool, error)
+	// ResizeDisk grows the primary disk of the VM to its DiskSize, on the running domain if it is running so that the
+	// guest sees the new size. Returns true if the disk was grown, or an ErrDiskShrink if it is larger than DiskSize.
+	ResizeDisk(vm *LibvirtClientMachine) (bool, error)
+	// IsReady returns true if the domain is running.
+	IsReady(vm *LibvirtClientMachine) bool
+	// GetIPAddresses returns the IP addresses leased to each of the domain's interfaces, in the order of the VM's
+	// network interfaces.
+	GetIPAddresses(vm *LibvirtClientMachine) ([]InterfaceAddresses, error)
+
+	// GetStoragePool looks up a storage pool by name.
+	GetStoragePool(name string) (*StoragePool, error)
+	// GetStorageVolume looks up a storage volume by name within the given storage pool.
+	GetStorageVolume(poolName string, name string) (*StorageVolume, error)
+	// GetStorageVolumeByPath looks up a storage volume by its path on the libvirt host.
+	GetStorageVolumeByPath(path string) (*StorageVolume, error)
+	// DeleteStorageVolume deletes a storage volume by name within the given storage pool.
+	DeleteStorageVolume(poolName string, name string) error
+	// GetNetwork looks up a network by name.
+	GetNetwork(name string) (*Network, error)
+
+	// GetHostInfo returns the capacity and usage of the libvirt host.
+	GetHostInfo() (*HostInfo, error)
+
+	// DownloadImage returns the image at the URL from the given storage pool if an image with the same checksum is
+	// cached there (see ImageVolumeName). Otherwise, it downloads the image into the storage pool in the background
+	// and returns ErrImageDownloadInProgress until the download is done; callers retry to get the image (or the
+	// error of the download). The checksum may be empty, in which case the image is downloaded to find out its
+	// checksum. Only qcow2 and raw images (which may be compressed with gzip or bzip2) are supported, as images are not
+	// converted.
+	DownloadImage(poolName string, url string, checksum string) (*Image, error)
+	// GetImage returns the image with the given checksum from the cache in the storage pool (see ImageVolumeName), or
+	// an error wrapping ErrNotFound if it is not cached.
+	GetImage(poolName string, checksum string) (*Image, error)
+	// GetLinkedClones returns the names of the storage volumes in all active storage pools which use the volume
+	// with the given path as their backing store.
+	GetLinkedClones(path string) ([]string, error)
+}
+
+// LibvirtClientFactory returns a LibvirtClient for the libvirt host at the given URI, authenticating with the given
+// credentials (which may be nil).
+type LibvirtClientFactory func(uri string, credentials *Credentials) (LibvirtClient, error)
+
+// Clone modes of the primary disk of VMs.
+const (
+	// CloneModeLinked creates the disk as a qcow2 overlay with the backing image as its backing store.
+	CloneModeLinked = "linked"
+	// CloneModeFull creates the disk as an independent (qcow2) copy of the backing image.
+	CloneModeFull = "full"
 )
 
+// LibvirtClientMachine describes the desired state of a libvirt VM.
 type LibvirtClientMachine struct {
 	Name               string
-	NetworkName        string
+	NetworkName        string // network of the VM's only interface if NetworkInterfaces is empty
 	StoragePoolName    string
 	CPU                int32
 	Memory             int32  // in MiB
+	MaxCPU             int32  // maximum number of vCPUs the VM can be scaled to without a restart; defaults to CPU
+	MaxMemory          int32  // maximum memory (in MiB) the VM can be scaled to without a restart; defaults to Memory
 	DiskSize           int32  // in GiB
 	BackingImagePath   string // path on the libvirt target where the base cloud image is located
 	BackingImageFormat string // format of the BackingImagePath image; defaults to 'qcow2'
-	UserData           string // cloud-init user data
+	CloneMode          string // how the disk is created from the backing image (CloneModeLinked or CloneModeFull); defaults to linked
+	UserData           string // bootstrap data, i.e. cloud-init user data or an Ignition config (see BootstrapFormat)
+	BootstrapFormat    string // format of the UserData (BootstrapFormatCloudConfig or BootstrapFormatIgnition); defaults to cloud-config
+	IgnitionDelivery   string // how an Ignition config is delivered (IgnitionDeliveryFWCfg or IgnitionDeliveryVolume); defaults to fw_cfg if the architecture supports it
+	Architecture       string // architecture (amd64, arm64, s390x or ppc64le); defaults to DefaultArchitecture
+	AllowEmulation     bool   // allow emulation (TCG) if the host does not support KVM for the architecture
+	Firmware           string // firmware type (FirmwareBIOS or FirmwareEFI); defaults to the firmware of the architecture
+	SecureBoot         bool   // enable UEFI Secure Boot with the default keys enrolled; requires FirmwareEFI
+	TPM                bool   // add an emulated TPM 2.0 device
+	AdditionalDisks    []LibvirtClientDisk
+	NetworkInterfaces  []LibvirtClientNetworkInterface
+	NetworkConfig      *NetworkConfig // written to the cloud-init ISO as network-config; the guest uses DHCP if nil
+}
+
+// LibvirtClientNetworkInterface describes a network interface of a libvirt VM.
+type LibvirtClientNetworkInterface struct {
+	NetworkName       string
+	Model             string // device model; defaults to 'virtio'
+	MACAddress        string // derived from the name of the VM and the index of the interface if empty (see MACAddress)
+	Primary           bool   // the first interface is primary if no interface is
+	ReservedIPAddress string // reserved for the interface in the DHCP server of the network if set
+	ReservedHostname  string // hostname of the DHCP reservation; defaults to the name of the VM
+}
+
+// InterfaceAddresses are the IP addresses leased to a network interface of a VM.
+type InterfaceAddresses struct {
+	NetworkName string
+	MACAddress  string
+	Primary     bool
+	Addresses   []string
+}
+
+// LibvirtClientDisk describes an additional (blank) data disk of a libvirt VM.
+type LibvirtClientDisk struct {
+	Name            string
+	Size            int32  // in GiB
+	StoragePoolName string // defaults to the StoragePoolName of the VM
+	Format          string // format of the storage volume (qcow2 or raw); defaults to 'qcow2'
+	Bus             string // virtio, scsi or sata; defaults to 'virtio'
+	Cache           string // host cache mode; uses the default of the hypervisor if empty
+}
+
+// maxCPU returns the maximum number of vCPUs of the VM, which is at least its number of vCPUs.
+func (vm *LibvirtClientMachine) maxCPU() int32 {
+	return max(vm.MaxCPU, vm.CPU)
+}
+
+// maxMemory returns the maximum memory (in MiB) of the VM, which is at least its memory.
+func (vm *LibvirtClientMachine) maxMemory() int32 {
+	return max(vm.MaxMemory, vm.Memory)
+}
+
+// DiskVolumeName returns the name of the VM's primary disk volume.
+func (vm *LibvirtClientMachine) DiskVolumeName() string {
+	return fmt.Sprintf("%s.qcow2", vm.Name)
+}
+
+// CloudInitVolumeName returns the name of the VM's cloud-init ISO volume.
+func (vm *LibvirtClientMachine) CloudInitVolumeName() string {
+	return fmt.Sprintf("%s-cloudinit.iso", vm.Name)
+}
+
+// AdditionalDiskVolumeName returns the name of the storage volume of one of the VM's additional disks.
+func (vm *LibvirtClientMachine) AdditionalDiskVolumeName(disk LibvirtClientDisk) string {
+	return fmt.Sprintf("%s-%s.%s", vm.Name, disk.Name, disk.format())
+}
+
+// AdditionalDiskStoragePoolName returns the name of the storage pool of one of the VM's additional disks.
+func (vm *LibvirtClientMachine) AdditionalDiskStoragePoolName(disk LibvirtClientDisk) string {
+	if disk.StoragePoolName == "" {
+		return vm.StoragePoolName
+	}
+	return disk.StoragePoolName
+}
+
+// additionalDiskTargets returns the targets of the VM's additional disks: vdb, vdc and so on on the virtio bus, and sdb,
+// sdc and so on on the scsi and sata buses (the cloud-init cdrom is sda).
+func (vm *LibvirtClientMachine) additionalDiskTargets() []libvirtxml.DomainDiskTarget {
+	next := map[string]int{"vd": 1, "sd": 1}
+	targets := make([]libvirtxml.DomainDiskTarget, 0, len(vm.AdditionalDisks))
+	for _, disk := range vm.AdditionalDisks {
+		prefix := "sd"
+		if disk.bus() == "virtio" {
+			prefix = "vd"
+		}
+		targets = append(targets, libvirtxml.DomainDiskTarget{Dev: diskDevName(prefix, next[prefix]), Bus: disk.bus()})
+		next[prefix]++
+	}
+	return targets
+}
+
+// diskDevName returns the device name of the disk with the given (0-based) index, e.g. "vda" or "sdab".
+func diskDevName(prefix string, index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('a'+(index-1)%26)) + name
+	}
+	return prefix + name
+}
+
+// Interfaces returns the network interfaces of the VM, i.e. its NetworkInterfaces or else a single interface connected
+// to its NetworkName, with defaults applied and exactly one primary interface.
+func (vm *LibvirtClientMachine) Interfaces() []LibvirtClientNetworkInterface {
+	interfaces := slices.Clone(vm.NetworkInterfaces)
+	if len(interfaces) == 0 {
+		interfaces = []LibvirtClientNetworkInterface{{NetworkName: vm.NetworkName}}
+	}
+	primary := slices.IndexFunc(interfaces, func(iface LibvirtClientNetworkInterface) bool { return iface.Primary })
+	for i := range interfaces {
+		if interfaces[i].Model == "" {
+			interfaces[i].Model = "virtio"
+		}
+		interfaces[i].Primary = i == max(primary, 0)
+	}
+	return interfaces
+}
+
+// MACAddress returns the MAC address of the VM's network interface with the given index (see Interfaces): its
+// MACAddress if set, or else an address derived from the name of the VM and the index, which stays the same when the
+// VM is recreated.
+func (vm *LibvirtClientMachine) MACAddress(index int) string {
+	if interfaces := vm.Interfaces(); index < len(interfaces) && interfaces[index].MACAddress != "" {
+		return interfaces[index].MACAddress
+	}
+	hash := sha256.Sum256(fmt.Appendf(nil, "%s/%d", vm.Name, index))
+	return fmt.Sprintf("52:54:00:%02x:%02x:%02x", hash[0], hash[1], hash[2])
+}
+
+func (disk LibvirtClientDisk) format() string {
+	if disk.Format == "" {
+		return "qcow2"
+	}
+	return disk.Format
+}
+
+func (disk LibvirtClientDisk) bus() string {
+	if disk.Bus == "" {
+		return "virtio"
+	}
+	return disk.Bus
+}
+
+func (vm *LibvirtClientMachine) backingImageFormat() string {
+	if vm.BackingImageFormat == "" {
+		return "qcow2"
+	}
+	return vm.BackingImageFormat
+}
+
+// domain returns the libvirt domain of the VM with the given architecture, firmware type (see architecture.firmware),
+// domain type, disk and bootstrap data (cloud-init ISO or Ignition config) paths, and the paths of the VM's additional
+// disks.
+func (vm *LibvirtClientMachine) domain(arch architecture, firmware string, domainType string, diskPath string, bootstrapPath string, additionalDiskPaths []string) *libvirtxml.Domain {
+	domain := &libvirtxml.Domain{
+		Type:   domainType,
+		Name:   vm.Name,
+		Memory: &libvirtxml.Memory{Unit: "MiB", Value: uint64(vm.maxMemory())},
+		VCPU:   &libvirtxml.DomainVCPU{Value: uint(vm.maxCPU())},
+		OS: &libvirtxml.DomainOS{
+			Type:  libvirtxml.DomainOSType{Arch: arch.arch, Machine: arch.machine, Value: "hvm"},
+			Boots: []libvirtxml.DomainOSBoot{{Dev: "hd"}},
+		},
+		Devices: libvirtxml.DomainDevices{
+			Disks: []libvirtxml.DomainDisk{
+				{
+					Type:   "file",
+					Device: "disk",
+					Driver: &libvirtxml.DomainDiskDriver{Name: "qemu", Type: "qcow2"},
+					Source: &libvirtxml.DomainDiskSource{File: diskPath},
+					Target: libvirtxml.DomainDiskTarget{Dev: "vda", Bus: "virtio"},
+				},
+			},
+			Serials:  []libvirtxml.DomainChardev{{Type: "pty", Target: arch.serialTarget}},
+			Consoles: []libvirtxml.DomainChardev{{Type: "pty", Target: arch.consoleTarget}},
+		},
+	}
+	// Start the domain with fewer vCPUs and less memory (via the memory balloon) than its maximums, so that it can be
+	// scaled up to them in place
+	if vm.CPU < vm.maxCPU() {
+		domain.VCPU.Current = uint(vm.CPU)
+	}
+	if vm.Memory < vm.maxMemory() {
+		domain.CurrentMemory = &libvirtxml.Memory{Unit: "MiB", Value: uint64(vm.Memory)}
+	}
+	if !vm.isIgnition() {
+		domain.Devices.Disks = append(domain.Devices.Disks, libvirtxml.DomainDisk{
+			Type:     "file",
+			Device:   "cdrom",
+			Driver:   &libvirtxml.DomainDiskDriver{Name: "qemu", Type: "raw"},
+			Source:   &libvirtxml.DomainDiskSource{File: bootstrapPath},
+			Target:   libvirtxml.DomainDiskTarget{Dev: arch.cdromDev, Bus: arch.cdromBus},
+			ReadOnly: &struct{}{},
+		})
+	}
+	for _, iface := range vm.Interfaces() {
+		domainInterface := libvirtxml.DomainInterface{
+			Type:   "network",
+			Source: &libvirtxml.DomainInterfaceSource{Network: iface.NetworkName},
+			Model:  &libvirtxml.DomainInterfaceModel{Type: iface.Model},
+		}
+		if iface.MACAddress != "" {
+			domainInterface.MAC = &libvirtxml.DomainInterfaceMAC{Address: iface.MACAddress}
+		}
+		domain.Devices.Interfaces = append(domain.Devices.Interfaces, domainInterface)
+	}
+	for i, target := range vm.additionalDiskTargets() {
+		disk := vm.AdditionalDisks[i]
+		domain.Devices.Disks = append(domain.Devices.Disks, libvirtxml.DomainDisk{
+			Type:   "file",
+			Device: "disk",
+			Driver: &libvirtxml.DomainDiskDriver{Name: "qemu", Type: disk.format(), Cache: disk.Cache},
+			Source: &libvirtxml.DomainDiskSource{File: additionalDiskPaths[i]},
+			Target: target,
+		})
+	}
+	if vm.isIgnition() {
+		vm.addIgnitionConfig(domain, bootstrapPath)
+	}
+	if firmware == FirmwareEFI {
+		// libvirt selects a firmware image with (or without) Secure Boot and creates the NVRAM of the domain from its
+		// template; the NVRAM is removed when the domain is undefined
+		secureBoot := "no"
+		if vm.SecureBoot {
+			secureBoot = "yes"
+		}
+		domain.OS.Firmware = FirmwareEFI
+		domain.OS.FirmwareFeatures = &libvirtxml.DomainOSFirmware{Features: []libvirtxml.DomainOSFirmwareFeature{
+			{Enabled: secureBoot, Name: "enrolled-keys"},
+			{Enabled: secureBoot, Name: "secure-boot"},
+		}}
+		if vm.SecureBoot {
+			domain.OS.Loader = &libvirtxml.DomainOSLoader{Secure: "yes"}
+		}
+		if arch.efiRequiresACPI {
+			domain.Features = &libvirtxml.DomainFeatures{ACPI: &struct{}{}}
+			if vm.SecureBoot && arch.secureBootRequiresSMM {
+				domain.Features.SMM = &libvirtxml.DomainFeatureState{State: "on"}
+			}
+		}
+	}
+	if vm.TPM {
+		// libvirt chooses the default TPM model of the architecture (e.g. tpm-crb on amd64) and keeps the state of the
+		// emulator until the domain is undefined
+		domain.Devices.TPMs = []libvirtxml.DomainTPM{{Backend: libvirtxml.DomainTPMBackend{Type: "emulator", Version: "2.0"}}}
+	}
+	if arch.cpuMode != "" {
+		domain.CPU = &libvirtxml.DomainCPU{Mode: arch.cpuMode}
+	}
+	if (!vm.isIgnition() && arch.cdromBus == "scsi") || slices.ContainsFunc(vm.AdditionalDisks, func(disk LibvirtClientDisk) bool { return disk.bus() == "scsi" }) {
+		domain.Devices.Controllers = append(domain.Devices.Controllers, libvirtxml.DomainController{Type: "scsi", Model: "virtio-scsi"})
+	}
+	return domain
+}
+
+// StoragePool describes a libvirt storage pool.
+type StoragePool struct {
+	Name       string
+	Active     bool
+	Capacity   uint64 // in bytes
+	Allocation uint64 // in bytes
+	Available  uint64 // in bytes
+}
+
+// StorageVolume describes a libvirt storage volume.
+type StorageVolume struct {
+	Name       string
+	Path       string
+	Capacity   uint64 // in bytes
+	Allocation uint64 // in bytes
+}
 
-	client              *libvirt.Libvirt // Libvirt client
-	diskVolumeName      string           // name of the disk volume created
-	cloudInitVolumeName string           // name of the cloud-init ISO volume created
+// Network describes a libvirt network.
+type Network struct {
+	Name   string
+	Active bool
 }
 
-func (vm *LibvirtClientMachine) openClient() error {
+// HostInfo describes the capacity and usage of a libvirt host.
+type HostInfo struct {
+	CPUs          uint32   // number of active physical CPUs
+	AllocatedCPUs uint32   // number of vCPUs of all running domains
+	Memory        uint64   // in bytes
+	FreeMemory    uint64   // in bytes
+	Architectures []string // supported VM architectures (amd64, arm64, s390x or ppc64le)
+	Emulated      []string // architectures of Architectures which are only supported with emulation (without KVM)
+}
+
+// DefaultURI returns the libvirt URI configured by the LIBVIRT_URI or LIBVIRT_DEFAULT_URI environment variable.
+func DefaultURI() string {
 	uri := os.Getenv("LIBVIRT_URI")
 	if uri == "" {
 		uri = os.Getenv("LIBVIRT_DEFAULT_URI")
 	}
-	if uri == "" {
-		return fmt.Errorf("LIBVIRT_URI or LIBVIRT_DEFAULT_URI environment variable must be set in order to connect to libvirt")
-	}
+	return uri
+}
 
-	// TODO: Add support for LIBVIRT_SASL_USERNAME and LIBVIRT_SASL_PASSWORD ??
+// libvirtClient is the LibvirtClient implementation backed by a shared go-libvirt connection.
+type libvirtClient struct {
+	conn   *connection      // shared connection to the libvirt host
+	client *libvirt.Libvirt // Libvirt client
+}
 
+func (c *libvirtClient) openClient() error {
 	var err error
-	urlParsed, err := url.Parse(uri)
+	c.client, err = c.conn.get()
+	return err
+}
+
+func (c *libvirtClient) createDisk(vm *LibvirtClientMachine) (string, error) {
+	pool, err := c.client.StoragePoolLookupByName(vm.StoragePoolName)
 	if err != nil {
-		return fmt.Errorf("failed to parse libvirt URI: %v", err)
+		return "", fmt.Errorf("failed to get storage pool '%s': %v", vm.StoragePoolName, err)
+	}
+
+	if vm.CloneMode == CloneModeFull {
+		return c.copyDisk(vm, pool)
 	}
 
-	vm.client, err = libvirt.ConnectToURI(urlParsed)
+	// Create volume with backing store via libvirt XML
+	volumeXML, err := (&libvirtxml.StorageVolume{
+		Name:     vm.DiskVolumeName(),
+		Capacity: &libvirtxml.Memory{Unit: "GiB", Value: uint64(vm.DiskSize)},
+		Target: &libvirtxml.StorageVolumeTarget{
+			Format: &libvirtxml.StorageVolumeFormat{Type: "qcow2"},
+		},
+		BackingStore: &libvirtxml.StorageVolumeBackingStore{
+			Path:   vm.BackingImagePath,
+			Format: &libvirtxml.StorageVolumeFormat{Type: vm.backingImageFormat()},
+		},
+	}).Marshal()
 	if err != nil {
-		return fmt.Errorf("failed to connect to libvirt: %v", err)
+		return "", fmt.Errorf("failed to render storage volume XML: %v", err)
 	}
 
-	vm.diskVolumeName = fmt.Sprintf("%s.qcow2", vm.Name)
-	if vm.BackingImageFormat == "" {
-		vm.BackingImageFormat = "qcow2"
+	vol, err := c.client.StorageVolCreateXML(pool, volumeXML, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to create storage volume: %v", err)
 	}
-	vm.cloudInitVolumeName = fmt.Sprintf("%s-cloudinit.iso", vm.Name)
-	return nil
-}
 
-func (vm *LibvirtClientMachine) closeClient() error {
-	err := vm.client.Disconnect()
+	slog.Debug("storage volume created successfully", "volume", vm.DiskVolumeName(), "pool", vm.StoragePoolName)
+
+	path, err := c.client.StorageVolGetPath(vol)
 	if err != nil {
-		return fmt.Errorf("failed closing connection to libvirt: %v", err)
+		return "", fmt.Errorf("failed to get storage volume path: %v", err)
 	}
-	return nil
+
+	return path, nil
 }
 
-func (vm *LibvirtClientMachine) createDisk() (string, error) {
-	pool, err := vm.client.StoragePoolLookupByName(vm.StoragePoolName)
+// copyDisk creates the disk as a full copy of the backing image, which must be a volume of a storage pool, and grows
+// it to the disk size of the VM.
+func (c *libvirtClient) copyDisk(vm *LibvirtClientMachine, pool libvirt.StoragePool) (string, error) {
+	source, err := c.client.StorageVolLookupByPath(vm.BackingImagePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to get storage pool '%s': %v", vm.StoragePoolName, err)
+		return "", fmt.Errorf("failed to get storage volume of backing image '%s': %v", vm.BackingImagePath, err)
 	}
 
-	// Create volume with backing store via libvirt XML
-	volumeXML := fmt.Sprintf(`<volume>
-  <name>%s</name>
-  <capacity unit='GiB'>%d</capacity>
-  <target>
-    <format type='qcow2'/>
-  </target>
-  <backingStore>
-    <path>%s</path>
-    <format type='%s'/>
-  </backingStore>
-</volume>`, vm.diskVolumeName, vm.DiskSize, vm.BackingImagePath, vm.BackingImageFormat)
-
-	// TODO: Instead of requiring the backing image to already exist on the target libvirt host, we could create a new storage volume and then download the image and upload it to the new volume?
-
-	vol, err := vm.client.StorageVolCreateXML(pool, volumeXML, 0)
+	// libvirt converts the backing image into the format of the new volume while copying it
+	volumeXML, err := (&libvirtxml.StorageVolume{
+		Name:     vm.DiskVolumeName(),
+		Capacity: &libvirtxml.Memory{Unit: "GiB", Value: uint64(vm.DiskSize)},
+		Target: &libvirtxml.StorageVolumeTarget{
+			Format: &libvirtxml.StorageVolumeFormat{Type: "qcow2"},
+		},
+	}).Marshal()
 	if err != nil {
-		return "", fmt.Errorf("failed to create storage volume: %v", err)
+		return "", fmt.Errorf("failed to render storage volume XML: %v", err)
 	}
 
-	slog.Debug("storage volume created successfully", "volume", vm.diskVolumeName, "pool", vm.StoragePoolName)
+	slog.Debug("copying backing image", "path", vm.BackingImagePath, "volume", vm.DiskVolumeName(), "pool", vm.StoragePoolName)
+	vol, err := c.client.StorageVolCreateXMLFrom(pool, volumeXML, source, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy backing image '%s' into storage volume: %v", vm.BackingImagePath, err)
+	}
 
-	path, err := vm.client.StorageVolGetPath(vol)
+	// The copy has the capacity of the backing image, which can only be grown
+	_, capacity, _, err := c.client.StorageVolGetInfo(vol)
+	if err != nil {
+		return "", fmt.Errorf("failed to get storage volume info for '%s': %v", vm.DiskVolumeName(), err)
+	}
+	if size := uint64(vm.DiskSize) * 1024 * 1024 * 1024; size > capacity {
+		if err := c.client.StorageVolResize(vol, size, 0); err != nil {
+			return "", fmt.Errorf("failed to resize storage volume '%s': %v", vm.DiskVolumeName(), err)
+		}
+	}
+
+	slog.Debug("storage volume created successfully", "volume", vm.DiskVolumeName(), "pool", vm.StoragePoolName)
+
+	path, err := c.client.StorageVolGetPath(vol)
 	if err != nil {
 		return "", fmt.Errorf("failed to get storage volume path: %v", err)
 	}
@@ -101,12 +513,52 @@ func (vm *LibvirtClientMachine) createDisk() (string, error) {
 	return path, nil
 }
 
-func (vm *LibvirtClientMachine) createCloudInitISO() (string, error) {
-	pool, err := vm.client.StoragePoolLookupByName(vm.StoragePoolName)
+// createAdditionalDisk creates the volume of the additional disk and returns its path, and whether it was created. An
+// existing volume of the disk (e.g. left over by an earlier attempt to create the VM which did not complete) is
+// reused, so that its data is kept.
+func (c *libvirtClient) createAdditionalDisk(vm *LibvirtClientMachine, disk LibvirtClientDisk) (string, bool, error) {
+	poolName := vm.AdditionalDiskStoragePoolName(disk)
+	pool, err := c.client.StoragePoolLookupByName(poolName)
 	if err != nil {
-		return "", fmt.Errorf("failed to get storage pool '%s': %v", vm.StoragePoolName, err)
+		return "", false, fmt.Errorf("failed to get storage pool '%s': %v", poolName, err)
+	}
+
+	if vol, err := c.client.StorageVolLookupByName(pool, vm.AdditionalDiskVolumeName(disk)); err == nil {
+		slog.Info("reusing existing storage volume of additional disk", "volume", vm.AdditionalDiskVolumeName(disk), "pool", poolName)
+		path, err := c.client.StorageVolGetPath(vol)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to get storage volume path: %v", err)
+		}
+		return path, false, nil
+	}
+
+	volumeXML, err := (&libvirtxml.StorageVolume{
+		Name:     vm.AdditionalDiskVolumeName(disk),
+		Capacity: &libvirtxml.Memory{Unit: "GiB", Value: uint64(disk.Size)},
+		Target: &libvirtxml.StorageVolumeTarget{
+			Format: &libvirtxml.StorageVolumeFormat{Type: disk.format()},
+		},
+	}).Marshal()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to render storage volume XML: %v", err)
+	}
+
+	vol, err := c.client.StorageVolCreateXML(pool, volumeXML, 0)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create storage volume: %v", err)
+	}
+
+	slog.Debug("storage volume created successfully", "volume", vm.AdditionalDiskVolumeName(disk), "pool", poolName)
+
+	path, err := c.client.StorageVolGetPath(vol)
+	if err != nil {
+		return "", true, fmt.Errorf("failed to get storage volume path: %v", err)
 	}
 
+	return path, true, nil
+}
+
+func (c *libvirtClient) createCloudInitISO(vm *LibvirtClientMachine, networkConfig string) (string, error) {
 	// Create the ISO content in memory first
 	writer, err := iso9660.NewWriter()
 	if err != nil {
@@ -127,52 +579,76 @@ func (vm *LibvirtClientMachine) createCloudInitISO() (string, error) {
 		return "", fmt.Errorf("failed to add cloud-init meta-data: %v", err)
 	}
 
+	// Add network-config file, if any
+	if networkConfig != "" {
+		slog.Debug("cloud-init network-config:\n", "network-config", networkConfig)
+		if err := writer.AddFile(bytes.NewReader([]byte(networkConfig)), "network-config"); err != nil {
+			return "", fmt.Errorf("failed to add cloud-init network-config: %v", err)
+		}
+	}
+
 	// Write ISO to temporary buffer
 	var buf bytes.Buffer
 	if err := writer.WriteTo(&buf, "cidata"); err != nil {
 		return "", fmt.Errorf("failed to write cloud-init ISO to buffer: %v", err)
 	}
 
-	// Create volume for the ISO via libvirt XML
-	volumeXML := fmt.Sprintf(`<volume>
-  <name>%s</name>
-  <capacity unit='bytes'>%d</capacity>
-  <target>
-    <format type='raw'/>
-  </target>
-</volume>`, vm.cloudInitVolumeName, buf.Len())
+	path, err := c.uploadVolume(vm, vm.CloudInitVolumeName(), buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+	slog.Debug("cloud-init storage volume created successfully", "volume", vm.CloudInitVolumeName(), "pool", vm.StoragePoolName)
+	return path, nil
+}
 
-	vol, err := vm.client.StorageVolCreateXML(pool, volumeXML, 0)
+// uploadVolume creates a raw storage volume with the given name and content in the VM's storage pool and returns its
+// path.
+func (c *libvirtClient) uploadVolume(vm *LibvirtClientMachine, name string, data []byte) (string, error) {
+	pool, err := c.client.StoragePoolLookupByName(vm.StoragePoolName)
 	if err != nil {
-		return "", fmt.Errorf("failed to create cloud-init storage volume: %v", err)
+		return "", fmt.Errorf("failed to get storage pool '%s': %v", vm.StoragePoolName, err)
 	}
 
-	// Upload the ISO content to the volume
-	err = vm.client.StorageVolUpload(vol, bytes.NewBuffer(buf.Bytes()), 0, uint64(buf.Len()), 0)
+	volumeXML, err := (&libvirtxml.StorageVolume{
+		Name:     name,
+		Capacity: &libvirtxml.Memory{Unit: "bytes", Value: uint64(len(data))},
+		Target: &libvirtxml.StorageVolumeTarget{
+			Format: &libvirtxml.StorageVolumeFormat{Type: "raw"},
+		},
+	}).Marshal()
 	if err != nil {
-		return "", fmt.Errorf("failed to upload cloud-init ISO to storage volume: %v", err)
+		return "", fmt.Errorf("failed to render storage volume XML: %v", err)
 	}
 
-	var test bytes.Buffer
-	err = vm.client.StorageVolDownload(vol, &test, 0, 0, 0)
+	vol, err := c.client.StorageVolCreateXML(pool, volumeXML, 0)
 	if err != nil {
-		return "", fmt.Errorf("failed to download cloud-init ISO from storage volume: %v", err)
+		return "", fmt.Errorf("failed to create storage volume '%s': %v", name, err)
 	}
-	if !bytes.Equal(test.Bytes(), buf.Bytes()) {
-		return "", fmt.Errorf("storage volume %v content does not match uploaded data", vm.cloudInitVolumeName)
+
+	// Upload the content to the volume and verify it
+	err = c.client.StorageVolUpload(vol, bytes.NewReader(data), 0, uint64(len(data)), 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload storage volume '%s': %v", name, err)
 	}
 
-	slog.Debug("cloud-init storage volume created successfully", "volume", vm.cloudInitVolumeName, "pool", vm.StoragePoolName)
+	var test bytes.Buffer
+	err = c.client.StorageVolDownload(vol, &test, 0, 0, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to download storage volume '%s': %v", name, err)
+	}
+	if !bytes.Equal(test.Bytes(), data) {
+		return "", fmt.Errorf("storage volume %v content does not match uploaded data", name)
+	}
 
-	path, err := vm.client.StorageVolGetPath(vol)
+	path, err := c.client.StorageVolGetPath(vol)
 	if err != nil {
-		return "", fmt.Errorf("failed to get cloud-init ISO volume path: %v", err)
+		return "", fmt.Errorf("failed to get path of storage volume '%s': %v", name, err)
 	}
 
 	return path, nil
 }
 
-func (vm *LibvirtClientMachine) Create() error {
+func (c *libvirtClient) Create(vm *LibvirtClientMachine) (rerr error) {
 
 	if len(vm.Name) > 63 {
 		return fmt.Errorf("VM name '%s' is too long; must be 63 characters or less", vm.Name)
@@ -180,89 +656,205 @@ func (vm *LibvirtClientMachine) Create() error {
 
 	slog.Debug("creating VM", "name", vm.Name)
 
-	err := vm.openClient()
+	if vm.BackingImagePath == "" {
+		return fmt.Errorf("VM '%s' has no backing image path", vm.Name)
+	}
+	if vm.CloneMode != "" && vm.CloneMode != CloneModeLinked && vm.CloneMode != CloneModeFull {
+		return fmt.Errorf("unsupported clone mode '%s'", vm.CloneMode)
+	}
+
+	arch, err := getArchitecture(vm.Architecture)
+	if err != nil {
+		return err
+	}
+	firmware, err := arch.firmware(vm)
 	if err != nil {
 		return err
 	}
-	defer vm.closeClient()
 
-	isoPath, err := vm.createCloudInitISO()
+	// The network-config and the DHCP reservations refer to the interfaces by their MAC addresses, so they must be known
+	// before creating the domain
+	vm, err = vm.withMACAddresses().withBootstrapDelivery(arch)
 	if err != nil {
-		return fmt.Errorf("failed to create cloud-init ISO: %v", err)
+		return err
+	}
+	networkConfig, err := vm.networkConfig()
+	if err != nil {
+		return err
 	}
 
-	diskPath, err := vm.createDisk()
+	err = c.openClient()
+	if err != nil {
+		return err
+	}
+
+	// Make sure that the host supports the architecture before creating any volumes
+	capabilities, err := c.getCapabilities()
+	if err != nil {
+		return err
+	}
+	domainType, err := arch.domainType(capabilities, vm.AllowEmulation)
+	if err != nil {
+		return err
+	}
+
+	// Remove the volumes and DHCP reservations created for the VM if creating it fails, so that it can be retried
+	var (
+		createdVolumes []string                // paths of the volumes created for the VM
+		reservedHosts  = map[string][]string{} // network name -> MAC addresses of the DHCP reservations of the VM
+	)
+	defer func() {
+		if rerr != nil {
+			c.rollbackCreate(vm, createdVolumes, reservedHosts)
+		}
+	}()
+
+	// The primary disk and the bootstrap data volumes of an earlier attempt to create the VM which did not complete
+	// (e.g. because the manager was restarted) are recreated
+	if err := c.deleteLeftoverVolumes(vm); err != nil {
+		return err
+	}
+
+	for _, iface := range vm.NetworkInterfaces {
+		if iface.ReservedIPAddress == "" {
+			continue
+		}
+		host := libvirtxml.NetworkDHCPHost{MAC: iface.MACAddress, Name: iface.ReservedHostname, IP: iface.ReservedIPAddress}
+		if host.Name == "" {
+			host.Name = vm.Name
+		}
+		if err := c.reserveDHCPHost(iface.NetworkName, host); err != nil {
+			return fmt.Errorf("failed to reserve IP address '%s' in network '%s': %v", iface.ReservedIPAddress, iface.NetworkName, err)
+		}
+		reservedHosts[iface.NetworkName] = append(reservedHosts[iface.NetworkName], iface.MACAddress)
+	}
+
+	var bootstrapPath string
+	if vm.isIgnition() {
+		slog.Debug("Ignition config:\n", "config", vm.UserData)
+		bootstrapPath, err = c.uploadVolume(vm, vm.IgnitionVolumeName(), []byte(vm.UserData))
+		if err != nil {
+			return fmt.Errorf("failed to create Ignition config volume: %v", err)
+		}
+	} else {
+		bootstrapPath, err = c.createCloudInitISO(vm, networkConfig)
+		if err != nil {
+			return fmt.Errorf("failed to create cloud-init ISO: %v", err)
+		}
+	}
+	createdVolumes = append(createdVolumes, bootstrapPath)
+
+	diskPath, err := c.createDisk(vm)
 	if err != nil {
 		return fmt.Errorf("failed to create disk: %v", err)
 	}
+	createdVolumes = append(createdVolumes, diskPath)
+
+	additionalDiskPaths := make([]string, 0, len(vm.AdditionalDisks))
+	for _, disk := range vm.AdditionalDisks {
+		path, created, err := c.createAdditionalDisk(vm, disk)
+		if err != nil {
+			return fmt.Errorf("failed to create additional disk '%s': %v", disk.Name, err)
+		}
+		if created {
+			createdVolumes = append(createdVolumes, path)
+		}
+		additionalDiskPaths = append(additionalDiskPaths, path)
+	}
 
 	// Create the VM via libvirt XML
-	domainXML := fmt.Sprintf(`<domain type='kvm'>
-  <name>%s</name>
-  <memory unit='MiB'>%d</memory>
-  <vcpu>%d</vcpu>
-  <os>
-    <type arch='x86_64'>hvm</type>
-    <boot dev='hd'/>
-  </os>
-  <devices>
-    <disk type='file' device='disk'>
-      <driver name='qemu' type='qcow2'/>
-      <source file='%s'/>
-      <target dev='vda' bus='virtio'/>
-    </disk>
-    <disk type='file' device='cdrom'>
-      <driver name='qemu' type='raw'/>
-      <source file='%s'/>
-      <target dev='hda' bus='ide'/>
-      <readonly/>
-    </disk>
-    <interface type='network'>
-      <source network='%s'/>
-      <model type='virtio'/>
-    </interface>
-    <serial type='pty'>
-      <target type='isa-serial' port='0'>
-        <model name='isa-serial'/>
-      </target>
-    </serial>
-    <console type='pty'>
-      <target type='serial' port='0'/>
-    </console>
-  </devices>
-</domain>`, vm.Name, vm.Memory, vm.CPU, diskPath, isoPath, vm.NetworkName)
+	domainXML, err := vm.domain(arch, firmware, domainType, diskPath, bootstrapPath, additionalDiskPaths).Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to render domain XML: %v", err)
+	}
 
 	// Define and start domain
-	domain, err := vm.client.DomainDefineXML(domainXML)
+	domain, err := c.client.DomainDefineXML(domainXML)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to define domain: %v", err)
 	}
 
-	if err := vm.client.DomainCreate(domain); err != nil {
-		return err
+	if err := c.client.DomainCreate(domain); err != nil {
+		if err := c.undefineDomain(domain); err != nil {
+			slog.Warn("failed to undefine domain which could not be started", "name", vm.Name, "error", err)
+		}
+		return fmt.Errorf("failed to start domain: %v", err)
+	}
+
+	return nil
+}
+
+// deleteLeftoverVolumes deletes the primary disk and bootstrap data volumes of the VM, which are left over by an
+// earlier attempt to create the VM which did not complete and would prevent creating them again. It must only be
+// called while the VM's domain does not exist.
+func (c *libvirtClient) deleteLeftoverVolumes(vm *LibvirtClientMachine) error {
+	pool, err := c.client.StoragePoolLookupByName(vm.StoragePoolName)
+	if err != nil {
+		return fmt.Errorf("failed to get storage pool '%s': %v", vm.StoragePoolName, err)
+	}
+	for _, name := range []string{vm.DiskVolumeName(), vm.CloudInitVolumeName(), vm.IgnitionVolumeName()} {
+		vol, err := c.client.StorageVolLookupByName(pool, name)
+		if err != nil {
+			continue
+		}
+		slog.Info("deleting leftover storage volume of VM", "name", vm.Name, "volume", name, "pool", vm.StoragePoolName)
+		if err := c.client.StorageVolDelete(vol, 0); err != nil {
+			return fmt.Errorf("failed to delete leftover storage volume '%s': %v", name, err)
+		}
 	}
+	return nil
+}
 
+// rollbackCreate deletes the volumes with the given paths and removes the given DHCP reservations (by network name)
+// after creating the VM failed. Failures are only logged, as the error of Create is returned.
+func (c *libvirtClient) rollbackCreate(vm *LibvirtClientMachine, volumePaths []string, reservedHosts map[string][]string) {
+	slog.Debug("removing the volumes and DHCP reservations of VM which could not be created", "name", vm.Name)
+	for _, path := range volumePaths {
+		vol, err := c.client.StorageVolLookupByPath(path)
+		if err != nil {
+			slog.Warn("failed to look up storage volume of VM which could not be created", "name", vm.Name, "path", path, "error", err)
+			continue
+		}
+		if err := c.client.StorageVolDelete(vol, 0); err != nil {
+			slog.Warn("failed to delete storage volume of VM which could not be created", "name", vm.Name, "path", path, "error", err)
+		}
+	}
+	for networkName, macs := range reservedHosts {
+		if err := c.removeDHCPHosts(networkName, macs); err != nil {
+			slog.Warn("failed to remove DHCP reservations of VM which could not be created", "name", vm.Name, "network", networkName, "error", err)
+		}
+	}
+}
+
+// undefineDomain undefines the domain, together with its NVRAM and the state of its emulated TPM (if any).
+func (c *libvirtClient) undefineDomain(domain libvirt.Domain) error {
+	if err := c.client.DomainUndefineFlags(domain, libvirt.DomainUndefineNvram|libvirt.DomainUndefineTpm); err != nil {
+		// libvirt before 8.9.0 does not know the TPM flag (and always removes the state of the TPM)
+		slog.Debug("failed to undefine domain with its TPM state; retrying without", "name", domain.Name, "error", err)
+		if err := c.client.DomainUndefineFlags(domain, libvirt.DomainUndefineNvram); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (vm *LibvirtClientMachine) Destroy() error {
+func (c *libvirtClient) Destroy(vm *LibvirtClientMachine) error {
 
 	slog.Debug("destroying VM", "name", vm.Name)
 
-	err := vm.openClient()
+	err := c.openClient()
 	if err != nil {
 		return err
 	}
-	defer vm.closeClient()
 
 	// Look up the domain
-	domain, err := vm.client.DomainLookupByName(vm.Name)
+	domain, err := c.client.DomainLookupByName(vm.Name)
 	if err != nil {
 		return fmt.Errorf("failed to lookup domain: %v", err)
 	}
 
 	// Check if domain is running and destroy it
-	active, err := vm.client.DomainIsActive(domain)
+	active, err := c.client.DomainIsActive(domain)
 
 	//domain.IsActive()
 	if err != nil {
@@ -271,64 +863,120 @@ func (vm *LibvirtClientMachine) Destroy() error {
 
 	if active == int32(libvirt.DomainRunning) {
 		slog.Debug("stopping VM", "name", vm.Name)
-		if err := vm.client.DomainDestroy(domain); err != nil {
+		if err := c.client.DomainDestroy(domain); err != nil {
 			return fmt.Errorf("failed to stop domain: %v", err)
 		}
 	}
 
-	// Undefine the domain
+	// Remember the additional disks and the MAC addresses of the domain, which may differ from those of the VM if it is
+	// out of sync
+	var additionalDiskPaths []string
+	macAddresses := map[string][]string{} // network name -> MAC addresses
+	for _, iface := range vm.withMACAddresses().NetworkInterfaces {
+		macAddresses[iface.NetworkName] = append(macAddresses[iface.NetworkName], iface.MACAddress)
+	}
+	if domainXML, err := c.getDomainXML(domain); err != nil {
+		slog.Warn("failed to get domain XML; only deleting the additional disks and DHCP reservations of the VM", "name", vm.Name, "error", err)
+	} else {
+		additionalDiskPaths = additionalDiskSources(domainXML)
+		for _, iface := range domainXML.Devices.Interfaces {
+			if iface.Source != nil && iface.MAC != nil {
+				macAddresses[iface.Source.Network] = append(macAddresses[iface.Source.Network], iface.MAC.Address)
+			}
+		}
+	}
+
+	// Undefine the domain, together with its NVRAM and the state of its emulated TPM (if any)
 	slog.Debug("undefining VM", "name", vm.Name)
-	if err := vm.client.DomainUndefine(domain); err != nil {
+	if err := c.undefineDomain(domain); err != nil {
 		return fmt.Errorf("failed to undefine domain: %v", err)
 	}
 
+	// Remove the DHCP reservations of the domain's interfaces
+	for networkName, macs := range macAddresses {
+		if err := c.removeDHCPHosts(networkName, macs); err != nil {
+			slog.Warn("failed to remove DHCP reservations", "network", networkName, "error", err)
+		}
+	}
+
 	// Delete volumes from storage pool
-	pool, err := vm.client.StoragePoolLookupByName(vm.StoragePoolName)
+	pool, err := c.client.StoragePoolLookupByName(vm.StoragePoolName)
 	if err != nil {
 		return fmt.Errorf("failed to get storage pool '%s': %v", vm.StoragePoolName, err)
 	}
 
 	// Refresh pool to detect all volumes
-	if err := vm.client.StoragePoolRefresh(pool, 0); err != nil {
+	if err := c.client.StoragePoolRefresh(pool, 0); err != nil {
 		slog.Warn("failed to refresh pool", "error", err)
 	}
 
 	// Delete disk volume
-	vol, err := vm.client.StorageVolLookupByName(pool, vm.diskVolumeName)
+	vol, err := c.client.StorageVolLookupByName(pool, vm.DiskVolumeName())
 	if err == nil {
-		slog.Debug("deleting volume", "volume", vm.diskVolumeName, "pool", vm.StoragePoolName)
-		if err := vm.client.StorageVolDelete(vol, 0); err != nil {
+		slog.Debug("deleting volume", "volume", vm.DiskVolumeName(), "pool", vm.StoragePoolName)
+		if err := c.client.StorageVolDelete(vol, 0); err != nil {
 			slog.Warn("failed to delete volume", "error", err)
 		}
 	}
 
-	// Delete cloud-init ISO volume
-	isoVol, err := vm.client.StorageVolLookupByName(pool, vm.cloudInitVolumeName)
-	if err == nil {
-		slog.Debug("deleting ISO volume", "volume", vm.cloudInitVolumeName, "pool", vm.StoragePoolName)
-		if err := vm.client.StorageVolDelete(isoVol, 0); err != nil {
-			slog.Warn("failed to delete ISO volume", "error", err)
+	// Delete bootstrap data volumes (the domain may have been created with a different bootstrap format)
+	for _, name := range []string{vm.CloudInitVolumeName(), vm.IgnitionVolumeName()} {
+		bootstrapVol, err := c.client.StorageVolLookupByName(pool, name)
+		if err == nil {
+			slog.Debug("deleting bootstrap data volume", "volume", name, "pool", vm.StoragePoolName)
+			if err := c.client.StorageVolDelete(bootstrapVol, 0); err != nil {
+				slog.Warn("failed to delete bootstrap data volume", "error", err)
+			}
+		}
+	}
+
+	// Delete additional disk volumes
+	for _, disk := range vm.AdditionalDisks {
+		poolName := vm.AdditionalDiskStoragePoolName(disk)
+		diskPool, err := c.client.StoragePoolLookupByName(poolName)
+		if err != nil {
+			slog.Warn("failed to get storage pool of additional disk", "pool", poolName, "error", err)
+			continue
+		}
+		diskVol, err := c.client.StorageVolLookupByName(diskPool, vm.AdditionalDiskVolumeName(disk))
+		if err == nil {
+			slog.Debug("deleting additional disk volume", "volume", vm.AdditionalDiskVolumeName(disk), "pool", poolName)
+			if err := c.client.StorageVolDelete(diskVol, 0); err != nil {
+				slog.Warn("failed to delete additional disk volume", "error", err)
+			}
+		}
+	}
+	for _, path := range additionalDiskPaths {
+		// Only delete volumes which were created for the VM (and not yet deleted above)
+		if !strings.HasPrefix(filepath.Base(path), vm.Name+"-") {
+			continue
+		}
+		diskVol, err := c.client.StorageVolLookupByPath(path)
+		if err == nil {
+			slog.Debug("deleting additional disk volume", "path", path)
+			if err := c.client.StorageVolDelete(diskVol, 0); err != nil {
+				slog.Warn("failed to delete additional disk volume", "error", err)
+			}
 		}
 	}
 
 	// Refresh pool again after deletions
-	vm.client.StoragePoolRefresh(pool, 0)
+	c.client.StoragePoolRefresh(pool, 0)
 
 	slog.Debug("VM destroyed and removed successfully", "name", vm.Name)
 
 	return nil
 }
 
-func (vm *LibvirtClientMachine) Exists() bool {
+func (c *libvirtClient) Exists(vm *LibvirtClientMachine) bool {
 
-	err := vm.openClient()
+	err := c.openClient()
 	if err != nil {
 		slog.Error("Error opening client", "error", err)
 		return false
 	}
-	defer vm.closeClient()
 
-	domain, err := vm.client.DomainLookupByName(vm.Name)
+	domain, err := c.client.DomainLookupByName(vm.Name)
 	if err != nil {
 		slog.Debug("Error looking up domain by name", "error", err)
 		return false
@@ -337,61 +985,270 @@ func (vm *LibvirtClientMachine) Exists() bool {
 	return domain.Name == vm.Name
 }
 
-func (vm *LibvirtClientMachine) IsReconciled() bool {
+func (c *libvirtClient) IsReconciled(vm *LibvirtClientMachine) bool {
 
-	err := vm.openClient()
+	err := c.openClient()
 	if err != nil {
 		slog.Error("Error opening client", "error", err)
 		return false
 	}
-	defer vm.closeClient()
 
-	domain, err := vm.client.DomainLookupByName(vm.Name)
+	domain, err := c.client.DomainLookupByName(vm.Name)
 	if err != nil {
 		slog.Debug("Error looking up domain by name", "error", err)
 		return false
 	}
 
-	// Get domain info
-	//rState, rMaxMem, rMemory, rNrVirtCPU, rCPUTime, err := vm.client.DomainGetInfo(domain)
-	_, rMaxMem, _, rNrVirtCPU, _, err := vm.client.DomainGetInfo(domain)
+	// vCPUs and memory are not compared, as UpdateResources applies them without recreating the domain. Neither are the
+	// domain and machine types, so that existing domains are not recreated when their defaults change (e.g. amd64
+	// domains created with the 'pc' machine type before 'q35' became the default)
+
+	// Compare additional disks
+	domainXML, err := c.getDomainXML(domain)
 	if err != nil {
-		slog.Debug("failed to get domain info", "error", err)
+		slog.Debug("failed to get domain XML", "error", err)
 		return false
 	}
-
-	// Compare vCPUs
-	if vm.CPU != int32(rNrVirtCPU) {
-		slog.Debug("VM is not reconciled; CPU mismatch", "name", vm.Name, "expected", vm.CPU, "actual", int32(rNrVirtCPU))
+	var actual []string
+	for _, disk := range domainXML.Devices.Disks {
+		if disk.Device == "disk" && disk.Target.Dev != "vda" && disk.ReadOnly == nil && disk.Source != nil {
+			actual = append(actual, fmt.Sprintf("%s:%s:%s", disk.Target.Dev, disk.Target.Bus, filepath.Base(disk.Source.File)))
+		}
+	}
+	var expected []string
+	for i, target := range vm.additionalDiskTargets() {
+		expected = append(expected, fmt.Sprintf("%s:%s:%s", target.Dev, target.Bus, vm.AdditionalDiskVolumeName(vm.AdditionalDisks[i])))
+	}
+	slices.Sort(actual)
+	slices.Sort(expected)
+	if !slices.Equal(expected, actual) {
+		slog.Debug("VM is not reconciled; additional disks mismatch", "name", vm.Name, "expected", expected, "actual", actual)
 		return false
 	}
 
-	// Compare memory
-	if vm.Memory != int32(rMaxMem/1024) {
-		slog.Debug("VM is not reconciled; Memory mismatch", "name", vm.Name, "expected", vm.Memory, "actual", int32(rMaxMem/1024))
+	// Compare network interfaces (in order, and their MAC addresses only if specified)
+	interfaces := vm.Interfaces()
+	if len(interfaces) != len(domainXML.Devices.Interfaces) {
+		slog.Debug("VM is not reconciled; network interfaces mismatch", "name", vm.Name, "expected", len(interfaces), "actual", len(domainXML.Devices.Interfaces))
 		return false
 	}
+	for i, iface := range interfaces {
+		domainInterface := domainXML.Devices.Interfaces[i]
+		if domainInterface.Source == nil || domainInterface.Source.Network != iface.NetworkName ||
+			domainInterface.Model == nil || domainInterface.Model.Type != iface.Model ||
+			(iface.MACAddress != "" && (domainInterface.MAC == nil || !strings.EqualFold(domainInterface.MAC.Address, iface.MACAddress))) {
+			slog.Debug("VM is not reconciled; network interface mismatch", "name", vm.Name, "network", iface.NetworkName)
+			return false
+		}
+	}
 
 	return true
 
 }
 
-func (vm *LibvirtClientMachine) IsReady() bool {
+func (c *libvirtClient) UpdateResources(vm *LibvirtClientMachine) (bool, error) {
 
-	err := vm.openClient()
+	err := c.openClient()
+	if err != nil {
+		return false, err
+	}
+
+	domain, err := c.client.DomainLookupByName(vm.Name)
+	if err != nil {
+		return false, wrapLookupError(err, fmt.Sprintf("domain '%s'", vm.Name))
+	}
+
+	// Compare the persistent configuration of the domain, and the live state if it is running
+	config, err := c.getDomainXMLFlags(domain, libvirt.DomainXMLInactive)
+	if err != nil {
+		return false, err
+	}
+	configResources := getDomainResources(config)
+	active, err := c.client.DomainIsActive(domain)
+	if err != nil {
+		return false, fmt.Errorf("failed to check domain state: %v", err)
+	}
+	liveResources := configResources
+	if active == 1 {
+		live, err := c.getDomainXML(domain)
+		if err != nil {
+			return false, err
+		}
+		liveResources = getDomainResources(live)
+	}
+	desired := domainResources{cpu: vm.CPU, maxCPU: vm.maxCPU(), memory: vm.Memory, maxMemory: vm.maxMemory()}
+	if configResources == desired && liveResources == desired {
+		return false, nil
+	}
+	slog.Debug("updating VM resources", "name", vm.Name, "desired", desired, "config", configResources, "live", liveResources)
+
+	// Update the persistent configuration; the maximums are raised before and lowered after the current values so
+	// that the current values never exceed them
+	if configResources != desired {
+		if desired.maxCPU > configResources.maxCPU {
+			if err := c.client.DomainSetVcpusFlags(domain, uint32(desired.maxCPU), uint32(libvirt.DomainVCPUConfig|libvirt.DomainVCPUMaximum)); err != nil {
+				return false, fmt.Errorf("failed to set maximum vCPUs: %v", err)
+			}
+		}
+		if desired.maxMemory > configResources.maxMemory {
+			if err := c.client.DomainSetMemoryFlags(domain, uint64(desired.maxMemory)*1024, uint32(libvirt.DomainMemConfig|libvirt.DomainMemMaximum)); err != nil {
+				return false, fmt.Errorf("failed to set maximum memory: %v", err)
+			}
+		}
+		if desired.cpu != configResources.cpu {
+			if err := c.client.DomainSetVcpusFlags(domain, uint32(desired.cpu), uint32(libvirt.DomainVCPUConfig)); err != nil {
+				return false, fmt.Errorf("failed to set vCPUs: %v", err)
+			}
+		}
+		if desired.memory != configResources.memory {
+			if err := c.client.DomainSetMemoryFlags(domain, uint64(desired.memory)*1024, uint32(libvirt.DomainMemConfig)); err != nil {
+				return false, fmt.Errorf("failed to set memory: %v", err)
+			}
+		}
+		if desired.maxCPU < configResources.maxCPU {
+			if err := c.client.DomainSetVcpusFlags(domain, uint32(desired.maxCPU), uint32(libvirt.DomainVCPUConfig|libvirt.DomainVCPUMaximum)); err != nil {
+				return false, fmt.Errorf("failed to set maximum vCPUs: %v", err)
+			}
+		}
+		if desired.maxMemory < configResources.maxMemory {
+			if err := c.client.DomainSetMemoryFlags(domain, uint64(desired.maxMemory)*1024, uint32(libvirt.DomainMemConfig|libvirt.DomainMemMaximum)); err != nil {
+				return false, fmt.Errorf("failed to set maximum memory: %v", err)
+			}
+		}
+	}
+	if active != 1 || liveResources == desired {
+		return true, nil
+	}
+
+	// Apply the current values to the running domain; the maximums can only change with a restart, as can vCPUs or
+	// memory which the hypervisor or guest fail to hotplug (or unplug)
+	restart := desired.maxCPU != liveResources.maxCPU || desired.maxMemory != liveResources.maxMemory
+	if !restart && desired.cpu != liveResources.cpu {
+		if err := c.client.DomainSetVcpusFlags(domain, uint32(desired.cpu), uint32(libvirt.DomainVCPULive)); err != nil {
+			slog.Debug("failed to set vCPUs of running VM; it has to be restarted", "name", vm.Name, "error", err)
+			restart = true
+		}
+	}
+	if !restart && desired.memory != liveResources.memory {
+		if err := c.client.DomainSetMemoryFlags(domain, uint64(desired.memory)*1024, uint32(libvirt.DomainMemLive)); err != nil {
+			slog.Debug("failed to set memory of running VM; it has to be restarted", "name", vm.Name, "error", err)
+			restart = true
+		}
+	}
+	if restart {
+		return configResources != desired, fmt.Errorf("domain '%s' has to be restarted to apply its vCPUs and memory: %w", vm.Name, ErrRestartRequired)
+	}
+
+	return true, nil
+}
+
+func (c *libvirtClient) ResizeDisk(vm *LibvirtClientMachine) (bool, error) {
+
+	err := c.openClient()
+	if err != nil {
+		return false, err
+	}
+
+	pool, err := c.client.StoragePoolLookupByName(vm.StoragePoolName)
+	if err != nil {
+		return false, wrapLookupError(err, fmt.Sprintf("storage pool '%s'", vm.StoragePoolName))
+	}
+	vol, err := c.client.StorageVolLookupByName(pool, vm.DiskVolumeName())
+	if err != nil {
+		return false, wrapLookupError(err, fmt.Sprintf("storage volume '%s'", vm.DiskVolumeName()))
+	}
+	_, capacity, _, err := c.client.StorageVolGetInfo(vol)
+	if err != nil {
+		return false, fmt.Errorf("failed to get storage volume info for '%s': %v", vm.DiskVolumeName(), err)
+	}
+	size := uint64(vm.DiskSize) * 1024 * 1024 * 1024
+	if capacity == size {
+		return false, nil
+	}
+	if capacity > size {
+		return false, fmt.Errorf("storage volume '%s' has a capacity of %d bytes, more than the disk size of %d GiB: %w", vm.DiskVolumeName(), capacity, vm.DiskSize, ErrDiskShrink)
+	}
+
+	// The image of a running domain is locked by the hypervisor, which has to resize it itself (and then notifies the
+	// guest of the new size)
+	domain, err := c.client.DomainLookupByName(vm.Name)
+	if err != nil {
+		return false, wrapLookupError(err, fmt.Sprintf("domain '%s'", vm.Name))
+	}
+	active, err := c.client.DomainIsActive(domain)
+	if err != nil {
+		return false, fmt.Errorf("failed to check domain state: %v", err)
+	}
+	slog.Debug("resizing disk", "name", vm.Name, "volume", vm.DiskVolumeName(), "capacity", capacity, "size", size, "active", active == 1)
+	if active == 1 {
+		if err := c.client.DomainBlockResize(domain, "vda", size, libvirt.DomainBlockResizeBytes); err != nil {
+			return false, fmt.Errorf("failed to resize disk of domain: %v", err)
+		}
+		// Let the storage pool pick up the new capacity of the volume
+		if err := c.client.StoragePoolRefresh(pool, 0); err != nil {
+			slog.Warn("failed to refresh pool", "error", err)
+		}
+	} else {
+		if err := c.client.StorageVolResize(vol, size, 0); err != nil {
+			return false, fmt.Errorf("failed to resize storage volume '%s': %v", vm.DiskVolumeName(), err)
+		}
+	}
+
+	return true, nil
+}
+
+func (c *libvirtClient) Restart(vm *LibvirtClientMachine, force bool) (bool, error) {
+
+	err := c.openClient()
+	if err != nil {
+		return false, err
+	}
+
+	domain, err := c.client.DomainLookupByName(vm.Name)
+	if err != nil {
+		return false, wrapLookupError(err, fmt.Sprintf("domain '%s'", vm.Name))
+	}
+	active, err := c.client.DomainIsActive(domain)
+	if err != nil {
+		return false, fmt.Errorf("failed to check domain state: %v", err)
+	}
+	if active == 1 {
+		if !force {
+			slog.Debug("shutting down VM", "name", vm.Name)
+			if err := c.client.DomainShutdown(domain); err != nil {
+				return false, fmt.Errorf("failed to shut down domain: %v", err)
+			}
+			return false, nil
+		}
+		slog.Debug("VM did not shut down in time; stopping it", "name", vm.Name)
+		if err := c.client.DomainDestroy(domain); err != nil {
+			return false, fmt.Errorf("failed to stop domain: %v", err)
+		}
+	}
+
+	// The domain starts with its persistent configuration
+	slog.Debug("starting VM", "name", vm.Name)
+	if err := c.client.DomainCreate(domain); err != nil {
+		return false, fmt.Errorf("failed to start domain: %v", err)
+	}
+	return true, nil
+}
+
+func (c *libvirtClient) IsReady(vm *LibvirtClientMachine) bool {
+
+	err := c.openClient()
 	if err != nil {
 		slog.Error("Error opening client", "error", err)
 		return false
 	}
-	defer vm.closeClient()
 
-	domain, err := vm.client.DomainLookupByName(vm.Name)
+	domain, err := c.client.DomainLookupByName(vm.Name)
 	if err != nil {
 		slog.Debug("Error looking up domain by name", "error", err)
 		return false
 	}
 
-	state, _, err := vm.client.DomainGetState(domain, 0)
+	state, _, err := c.client.DomainGetState(domain, 0)
 	if err != nil {
 		slog.Debug("failed to get domain state", "error", err)
 		return false
@@ -401,22 +1258,21 @@ func (vm *LibvirtClientMachine) IsReady() bool {
 	return state == int32(libvirt.DomainRunning)
 }
 
-func (vm *LibvirtClientMachine) GetIPAddresses() ([]string, error) {
+func (c *libvirtClient) GetIPAddresses(vm *LibvirtClientMachine) ([]InterfaceAddresses, error) {
 
-	err := vm.openClient()
+	err := c.openClient()
 	if err != nil {
 		slog.Error("Error opening client", "error", err)
 		return nil, err
 	}
-	defer vm.closeClient()
 
-	domain, err := vm.client.DomainLookupByName(vm.Name)
+	domain, err := c.client.DomainLookupByName(vm.Name)
 	if err != nil {
 		slog.Debug("Error looking up domain by name", "error", err)
 		return nil, err
 	}
 
-	state, _, err := vm.client.DomainGetState(domain, 0)
+	state, _, err := c.client.DomainGetState(domain, 0)
 	if err != nil {
 		slog.Debug("failed to get domain state", "error", err)
 		return nil, err
@@ -426,16 +1282,374 @@ func (vm *LibvirtClientMachine) GetIPAddresses() ([]string, error) {
 		return nil, fmt.Errorf("Error: VM %s is not running", vm.Name)
 	}
 
-	ifaces, err := vm.client.DomainInterfaceAddresses(domain, uint32(libvirt.DomainInterfaceAddressesSrcLease), 0)
-	var addresses []string
+	// The MAC addresses of the interfaces (which may have been generated by libvirt) are only known from the domain XML
+	domainXML, err := c.getDomainXML(domain)
+	if err != nil {
+		return nil, err
+	}
+	interfaces := vm.Interfaces()
+	addresses := make([]InterfaceAddresses, 0, len(domainXML.Devices.Interfaces))
+	for i, domainInterface := range domainXML.Devices.Interfaces {
+		iface := InterfaceAddresses{}
+		if domainInterface.Source != nil {
+			iface.NetworkName = domainInterface.Source.Network
+		}
+		if domainInterface.MAC != nil {
+			iface.MACAddress = domainInterface.MAC.Address
+		}
+		iface.Primary = i < len(interfaces) && interfaces[i].Primary
+		addresses = append(addresses, iface)
+	}
+
+	ifaces, err := c.client.DomainInterfaceAddresses(domain, uint32(libvirt.DomainInterfaceAddressesSrcLease), 0)
 	if err == nil && len(ifaces) > 0 {
 		for _, iface := range ifaces {
-			if iface.Name != "" {
-				for _, addr := range iface.Addrs {
-					addresses = append(addresses, addr.Addr)
-				}
+			if iface.Name == "" || len(iface.Hwaddr) == 0 {
+				continue
+			}
+			i := slices.IndexFunc(addresses, func(a InterfaceAddresses) bool { return strings.EqualFold(a.MACAddress, iface.Hwaddr[0]) })
+			if i < 0 {
+				continue
+			}
+			for _, addr := range iface.Addrs {
+				addresses[i].Addresses = append(addresses[i].Addresses, addr.Addr)
 			}
 		}
 	}
+	vm.AddStaticAddresses(addresses)
 	return addresses, nil
 }
+
+func (c *libvirtClient) GetStoragePool(name string) (*StoragePool, error) {
+
+	err := c.openClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := c.client.StoragePoolLookupByName(name)
+	if err != nil {
+		return nil, wrapLookupError(err, fmt.Sprintf("storage pool '%s'", name))
+	}
+
+	state, capacity, allocation, available, err := c.client.StoragePoolGetInfo(pool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage pool info for '%s': %v", name, err)
+	}
+
+	return &StoragePool{
+		Name:       pool.Name,
+		Active:     state == uint8(libvirt.StoragePoolRunning),
+		Capacity:   capacity,
+		Allocation: allocation,
+		Available:  available,
+	}, nil
+}
+
+func (c *libvirtClient) GetStorageVolume(poolName string, name string) (*StorageVolume, error) {
+
+	err := c.openClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := c.client.StoragePoolLookupByName(poolName)
+	if err != nil {
+		return nil, wrapLookupError(err, fmt.Sprintf("storage pool '%s'", poolName))
+	}
+
+	vol, err := c.client.StorageVolLookupByName(pool, name)
+	if err != nil {
+		return nil, wrapLookupError(err, fmt.Sprintf("storage volume '%s' in pool '%s'", name, poolName))
+	}
+
+	return c.getStorageVolume(vol)
+}
+
+func (c *libvirtClient) GetStorageVolumeByPath(path string) (*StorageVolume, error) {
+
+	err := c.openClient()
+	if err != nil {
+		return nil, err
+	}
+
+	vol, err := c.client.StorageVolLookupByPath(path)
+	if err != nil {
+		return nil, wrapLookupError(err, fmt.Sprintf("storage volume '%s'", path))
+	}
+
+	return c.getStorageVolume(vol)
+}
+
+func (c *libvirtClient) getStorageVolume(vol libvirt.StorageVol) (*StorageVolume, error) {
+	_, capacity, allocation, err := c.client.StorageVolGetInfo(vol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage volume info for '%s': %v", vol.Name, err)
+	}
+
+	path, err := c.client.StorageVolGetPath(vol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage volume path for '%s': %v", vol.Name, err)
+	}
+
+	return &StorageVolume{
+		Name:       vol.Name,
+		Path:       path,
+		Capacity:   capacity,
+		Allocation: allocation,
+	}, nil
+}
+
+func (c *libvirtClient) DeleteStorageVolume(poolName string, name string) error {
+
+	err := c.openClient()
+	if err != nil {
+		return err
+	}
+
+	pool, err := c.client.StoragePoolLookupByName(poolName)
+	if err != nil {
+		return wrapLookupError(err, fmt.Sprintf("storage pool '%s'", poolName))
+	}
+
+	vol, err := c.client.StorageVolLookupByName(pool, name)
+	if err != nil {
+		return wrapLookupError(err, fmt.Sprintf("storage volume '%s' in pool '%s'", name, poolName))
+	}
+
+	slog.Debug("deleting volume", "volume", name, "pool", poolName)
+	if err := c.client.StorageVolDelete(vol, 0); err != nil {
+		return fmt.Errorf("failed to delete storage volume '%s': %v", name, err)
+	}
+	return nil
+}
+
+func (c *libvirtClient) GetNetwork(name string) (*Network, error) {
+
+	err := c.openClient()
+	if err != nil {
+		return nil, err
+	}
+
+	network, err := c.client.NetworkLookupByName(name)
+	if err != nil {
+		return nil, wrapLookupError(err, fmt.Sprintf("network '%s'", name))
+	}
+
+	active, err := c.client.NetworkIsActive(network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check network state for '%s': %v", name, err)
+	}
+
+	return &Network{
+		Name:   network.Name,
+		Active: active == 1,
+	}, nil
+}
+
+func (c *libvirtClient) GetHostInfo() (*HostInfo, error) {
+
+	err := c.openClient()
+	if err != nil {
+		return nil, err
+	}
+
+	_, memory, cpus, _, _, _, _, _, err := c.client.NodeGetInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node info: %v", err)
+	}
+
+	freeMemory, err := c.client.NodeGetFreeMemory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get free memory: %v", err)
+	}
+
+	domains, _, err := c.client.ConnectListAllDomains(1, libvirt.ConnectListDomainsActive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %v", err)
+	}
+	var allocatedCPUs uint32
+	for _, domain := range domains {
+		_, _, _, nrVirtCPU, _, err := c.client.DomainGetInfo(domain)
+		if err != nil {
+			// The domain may have been shut down or undefined in the meantime
+			slog.Debug("failed to get domain info", "name", domain.Name, "error", err)
+			continue
+		}
+		allocatedCPUs += uint32(nrVirtCPU)
+	}
+
+	capabilities, err := c.getCapabilities()
+	if err != nil {
+		return nil, err
+	}
+
+	return &HostInfo{
+		CPUs:          uint32(cpus),
+		AllocatedCPUs: allocatedCPUs,
+		Memory:        memory * 1024, // NodeGetInfo returns KiB
+		FreeMemory:    freeMemory,
+		Architectures: supportedArchitectures(capabilities),
+		Emulated:      emulatedArchitectures(capabilities),
+	}, nil
+}
+
+// reserveDHCPHost adds the DHCP host (reservation) to the network, replacing any reservation for the same MAC address.
+func (c *libvirtClient) reserveDHCPHost(networkName string, host libvirtxml.NetworkDHCPHost) error {
+	network, networkXML, flags, err := c.getNetworkForUpdate(networkName)
+	if err != nil {
+		return err
+	}
+	for _, existing := range dhcpHosts(networkXML) {
+		if !strings.EqualFold(existing.MAC, host.MAC) {
+			continue
+		}
+		if existing == host {
+			return nil
+		}
+		if err := c.updateDHCPHost(network, libvirt.NetworkUpdateCommandDelete, existing, flags); err != nil {
+			return err
+		}
+	}
+	slog.Debug("adding DHCP reservation", "network", networkName, "mac", host.MAC, "name", host.Name, "ip", host.IP)
+	return c.updateDHCPHost(network, libvirt.NetworkUpdateCommandAddLast, host, flags)
+}
+
+// removeDHCPHosts removes the DHCP hosts (reservations) with the given MAC addresses from the network.
+func (c *libvirtClient) removeDHCPHosts(networkName string, macAddresses []string) error {
+	network, networkXML, flags, err := c.getNetworkForUpdate(networkName)
+	if err != nil {
+		return err
+	}
+	for _, existing := range dhcpHosts(networkXML) {
+		if !slices.ContainsFunc(macAddresses, func(mac string) bool { return strings.EqualFold(mac, existing.MAC) }) {
+			continue
+		}
+		slog.Debug("removing DHCP reservation", "network", networkName, "mac", existing.MAC, "name", existing.Name, "ip", existing.IP)
+		if err := c.updateDHCPHost(network, libvirt.NetworkUpdateCommandDelete, existing, flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getNetworkForUpdate returns the network with the given name, its (persistent) XML and the flags with which
+// NetworkUpdate changes both its persistent and, if it is active, its live configuration.
+func (c *libvirtClient) getNetworkForUpdate(name string) (libvirt.Network, *libvirtxml.Network, libvirt.NetworkUpdateFlags, error) {
+	network, err := c.client.NetworkLookupByName(name)
+	if err != nil {
+		return network, nil, 0, wrapLookupError(err, fmt.Sprintf("network '%s'", name))
+	}
+	data, err := c.client.NetworkGetXMLDesc(network, uint32(libvirt.NetworkXMLInactive))
+	if err != nil {
+		return network, nil, 0, fmt.Errorf("failed to get network XML: %v", err)
+	}
+	networkXML := &libvirtxml.Network{}
+	if err := networkXML.Unmarshal(data); err != nil {
+		return network, nil, 0, fmt.Errorf("failed to parse network XML: %v", err)
+	}
+	flags := libvirt.NetworkUpdateAffectConfig
+	if active, err := c.client.NetworkIsActive(network); err == nil && active == 1 {
+		flags |= libvirt.NetworkUpdateAffectLive
+	}
+	return network, networkXML, flags, nil
+}
+
+func (c *libvirtClient) updateDHCPHost(network libvirt.Network, command libvirt.NetworkUpdateCommand, host libvirtxml.NetworkDHCPHost, flags libvirt.NetworkUpdateFlags) error {
+	hostXML, err := host.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to render DHCP host XML: %v", err)
+	}
+	// The parent index -1 selects the IP range of the network which matches the host's IP address
+	return c.client.NetworkUpdateCompat(network, command, libvirt.NetworkSectionIPDhcpHost, -1, hostXML, flags)
+}
+
+// dhcpHosts returns the DHCP hosts (reservations) of all IP ranges of the network.
+func dhcpHosts(network *libvirtxml.Network) []libvirtxml.NetworkDHCPHost {
+	var hosts []libvirtxml.NetworkDHCPHost
+	for _, ip := range network.IPs {
+		if ip.DHCP != nil {
+			hosts = append(hosts, ip.DHCP.Hosts...)
+		}
+	}
+	return hosts
+}
+
+func (c *libvirtClient) getDomainXML(domain libvirt.Domain) (*libvirtxml.Domain, error) {
+	return c.getDomainXMLFlags(domain, 0)
+}
+
+// getDomainXMLFlags returns the parsed XML of the domain, e.g. of its persistent configuration with
+// libvirt.DomainXMLInactive.
+func (c *libvirtClient) getDomainXMLFlags(domain libvirt.Domain, flags libvirt.DomainXMLFlags) (*libvirtxml.Domain, error) {
+	data, err := c.client.DomainGetXMLDesc(domain, flags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain XML: %v", err)
+	}
+	domainXML := &libvirtxml.Domain{}
+	if err := domainXML.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("failed to parse domain XML: %v", err)
+	}
+	return domainXML, nil
+}
+
+// domainResources are the (current and maximum) vCPUs and memory (in MiB) of a domain.
+type domainResources struct {
+	cpu, maxCPU, memory, maxMemory int32
+}
+
+// getDomainResources returns the vCPUs and memory of the domain XML.
+func getDomainResources(domain *libvirtxml.Domain) domainResources {
+	var resources domainResources
+	if domain.VCPU != nil {
+		resources.maxCPU = int32(domain.VCPU.Value)
+		resources.cpu = resources.maxCPU
+		if domain.VCPU.Current != 0 {
+			resources.cpu = int32(domain.VCPU.Current)
+		}
+	}
+	if domain.Memory != nil {
+		resources.maxMemory = int32(domain.Memory.Bytes() >> 20)
+		resources.memory = resources.maxMemory
+		if domain.CurrentMemory != nil {
+			resources.memory = int32(domain.CurrentMemory.Bytes() >> 20)
+		}
+	}
+	return resources
+}
+
+// additionalDiskSources returns the source paths of the disks of the domain other than its primary disk (vda) and
+// read-only disks (i.e. an Ignition config).
+func additionalDiskSources(domain *libvirtxml.Domain) []string {
+	var paths []string
+	for _, disk := range domain.Devices.Disks {
+		if disk.Device == "disk" && disk.Target.Dev != "vda" && disk.ReadOnly == nil && disk.Source != nil && disk.Source.File != "" {
+			paths = append(paths, disk.Source.File)
+		}
+	}
+	return paths
+}
+
+func (c *libvirtClient) getCapabilities() (*libvirtxml.Capabilities, error) {
+	data, err := c.client.ConnectGetCapabilities()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host capabilities: %v", err)
+	}
+	capabilities := &libvirtxml.Capabilities{}
+	if err := capabilities.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("failed to parse host capabilities: %v", err)
+	}
+	return capabilities, nil
+}
+
+// wrapLookupError wraps libvirt's "no such object" errors with ErrNotFound so that callers can check for them with errors.Is
+func wrapLookupError(err error, what string) error {
+	var libvirtErr libvirt.Error
+	if errors.As(err, &libvirtErr) {
+		switch libvirt.ErrorNumber(libvirtErr.Code) {
+		case libvirt.ErrNoDomain, libvirt.ErrNoNetwork, libvirt.ErrNoStoragePool, libvirt.ErrNoStorageVol:
+			return fmt.Errorf("%s %w: %v", what, ErrNotFound, err)
+		}
+	}
+	return fmt.Errorf("failed to look up %s: %v", what, err)
+}
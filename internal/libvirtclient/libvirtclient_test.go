@@ -0,0 +1,137 @@
+package libvirtclient
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/joshuagrisham/cluster-api-provider-libvirt/internal/libvirtclient/libvirtxml"
+)
+
+func TestDiskDevName(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(diskDevName("vd", 0)).To(Equal("vda"))
+	g.Expect(diskDevName("vd", 1)).To(Equal("vdb"))
+	g.Expect(diskDevName("sd", 25)).To(Equal("sdz"))
+	g.Expect(diskDevName("sd", 26)).To(Equal("sdaa"))
+	g.Expect(diskDevName("sd", 27)).To(Equal("sdab"))
+}
+
+func TestMachineDomainAdditionalDisks(t *testing.T) {
+	g := NewWithT(t)
+
+	vm := &LibvirtClientMachine{
+		Name:            "test-machine",
+		NetworkName:     "default",
+		StoragePoolName: "default",
+		CPU:             2,
+		Memory:          2048,
+		AdditionalDisks: []LibvirtClientDisk{
+			{Name: "etcd", Size: 10, Cache: "none"},
+			{Name: "data", Size: 100, StoragePoolName: "fast", Format: "raw", Bus: "scsi"},
+			{Name: "logs", Size: 5},
+		},
+	}
+	g.Expect(vm.AdditionalDiskVolumeName(vm.AdditionalDisks[0])).To(Equal("test-machine-etcd.qcow2"))
+	g.Expect(vm.AdditionalDiskVolumeName(vm.AdditionalDisks[1])).To(Equal("test-machine-data.raw"))
+	g.Expect(vm.AdditionalDiskStoragePoolName(vm.AdditionalDisks[0])).To(Equal("default"))
+	g.Expect(vm.AdditionalDiskStoragePoolName(vm.AdditionalDisks[1])).To(Equal("fast"))
+
+	amd64, _ := getArchitecture("amd64")
+	domain := vm.domain(amd64, FirmwareBIOS, "kvm", "/k8s/test-machine.qcow2", "/k8s/test-machine-cloudinit.iso",
+		[]string{"/k8s/test-machine-etcd.qcow2", "/fast/test-machine-data.raw", "/k8s/test-machine-logs.qcow2"})
+
+	g.Expect(domain.Devices.Disks).To(HaveLen(5))
+	g.Expect(domain.Devices.Disks[2]).To(Equal(libvirtxml.DomainDisk{
+		Type:   "file",
+		Device: "disk",
+		Driver: &libvirtxml.DomainDiskDriver{Name: "qemu", Type: "qcow2", Cache: "none"},
+		Source: &libvirtxml.DomainDiskSource{File: "/k8s/test-machine-etcd.qcow2"},
+		Target: libvirtxml.DomainDiskTarget{Dev: "vdb", Bus: "virtio"},
+	}))
+	g.Expect(domain.Devices.Disks[3].Driver).To(Equal(&libvirtxml.DomainDiskDriver{Name: "qemu", Type: "raw"}))
+	g.Expect(domain.Devices.Disks[3].Target).To(Equal(libvirtxml.DomainDiskTarget{Dev: "sdb", Bus: "scsi"}))
+	g.Expect(domain.Devices.Disks[4].Target).To(Equal(libvirtxml.DomainDiskTarget{Dev: "vdc", Bus: "virtio"}))
+	g.Expect(domain.Devices.Controllers).To(ConsistOf(libvirtxml.DomainController{Type: "scsi", Model: "virtio-scsi"}))
+
+	g.Expect(additionalDiskSources(domain)).To(Equal([]string{
+		"/k8s/test-machine-etcd.qcow2", "/fast/test-machine-data.raw", "/k8s/test-machine-logs.qcow2",
+	}))
+}
+
+func TestMachineDomainNetworkInterfaces(t *testing.T) {
+	g := NewWithT(t)
+
+	vm := &LibvirtClientMachine{Name: "test-machine", NetworkName: "default", CPU: 2, Memory: 2048}
+	g.Expect(vm.Interfaces()).To(Equal([]LibvirtClientNetworkInterface{{NetworkName: "default", Model: "virtio", Primary: true}}))
+
+	vm.NetworkInterfaces = []LibvirtClientNetworkInterface{
+		{NetworkName: "management"},
+		{NetworkName: "storage", Model: "e1000e", MACAddress: "52:54:00:12:34:56", Primary: true},
+	}
+	g.Expect(vm.Interfaces()).To(Equal([]LibvirtClientNetworkInterface{
+		{NetworkName: "management", Model: "virtio"},
+		{NetworkName: "storage", Model: "e1000e", MACAddress: "52:54:00:12:34:56", Primary: true},
+	}))
+	g.Expect(vm.NetworkInterfaces[0].Model).To(BeEmpty())
+
+	amd64, _ := getArchitecture("amd64")
+	domain := vm.domain(amd64, FirmwareBIOS, "kvm", "/k8s/test-machine.qcow2", "/k8s/test-machine-cloudinit.iso", nil)
+	g.Expect(domain.Devices.Interfaces).To(Equal([]libvirtxml.DomainInterface{
+		{
+			Type:   "network",
+			Source: &libvirtxml.DomainInterfaceSource{Network: "management"},
+			Model:  &libvirtxml.DomainInterfaceModel{Type: "virtio"},
+		},
+		{
+			Type:   "network",
+			MAC:    &libvirtxml.DomainInterfaceMAC{Address: "52:54:00:12:34:56"},
+			Source: &libvirtxml.DomainInterfaceSource{Network: "storage"},
+			Model:  &libvirtxml.DomainInterfaceModel{Type: "e1000e"},
+		},
+	}))
+
+	vm.NetworkInterfaces[1].Primary = false
+	g.Expect(vm.Interfaces()[0].Primary).To(BeTrue())
+}
+
+func TestMachineDomainResources(t *testing.T) {
+	g := NewWithT(t)
+
+	vm := &LibvirtClientMachine{Name: "test-machine", NetworkName: "default", CPU: 2, Memory: 2048}
+	amd64, _ := getArchitecture("amd64")
+	domain := vm.domain(amd64, FirmwareBIOS, "kvm", "/k8s/test-machine.qcow2", "/k8s/test-machine-cloudinit.iso", nil)
+	g.Expect(domain.VCPU).To(Equal(&libvirtxml.DomainVCPU{Value: 2}))
+	g.Expect(domain.Memory).To(Equal(&libvirtxml.Memory{Unit: "MiB", Value: 2048}))
+	g.Expect(domain.CurrentMemory).To(BeNil())
+	g.Expect(getDomainResources(domain)).To(Equal(domainResources{cpu: 2, maxCPU: 2, memory: 2048, maxMemory: 2048}))
+
+	vm.MaxCPU = 8
+	vm.MaxMemory = 8192
+	domain = vm.domain(amd64, FirmwareBIOS, "kvm", "/k8s/test-machine.qcow2", "/k8s/test-machine-cloudinit.iso", nil)
+	g.Expect(domain.VCPU).To(Equal(&libvirtxml.DomainVCPU{Current: 2, Value: 8}))
+	g.Expect(domain.Memory).To(Equal(&libvirtxml.Memory{Unit: "MiB", Value: 8192}))
+	g.Expect(domain.CurrentMemory).To(Equal(&libvirtxml.Memory{Unit: "MiB", Value: 2048}))
+	g.Expect(getDomainResources(domain)).To(Equal(domainResources{cpu: 2, maxCPU: 8, memory: 2048, maxMemory: 8192}))
+
+	vm.MaxCPU = 1
+	domain = vm.domain(amd64, FirmwareBIOS, "kvm", "/k8s/test-machine.qcow2", "/k8s/test-machine-cloudinit.iso", nil)
+	g.Expect(domain.VCPU).To(Equal(&libvirtxml.DomainVCPU{Value: 2}), "a maximum below the vCPUs is ignored")
+}
+
+func TestMachineMACAddress(t *testing.T) {
+	g := NewWithT(t)
+
+	vm := &LibvirtClientMachine{Name: "test-machine", NetworkInterfaces: []LibvirtClientNetworkInterface{
+		{NetworkName: "default"},
+		{NetworkName: "storage", MACAddress: "52:54:00:12:34:56"},
+		{NetworkName: "storage"},
+	}}
+	mac := vm.MACAddress(0)
+	g.Expect(mac).To(MatchRegexp(`^52:54:00(:[0-9a-f]{2}){3}$`))
+	g.Expect(vm.MACAddress(0)).To(Equal(mac), "the MAC address is stable")
+	g.Expect(vm.MACAddress(1)).To(Equal("52:54:00:12:34:56"))
+	g.Expect(vm.MACAddress(2)).NotTo(Equal(mac))
+	g.Expect((&LibvirtClientMachine{Name: "other-machine"}).MACAddress(0)).NotTo(Equal(mac))
+}
@@ -0,0 +1,419 @@
+// Package libvirtxml provides typed models of the libvirt domain, storage volume, network and capabilities XML formats
+// (see https://libvirt.org/format.html), which are marshalled and parsed with encoding/xml so that all values are
+// escaped.
+//
+// Only the elements and attributes used by CAPLV are modelled; any others are ignored when parsing XML from libvirt.
+package libvirtxml
+
+import (
+	"encoding/xml"
+)
+
+// Domain is a libvirt domain (https://libvirt.org/formatdomain.html).
+type Domain struct {
+	XMLName       xml.Name        `xml:"domain"`
+	Type          string          `xml:"type,attr"`
+	Name          string          `xml:"name"`
+	UUID          string          `xml:"uuid,omitempty"`
+	Memory        *Memory         `xml:"memory"`
+	CurrentMemory *Memory         `xml:"currentMemory"`
+	VCPU          *DomainVCPU     `xml:"vcpu"`
+	SysInfo       []DomainSysInfo `xml:"sysinfo"`
+	OS            *DomainOS       `xml:"os"`
+	Features      *DomainFeatures `xml:"features"`
+	CPU           *DomainCPU      `xml:"cpu"`
+	Devices       DomainDevices   `xml:"devices"`
+}
+
+// Memory is an amount of memory or storage with a unit (e.g. "KiB", "MiB" or "bytes").
+type Memory struct {
+	Unit  string `xml:"unit,attr,omitempty"`
+	Value uint64 `xml:",chardata"`
+}
+
+// Bytes returns the amount of memory in bytes. Values without a (known) unit are in KiB, which is the default unit of
+// libvirt.
+func (m *Memory) Bytes() uint64 {
+	switch m.Unit {
+	case "b", "bytes":
+		return m.Value
+	case "KB":
+		return m.Value * 1000
+	case "M", "MiB":
+		return m.Value << 20
+	case "MB":
+		return m.Value * 1000 * 1000
+	case "G", "GiB":
+		return m.Value << 30
+	case "GB":
+		return m.Value * 1000 * 1000 * 1000
+	default:
+		return m.Value << 10
+	}
+}
+
+// DomainVCPU is the maximum number of virtual CPUs of a domain, of which Current are online (all if zero).
+type DomainVCPU struct {
+	Placement string `xml:"placement,attr,omitempty"`
+	Current   uint   `xml:"current,attr,omitempty"`
+	Value     uint   `xml:",chardata"`
+}
+
+// DomainSysInfo is system information passed to the guest, e.g. fw_cfg entries (type "fwcfg").
+type DomainSysInfo struct {
+	Type    string               `xml:"type,attr"`
+	Entries []DomainSysInfoEntry `xml:"entry"`
+}
+
+// DomainSysInfoEntry is a named entry of the system information, whose value is either given inline or read from a file.
+type DomainSysInfoEntry struct {
+	Name  string `xml:"name,attr"`
+	File  string `xml:"file,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// DomainOS describes how a domain is booted. If Firmware is set (e.g. to "efi"), libvirt selects the firmware image
+// with the requested FirmwareFeatures and creates the NVRAM of the domain from the firmware's template.
+type DomainOS struct {
+	Firmware         string            `xml:"firmware,attr,omitempty"`
+	Type             DomainOSType      `xml:"type"`
+	FirmwareFeatures *DomainOSFirmware `xml:"firmware"`
+	Loader           *DomainOSLoader   `xml:"loader"`
+	NVRAM            *DomainOSNVRAM    `xml:"nvram"`
+	Boots            []DomainOSBoot    `xml:"boot"`
+}
+
+// DomainOSFirmware lists features which the automatically selected firmware must (not) have.
+type DomainOSFirmware struct {
+	Features []DomainOSFirmwareFeature `xml:"feature"`
+}
+
+// DomainOSFirmwareFeature is a firmware feature (e.g. "secure-boot" or "enrolled-keys").
+type DomainOSFirmwareFeature struct {
+	Enabled string `xml:"enabled,attr"` // "yes" or "no"
+	Name    string `xml:"name,attr"`
+}
+
+// DomainOSLoader is the firmware image of a domain.
+type DomainOSLoader struct {
+	Readonly string `xml:"readonly,attr,omitempty"`
+	Secure   string `xml:"secure,attr,omitempty"`
+	Type     string `xml:"type,attr,omitempty"`
+	Path     string `xml:",chardata"`
+}
+
+// DomainOSNVRAM is the NVRAM (UEFI variable store) of a domain.
+type DomainOSNVRAM struct {
+	Template string `xml:"template,attr,omitempty"`
+	Path     string `xml:",chardata"`
+}
+
+// DomainOSType is the type of operating system (e.g. "hvm") and the architecture and machine type of a domain.
+type DomainOSType struct {
+	Arch    string `xml:"arch,attr,omitempty"`
+	Machine string `xml:"machine,attr,omitempty"`
+	Value   string `xml:",chardata"`
+}
+
+// DomainOSBoot is a boot device (e.g. "hd" or "cdrom").
+type DomainOSBoot struct {
+	Dev string `xml:"dev,attr"`
+}
+
+// DomainFeatures are the hypervisor features of a domain.
+type DomainFeatures struct {
+	ACPI *struct{}           `xml:"acpi"`
+	APIC *struct{}           `xml:"apic"`
+	SMM  *DomainFeatureState `xml:"smm"`
+}
+
+// DomainFeatureState is a hypervisor feature which can be turned on or off.
+type DomainFeatureState struct {
+	State string `xml:"state,attr"` // "on" or "off"
+}
+
+// DomainCPU is the CPU model of a domain.
+type DomainCPU struct {
+	Mode string `xml:"mode,attr,omitempty"`
+}
+
+// DomainDevices are the devices of a domain.
+type DomainDevices struct {
+	Controllers []DomainController `xml:"controller"`
+	Disks       []DomainDisk       `xml:"disk"`
+	Interfaces  []DomainInterface  `xml:"interface"`
+	Serials     []DomainChardev    `xml:"serial"`
+	Consoles    []DomainChardev    `xml:"console"`
+	TPMs        []DomainTPM        `xml:"tpm"`
+}
+
+// DomainController is a device controller (e.g. type "scsi" with model "virtio-scsi").
+type DomainController struct {
+	Type  string `xml:"type,attr"`
+	Index *uint  `xml:"index,attr"`
+	Model string `xml:"model,attr,omitempty"`
+}
+
+// DomainDisk is a disk, cdrom or floppy device.
+type DomainDisk struct {
+	Type     string            `xml:"type,attr"`
+	Device   string            `xml:"device,attr,omitempty"`
+	Driver   *DomainDiskDriver `xml:"driver"`
+	Source   *DomainDiskSource `xml:"source"`
+	Target   DomainDiskTarget  `xml:"target"`
+	Serial   string            `xml:"serial,omitempty"`
+	ReadOnly *struct{}         `xml:"readonly"`
+}
+
+// DomainDiskDriver is the hypervisor driver, image format and cache mode of a disk.
+type DomainDiskDriver struct {
+	Name  string `xml:"name,attr,omitempty"`
+	Type  string `xml:"type,attr,omitempty"`
+	Cache string `xml:"cache,attr,omitempty"`
+}
+
+// DomainDiskSource is the source of a disk, i.e. a file (type "file") or a storage volume (type "volume").
+type DomainDiskSource struct {
+	File   string `xml:"file,attr,omitempty"`
+	Pool   string `xml:"pool,attr,omitempty"`
+	Volume string `xml:"volume,attr,omitempty"`
+}
+
+// DomainDiskTarget is the device name and bus of a disk in the guest.
+type DomainDiskTarget struct {
+	Dev string `xml:"dev,attr"`
+	Bus string `xml:"bus,attr,omitempty"`
+}
+
+// DomainInterface is a network interface.
+type DomainInterface struct {
+	Type   string                 `xml:"type,attr"`
+	MAC    *DomainInterfaceMAC    `xml:"mac"`
+	Source *DomainInterfaceSource `xml:"source"`
+	Model  *DomainInterfaceModel  `xml:"model"`
+}
+
+// DomainInterfaceMAC is the MAC address of a network interface.
+type DomainInterfaceMAC struct {
+	Address string `xml:"address,attr"`
+}
+
+// DomainInterfaceSource is the network (type "network") or bridge (type "bridge") of a network interface.
+type DomainInterfaceSource struct {
+	Network string `xml:"network,attr,omitempty"`
+	Bridge  string `xml:"bridge,attr,omitempty"`
+}
+
+// DomainInterfaceModel is the device model of a network interface (e.g. "virtio").
+type DomainInterfaceModel struct {
+	Type string `xml:"type,attr"`
+}
+
+// DomainChardev is a serial port or console.
+type DomainChardev struct {
+	Type   string               `xml:"type,attr"`
+	Target *DomainChardevTarget `xml:"target"`
+}
+
+// DomainChardevTarget is the device of a serial port or console in the guest.
+type DomainChardevTarget struct {
+	Type  string              `xml:"type,attr,omitempty"`
+	Port  *uint               `xml:"port,attr"`
+	Model *DomainChardevModel `xml:"model"`
+}
+
+// DomainChardevModel is the device model of a serial port (e.g. "isa-serial").
+type DomainChardevModel struct {
+	Name string `xml:"name,attr"`
+}
+
+// DomainTPM is a TPM device.
+type DomainTPM struct {
+	Model   string           `xml:"model,attr,omitempty"`
+	Backend DomainTPMBackend `xml:"backend"`
+}
+
+// DomainTPMBackend is the backend of a TPM device, e.g. an emulated (swtpm) TPM 2.0 device.
+type DomainTPMBackend struct {
+	Type    string `xml:"type,attr"`
+	Version string `xml:"version,attr,omitempty"`
+}
+
+// StorageVolume is a libvirt storage volume (https://libvirt.org/formatstorage.html#storage-volume-xml).
+type StorageVolume struct {
+	XMLName      xml.Name                   `xml:"volume"`
+	Type         string                     `xml:"type,attr,omitempty"`
+	Name         string                     `xml:"name"`
+	Capacity     *Memory                    `xml:"capacity"`
+	Allocation   *Memory                    `xml:"allocation"`
+	Target       *StorageVolumeTarget       `xml:"target"`
+	BackingStore *StorageVolumeBackingStore `xml:"backingStore"`
+}
+
+// StorageVolumeTarget is the path and format of a storage volume.
+type StorageVolumeTarget struct {
+	Path   string               `xml:"path,omitempty"`
+	Format *StorageVolumeFormat `xml:"format"`
+}
+
+// StorageVolumeBackingStore is the backing image of a copy-on-write storage volume.
+type StorageVolumeBackingStore struct {
+	Path   string               `xml:"path"`
+	Format *StorageVolumeFormat `xml:"format"`
+}
+
+// StorageVolumeFormat is the format of a storage volume (e.g. "qcow2" or "raw").
+type StorageVolumeFormat struct {
+	Type string `xml:"type,attr"`
+}
+
+// Network is a libvirt virtual network (https://libvirt.org/formatnetwork.html).
+type Network struct {
+	XMLName xml.Name        `xml:"network"`
+	Name    string          `xml:"name"`
+	UUID    string          `xml:"uuid,omitempty"`
+	Forward *NetworkForward `xml:"forward"`
+	Bridge  *NetworkBridge  `xml:"bridge"`
+	Domain  *NetworkDomain  `xml:"domain"`
+	IPs     []NetworkIP     `xml:"ip"`
+}
+
+// NetworkForward is how the traffic of a network is forwarded (e.g. mode "nat").
+type NetworkForward struct {
+	Mode string `xml:"mode,attr,omitempty"`
+}
+
+// NetworkBridge is the bridge device of a network.
+type NetworkBridge struct {
+	Name string `xml:"name,attr,omitempty"`
+}
+
+// NetworkDomain is the DNS domain of a network.
+type NetworkDomain struct {
+	Name string `xml:"name,attr"`
+}
+
+// NetworkIP is an IPv4 or IPv6 address range of a network.
+type NetworkIP struct {
+	Family  string       `xml:"family,attr,omitempty"`
+	Address string       `xml:"address,attr,omitempty"`
+	Netmask string       `xml:"netmask,attr,omitempty"`
+	Prefix  uint         `xml:"prefix,attr,omitempty"`
+	DHCP    *NetworkDHCP `xml:"dhcp"`
+}
+
+// NetworkDHCP is the DHCP configuration of a network's IP address range.
+type NetworkDHCP struct {
+	Ranges []NetworkDHCPRange `xml:"range"`
+	Hosts  []NetworkDHCPHost  `xml:"host"`
+}
+
+// NetworkDHCPRange is a range of addresses handed out by DHCP.
+type NetworkDHCPRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+// NetworkDHCPHost is a static DHCP lease (reservation).
+type NetworkDHCPHost struct {
+	MAC  string `xml:"mac,attr,omitempty"`
+	Name string `xml:"name,attr,omitempty"`
+	IP   string `xml:"ip,attr,omitempty"`
+}
+
+// Capabilities are the capabilities of a libvirt host (https://libvirt.org/formatcaps.html).
+type Capabilities struct {
+	XMLName xml.Name          `xml:"capabilities"`
+	Host    CapabilitiesHost  `xml:"host"`
+	Guests  []CapabilityGuest `xml:"guest"`
+}
+
+// CapabilitiesHost describes the libvirt host.
+type CapabilitiesHost struct {
+	CPU CapabilitiesHostCPU `xml:"cpu"`
+}
+
+// CapabilitiesHostCPU describes the CPU of the libvirt host.
+type CapabilitiesHostCPU struct {
+	Arch string `xml:"arch"`
+}
+
+// CapabilityGuest is a guest architecture and operating system type (e.g. "hvm") supported by the libvirt host.
+type CapabilityGuest struct {
+	OSType string              `xml:"os_type"`
+	Arch   CapabilityGuestArch `xml:"arch"`
+}
+
+// CapabilityGuestArch is a guest architecture with its machine types and domain types (e.g. "qemu" or "kvm").
+type CapabilityGuestArch struct {
+	Name     string                   `xml:"name,attr"`
+	Machines []CapabilityGuestMachine `xml:"machine"`
+	Domains  []CapabilityGuestDomain  `xml:"domain"`
+}
+
+// CapabilityGuestMachine is a machine type (e.g. "q35"), which may be an alias of a canonical machine type (e.g.
+// "pc-q35-8.2").
+type CapabilityGuestMachine struct {
+	Canonical string `xml:"canonical,attr,omitempty"`
+	Name      string `xml:",chardata"`
+}
+
+// CapabilityGuestDomain is a domain type supported for a guest architecture.
+type CapabilityGuestDomain struct {
+	Type string `xml:"type,attr"`
+}
+
+// Marshal returns the XML of the domain.
+func (d *Domain) Marshal() (string, error) {
+	return marshal(d)
+}
+
+// Unmarshal parses the XML of a domain, e.g. as returned by DomainGetXMLDesc.
+func (d *Domain) Unmarshal(data string) error {
+	return xml.Unmarshal([]byte(data), d)
+}
+
+// Marshal returns the XML of the storage volume.
+func (v *StorageVolume) Marshal() (string, error) {
+	return marshal(v)
+}
+
+// Unmarshal parses the XML of a storage volume, e.g. as returned by StorageVolGetXMLDesc.
+func (v *StorageVolume) Unmarshal(data string) error {
+	return xml.Unmarshal([]byte(data), v)
+}
+
+// Marshal returns the XML of the network.
+func (n *Network) Marshal() (string, error) {
+	return marshal(n)
+}
+
+// Unmarshal parses the XML of a network, e.g. as returned by NetworkGetXMLDesc.
+func (n *Network) Unmarshal(data string) error {
+	return xml.Unmarshal([]byte(data), n)
+}
+
+// Marshal returns the XML of the DHCP host, e.g. for NetworkUpdate.
+func (h *NetworkDHCPHost) Marshal() (string, error) {
+	data, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"host"`
+		*NetworkDHCPHost
+	}{NetworkDHCPHost: h})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func marshal(v any) (string, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Unmarshal parses the XML of the capabilities of a libvirt host, as returned by ConnectGetCapabilities.
+func (c *Capabilities) Unmarshal(data string) error {
+	return xml.Unmarshal([]byte(data), c)
+}
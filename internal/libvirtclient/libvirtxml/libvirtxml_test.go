@@ -0,0 +1,168 @@
+package libvirtxml
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// domainXMLDesc is (abbreviated) output of DomainGetXMLDesc for a domain created by CAPLV.
+const domainXMLDesc = `<domain type='kvm' id='4'>
+  <name>test-machine</name>
+  <uuid>0b3c4f8e-3c8b-4a39-9d0b-8e3f0c6c2a11</uuid>
+  <memory unit='KiB'>2097152</memory>
+  <currentMemory unit='KiB'>1048576</currentMemory>
+  <vcpu placement='static' current='1'>2</vcpu>
+  <os>
+    <type arch='x86_64' machine='pc-i440fx-8.2'>hvm</type>
+    <boot dev='hd'/>
+  </os>
+  <devices>
+    <emulator>/usr/bin/qemu-system-x86_64</emulator>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2'/>
+      <source file='/k8s/test-machine.qcow2' index='2'/>
+      <backingStore type='file' index='3'>
+        <format type='qcow2'/>
+        <source file='/images/base.qcow2'/>
+      </backingStore>
+      <target dev='vda' bus='virtio'/>
+      <alias name='virtio-disk0'/>
+    </disk>
+    <disk type='file' device='cdrom'>
+      <driver name='qemu' type='raw'/>
+      <source file='/k8s/test-machine-cloudinit.iso' index='1'/>
+      <target dev='hda' bus='ide'/>
+      <readonly/>
+    </disk>
+    <interface type='network'>
+      <mac address='52:54:00:6b:3c:58'/>
+      <source network='default' portid='2b4f5f05-3d8e-4c6c-8b55-3f0a1f1c2d3e' bridge='virbr0'/>
+      <target dev='vnet3'/>
+      <model type='virtio'/>
+    </interface>
+    <serial type='pty'>
+      <source path='/dev/pts/2'/>
+      <target type='isa-serial' port='0'>
+        <model name='isa-serial'/>
+      </target>
+    </serial>
+    <console type='pty' tty='/dev/pts/2'>
+      <target type='serial' port='0'/>
+    </console>
+  </devices>
+</domain>`
+
+func TestDomainUnmarshal(t *testing.T) {
+	g := NewWithT(t)
+
+	domain := &Domain{}
+	g.Expect(domain.Unmarshal(domainXMLDesc)).To(Succeed())
+
+	g.Expect(domain.Name).To(Equal("test-machine"))
+	g.Expect(domain.Memory).To(Equal(&Memory{Unit: "KiB", Value: 2097152}))
+	g.Expect(domain.CurrentMemory.Bytes()).To(Equal(uint64(1024 * 1024 * 1024)))
+	g.Expect(domain.VCPU).To(Equal(&DomainVCPU{Placement: "static", Current: 1, Value: 2}))
+	g.Expect(domain.OS.Type).To(Equal(DomainOSType{Arch: "x86_64", Machine: "pc-i440fx-8.2", Value: "hvm"}))
+	g.Expect(domain.Devices.Disks).To(HaveLen(2))
+	g.Expect(domain.Devices.Disks[0].Source.File).To(Equal("/k8s/test-machine.qcow2"))
+	g.Expect(domain.Devices.Disks[0].ReadOnly).To(BeNil())
+	g.Expect(domain.Devices.Disks[1].ReadOnly).NotTo(BeNil())
+	g.Expect(domain.Devices.Interfaces).To(ConsistOf(DomainInterface{
+		Type:   "network",
+		MAC:    &DomainInterfaceMAC{Address: "52:54:00:6b:3c:58"},
+		Source: &DomainInterfaceSource{Network: "default", Bridge: "virbr0"},
+		Model:  &DomainInterfaceModel{Type: "virtio"},
+	}))
+	g.Expect(*domain.Devices.Consoles[0].Target.Port).To(Equal(uint(0)))
+}
+
+func TestDomainMarshalEscapesValues(t *testing.T) {
+	g := NewWithT(t)
+
+	domain := &Domain{
+		Type:   "kvm",
+		Name:   `test'><name>injected</name>`,
+		Memory: &Memory{Unit: "MiB", Value: 2048},
+		Devices: DomainDevices{
+			Disks: []DomainDisk{{
+				Type:   "file",
+				Device: "disk",
+				Source: &DomainDiskSource{File: `/k8s/it's <here>.qcow2`},
+				Target: DomainDiskTarget{Dev: "vda", Bus: "virtio"},
+			}},
+		},
+	}
+	data, err := domain.Marshal()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(strings.Count(data, "<name>")).To(Equal(1))
+
+	parsed := &Domain{}
+	g.Expect(parsed.Unmarshal(data)).To(Succeed())
+	parsed.XMLName = domain.XMLName
+	g.Expect(parsed).To(Equal(domain))
+}
+
+func TestStorageVolumeMarshal(t *testing.T) {
+	g := NewWithT(t)
+
+	volume := &StorageVolume{
+		Name:     "test-machine.qcow2",
+		Capacity: &Memory{Unit: "GiB", Value: 20},
+		Target:   &StorageVolumeTarget{Format: &StorageVolumeFormat{Type: "qcow2"}},
+		BackingStore: &StorageVolumeBackingStore{
+			Path:   "/images/base.qcow2",
+			Format: &StorageVolumeFormat{Type: "qcow2"},
+		},
+	}
+	data, err := volume.Marshal()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(data).To(Equal(`<volume>
+  <name>test-machine.qcow2</name>
+  <capacity unit="GiB">20</capacity>
+  <target>
+    <format type="qcow2"></format>
+  </target>
+  <backingStore>
+    <path>/images/base.qcow2</path>
+    <format type="qcow2"></format>
+  </backingStore>
+</volume>`))
+}
+
+func TestNetworkUnmarshal(t *testing.T) {
+	g := NewWithT(t)
+
+	network := &Network{}
+	g.Expect(network.Unmarshal(`<network connections='2'>
+  <name>default</name>
+  <uuid>3e3fce45-4f53-4fa7-bb32-11f34168b82b</uuid>
+  <forward mode='nat'>
+    <nat><port start='1024' end='65535'/></nat>
+  </forward>
+  <bridge name='virbr0' stp='on' delay='0'/>
+  <mac address='52:54:00:0a:cd:21'/>
+  <ip address='192.168.122.1' netmask='255.255.255.0'>
+    <dhcp>
+      <range start='192.168.122.2' end='192.168.122.254'/>
+      <host mac='52:54:00:6b:3c:58' name='test-machine' ip='192.168.122.10'/>
+    </dhcp>
+  </ip>
+</network>`)).To(Succeed())
+
+	g.Expect(network.Name).To(Equal("default"))
+	g.Expect(network.Forward.Mode).To(Equal("nat"))
+	g.Expect(network.Bridge.Name).To(Equal("virbr0"))
+	g.Expect(network.IPs).To(HaveLen(1))
+	g.Expect(network.IPs[0].DHCP.Ranges).To(ConsistOf(NetworkDHCPRange{Start: "192.168.122.2", End: "192.168.122.254"}))
+	g.Expect(network.IPs[0].DHCP.Hosts).To(ConsistOf(NetworkDHCPHost{MAC: "52:54:00:6b:3c:58", Name: "test-machine", IP: "192.168.122.10"}))
+}
+
+func TestNetworkDHCPHostMarshal(t *testing.T) {
+	g := NewWithT(t)
+
+	data, err := (&NetworkDHCPHost{MAC: "52:54:00:6b:3c:58", Name: "test-machine", IP: "192.168.122.10"}).Marshal()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(data).To(Equal(`<host mac="52:54:00:6b:3c:58" name="test-machine" ip="192.168.122.10"></host>`))
+}
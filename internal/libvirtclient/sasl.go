@@ -0,0 +1,324 @@
+package libvirtclient
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/digitalocean/go-libvirt/socket"
+)
+
+// Constants of the libvirt remote protocol (see libvirt's src/rpc/virnetprotocol.x and src/remote/remote_protocol.x).
+const (
+	remoteProgram        = 0x20008086
+	remoteProgramVersion = 1
+
+	remoteProcAuthList      = 66
+	remoteProcAuthSASLInit  = 67
+	remoteProcAuthSASLStart = 68
+	remoteProcAuthSASLStep  = 69
+
+	remoteAuthSASL        = 1
+	remoteAuthSASLDataMax = 65536
+
+	rpcHeaderSize   = 24
+	rpcMessageMax   = 32 * 1024 * 1024
+	rpcTypeCall     = 0
+	rpcTypeReply    = 1
+	rpcStatusOK     = 0
+	rpcStatusError  = 1
+	saslAuthTimeout = 30 * time.Second
+)
+
+// saslDialer wraps another dialer and performs SASL authentication on every new connection before it is handed to
+// go-libvirt, which does not implement SASL itself. The SCRAM-SHA-256 and SCRAM-SHA-1 mechanisms are supported.
+//
+// Note that libvirtd only accepts SASL mechanisms without a security layer (such as SCRAM) on connections which are
+// already encrypted, i.e. qemu+tls (or qemu+tcp through an encrypted tunnel).
+type saslDialer struct {
+	dialer   socket.Dialer
+	username string
+	password string
+}
+
+// Dial implements socket.Dialer.
+func (d *saslDialer) Dial() (net.Conn, error) {
+	conn, err := d.dialer.Dial()
+	if err != nil {
+		return nil, err
+	}
+
+	// Not all connections support deadlines (e.g. SSH channels), so the timeout is best effort
+	_ = conn.SetDeadline(time.Now().Add(saslAuthTimeout))
+	if err := d.authenticate(&rpcConn{conn: conn}); err != nil {
+		conn.Close() //nolint:errcheck
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// authenticate performs SASL authentication if the server requires it.
+func (d *saslDialer) authenticate(conn *rpcConn) error {
+	reply, err := conn.call(remoteProcAuthList, nil)
+	if err != nil {
+		return wrapAuthError(fmt.Errorf("failed to list libvirt authentication types: %w", err))
+	}
+	authTypes := reply.uint32s()
+	if reply.err != nil {
+		return fmt.Errorf("failed to list libvirt authentication types: %v", reply.err)
+	}
+	if !slices.Contains(authTypes, remoteAuthSASL) {
+		return nil
+	}
+
+	reply, err = conn.call(remoteProcAuthSASLInit, nil)
+	if err != nil {
+		return wrapAuthError(fmt.Errorf("failed to initialize libvirt SASL authentication: %w", err))
+	}
+	offered := strings.FieldsFunc(strings.ToUpper(reply.string()), func(r rune) bool { return r == ',' || r == ' ' })
+	if reply.err != nil {
+		return fmt.Errorf("failed to initialize libvirt SASL authentication: %v", reply.err)
+	}
+
+	var mechanism string
+	var client *scramClient
+	for _, m := range scramMechanisms {
+		if slices.Contains(offered, m.name) {
+			mechanism = m.name
+			if client, err = newSCRAMClient(m.hash, d.username, d.password); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if client == nil {
+		return fmt.Errorf("%w: libvirt offers none of the supported SASL mechanisms SCRAM-SHA-256 or SCRAM-SHA-1 (offered: %s)",
+			ErrAuthenticationFailed, strings.Join(offered, ", "))
+	}
+
+	args := &xdrWriter{}
+	args.string(mechanism)
+	args.saslData(client.clientFirst())
+	reply, err = conn.call(remoteProcAuthSASLStart, args.Bytes())
+	if err != nil {
+		return wrapAuthError(fmt.Errorf("SASL %s authentication failed: %w", mechanism, err))
+	}
+	complete, serverFirst := reply.saslResult()
+	if reply.err != nil || complete {
+		return fmt.Errorf("%w: unexpected SASL %s server response", ErrAuthenticationFailed, mechanism)
+	}
+
+	clientFinal, err := client.clientFinal(serverFirst)
+	if err != nil {
+		return fmt.Errorf("%w: SASL %s authentication failed: %v", ErrAuthenticationFailed, mechanism, err)
+	}
+	args = &xdrWriter{}
+	args.saslData(clientFinal)
+	reply, err = conn.call(remoteProcAuthSASLStep, args.Bytes())
+	if err != nil {
+		return wrapAuthError(fmt.Errorf("SASL %s authentication failed: %w", mechanism, err))
+	}
+	complete, serverFinal := reply.saslResult()
+	if reply.err != nil {
+		return fmt.Errorf("%w: unexpected SASL %s server response", ErrAuthenticationFailed, mechanism)
+	}
+	if err := client.verifyServerFinal(serverFinal); err != nil {
+		return fmt.Errorf("%w: SASL %s authentication failed: %v", ErrAuthenticationFailed, mechanism, err)
+	}
+
+	// Some SASL implementations only complete once the client acknowledges the server-final-message
+	if !complete {
+		args = &xdrWriter{}
+		args.saslData(nil)
+		reply, err = conn.call(remoteProcAuthSASLStep, args.Bytes())
+		if err != nil {
+			return wrapAuthError(fmt.Errorf("SASL %s authentication failed: %w", mechanism, err))
+		}
+		if complete, _ = reply.saslResult(); reply.err != nil || !complete {
+			return fmt.Errorf("%w: SASL %s authentication did not complete", ErrAuthenticationFailed, mechanism)
+		}
+	}
+
+	return nil
+}
+
+// rpcConn makes calls to the libvirt remote program on a raw connection.
+type rpcConn struct {
+	conn   io.ReadWriter
+	serial uint32
+}
+
+// call sends a call to the given procedure with the given XDR-encoded arguments and returns a reader of the reply. If
+// libvirt replies with an error, it is returned as a libvirt.Error.
+func (c *rpcConn) call(procedure uint32, args []byte) (*xdrReader, error) {
+	c.serial++
+
+	message := &xdrWriter{}
+	message.uint32(uint32(4 + rpcHeaderSize + len(args)))
+	message.uint32(remoteProgram)
+	message.uint32(remoteProgramVersion)
+	message.uint32(procedure)
+	message.uint32(rpcTypeCall)
+	message.uint32(c.serial)
+	message.uint32(rpcStatusOK)
+	message.Write(args)
+	if _, err := c.conn.Write(message.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var length uint32
+	if err := binary.Read(c.conn, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if length < 4+rpcHeaderSize || length > rpcMessageMax {
+		return nil, fmt.Errorf("invalid libvirt message length %d", length)
+	}
+	buf := make([]byte, length-4)
+	if _, err := io.ReadFull(c.conn, buf); err != nil {
+		return nil, err
+	}
+
+	reply := &xdrReader{buf: buf}
+	program, version, replyProcedure := reply.uint32(), reply.uint32(), reply.uint32()
+	messageType, serial, status := reply.uint32(), reply.uint32(), reply.uint32()
+	if program != remoteProgram || version != remoteProgramVersion || replyProcedure != procedure ||
+		messageType != rpcTypeReply || serial != c.serial {
+		return nil, errors.New("unexpected reply from libvirt")
+	}
+
+	switch status {
+	case rpcStatusOK:
+		return reply, nil
+	case rpcStatusError:
+		// remote_error starts with the error code, the error domain and the (optional) message
+		code, _ := reply.uint32(), reply.uint32()
+		var message string
+		if reply.uint32() != 0 {
+			message = reply.string()
+		}
+		if reply.err != nil {
+			return nil, fmt.Errorf("failed to decode libvirt error: %v", reply.err)
+		}
+		return nil, libvirt.Error{Code: code, Message: message}
+	default:
+		return nil, fmt.Errorf("unexpected libvirt reply status %d", status)
+	}
+}
+
+// xdrWriter encodes the XDR types used by SASL authentication.
+type xdrWriter struct {
+	bytes.Buffer
+}
+
+func (w *xdrWriter) uint32(v uint32) {
+	_ = binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *xdrWriter) string(s string) {
+	w.uint32(uint32(len(s)))
+	w.WriteString(s)
+	w.Write(make([]byte, (4-len(s)%4)%4))
+}
+
+// saslData encodes the "int nil; char data<>" pair of the SASL procedures. Note that libvirt declares the data as a
+// variable-length array of XDR chars, each of which is encoded as a 4-byte integer.
+func (w *xdrWriter) saslData(data []byte) {
+	if data == nil {
+		w.uint32(1)
+		w.uint32(0)
+		return
+	}
+	w.uint32(0)
+	w.uint32(uint32(len(data)))
+	for _, b := range data {
+		w.uint32(uint32(int32(int8(b))))
+	}
+}
+
+// xdrReader decodes the XDR types used by SASL authentication. Decoding errors are recorded in err, after which all
+// reads return zero values.
+type xdrReader struct {
+	buf []byte
+	err error
+}
+
+func (r *xdrReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.buf) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *xdrReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *xdrReader) uint32s() []uint32 {
+	n := r.uint32()
+	if n > uint32(len(r.buf)/4) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	values := make([]uint32, n)
+	for i := range values {
+		values[i] = r.uint32()
+	}
+	return values
+}
+
+func (r *xdrReader) string() string {
+	n := int(r.uint32())
+	b := r.next(n)
+	r.next((4 - n%4) % 4)
+	return string(b)
+}
+
+// saslResult decodes the "int complete; int nil; char data<>" result of the SASL procedures.
+func (r *xdrReader) saslResult() (bool, []byte) {
+	complete := r.uint32() != 0
+	isNil := r.uint32() != 0
+	n := r.uint32()
+	if n > remoteAuthSASLDataMax || n > uint32(len(r.buf)/4) {
+		r.err = io.ErrUnexpectedEOF
+		return false, nil
+	}
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(r.uint32())
+	}
+	if isNil {
+		data = nil
+	}
+	return complete, data
+}
+
+// wrapAuthError marks libvirt authentication errors with ErrAuthenticationFailed.
+func wrapAuthError(err error) error {
+	var libvirtErr libvirt.Error
+	if errors.As(err, &libvirtErr) && !errors.Is(err, ErrAuthenticationFailed) {
+		switch libvirt.ErrorNumber(libvirtErr.Code) {
+		case libvirt.ErrAuthFailed, libvirt.ErrAuthCancelled, libvirt.ErrAuthUnavailable:
+			return fmt.Errorf("%w: %w", ErrAuthenticationFailed, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,228 @@
+package libvirtclient
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+	. "github.com/onsi/gomega"
+)
+
+// testSASLServer is a minimal libvirtd which requires SCRAM-SHA-256 authentication.
+type testSASLServer struct {
+	username   string
+	password   string
+	mechanisms string
+	authTypes  []uint32
+
+	authenticated bool
+}
+
+// pipeDialer returns a new connection to a testSASLServer on every Dial.
+type pipeDialer struct {
+	server *testSASLServer
+}
+
+func (d *pipeDialer) Dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	go d.server.serve(server)
+	return client, nil
+}
+
+func (s *testSASLServer) serve(conn net.Conn) {
+	defer conn.Close() //nolint:errcheck
+
+	var clientFirstBare, serverFirst string
+	var saltedPassword []byte
+	for {
+		var length uint32
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+		buf := make([]byte, length-4)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		call := &xdrReader{buf: buf}
+		_, _, procedure, _, serial, _ := call.uint32(), call.uint32(), call.uint32(), call.uint32(), call.uint32(), call.uint32()
+
+		reply := &xdrWriter{}
+		var replyErr *libvirt.Error
+		switch procedure {
+		case remoteProcAuthList:
+			reply.uint32(uint32(len(s.authTypes)))
+			for _, t := range s.authTypes {
+				reply.uint32(t)
+			}
+		case remoteProcAuthSASLInit:
+			reply.string(s.mechanisms)
+		case remoteProcAuthSASLStart:
+			if mechanism := call.string(); mechanism != "SCRAM-SHA-256" {
+				replyErr = &libvirt.Error{Code: uint32(libvirt.ErrAuthFailed), Message: "unsupported mechanism"}
+				break
+			}
+			clientFirst := readSASLData(call)
+			clientFirstBare = strings.TrimPrefix(string(clientFirst), "n,,")
+			attributes, _ := parseSCRAMAttributes([]byte(clientFirstBare))
+			if attributes["n"] != s.username {
+				replyErr = &libvirt.Error{Code: uint32(libvirt.ErrAuthFailed), Message: "authentication failed: unknown user"}
+				break
+			}
+			salt := []byte("salt")
+			saltedPassword, _ = pbkdf2.Key(sha256.New, s.password, salt, 4096, sha256.Size)
+			serverFirst = "r=" + attributes["r"] + "server-nonce,s=" + base64.StdEncoding.EncodeToString(salt) + ",i=4096"
+			reply.uint32(0)
+			reply.saslData([]byte(serverFirst))
+		case remoteProcAuthSASLStep:
+			clientFinal := readSASLData(call)
+			withoutProof, proof, _ := strings.Cut(string(clientFinal), ",p=")
+			authMessage := []byte(clientFirstBare + "," + serverFirst + "," + withoutProof)
+
+			mac := func(key []byte, data []byte) []byte {
+				h := hmac.New(sha256.New, key)
+				h.Write(data)
+				return h.Sum(nil)
+			}
+			clientKey := mac(saltedPassword, []byte("Client Key"))
+			storedKey := sha256.Sum256(clientKey)
+			clientProof, _ := base64.StdEncoding.DecodeString(proof)
+			recoveredKey := make([]byte, sha256.Size)
+			if len(clientProof) == sha256.Size {
+				subtle.XORBytes(recoveredKey, clientProof, mac(storedKey[:], authMessage))
+			}
+			if recovered := sha256.Sum256(recoveredKey); !hmac.Equal(recovered[:], storedKey[:]) {
+				replyErr = &libvirt.Error{Code: uint32(libvirt.ErrAuthFailed), Message: "authentication failed: invalid proof"}
+				break
+			}
+			s.authenticated = true
+			reply.uint32(1)
+			reply.saslData([]byte("v=" + base64.StdEncoding.EncodeToString(mac(mac(saltedPassword, []byte("Server Key")), authMessage))))
+		default:
+			replyErr = &libvirt.Error{Code: uint32(libvirt.ErrOperationDenied), Message: "unsupported procedure"}
+		}
+
+		status := uint32(rpcStatusOK)
+		if replyErr != nil {
+			status = rpcStatusError
+			reply = &xdrWriter{}
+			reply.uint32(replyErr.Code)
+			reply.uint32(0)
+			reply.uint32(1)
+			reply.string(replyErr.Message)
+		}
+
+		message := &xdrWriter{}
+		message.uint32(uint32(4 + rpcHeaderSize + reply.Len()))
+		message.uint32(remoteProgram)
+		message.uint32(remoteProgramVersion)
+		message.uint32(procedure)
+		message.uint32(rpcTypeReply)
+		message.uint32(serial)
+		message.uint32(status)
+		message.Write(reply.Bytes())
+		if _, err := conn.Write(message.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+// readSASLData decodes the "int nil; char data<>" arguments of the SASL procedures.
+func readSASLData(r *xdrReader) []byte {
+	r.uint32() // nil
+	data := make([]byte, r.uint32())
+	for i := range data {
+		data[i] = byte(r.uint32())
+	}
+	return data
+}
+
+func newTestSASLServer() *testSASLServer {
+	return &testSASLServer{
+		username:   "caplv",
+		password:   "s3cr3t,=",
+		mechanisms: "DIGEST-MD5,SCRAM-SHA-1,SCRAM-SHA-256",
+		authTypes:  []uint32{remoteAuthSASL},
+	}
+}
+
+func TestSASLDialer(t *testing.T) {
+	t.Run("authenticates with SCRAM-SHA-256", func(t *testing.T) {
+		g := NewWithT(t)
+		server := newTestSASLServer()
+		dialer := &saslDialer{dialer: &pipeDialer{server: server}, username: "caplv", password: "s3cr3t,="}
+
+		conn, err := dialer.Dial()
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(conn.Close()).To(Succeed())
+		g.Expect(server.authenticated).To(BeTrue())
+	})
+
+	t.Run("fails with a wrong password", func(t *testing.T) {
+		g := NewWithT(t)
+		server := newTestSASLServer()
+		dialer := &saslDialer{dialer: &pipeDialer{server: server}, username: "caplv", password: "wrong"}
+
+		_, err := dialer.Dial()
+		g.Expect(err).To(MatchError(ErrAuthenticationFailed))
+		g.Expect(err).To(MatchError(ContainSubstring("invalid proof")))
+		g.Expect(server.authenticated).To(BeFalse())
+	})
+
+	t.Run("fails without a supported mechanism", func(t *testing.T) {
+		g := NewWithT(t)
+		server := newTestSASLServer()
+		server.mechanisms = "GSSAPI,DIGEST-MD5"
+		dialer := &saslDialer{dialer: &pipeDialer{server: server}, username: "caplv", password: "s3cr3t,="}
+
+		_, err := dialer.Dial()
+		g.Expect(err).To(MatchError(ErrAuthenticationFailed))
+		g.Expect(err).To(MatchError(ContainSubstring("GSSAPI, DIGEST-MD5")))
+	})
+
+	t.Run("skips authentication if not required", func(t *testing.T) {
+		g := NewWithT(t)
+		server := newTestSASLServer()
+		server.authTypes = []uint32{0}
+		dialer := &saslDialer{dialer: &pipeDialer{server: server}, username: "caplv", password: "s3cr3t,="}
+
+		conn, err := dialer.Dial()
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(conn.Close()).To(Succeed())
+		g.Expect(server.authenticated).To(BeFalse())
+	})
+}
+
+func TestSCRAMClientRejectsInvalidServerSignature(t *testing.T) {
+	g := NewWithT(t)
+
+	client, err := newSCRAMClient(sha256.New, "caplv", "s3cr3t")
+	g.Expect(err).NotTo(HaveOccurred())
+	client.clientFirst()
+	_, err = client.clientFinal([]byte("r=" + client.nonce + "server,s=" + base64.StdEncoding.EncodeToString([]byte("salt")) + ",i=1"))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(client.verifyServerFinal([]byte("v=" + base64.StdEncoding.EncodeToString([]byte("forged"))))).NotTo(Succeed())
+	g.Expect(client.verifyServerFinal([]byte("e=invalid-proof"))).To(MatchError(ContainSubstring("invalid-proof")))
+
+	_, err = client.clientFinal([]byte("r=other-nonce,s=c2FsdA==,i=1"))
+	g.Expect(err).To(MatchError(ContainSubstring("nonce")))
+}
+
+func TestWrapAuthError(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(wrapAuthError(libvirt.Error{Code: uint32(libvirt.ErrAuthFailed), Message: "authentication required"})).
+		To(MatchError(ErrAuthenticationFailed))
+	g.Expect(wrapAuthError(libvirt.Error{Code: uint32(libvirt.ErrNoDomain)})).NotTo(MatchError(ErrAuthenticationFailed))
+	g.Expect(wrapAuthError(errors.New("connection refused"))).NotTo(MatchError(ErrAuthenticationFailed))
+	g.Expect(wrapAuthError(nil)).To(BeNil())
+}
@@ -0,0 +1,133 @@
+package libvirtclient
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // SCRAM-SHA-1 is a supported (if weaker) SASL mechanism
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// scramMechanisms are the supported SCRAM SASL mechanisms (RFC 5802, RFC 7677), in order of preference.
+var scramMechanisms = []struct {
+	name string
+	hash func() hash.Hash
+}{
+	{name: "SCRAM-SHA-256", hash: sha256.New},
+	{name: "SCRAM-SHA-1", hash: sha1.New},
+}
+
+// scramClient is the client side of a SCRAM authentication exchange without channel binding.
+type scramClient struct {
+	hash     func() hash.Hash
+	username string
+	password string
+
+	nonce           string
+	clientFirstBare string
+	serverSignature []byte
+}
+
+// newSCRAMClient returns a new SCRAM client using the given hash function.
+func newSCRAMClient(h func() hash.Hash, username string, password string) (*scramClient, error) {
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &scramClient{
+		hash:     h,
+		username: username,
+		password: password,
+		nonce:    base64.RawStdEncoding.EncodeToString(nonce),
+	}, nil
+}
+
+// clientFirst returns the client-first-message.
+func (c *scramClient) clientFirst() []byte {
+	username := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(c.username)
+	c.clientFirstBare = "n=" + username + ",r=" + c.nonce
+	return []byte("n,," + c.clientFirstBare)
+}
+
+// clientFinal returns the client-final-message for the given server-first-message.
+func (c *scramClient) clientFinal(serverFirst []byte) ([]byte, error) {
+	attributes, err := parseSCRAMAttributes(serverFirst)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := attributes["r"]
+	if !strings.HasPrefix(nonce, c.nonce) || len(nonce) == len(c.nonce) {
+		return nil, errors.New("invalid SCRAM server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attributes["s"])
+	if err != nil || len(salt) == 0 {
+		return nil, errors.New("invalid SCRAM salt")
+	}
+	iterations, err := strconv.Atoi(attributes["i"])
+	if err != nil || iterations < 1 {
+		return nil, errors.New("invalid SCRAM iteration count")
+	}
+
+	saltedPassword, err := pbkdf2.Key(c.hash, c.password, salt, iterations, c.hash().Size())
+	if err != nil {
+		return nil, err
+	}
+	clientKey := c.hmac(saltedPassword, []byte("Client Key"))
+	storedKey := c.hash()
+	storedKey.Write(clientKey)
+
+	clientFinalWithoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte("n,,")) + ",r=" + nonce
+	authMessage := []byte(c.clientFirstBare + "," + string(serverFirst) + "," + clientFinalWithoutProof)
+
+	clientSignature := c.hmac(storedKey.Sum(nil), authMessage)
+	proof := make([]byte, len(clientKey))
+	subtle.XORBytes(proof, clientKey, clientSignature)
+	c.serverSignature = c.hmac(c.hmac(saltedPassword, []byte("Server Key")), authMessage)
+
+	return []byte(clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// verifyServerFinal checks the server signature in the server-final-message, which proves that the server knows the
+// password as well.
+func (c *scramClient) verifyServerFinal(serverFinal []byte) error {
+	attributes, err := parseSCRAMAttributes(serverFinal)
+	if err != nil {
+		return err
+	}
+	if e, ok := attributes["e"]; ok {
+		return fmt.Errorf("server rejected SCRAM authentication: %s", e)
+	}
+	signature, err := base64.StdEncoding.DecodeString(attributes["v"])
+	if err != nil || c.serverSignature == nil || !hmac.Equal(signature, c.serverSignature) {
+		return errors.New("invalid SCRAM server signature")
+	}
+	return nil
+}
+
+func (c *scramClient) hmac(key []byte, data []byte) []byte {
+	mac := hmac.New(c.hash, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// parseSCRAMAttributes parses a SCRAM message of comma-separated "<name>=<value>" attributes.
+func parseSCRAMAttributes(message []byte) (map[string]string, error) {
+	attributes := map[string]string{}
+	for _, attribute := range strings.Split(string(message), ",") {
+		name, value, ok := strings.Cut(attribute, "=")
+		if !ok || len(name) != 1 {
+			return nil, fmt.Errorf("invalid SCRAM message %q", message)
+		}
+		attributes[name] = value
+	}
+	return attributes, nil
+}
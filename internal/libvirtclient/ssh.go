@@ -0,0 +1,189 @@
+package libvirtclient
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// defaultSSHPort is the default SSH port.
+	defaultSSHPort = "22"
+	// defaultSSHUser is the SSH user used if the URI does not include one.
+	defaultSSHUser = "root"
+	// defaultSystemSocket is the path of the libvirt socket of the system instance on the remote host.
+	defaultSystemSocket = "/var/run/libvirt/libvirt-sock"
+)
+
+// sshDialer tunnels to the libvirt unix socket on a remote host over SSH, using a private key and known_hosts from
+// memory. The socket is reached through OpenSSH's "direct-streamlocal" forwarding (AllowStreamLocalForwarding, which
+// is enabled by default), so no ssh binary is needed locally and no netcat or virt-ssh-helper is needed remotely.
+type sshDialer struct {
+	address string
+	socket  string
+	config  *ssh.ClientConfig
+}
+
+// newSSHDialer returns a dialer for the qemu+ssh URI using the SSH private key and known_hosts from the given
+// credentials. The host key of the server must be listed in known_hosts.
+func newSSHDialer(uri *url.URL, credentials *Credentials) (*sshDialer, error) {
+	signer, err := ssh.ParsePrivateKey(credentials.SSHPrivateKey)
+	if err != nil {
+		var passphraseErr *ssh.PassphraseMissingError
+		if errors.As(err, &passphraseErr) {
+			return nil, errors.New("invalid SSH private key: passphrase-protected keys are not supported")
+		}
+		return nil, fmt.Errorf("invalid SSH private key: %v", err)
+	}
+
+	if len(credentials.SSHKnownHosts) == 0 {
+		return nil, errors.New("SSH known_hosts must be set in order to verify the libvirt host")
+	}
+	knownHosts, err := loadKnownHosts(credentials.SSHKnownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	socket := uri.Query().Get("socket")
+	if socket == "" {
+		if uri.Path != "/system" {
+			return nil, fmt.Errorf("the socket parameter must be set for qemu+ssh URIs with path %q", uri.Path)
+		}
+		socket = defaultSystemSocket
+	}
+
+	user := defaultSSHUser
+	if uri.User != nil && uri.User.Username() != "" {
+		user = uri.User.Username()
+	}
+	port := uri.Port()
+	if port == "" {
+		port = defaultSSHPort
+	}
+	address := net.JoinHostPort(uri.Hostname(), port)
+
+	return &sshDialer{
+		address: address,
+		socket:  socket,
+		config: &ssh.ClientConfig{
+			User:              user,
+			Auth:              []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback:   hostKeyCallback(knownHosts),
+			HostKeyAlgorithms: hostKeyAlgorithms(knownHosts, address),
+			Timeout:           defaultDialTimeout,
+		},
+	}, nil
+}
+
+// Dial implements socket.Dialer.
+func (d *sshDialer) Dial() (net.Conn, error) {
+	client, err := ssh.Dial("tcp", d.address, d.config)
+	if err != nil {
+		if strings.Contains(err.Error(), "unable to authenticate") && !errors.Is(err, ErrAuthenticationFailed) {
+			return nil, fmt.Errorf("%w: %v", ErrAuthenticationFailed, err)
+		}
+		return nil, err
+	}
+
+	conn, err := client.Dial("unix", d.socket)
+	if err != nil {
+		client.Close() //nolint:errcheck
+		return nil, fmt.Errorf("failed to connect to libvirt socket %s over SSH: %v", d.socket, err)
+	}
+	return &sshConn{Conn: conn, client: client}, nil
+}
+
+// sshConn is a connection tunneled over SSH which also closes the SSH client when closed.
+type sshConn struct {
+	net.Conn
+	client *ssh.Client
+}
+
+func (c *sshConn) Close() error {
+	err := c.Conn.Close()
+	if clientErr := c.client.Close(); err == nil {
+		err = clientErr
+	}
+	return err
+}
+
+// loadKnownHosts loads the contents of an OpenSSH known_hosts file with knownhosts.New, which only reads files, through
+// a temporary file that is removed again afterwards.
+func loadKnownHosts(data []byte) (ssh.HostKeyCallback, error) {
+	file, err := os.CreateTemp("", "known_hosts-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write SSH known_hosts: %v", err)
+	}
+	defer os.Remove(file.Name()) //nolint:errcheck
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write SSH known_hosts: %v", err)
+	}
+
+	callback, err := knownhosts.New(file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH known_hosts: %v", err)
+	}
+	return callback, nil
+}
+
+// hostKeyCallback wraps a knownhosts callback so that rejected host keys fail with ErrAuthenticationFailed.
+func hostKeyCallback(callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var revokedErr *knownhosts.RevokedError
+		var keyErr *knownhosts.KeyError
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &revokedErr):
+			return fmt.Errorf("%w: SSH host key of %s is revoked", ErrAuthenticationFailed, hostname)
+		case errors.As(err, &keyErr) && len(keyErr.Want) > 0:
+			return fmt.Errorf("%w: SSH host key mismatch for %s", ErrAuthenticationFailed, hostname)
+		case errors.As(err, &keyErr):
+			return fmt.Errorf("%w: SSH host %s is not in known_hosts", ErrAuthenticationFailed, hostname)
+		default:
+			return fmt.Errorf("%w: %v", ErrAuthenticationFailed, err)
+		}
+	}
+}
+
+// hostKeyAlgorithms returns the host key algorithms of the keys listed for the address, so that the server presents
+// a key which can be verified. The listed keys are found by checking a key which cannot be listed, as knownhosts
+// reports them in the resulting KeyError. It returns nil (i.e. the default algorithms) if no keys are listed, e.g. if
+// the host is only verified through a @cert-authority.
+func hostKeyAlgorithms(callback ssh.HostKeyCallback, address string) []string {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	probe, err := ssh.NewPublicKey(public)
+	if err != nil {
+		return nil
+	}
+	var keyErr *knownhosts.KeyError
+	if !errors.As(callback(address, &net.TCPAddr{}, probe), &keyErr) {
+		return nil
+	}
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		switch known.Key.Type() {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, known.Key.Type())
+		}
+	}
+	return algorithms
+}
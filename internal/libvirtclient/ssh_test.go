@@ -0,0 +1,203 @@
+package libvirtclient
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// newTestSSHKey returns a new ed25519 SSH signer and its PEM-encoded private key.
+func newTestSSHKey(t *testing.T) (ssh.Signer, []byte) {
+	t.Helper()
+	g := NewWithT(t)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	g.Expect(err).NotTo(HaveOccurred())
+	signer, err := ssh.NewSignerFromKey(key)
+	g.Expect(err).NotTo(HaveOccurred())
+	block, err := ssh.MarshalPrivateKey(key, "")
+	g.Expect(err).NotTo(HaveOccurred())
+	return signer, pem.EncodeToMemory(block)
+}
+
+// startTestSSHServer starts an SSH server which accepts the given client key and echoes all data sent to the unix
+// socket at socketPath through direct-streamlocal channels. It returns the listener port.
+func startTestSSHServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey, socketPath string) string {
+	t.Helper()
+	g := NewWithT(t)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "caplv" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).NotTo(HaveOccurred())
+	t.Cleanup(func() { listener.Close() }) //nolint:errcheck
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, channels, requests, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(requests)
+				for newChannel := range channels {
+					var target struct {
+						SocketPath string
+						Reserved0  string
+						Reserved1  uint32
+					}
+					if newChannel.ChannelType() != "direct-streamlocal@openssh.com" ||
+						ssh.Unmarshal(newChannel.ExtraData(), &target) != nil || target.SocketPath != socketPath {
+						_ = newChannel.Reject(ssh.ConnectionFailed, "no such socket")
+						continue
+					}
+					channel, channelRequests, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+					go ssh.DiscardRequests(channelRequests)
+					go func() {
+						defer channel.Close() //nolint:errcheck
+						_, _ = io.Copy(channel, channel)
+					}()
+				}
+			}()
+		}
+	}()
+
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	g.Expect(err).NotTo(HaveOccurred())
+	return port
+}
+
+func dialSSH(t *testing.T, uri string, credentials *Credentials) error {
+	t.Helper()
+	g := NewWithT(t)
+
+	u, err := url.Parse(uri)
+	g.Expect(err).NotTo(HaveOccurred())
+	dialer, err := newDialer(u, credentials)
+	if err != nil {
+		return err
+	}
+	g.Expect(dialer).NotTo(BeNil())
+
+	conn, err := dialer.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close() //nolint:errcheck
+
+	// The test server echoes everything sent to the libvirt socket
+	_, err = conn.Write([]byte("ping"))
+	g.Expect(err).NotTo(HaveOccurred())
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(conn, reply)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(reply)).To(Equal("ping"))
+	return nil
+}
+
+func TestSSHDialer(t *testing.T) {
+	hostKey, _ := newTestSSHKey(t)
+	clientKey, clientKeyPEM := newTestSSHKey(t)
+	port := startTestSSHServer(t, hostKey, clientKey.PublicKey(), defaultSystemSocket)
+	address := net.JoinHostPort("127.0.0.1", port)
+	knownHostsLine := []byte(knownhosts.Line([]string{address}, hostKey.PublicKey()) + "\n")
+
+	t.Run("tunnels to the libvirt socket", func(t *testing.T) {
+		g := NewWithT(t)
+		err := dialSSH(t, fmt.Sprintf("qemu+ssh://caplv@%s/system", address), &Credentials{
+			SSHPrivateKey: clientKeyPEM,
+			SSHKnownHosts: knownHostsLine,
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+	})
+
+	t.Run("accepts hashed and wildcard known_hosts entries", func(t *testing.T) {
+		g := NewWithT(t)
+		for _, pattern := range []string{knownhosts.HashHostname(knownhosts.Normalize(address)), "[127.0.0.*]:" + port} {
+			err := dialSSH(t, fmt.Sprintf("qemu+ssh://caplv@%s/system", address), &Credentials{
+				SSHPrivateKey: clientKeyPEM,
+				SSHKnownHosts: []byte("# comment\n\n" + knownhosts.Line([]string{pattern}, hostKey.PublicKey()) + "\n"),
+			})
+			g.Expect(err).NotTo(HaveOccurred(), pattern)
+		}
+	})
+
+	t.Run("uses the socket parameter", func(t *testing.T) {
+		g := NewWithT(t)
+		err := dialSSH(t, fmt.Sprintf("qemu+ssh://caplv@%s/system?socket=/run/other-sock", address), &Credentials{
+			SSHPrivateKey: clientKeyPEM,
+			SSHKnownHosts: knownHostsLine,
+		})
+		g.Expect(err).To(MatchError(ContainSubstring("/run/other-sock")))
+	})
+
+	t.Run("rejects unknown host keys", func(t *testing.T) {
+		g := NewWithT(t)
+		otherKey, _ := newTestSSHKey(t)
+		err := dialSSH(t, fmt.Sprintf("qemu+ssh://caplv@%s/system", address), &Credentials{
+			SSHPrivateKey: clientKeyPEM,
+			SSHKnownHosts: []byte(knownhosts.Line([]string{address}, otherKey.PublicKey())),
+		})
+		g.Expect(err).To(MatchError(ErrAuthenticationFailed))
+		g.Expect(err).To(MatchError(ContainSubstring("mismatch")))
+
+		err = dialSSH(t, fmt.Sprintf("qemu+ssh://caplv@%s/system", address), &Credentials{
+			SSHPrivateKey: clientKeyPEM,
+			SSHKnownHosts: []byte(knownhosts.Line([]string{"libvirt.example.com"}, hostKey.PublicKey())),
+		})
+		g.Expect(err).To(MatchError(ErrAuthenticationFailed))
+		g.Expect(err).To(MatchError(ContainSubstring("not in known_hosts")))
+
+		err = dialSSH(t, fmt.Sprintf("qemu+ssh://caplv@%s/system", address), &Credentials{
+			SSHPrivateKey: clientKeyPEM,
+			SSHKnownHosts: []byte("[127.0.0.*]:" + port + ",![127.0.0.1]:" + port + " " + string(ssh.MarshalAuthorizedKey(hostKey.PublicKey()))),
+		})
+		g.Expect(err).To(MatchError(ContainSubstring("not in known_hosts")))
+
+		err = dialSSH(t, fmt.Sprintf("qemu+ssh://caplv@%s/system", address), &Credentials{
+			SSHPrivateKey: clientKeyPEM,
+			SSHKnownHosts: append(knownHostsLine, []byte("@revoked * "+string(ssh.MarshalAuthorizedKey(hostKey.PublicKey())))...),
+		})
+		g.Expect(err).To(MatchError(ContainSubstring("revoked")))
+	})
+
+	t.Run("fails with an unknown client key", func(t *testing.T) {
+		g := NewWithT(t)
+		_, otherKeyPEM := newTestSSHKey(t)
+		err := dialSSH(t, fmt.Sprintf("qemu+ssh://caplv@%s/system", address), &Credentials{
+			SSHPrivateKey: otherKeyPEM,
+			SSHKnownHosts: knownHostsLine,
+		})
+		g.Expect(err).To(MatchError(ErrAuthenticationFailed))
+	})
+
+	t.Run("requires known_hosts", func(t *testing.T) {
+		g := NewWithT(t)
+		err := dialSSH(t, fmt.Sprintf("qemu+ssh://caplv@%s/system", address), &Credentials{SSHPrivateKey: clientKeyPEM})
+		g.Expect(err).To(MatchError(ContainSubstring("known_hosts must be set")))
+	})
+}